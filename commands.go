@@ -0,0 +1,491 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"terminally-online/cron/endpoint"
+	"terminally-online/cron/tui"
+	"text/tabwriter"
+	"time"
+)
+
+type checkResult struct {
+	URL      string        `json:"url"`
+	State    string        `json:"state"`
+	Status   int           `json:"status"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// check runs a one-off check of the given URLs, or of every configured
+// endpoint, and exits with exitFailure when any of them is down and with
+// exitError when there is nothing to check. URLs that are configured are
+// checked with their configuration; flags that are set override it.
+func check(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	method := flags.String("method", "", "HTTP method (default GET)")
+	status := flags.Int("status", 0, "expected status code (default 200)")
+	timeout := flags.Duration("timeout", 0, "timeout of each attempt (default 5s)")
+	retries := flags.Int("retries", -1, "number of retries after a failure (default 3)")
+	contains := flags.String("contains", "", "content the body must contain")
+	asJSON := flags.Bool("json", false, "print results as JSON")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	configured := make(map[string]endpoint.EndpointRequest)
+	var requests []endpoint.EndpointRequest
+	for _, ep := range endpoint.ConfiguredEndpoints(endpoint.DOMAIN_CONFIG) {
+		configured[ep.URL] = ep
+		if flags.NArg() == 0 {
+			requests = append(requests, ep)
+		}
+	}
+	if flags.NArg() == 0 && len(requests) == 0 {
+		fmt.Fprintln(os.Stderr, "No endpoints are configured; pass the URLs to check")
+		fmt.Fprintln(os.Stderr, "Usage: cron check [flags] [url...]")
+		return exitError
+	}
+	for _, url := range flags.Args() {
+		request, ok := configured[url]
+		if !ok {
+			request = endpoint.EndpointRequest{URL: url}
+		}
+		requests = append(requests, request)
+	}
+
+	for i := range requests {
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "method":
+				requests[i].Method = *method
+			case "status":
+				requests[i].Status = *status
+			case "timeout":
+				requests[i].Timeout = *timeout
+			case "retries":
+				requests[i].RetryAttempts = *retries
+			case "contains":
+				requests[i].ExpectedContent = *contains
+			}
+		})
+		if err := requests[i].Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid endpoint %q: %v\n", requests[i].URL, err)
+			return exitError
+		}
+	}
+
+	handler := endpoint.NewCheckHandler()
+	results := make([]checkResult, len(requests))
+	var wg sync.WaitGroup
+	for i, request := range requests {
+		wg.Add(1)
+		go func(i int, request endpoint.EndpointRequest) {
+			defer wg.Done()
+			response := handler.Check(context.Background(), request)
+			results[i] = checkResult{
+				URL:      request.URL,
+				State:    endpoint.StateUp,
+				Status:   response.Status,
+				Duration: response.Duration,
+			}
+			if response.Error != nil {
+				results[i].State = endpoint.StateDown
+				results[i].Error = response.Error.Error()
+			}
+		}(i, request)
+	}
+	wg.Wait()
+
+	if *asJSON {
+		printJSON(os.Stdout, results)
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "STATE\tURL\tSTATUS\tDURATION\tERROR")
+		for _, result := range results {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", result.State, result.URL, result.Status,
+				result.Duration.Round(time.Millisecond), result.Error)
+		}
+		w.Flush()
+	}
+
+	for _, result := range results {
+		if result.State == endpoint.StateDown {
+			return exitFailure
+		}
+	}
+	return exitOK
+}
+
+// list prints the current state of every endpoint stored in the database.
+func list(args []string) int {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	dbPath := flags.String("db", "endpoints.db", "path to the database")
+	rawSelector := flags.String("selector", "", "label selector such as env=prod")
+	asJSON := flags.Bool("json", false, "print endpoints as JSON")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	selector, err := endpoint.ParseSelector(*rawSelector)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid selector: %v\n", err)
+		return exitError
+	}
+
+	handler, err := endpoint.OpenEndpointHandler(*dbPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer handler.Close()
+
+	// The database does not record the check interval, so the latest check
+	// of every location counts.
+	status, err := handler.GetStatus(time.Now(), 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read endpoints: %v\n", err)
+		return exitError
+	}
+
+	endpoints := []endpoint.EndpointStatus{}
+	for _, ep := range status.Endpoints {
+		if selector.Matches(ep.Labels) {
+			endpoints = append(endpoints, ep)
+		}
+	}
+
+	if *asJSON {
+		printJSON(os.Stdout, endpoints)
+		return exitOK
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STATE\tURL\tDOMAIN\tLAST CHECK\tDURATION\tUPTIME")
+	for _, ep := range endpoints {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%.2f%%\n", ep.State, ep.URL, ep.Domain,
+			ep.LastCheck.Local().Format(time.DateTime), ep.LastDuration.Round(time.Millisecond), ep.UpTime)
+	}
+	w.Flush()
+	return exitOK
+}
+
+// history prints the most recent stored checks of an endpoint.
+func history(args []string) int {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	dbPath := flags.String("db", "endpoints.db", "path to the database")
+	limit := flags.Int("limit", 20, "number of checks to print, 0 for all")
+	asJSON := flags.Bool("json", false, "print the history as JSON")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: cron history [flags] <url>")
+		return exitError
+	}
+
+	handler, err := endpoint.OpenEndpointHandler(*dbPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer handler.Close()
+
+	response, err := handler.GetHistoryResponse(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read history: %v\n", err)
+		return exitError
+	}
+	if response == nil {
+		fmt.Fprintf(os.Stderr, "No history for %s\n", flags.Arg(0))
+		return exitFailure
+	}
+	if *limit > 0 && len(response.History) > *limit {
+		response.History = response.History[len(response.History)-*limit:]
+	}
+
+	if *asJSON {
+		printJSON(os.Stdout, response)
+		return exitOK
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tLOCATION\tSTATUS\tDURATION\tERROR")
+	for _, entry := range response.History {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", entry.Timestamp.Local().Format(time.DateTime), entry.Location,
+			entry.Status, entry.Duration.Round(time.Millisecond), entry.Error)
+	}
+	w.Flush()
+	fmt.Printf("\n%d of %d checks succeeded (%.2f%% uptime)\n",
+		response.Stats.SuccessfulChecks, response.Stats.TotalChecks, response.Stats.UpTimePercentage)
+	return exitOK
+}
+
+// top shows a live dashboard of a running instance, or of a database opened
+// read-only with -db. Without a terminal it prints the table once.
+func top(args []string) int {
+	flags := flag.NewFlagSet("top", flag.ContinueOnError)
+	api := flags.String("api", "http://localhost:8080", "URL of a running instance")
+	dbPath := flags.String("db", "", "read a database instead of the API")
+	interval := flags.Duration("interval", 2*time.Second, "refresh interval")
+	domain := flags.String("domain", "", "only show endpoints whose domain or URL contains this")
+	token := flags.String("token", os.Getenv("CRON_ADMIN_TOKEN"), "admin token of the instance, needed to check endpoints")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if *interval <= 0 {
+		fmt.Fprintln(os.Stderr, "The refresh interval must be positive")
+		return exitError
+	}
+
+	var source tui.Source = tui.NewAPISource(*api, *token)
+	if *dbPath != "" {
+		handler, err := endpoint.OpenEndpointHandler(*dbPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer handler.Close()
+		source = tui.NewDBSource(*dbPath, handler, endpoint.ConfiguredEndpoints(endpoint.DOMAIN_CONFIG))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := tui.Run(ctx, source, *domain, *interval, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return exitOK
+}
+
+func validateConfig(args []string) int {
+	flags := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	interval := flags.Duration("interval", 30*time.Minute, "how often the server checks endpoints")
+	histSize := flags.Int("history", 48, "number of checks the server keeps per endpoint and location")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	if err := endpoint.ValidateConfig(time.Duration(*histSize) * (*interval)); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		return exitFailure
+	}
+
+	fmt.Printf("Configuration is valid: %d endpoints, %d heartbeats, %d SLOs, %d routes\n",
+		len(endpoint.ConfiguredEndpoints(endpoint.DOMAIN_CONFIG)), len(endpoint.HEARTBEAT_CONFIG),
+		len(endpoint.SLO_CONFIG), len(endpoint.ROUTING_CONFIG.Routes))
+	return exitOK
+}
+
+type migrationStatus struct {
+	Driver  string               `json:"driver"`
+	Version int                  `json:"version"`
+	Pending []endpoint.Migration `json:"pending"`
+}
+
+// migrations lists the migrations the server would apply to a database on
+// its next start.
+func migrations(args []string) int {
+	flags := flag.NewFlagSet("migrations", flag.ContinueOnError)
+	dbPath := flags.String("db", "endpoints.db", "path to the database")
+	asJSON := flags.Bool("json", false, "print the migrations as JSON")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	driver := endpoint.STORAGE_CONFIG.Driver
+	if driver == "" {
+		driver = endpoint.StorageBolt
+	}
+	store, err := endpoint.OpenStore(driver, *dbPath, true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer store.Close()
+
+	status := migrationStatus{Driver: driver, Pending: []endpoint.Migration{}}
+	if status.Version, err = store.SchemaVersion(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read schema version: %v\n", err)
+		return exitError
+	}
+	pending, err := store.PendingMigrations()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	status.Pending = append(status.Pending, pending...)
+
+	if *asJSON {
+		printJSON(os.Stdout, status)
+		return exitOK
+	}
+
+	fmt.Printf("%s database %s is at schema version %d\n", status.Driver, *dbPath, status.Version)
+	if len(pending) == 0 {
+		fmt.Println("No pending migrations")
+		return exitOK
+	}
+
+	fmt.Println("\nPending migrations, applied after a backup when the server next starts:")
+	for _, migration := range pending {
+		fmt.Printf("  %3d  %s\n", migration.Version, migration.Description)
+	}
+	return exitOK
+}
+
+// restore installs a backup in place of the database after checking that
+// this build can read it. The server must be stopped first.
+func restore(args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	dbPath := flags.String("db", "endpoints.db", "path to the database to replace")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: cron restore [flags] <backup>")
+		return exitError
+	}
+
+	result, err := endpoint.RestoreBackup(endpoint.STORAGE_CONFIG.Driver, flags.Arg(0), *dbPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	fmt.Printf("Restored %s to %s at schema version %d\n", flags.Arg(0), *dbPath, result.Version)
+	if result.Previous != "" {
+		fmt.Printf("The previous database was moved to %s\n", result.Previous)
+	}
+	return exitOK
+}
+
+// export writes the stored checks of the given URLs, or of every endpoint
+// matching the filters, as CSV or JSON Lines.
+func export(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	dbPath := flags.String("db", "endpoints.db", "path to the database")
+	format := flags.String("format", "", "csv or jsonl (default from the -o extension, or csv)")
+	output := flags.String("o", "", "file to write to (default stdout)")
+	domain := flags.String("domain", "", "only export endpoints in this domain")
+	rawSelector := flags.String("selector", "", "label selector such as env=prod")
+	since := flags.String("since", "", "only export checks at or after this RFC 3339 time")
+	until := flags.String("until", "", "only export checks at or before this RFC 3339 time")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	selector, err := endpoint.ParseSelector(*rawSelector)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid selector: %v\n", err)
+		return exitError
+	}
+	filter := endpoint.ExportFilter{URLs: flags.Args(), Domain: *domain, Selector: selector}
+	for _, bound := range []struct {
+		value string
+		into  *time.Time
+	}{{*since, &filter.Since}, {*until, &filter.Until}} {
+		if bound.value == "" {
+			continue
+		}
+		if *bound.into, err = time.Parse(time.RFC3339, bound.value); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid time %q: %v\n", bound.value, err)
+			return exitError
+		}
+	}
+	if *format == "" {
+		*format = endpoint.ExportFormat(*output)
+	}
+	if *format == "" {
+		*format = endpoint.ExportCSV
+	}
+
+	handler, err := endpoint.OpenEndpointHandler(*dbPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer handler.Close()
+
+	w := os.Stdout
+	if *output != "" {
+		if w, err = os.Create(*output); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer w.Close()
+	}
+
+	count, err := handler.Export(w, *format, filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export: %v\n", err)
+		return exitError
+	}
+	if *output != "" {
+		fmt.Printf("Exported %d checks to %s\n", count, *output)
+	}
+	return exitOK
+}
+
+// importHistory stores the checks of a CSV or JSON Lines file, skipping
+// checks that are already stored. The server must be stopped first.
+func importHistory(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dbPath := flags.String("db", "endpoints.db", "path to the database")
+	histSize := flags.Int("history", 48, "number of checks kept per endpoint and location")
+	format := flags.String("format", "", "csv or jsonl (default from the file extension)")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: cron import [flags] <file|->")
+		return exitError
+	}
+	if *format == "" {
+		*format = endpoint.ExportFormat(flags.Arg(0))
+	}
+	if *format == "" {
+		fmt.Fprintln(os.Stderr, "Cannot tell the format from the file name, set -format")
+		return exitError
+	}
+
+	var r io.Reader = os.Stdin
+	if flags.Arg(0) != "-" {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer f.Close()
+		r = f
+	}
+
+	handler, err := endpoint.NewEndpointHandler(*dbPath, *histSize)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer handler.Close()
+
+	result, err := handler.Import(r, *format)
+	fmt.Printf("Imported %d checks, skipped %d already stored and %d older than the kept history\n",
+		result.Imported, result.Duplicates, result.Dropped)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to import: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+func printJSON(w io.Writer, v interface{}) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"terminally-online/cron/endpoint"
+	"testing"
+	"time"
+)
+
+func TestCheckExitCodes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	configured := endpoint.DOMAIN_CONFIG
+	defer func() { endpoint.DOMAIN_CONFIG = configured }()
+
+	tests := []struct {
+		name    string
+		domains []endpoint.DomainRequest
+		args    []string
+		want    int
+	}{
+		{"up", nil, []string{server.URL + "/up"}, exitOK},
+		{"down", nil, []string{server.URL + "/down"}, exitFailure},
+		{"configured", []endpoint.DomainRequest{{Domain: "test", Endpoints: []endpoint.EndpointRequest{{URL: server.URL + "/up"}}}}, nil, exitOK},
+		{"nothing to check", nil, nil, exitError},
+		{"invalid endpoint", nil, []string{"-timeout", "-1s", server.URL + "/up"}, exitError},
+		{"unknown flag", nil, []string{"-unknown"}, exitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint.DOMAIN_CONFIG = tt.domains
+			if got := check(tt.args); got != tt.want {
+				t.Errorf("Expected exit code %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateConfigExitCodes(t *testing.T) {
+	configured, slos := endpoint.DOMAIN_CONFIG, endpoint.SLO_CONFIG
+	defer func() { endpoint.DOMAIN_CONFIG, endpoint.SLO_CONFIG = configured, slos }()
+
+	valid := []endpoint.DomainRequest{{Domain: "test", Endpoints: []endpoint.EndpointRequest{{URL: "https://test.com"}}}}
+	slo := []endpoint.SLO{{Name: "availability", Kind: endpoint.SLOAvailability, URLs: []string{"https://test.com"}, Objective: 0.99, Window: 24 * time.Hour}}
+
+	tests := []struct {
+		name    string
+		domains []endpoint.DomainRequest
+		slos    []endpoint.SLO
+		args    []string
+		want    int
+	}{
+		{"valid", valid, slo, nil, exitOK},
+		{"invalid endpoint", []endpoint.DomainRequest{{Domain: "test", Endpoints: []endpoint.EndpointRequest{{URL: "test.com"}}}}, nil, nil, exitFailure},
+		{"window beyond the history", valid, slo, []string{"-history", "24"}, exitFailure},
+		{"unknown flag", valid, nil, []string{"-unknown"}, exitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint.DOMAIN_CONFIG, endpoint.SLO_CONFIG = tt.domains, tt.slos
+			if got := validateConfig(tt.args); got != tt.want {
+				t.Errorf("Expected exit code %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHistoryExitCodes(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "endpoints.db")
+	handler, err := endpoint.NewEndpointHandler(dbPath, 10)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	checks := `{"url":"https://test.com","timestamp":"2024-03-01T12:00:00Z","status":200}` + "\n"
+	if _, err := handler.Import(strings.NewReader(checks), endpoint.ExportJSONLines); err != nil {
+		t.Fatalf("Failed to import checks: %v", err)
+	}
+	handler.Close()
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"history", []string{"-db", dbPath, "https://test.com"}, exitOK},
+		{"json", []string{"-db", dbPath, "-json", "https://test.com"}, exitOK},
+		{"no history", []string{"-db", dbPath, "https://missing.com"}, exitFailure},
+		{"no url", []string{"-db", dbPath}, exitError},
+		{"missing database", []string{"-db", filepath.Join(t.TempDir(), "missing.db"), "https://test.com"}, exitError},
+		{"unknown flag", []string{"-unknown"}, exitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := history(tt.args); got != tt.want {
+				t.Errorf("Expected exit code %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	outboxBucket = "outbox"
+
+	defaultAgentBatchSize  = 500
+	defaultAgentBufferSize = 50000
+
+	// agentBatchBytes bounds the buffered results sent at once, well within
+	// what the server accepts, since results of endpoints with change
+	// detection carry their whole body.
+	agentBatchBytes = maxProbeResultsBody / 2
+
+	// agentRetry is how often an agent that has never received its
+	// assignment asks for it again.
+	agentRetry = time.Minute
+)
+
+// NewAgent creates a probe agent that checks the endpoints the server assigns
+// to it and reports the results back. Results are written to the handler's
+// database first and only removed once the server has accepted them, so
+// they survive the server being unreachable and agent restarts.
+func NewAgent(handler *EndpointHandler, config AgentConfig) *Agent {
+	config.ServerURL = strings.TrimSuffix(config.ServerURL, "/")
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultAgentBatchSize
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultAgentBufferSize
+	}
+
+	return &Agent{
+		handler: handler,
+		config:  config,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		done:    make(chan struct{}),
+	}
+}
+
+func (a *Agent) Start() {
+	a.wg.Add(1)
+	go a.run()
+	log.Printf("Probe agent reporting to %s", a.config.ServerURL)
+}
+
+func (a *Agent) Stop() {
+	close(a.done)
+	a.wg.Wait()
+}
+
+func (a *Agent) run() {
+	defer a.wg.Done()
+
+	for {
+		wait := a.Cycle(context.Background())
+		select {
+		case <-time.After(wait):
+		case <-a.done:
+			return
+		}
+	}
+}
+
+// Cycle refreshes the assignment, checks every assigned endpoint and sends
+// the buffered results. It returns how long to wait before the next cycle.
+// A failed refresh keeps checking the endpoints of the last assignment.
+func (a *Agent) Cycle(ctx context.Context) time.Duration {
+	if err := a.refresh(ctx); err != nil {
+		log.Printf("Failed to fetch probe assignment: %v", err)
+	}
+	if a.assignment.Interval <= 0 {
+		a.flush(ctx)
+		return agentRetry
+	}
+
+	a.checkAll(ctx)
+	a.flush(ctx)
+	return a.assignment.Interval
+}
+
+// Buffered returns the number of results waiting to be sent.
+func (a *Agent) Buffered() (int, error) {
+	var count int
+	err := a.handler.store.View(func(tx RecordTx) error {
+		var err error
+		count, err = tx.Count(outboxBucket)
+		return err
+	})
+	return count, err
+}
+
+func (a *Agent) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.config.ServerURL+"/probes/assignment", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+a.config.Token)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("received error status code: %d", resp.StatusCode)
+	}
+
+	var assignment ProbeAssignment
+	if err := json.NewDecoder(resp.Body).Decode(&assignment); err != nil {
+		return fmt.Errorf("failed to decode assignment: %w", err)
+	}
+	if a.assignment.Location == "" {
+		log.Printf("Probing %d endpoints from %s every %v", len(assignment.Endpoints), assignment.Location, assignment.Interval)
+	}
+	a.assignment = assignment
+	return nil
+}
+
+func (a *Agent) checkAll(ctx context.Context) {
+	results := make([]ProbeResult, len(a.assignment.Endpoints))
+
+	var wg sync.WaitGroup
+	for i, endpoint := range a.assignment.Endpoints {
+		wg.Add(1)
+		go func(i int, endpoint EndpointRequest) {
+			defer wg.Done()
+			results[i] = newProbeResult(a.handler.Check(ctx, endpoint))
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	if err := a.buffer(results); err != nil {
+		log.Printf("Failed to buffer probe results: %v", err)
+	}
+}
+
+// buffer appends the results to the outbox, dropping the oldest results once
+// it holds more than the buffer size.
+func (a *Agent) buffer(results []ProbeResult) error {
+	return a.handler.store.Update(func(tx RecordTx) error {
+		for _, result := range results {
+			id, err := nextRecordID(tx, outboxBucket)
+			if err != nil {
+				return err
+			}
+			if err := putRecord(tx, outboxBucket, id, result); err != nil {
+				return err
+			}
+		}
+
+		count, err := tx.Count(outboxBucket)
+		if err != nil {
+			return err
+		}
+		excess := count - a.config.BufferSize
+		if excess <= 0 {
+			return nil
+		}
+		log.Printf("Probe result buffer is full, dropping the %d oldest results", excess)
+
+		var oldest []uint64
+		err = tx.ForEach(outboxBucket, func(id uint64, data []byte) error {
+			if len(oldest) < excess {
+				oldest = append(oldest, id)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range oldest {
+			if err := deleteRecord(tx, outboxBucket, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// flush sends the buffered results in batches, oldest first, and stops at
+// the first batch the server does not accept.
+func (a *Agent) flush(ctx context.Context) {
+	for {
+		ids, results, err := a.nextBatch()
+		if err != nil {
+			log.Printf("Failed to read buffered probe results: %v", err)
+			return
+		}
+		if len(results) == 0 {
+			return
+		}
+
+		body, err := postJSON(ctx, a.client, a.config.ServerURL+"/probes/results",
+			map[string]string{"Authorization": "Bearer " + a.config.Token}, results)
+		if err != nil {
+			count, _ := a.Buffered()
+			log.Printf("Failed to send probe results, %d buffered: %v", count, err)
+			return
+		}
+
+		var response ProbeResultsResponse
+		if err := json.Unmarshal(body, &response); err == nil && response.Rejected > 0 {
+			log.Printf("Server rejected %d probe results for endpoints no longer assigned", response.Rejected)
+		}
+
+		err = a.handler.store.Update(func(tx RecordTx) error {
+			for _, id := range ids {
+				if err := deleteRecord(tx, outboxBucket, id); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to remove sent probe results: %v", err)
+			return
+		}
+	}
+}
+
+// nextBatch reads the oldest buffered results, up to the batch size and
+// agentBatchBytes. A batch holds at least one result.
+func (a *Agent) nextBatch() ([]uint64, []ProbeResult, error) {
+	var ids []uint64
+	var results []ProbeResult
+	size, full := 0, false
+
+	err := a.handler.store.View(func(tx RecordTx) error {
+		return tx.ForEach(outboxBucket, func(id uint64, data []byte) error {
+			// Once a result does not fit, later ones are left for the next
+			// batch too, so results are sent in order.
+			if full || len(results) >= a.config.BatchSize || (len(results) > 0 && size+len(data) > agentBatchBytes) {
+				full = true
+				return nil
+			}
+			size += len(data)
+			var result ProbeResult
+			if err := json.Unmarshal(data, &result); err != nil {
+				return fmt.Errorf("failed to unmarshal probe result: %w", err)
+			}
+			ids = append(ids, id)
+			results = append(results, result)
+			return nil
+		})
+	})
+	return ids, results, err
+}
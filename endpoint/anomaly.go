@@ -0,0 +1,136 @@
+package endpoint
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	baselineBucket = "baselines"
+
+	// madScale turns the median absolute deviation into an estimate of the
+	// standard deviation of normally distributed durations.
+	madScale = 1.4826
+
+	// seasonalSamples is how many of the latest successful checks are kept
+	// for each hour of the week, unless MinSamples asks for more.
+	seasonalSamples = 50
+)
+
+// Score rates how far the result's duration lies above the endpoint's usual
+// latency, in robust standard deviations: the distance from the median of
+// the baseline divided by its scaled median absolute deviation. The baseline
+// is the successful checks in the history outside maintenance. With Seasonal
+// set it is the seasonal durations instead, those of checks made in the same
+// hour of the week, once there are MinSamples of them. Failed checks and
+// histories too short for a baseline score 0.
+func (c AnomalyConfig) Score(history []EndpointResponse, seasonal []time.Duration, result EndpointResponse) float64 {
+	if c.Threshold <= 0 || result.Error != nil || result.Maintenance {
+		return 0
+	}
+
+	var baseline []float64
+	if c.Seasonal && len(seasonal) >= c.MinSamples {
+		for _, d := range seasonal {
+			baseline = append(baseline, float64(d))
+		}
+	} else {
+		baseline = c.baseline(history)
+	}
+	if len(baseline) == 0 || len(baseline) < c.MinSamples {
+		return 0
+	}
+
+	median := medianOf(baseline)
+	deviations := make([]float64, len(baseline))
+	for i, d := range baseline {
+		deviations[i] = math.Abs(d - median)
+	}
+
+	// Endpoints that answer in nearly constant time have no spread at all, so
+	// the deviation is floored at 5% of the median or a millisecond.
+	spread := madScale * medianOf(deviations)
+	spread = math.Max(spread, math.Max(0.05*median, float64(time.Millisecond)))
+
+	score := (float64(result.Duration) - median) / spread
+	if score < 0 {
+		return 0
+	}
+	return math.Round(score*100) / 100
+}
+
+// Anomalous reports whether the score is high enough to flag the check.
+func (c AnomalyConfig) Anomalous(score float64) bool {
+	return c.Threshold > 0 && score >= c.Threshold
+}
+
+func (c AnomalyConfig) baseline(history []EndpointResponse) []float64 {
+	var durations []float64
+	for _, r := range history {
+		if r.Error != nil || r.Maintenance {
+			continue
+		}
+		durations = append(durations, float64(r.Duration))
+	}
+	return durations
+}
+
+// seasonalBaseline holds the durations of the latest successful checks of an
+// endpoint from one location in one hour of the week. The history is too
+// short to hold enough checks of any hour, so these are kept on their own.
+type seasonalBaseline struct {
+	Durations []time.Duration `json:"durations"`
+}
+
+func seasonalKey(result EndpointResponse) string {
+	return fmt.Sprintf("%s\x00%s\x00%d", result.Endpoint.URL, result.Location, hourOfWeek(result.Timestamp))
+}
+
+// seasonalDurations returns the seasonal baseline for the result.
+func (h *EndpointHandler) seasonalDurations(result EndpointResponse) ([]time.Duration, error) {
+	var baseline seasonalBaseline
+	err := h.store.View(func(tx RecordTx) error {
+		_, err := getKeyedRecord(tx, baselineBucket, seasonalKey(result), &baseline)
+		return err
+	})
+	return baseline.Durations, err
+}
+
+// recordSeasonal adds the duration of a successful check outside maintenance
+// to the seasonal baseline of its hour of the week.
+func (h *EndpointHandler) recordSeasonal(result EndpointResponse) error {
+	if result.Error != nil || result.Maintenance {
+		return nil
+	}
+
+	limit := max(seasonalSamples, h.anomaly.MinSamples)
+	return h.store.Update(func(tx RecordTx) error {
+		key := seasonalKey(result)
+		var baseline seasonalBaseline
+		if _, err := getKeyedRecord(tx, baselineBucket, key, &baseline); err != nil {
+			return err
+		}
+		baseline.Durations = append(baseline.Durations, result.Duration)
+		if len(baseline.Durations) > limit {
+			baseline.Durations = baseline.Durations[len(baseline.Durations)-limit:]
+		}
+		return putKeyedRecord(tx, baselineBucket, key, baseline)
+	})
+}
+
+func hourOfWeek(t time.Time) int {
+	t = t.UTC()
+	return int(t.Weekday())*24 + t.Hour()
+}
+
+func medianOf(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
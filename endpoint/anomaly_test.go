@@ -0,0 +1,161 @@
+package endpoint
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnomalyScore(t *testing.T) {
+	config := AnomalyConfig{MinSamples: 5, Threshold: 5}
+	start := time.Date(2024, 11, 11, 10, 0, 0, 0, time.UTC)
+
+	history := func(durations ...time.Duration) []EndpointResponse {
+		var results []EndpointResponse
+		for i, d := range durations {
+			results = append(results, EndpointResponse{Duration: d, Timestamp: start.Add(time.Duration(i) * time.Hour)})
+		}
+		return results
+	}
+	steady := history(100*time.Millisecond, 110*time.Millisecond, 90*time.Millisecond, 105*time.Millisecond, 95*time.Millisecond, 100*time.Millisecond)
+
+	tests := []struct {
+		name    string
+		config  AnomalyConfig
+		history []EndpointResponse
+		result  EndpointResponse
+		want    bool
+	}{
+		{"usual latency", config, steady, EndpointResponse{Duration: 108 * time.Millisecond}, false},
+		{"much slower", config, steady, EndpointResponse{Duration: 400 * time.Millisecond}, true},
+		{"faster", config, steady, EndpointResponse{Duration: 10 * time.Millisecond}, false},
+		{"failed check", config, steady, EndpointResponse{Duration: 400 * time.Millisecond, Error: errors.New("timeout")}, false},
+		{"too little history", config, steady[:3], EndpointResponse{Duration: 400 * time.Millisecond}, false},
+		{"disabled", AnomalyConfig{MinSamples: 5}, steady, EndpointResponse{Duration: 400 * time.Millisecond}, false},
+		{
+			"constant latency",
+			config,
+			history(100*time.Millisecond, 100*time.Millisecond, 100*time.Millisecond, 100*time.Millisecond, 100*time.Millisecond),
+			EndpointResponse{Duration: 110 * time.Millisecond},
+			false,
+		},
+		{
+			"failures left out of baseline",
+			config,
+			append(history(time.Minute, time.Minute), steady...),
+			EndpointResponse{Duration: 400 * time.Millisecond},
+			true,
+		},
+	}
+	tests[len(tests)-1].history[0].Error = errors.New("timeout")
+	tests[len(tests)-1].history[1].Error = errors.New("timeout")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := tt.config.Score(tt.history, nil, tt.result)
+			if got := tt.config.Anomalous(score); got != tt.want {
+				t.Errorf("Expected anomalous %v, got %v with score %.2f", tt.want, got, score)
+			}
+		})
+	}
+}
+
+func TestAnomalyScoreSeasonal(t *testing.T) {
+	config := AnomalyConfig{MinSamples: 3, Threshold: 5, Seasonal: true}
+	monday := time.Date(2024, 11, 11, 9, 0, 0, 0, time.UTC)
+
+	// Mondays at 9 are always busy, every other hour is quick. The history
+	// is too short to hold any earlier Monday at 9.
+	handler := NewStoreHandler(NewMemoryStore(), 5)
+	handler.anomaly = config
+	endpoint := EndpointRequest{URL: "https://test.com", Status: http.StatusOK}
+	check := func(at time.Time, duration time.Duration) EndpointResponse {
+		result := EndpointResponse{Endpoint: endpoint, Status: http.StatusOK, Duration: duration, Timestamp: at}
+		handler.finishResult(&result)
+		return result
+	}
+	for week := 0; week < 3; week++ {
+		at := monday.AddDate(0, 0, 7*week)
+		check(at, time.Second)
+		for hour := 1; hour <= 6; hour++ {
+			check(at.Add(time.Duration(hour)*time.Hour), 100*time.Millisecond)
+		}
+	}
+
+	seasonal, err := handler.seasonalDurations(EndpointResponse{Endpoint: endpoint, Timestamp: monday})
+	if err != nil || len(seasonal) != 3 {
+		t.Fatalf("Expected 3 seasonal samples for Monday at 9, got %v, %v", seasonal, err)
+	}
+
+	history, _ := handler.GetEndpointHistory(endpoint.URL)
+	busy := check(monday.AddDate(0, 0, 21), time.Second)
+	if busy.Anomalous {
+		t.Errorf("Expected usual Monday latency to be normal, got score %.2f", busy.Anomaly)
+	}
+	if score := config.Score(history, nil, busy); !config.Anomalous(score) {
+		t.Errorf("Expected Monday latency to stand out without seasonality, got score %.2f", score)
+	}
+	if slow := check(monday.AddDate(0, 0, 21).Add(time.Hour), time.Second); !slow.Anomalous {
+		t.Errorf("Expected a slow check at 10 to stand out, got score %.2f", slow.Anomaly)
+	}
+}
+
+func TestSchedulerAnomaly(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 50)
+	handler.anomaly = AnomalyConfig{MinSamples: 10, Threshold: 5}
+
+	endpoint := EndpointRequest{URL: "https://test.com", Status: http.StatusOK, AnomalyAfter: 2}
+	if err := handler.RegisterEndpoints([]EndpointRequest{endpoint}); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
+
+	alerts := make(channelNotifier, 16)
+	scheduler := NewScheduler(handler, time.Minute, nil)
+	scheduler.Alerter().Register(alerts)
+
+	var durations []time.Duration
+	for i := 0; i < 20; i++ {
+		durations = append(durations, time.Duration(100+i%5)*time.Millisecond)
+	}
+	durations = append(durations, time.Second, time.Second, 100*time.Millisecond)
+
+	start := time.Now()
+	for i, duration := range durations {
+		result := EndpointResponse{Endpoint: endpoint, Status: http.StatusOK, Duration: duration, Timestamp: start.Add(time.Duration(i) * time.Minute)}
+		handler.finishResult(&result)
+		scheduler.record(result)
+	}
+
+	var kinds []string
+	for i := 0; i < 2; i++ {
+		select {
+		case alert := <-alerts:
+			kinds = append(kinds, alert.Kind)
+			if alert.Kind == AlertAnomaly && alert.Anomaly < 5 {
+				t.Errorf("Expected the anomaly score on the alert, got %.2f", alert.Anomaly)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected 2 alerts, got %v", kinds)
+		}
+	}
+
+	sort.Strings(kinds)
+	if got := strings.Join(kinds, ","); got != "anomaly,recovered" {
+		t.Errorf("Expected sustained anomaly to alert and recover, got %s", got)
+	}
+
+	history, err := handler.GetEndpointHistory(endpoint.URL)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	response := newHistoryResponse(EndpointMeta{URL: endpoint.URL}, history)
+	if response.Stats.AnomalousChecks != 2 {
+		t.Errorf("Expected 2 anomalous checks, got %+v", response.Stats)
+	}
+	if response.History[20].Anomaly < 5 || response.History[19].Anomaly >= 5 {
+		t.Errorf("Expected anomaly scores in history, got %v and %v", response.History[19].Anomaly, response.History[20].Anomaly)
+	}
+}
@@ -0,0 +1,224 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+const (
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".db"
+	snapshotLayout = "20060102T150405Z"
+)
+
+// Validate checks the snapshot schedule. Memory stores cannot be backed up,
+// so snapshots need one of the other drivers.
+func (c BackupConfig) Validate(driver string) error {
+	if c.SnapshotDir == "" {
+		return nil
+	}
+	if driver == StorageMemory {
+		return errors.New("snapshots need the bolt or sqlite storage driver")
+	}
+	if c.SnapshotInterval <= 0 {
+		return errors.New("snapshot interval must be positive")
+	}
+	if c.SnapshotKeep < 1 {
+		return errors.New("at least one snapshot must be kept")
+	}
+	return nil
+}
+
+// Backup writes a consistent copy of the database to w while checks keep
+// being stored.
+func (h *EndpointHandler) Backup(w io.Writer) error {
+	return h.store.Backup(w)
+}
+
+// SchemaVersion returns the schema version of the database.
+func (h *EndpointHandler) SchemaVersion() (int, error) {
+	return h.store.SchemaVersion()
+}
+
+// Snapshot saves a backup into dir named after the time it was taken and
+// removes the oldest snapshots beyond keep. It returns the snapshot's path.
+func (h *EndpointHandler) Snapshot(dir string, keep int, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	path := filepath.Join(dir, snapshotPrefix+now.UTC().Format(snapshotLayout)+snapshotSuffix)
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if err := backupStoreTo(h.store, tmp); err != nil {
+		return "", fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	return path, rotateSnapshots(dir, keep)
+}
+
+// rotateSnapshots removes all but the newest keep snapshots in dir. Their
+// names sort in the order they were taken.
+func rotateSnapshots(dir string, keep int) error {
+	snapshots, err := filepath.Glob(filepath.Join(dir, snapshotPrefix+"*"+snapshotSuffix))
+	if err != nil {
+		return err
+	}
+	sort.Strings(snapshots)
+
+	var errs []error
+	for len(snapshots) > keep {
+		if err := os.Remove(snapshots[0]); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove old snapshot: %w", err))
+		}
+		snapshots = snapshots[1:]
+	}
+	return errors.Join(errs...)
+}
+
+func NewSnapshotter(handler *EndpointHandler, config BackupConfig) *Snapshotter {
+	return &Snapshotter{
+		handler: handler,
+		config:  config,
+		done:    make(chan struct{}),
+	}
+}
+
+func (s *Snapshotter) Start() {
+	s.wg.Add(1)
+	go s.run()
+	log.Printf("Saving a snapshot to %s every %v, keeping %d", s.config.SnapshotDir, s.config.SnapshotInterval, s.config.SnapshotKeep)
+}
+
+func (s *Snapshotter) Stop() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+func (s *Snapshotter) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			path, err := s.handler.Snapshot(s.config.SnapshotDir, s.config.SnapshotKeep, now)
+			if err != nil {
+				log.Printf("Failed to save snapshot: %v", err)
+				continue
+			}
+			log.Printf("Saved snapshot %s", path)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// RestoreBackup replaces the database at dbPath with the backup at
+// backupPath. The backup must be a database of the driver with a schema
+// version this build supports; migrations run when the server next starts.
+// An existing database is kept next to it. The server must be stopped first.
+func RestoreBackup(driver, backupPath, dbPath string) (RestoreResult, error) {
+	var result RestoreResult
+	if driver == StorageMemory {
+		return result, errors.New("the memory store cannot be restored")
+	}
+
+	version, err := backupVersion(driver, backupPath)
+	if err != nil {
+		return result, fmt.Errorf("invalid backup %s: %w", backupPath, err)
+	}
+	result.Version = version
+
+	if _, err := os.Stat(dbPath); err == nil {
+		// Opening the database for writing fails while a server holds the
+		// bbolt lock.
+		store, err := OpenStore(driver, dbPath, false)
+		if errors.Is(err, bbolt.ErrTimeout) {
+			return result, fmt.Errorf("database %s is in use, stop the server before restoring", dbPath)
+		}
+		if err != nil {
+			return result, err
+		}
+		store.Close()
+	}
+
+	tmp := dbPath + ".restore"
+	if err := copyFile(backupPath, tmp); err != nil {
+		os.Remove(tmp)
+		return result, fmt.Errorf("failed to copy backup: %w", err)
+	}
+
+	if _, err := os.Stat(dbPath); err == nil {
+		result.Previous = fmt.Sprintf("%s.pre-restore-%s.bak", dbPath, time.Now().Format("20060102150405"))
+		if err := os.Rename(dbPath, result.Previous); err != nil {
+			os.Remove(tmp)
+			return result, fmt.Errorf("failed to move the current database aside: %w", err)
+		}
+	}
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return result, fmt.Errorf("failed to install backup: %w", err)
+	}
+	return result, nil
+}
+
+// backupVersion opens the backup read-only and checks its schema version.
+// Version 0 means it is not a database written by this service.
+func backupVersion(driver, path string) (int, error) {
+	store, err := OpenStore(driver, path, true)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+
+	version, err := store.SchemaVersion()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if version == 0 {
+		return 0, errors.New("it has no schema version")
+	}
+	if _, err := store.PendingMigrations(); err != nil {
+		return 0, err
+	}
+	if _, err := store.URLs(); err != nil {
+		return 0, fmt.Errorf("failed to read results: %w", err)
+	}
+	return version, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,193 @@
+package endpoint
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestBackupConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  BackupConfig
+		driver  string
+		wantErr bool
+	}{
+		{"disabled", BackupConfig{}, StorageMemory, false},
+		{"valid", BackupConfig{SnapshotDir: "snapshots", SnapshotInterval: time.Hour, SnapshotKeep: 3}, StorageBolt, false},
+		{"memory store", BackupConfig{SnapshotDir: "snapshots", SnapshotInterval: time.Hour, SnapshotKeep: 3}, StorageMemory, true},
+		{"no interval", BackupConfig{SnapshotDir: "snapshots", SnapshotKeep: 3}, StorageBolt, true},
+		{"keep none", BackupConfig{SnapshotDir: "snapshots", SnapshotInterval: time.Hour}, StorageBolt, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(tt.driver); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// newBackupHandler returns a bbolt handler holding one result.
+func newBackupHandler(t *testing.T, path string) *EndpointHandler {
+	t.Helper()
+
+	defer func(config StorageConfig) { STORAGE_CONFIG = config }(STORAGE_CONFIG)
+	STORAGE_CONFIG = StorageConfig{Driver: StorageBolt}
+
+	handler, err := NewEndpointHandler(path, 10)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	endpoint := EndpointRequest{URL: "https://test.com", Method: "GET", Status: http.StatusOK}
+	if err := handler.storeResponse(EndpointResponse{Endpoint: endpoint, Status: http.StatusOK, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Failed to store response: %v", err)
+	}
+	return handler
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	handler := newBackupHandler(t, filepath.Join(dir, "endpoints.db"))
+	defer handler.Close()
+
+	snapshots := filepath.Join(dir, "snapshots")
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var paths []string
+	for i := 0; i < 5; i++ {
+		path, err := handler.Snapshot(snapshots, 3, start.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatalf("Failed to save snapshot: %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	kept, _ := filepath.Glob(filepath.Join(snapshots, "*"))
+	if strings.Join(kept, ",") != strings.Join(paths[2:], ",") {
+		t.Errorf("Expected the newest 3 snapshots to be kept, got %v", kept)
+	}
+
+	store, err := NewBoltStore(paths[4], true)
+	if err != nil {
+		t.Fatalf("Failed to open snapshot: %v", err)
+	}
+	defer store.Close()
+	if results, _ := store.Results("https://test.com", time.Time{}, time.Time{}); len(results) != 1 {
+		t.Errorf("Expected the snapshot to hold 1 result, got %d", len(results))
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	dir := t.TempDir()
+	backup := filepath.Join(dir, "backup.db")
+	handler := newBackupHandler(t, filepath.Join(dir, "source.db"))
+	if err := backupStoreTo(handler.store, backup); err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	handler.Close()
+
+	dbPath := filepath.Join(dir, "endpoints.db")
+	current := newBackupHandler(t, dbPath)
+
+	if _, err := RestoreBackup(StorageBolt, backup, dbPath); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("Expected restoring over an open database to fail, got %v", err)
+	}
+	current.Close()
+
+	notDB := filepath.Join(dir, "notes.txt")
+	os.WriteFile(notDB, []byte("not a database"), 0600)
+	unversioned := filepath.Join(dir, "unversioned.db")
+	db, _ := bbolt.Open(unversioned, 0600, nil)
+	db.Close()
+	newer := filepath.Join(dir, "newer.db")
+	db, _ = bbolt.Open(newer, 0600, nil)
+	db.Update(func(tx *bbolt.Tx) error {
+		b, _ := tx.CreateBucket([]byte(metadataBucket))
+		return b.Put([]byte(schemaVersionKey), []byte(strconv.Itoa(len(boltMigrations)+1)))
+	})
+	db.Close()
+
+	for _, invalid := range []string{filepath.Join(dir, "missing.db"), notDB, unversioned, newer} {
+		if _, err := RestoreBackup(StorageBolt, invalid, dbPath); err == nil {
+			t.Errorf("Expected %s to be refused", filepath.Base(invalid))
+		}
+	}
+	if before, _ := os.ReadFile(dbPath); len(before) == 0 {
+		t.Fatalf("Expected refused restores to leave the database in place")
+	}
+
+	result, err := RestoreBackup(StorageBolt, backup, dbPath)
+	if err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if result.Version != len(boltMigrations) {
+		t.Errorf("Expected schema version %d, got %d", len(boltMigrations), result.Version)
+	}
+	if _, err := os.Stat(result.Previous); err != nil {
+		t.Errorf("Expected the previous database to be kept: %v", err)
+	}
+
+	want, _ := os.ReadFile(backup)
+	got, _ := os.ReadFile(dbPath)
+	if string(got) != string(want) {
+		t.Errorf("Expected the database to be replaced by the backup")
+	}
+}
+
+func TestBackupAPI(t *testing.T) {
+	dir := t.TempDir()
+	handler := newBackupHandler(t, filepath.Join(dir, "endpoints.db"))
+	defer handler.Close()
+
+	api := NewAPI(handler, NewScheduler(handler, time.Minute, nil))
+
+	tests := []struct {
+		name       string
+		adminToken string
+		header     string
+		wantStatus int
+	}{
+		{"disabled", "", "Bearer ", http.StatusUnauthorized},
+		{"missing token", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api.adminToken = tt.adminToken
+			req := httptest.NewRequest("GET", "/admin/backup", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			api.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if version := rr.Header().Get("X-Schema-Version"); version != strconv.Itoa(len(boltMigrations)) {
+				t.Errorf("Expected schema version header %d, got %q", len(boltMigrations), version)
+			}
+			path := filepath.Join(dir, "downloaded.db")
+			if err := os.WriteFile(path, rr.Body.Bytes(), 0600); err != nil {
+				t.Fatalf("Failed to write backup: %v", err)
+			}
+			if _, err := RestoreBackup(StorageBolt, path, filepath.Join(dir, "restored.db")); err != nil {
+				t.Errorf("Expected the downloaded backup to restore, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package endpoint
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Body policies decide which response bodies are stored with the results.
+const (
+	BodyNone       = "none"
+	BodyOnFailure  = "failure"
+	BodyTruncated  = "truncated"
+	BodyCompressed = "compressed"
+)
+
+var bodyPolicies = []string{BodyNone, BodyOnFailure, BodyTruncated, BodyCompressed}
+
+// Encodings of stored bodies.
+const (
+	bodyIdentity = "identity"
+	bodyGzip     = "gzip"
+)
+
+const (
+	defaultBodyLimit   = 64 << 10
+	defaultMaxBodySize = 1 << 20
+)
+
+// readBody reads at most limit bytes of the body and reports whether there
+// was more.
+func readBody(r io.Reader, limit int64) ([]byte, bool, error) {
+	if limit <= 0 {
+		limit = defaultMaxBodySize
+	}
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(body)) > limit {
+		return body[:limit], true, nil
+	}
+	return body, false, nil
+}
+
+func hashBody(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// keptBody returns the part of the response's body its endpoint's policy
+// keeps, before compression.
+func keptBody(response EndpointResponse) string {
+	endpoint := response.Endpoint
+	switch endpoint.BodyPolicy {
+	case BodyNone:
+		return ""
+	case BodyCompressed:
+		return response.Body
+	case BodyOnFailure, "":
+		if response.Error == nil {
+			return ""
+		}
+	}
+
+	limit := endpoint.BodyLimit
+	if limit <= 0 {
+		limit = defaultBodyLimit
+	}
+	if len(response.Body) > limit {
+		return response.Body[:limit]
+	}
+	return response.Body
+}
+
+// encodeBody returns the body to store for the response and its encoding,
+// or nil when the policy keeps none.
+func encodeBody(response EndpointResponse) ([]byte, string, error) {
+	body := keptBody(response)
+	if body == "" {
+		return nil, "", nil
+	}
+	if response.Endpoint.BodyPolicy != BodyCompressed {
+		return []byte(body), bodyIdentity, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(zw, body); err != nil {
+		return nil, "", fmt.Errorf("failed to compress body: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, "", fmt.Errorf("failed to compress body: %w", err)
+	}
+	return buf.Bytes(), bodyGzip, nil
+}
+
+func decodeBody(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case bodyIdentity:
+		return data, nil
+	case bodyGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress body: %w", err)
+		}
+		defer zr.Close()
+		body, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress body: %w", err)
+		}
+		return body, nil
+	default:
+		return nil, fmt.Errorf("unknown body encoding %q", encoding)
+	}
+}
+
+// GetBody returns the body stored with the endpoint's check at timestamp,
+// or with its latest check that has one when timestamp is zero. It returns
+// nil when there is none.
+func (h *EndpointHandler) GetBody(url string, timestamp time.Time) (*ResponseBody, error) {
+	results, err := h.store.Results(url, timestamp, timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(results) - 1; i >= 0; i-- {
+		result := results[i]
+		if result.BodyEncoding == "" {
+			continue
+		}
+
+		data, err := h.store.Body(url, result.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			return nil, nil
+		}
+		body, err := decodeBody(data, result.BodyEncoding)
+		if err != nil {
+			return nil, err
+		}
+		// Policies only ever keep the start of the body, so a shorter
+		// stored body was cut to the endpoint's BodyLimit.
+		return &ResponseBody{
+			Timestamp:       result.Timestamp,
+			Data:            body,
+			Hash:            result.BodyHash,
+			Size:            result.BodySize,
+			Truncated:       result.BodyTruncated,
+			StoredSize:      int64(len(body)),
+			StoredTruncated: int64(len(body)) < result.BodySize,
+		}, nil
+	}
+	return nil, nil
+}
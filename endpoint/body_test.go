@@ -0,0 +1,191 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadBody(t *testing.T) {
+	tests := []struct {
+		body          string
+		limit         int64
+		want          string
+		wantTruncated bool
+	}{
+		{"hello", 10, "hello", false},
+		{"hello", 5, "hello", false},
+		{"hello world", 5, "hello", true},
+		{"", 5, "", false},
+	}
+
+	for _, tt := range tests {
+		body, truncated, err := readBody(strings.NewReader(tt.body), tt.limit)
+		if err != nil {
+			t.Fatalf("readBody(%q, %d) error = %v", tt.body, tt.limit, err)
+		}
+		if string(body) != tt.want || truncated != tt.wantTruncated {
+			t.Errorf("readBody(%q, %d) = %q, %v, want %q, %v", tt.body, tt.limit, body, truncated, tt.want, tt.wantTruncated)
+		}
+	}
+}
+
+func TestEncodeBody(t *testing.T) {
+	body := strings.Repeat("<p>plug</p>", 100)
+	failed := errors.New("expected content not found")
+
+	tests := []struct {
+		name         string
+		endpoint     EndpointRequest
+		err          error
+		wantBody     string
+		wantEncoding string
+	}{
+		{"none", EndpointRequest{BodyPolicy: BodyNone}, failed, "", ""},
+		{"failure with success", EndpointRequest{BodyPolicy: BodyOnFailure}, nil, "", ""},
+		{"failure with failure", EndpointRequest{BodyPolicy: BodyOnFailure, BodyLimit: 22}, failed, body[:22], bodyIdentity},
+		{"default policy", EndpointRequest{}, failed, body, bodyIdentity},
+		{"truncated", EndpointRequest{BodyPolicy: BodyTruncated, BodyLimit: 11}, nil, body[:11], bodyIdentity},
+		{"truncated shorter than limit", EndpointRequest{BodyPolicy: BodyTruncated, BodyLimit: 10000}, nil, body, bodyIdentity},
+		{"compressed", EndpointRequest{BodyPolicy: BodyCompressed, BodyLimit: 11}, nil, body, bodyGzip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, encoding, err := encodeBody(EndpointResponse{Endpoint: tt.endpoint, Error: tt.err, Body: body})
+			if err != nil {
+				t.Fatalf("encodeBody() error = %v", err)
+			}
+			if encoding != tt.wantEncoding {
+				t.Fatalf("Expected encoding %q, got %q", tt.wantEncoding, encoding)
+			}
+			if encoding == "" {
+				if data != nil {
+					t.Errorf("Expected no body, got %q", data)
+				}
+				return
+			}
+
+			if encoding == bodyGzip && len(data) >= len(body) {
+				t.Errorf("Expected the body to be compressed, got %d bytes for %d", len(data), len(body))
+			}
+			decoded, err := decodeBody(data, encoding)
+			if err != nil {
+				t.Fatalf("decodeBody() error = %v", err)
+			}
+			if string(decoded) != tt.wantBody {
+				t.Errorf("Expected body %q, got %q", tt.wantBody, decoded)
+			}
+		})
+	}
+}
+
+func TestBodyPolicy(t *testing.T) {
+	page := strings.Repeat("a", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+	up := EndpointRequest{URL: server.URL + "/up", RetryAttempts: 1, RetryDelay: time.Millisecond, MaxBodySize: 40}
+	down := EndpointRequest{URL: server.URL + "/down", RetryAttempts: 1, RetryDelay: time.Millisecond, BodyLimit: 10}
+
+	response := handler.Handle(context.Background(), up)
+	if response.BodySize != 40 || !response.BodyTruncated || response.BodyHash != hashBody([]byte(page[:40])) {
+		t.Errorf("Expected the read to stop at 40 bytes, got size %d, truncated %v", response.BodySize, response.BodyTruncated)
+	}
+	handler.Handle(context.Background(), down)
+
+	history, _ := handler.GetEndpointHistory(up.URL)
+	if len(history) != 1 || history[0].BodyStored || history[0].BodySize != 40 || history[0].Body != "" {
+		t.Errorf("Expected a successful check to keep its hash and size only, got %+v", history)
+	}
+	if body, err := handler.GetBody(up.URL, time.Time{}); err != nil || body != nil {
+		t.Errorf("Expected no body for a successful check, got %+v, %v", body, err)
+	}
+
+	history, _ = handler.GetEndpointHistory(down.URL)
+	if len(history) != 1 || !history[0].BodyStored || history[0].BodySize != 100 {
+		t.Fatalf("Expected a failed check to store its body, got %+v", history)
+	}
+	body, err := handler.GetBody(down.URL, history[0].Timestamp)
+	if err != nil || body == nil {
+		t.Fatalf("Expected the stored body, got %+v, %v", body, err)
+	}
+	if string(body.Data) != page[:10] || body.Size != 100 || body.Hash != hashBody([]byte(page)) {
+		t.Errorf("Expected the first 10 bytes with the full hash and size, got %+v", body)
+	}
+	if body.Truncated || !body.StoredTruncated || body.StoredSize != 10 {
+		t.Errorf("Expected the body to be marked as cut by the policy only, got %+v", body)
+	}
+}
+
+func TestEndpointBodyAPI(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+	api := NewAPI(handler, NewScheduler(handler, time.Minute, nil))
+
+	compressed := EndpointRequest{URL: "https://test.com", Method: "GET", Status: http.StatusOK, BodyPolicy: BodyCompressed}
+	truncated := EndpointRequest{URL: "https://test.com", Method: "GET", Status: http.StatusOK, BodyPolicy: BodyTruncated, BodyLimit: 4}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	for i, body := range []string{"first", "second"} {
+		endpoint := compressed
+		if i == 1 {
+			endpoint = truncated
+		}
+		handler.storeResponse(EndpointResponse{
+			Endpoint:  endpoint,
+			Status:    http.StatusOK,
+			Timestamp: start.Add(time.Duration(i) * time.Hour),
+			Body:      body,
+			BodyHash:  hashBody([]byte(body)),
+			BodySize:  int64(len(body)),
+		})
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		want       string
+		wantFull   string
+		wantStored string
+	}{
+		{"latest", "/endpoint/body?url=https://test.com", http.StatusOK, "seco", "second", "4 true"},
+		{"by timestamp", "/endpoint/body?url=https://test.com&timestamp=2024-03-01T12:00:00.123456789Z", http.StatusOK, "first", "first", "5 false"},
+		{"no check at timestamp", "/endpoint/body?url=https://test.com&timestamp=2024-03-01T12:00:00Z", http.StatusNotFound, "No body stored", "", ""},
+		{"unknown endpoint", "/endpoint/body?url=https://missing.com", http.StatusNotFound, "No body stored", "", ""},
+		{"missing url", "/endpoint/body", http.StatusBadRequest, "URL parameter is required", "", ""},
+		{"invalid timestamp", "/endpoint/body?url=https://test.com&timestamp=noon", http.StatusBadRequest, "Invalid timestamp", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			api.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.want) {
+				t.Errorf("Expected body to contain %q, got %q", tt.want, rr.Body.String())
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			if rr.Header().Get("X-Body-Hash") != hashBody([]byte(tt.wantFull)) {
+				t.Errorf("Expected the hash of %q, got %q", tt.wantFull, rr.Header().Get("X-Body-Hash"))
+			}
+			if stored := rr.Header().Get("X-Stored-Size") + " " + rr.Header().Get("X-Stored-Truncated"); stored != tt.wantStored {
+				t.Errorf("Expected the stored size and truncation %q, got %q", tt.wantStored, stored)
+			}
+		})
+	}
+}
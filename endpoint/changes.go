@@ -0,0 +1,189 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+const (
+	changeBucket      = "changes"
+	changeIndexBucket = "change_index"
+
+	CategoryContentChanged = "content_changed"
+
+	// maxDiffSize caps the diff stored with a change.
+	maxDiffSize = 64 << 10
+)
+
+var ErrChangeNotFound = errors.New("change not found")
+
+// compileIgnoreContent compiles the patterns of content to leave out when
+// looking for changes.
+func compileIgnoreContent(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore content pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// normalizeContent removes what the patterns match from the body, so that
+// timestamps, nonces and other content that differs on every request does
+// not count as a change.
+func normalizeContent(body string, patterns []string) (string, error) {
+	compiled, err := compileIgnoreContent(patterns)
+	if err != nil {
+		return "", err
+	}
+	for _, re := range compiled {
+		body = re.ReplaceAllString(body, "")
+	}
+	return body, nil
+}
+
+// detectChange sets the content hash of a response from an endpoint with
+// change detection and records a new version when it differs from the
+// latest one seen from the same location. Only successful checks outside
+// maintenance are compared, so error pages are not taken for new content.
+// Results older than the latest version, such as ones buffered by a probe,
+// are hashed but not compared.
+func (h *EndpointHandler) detectChange(response *EndpointResponse) error {
+	endpoint := response.Endpoint
+	if !endpoint.DetectChanges || response.Error != nil || response.Maintenance {
+		return nil
+	}
+
+	content, err := normalizeContent(response.Body, endpoint.IgnoreContent)
+	if err != nil {
+		return err
+	}
+	hash := hashBody([]byte(content))
+	response.ContentHash = hash
+
+	changed := false
+	err = h.store.Update(func(tx RecordTx) error {
+		key := changeIndexKey(endpoint.URL, response.Location)
+		var index changeIndex
+		found, err := getKeyedRecord(tx, changeIndexBucket, key, &index)
+		if err != nil {
+			return err
+		}
+		if found && (index.Hash == hash || !response.Timestamp.After(index.Timestamp)) {
+			return nil
+		}
+
+		id, err := nextRecordID(tx, changeBucket)
+		if err != nil {
+			return err
+		}
+		change := ContentChange{
+			ID:        id,
+			URL:       endpoint.URL,
+			Domain:    endpoint.Domain,
+			Location:  response.Location,
+			Timestamp: response.Timestamp,
+			Hash:      hash,
+		}
+		if found {
+			previousAt := index.Timestamp
+			change.PreviousHash = index.Hash
+			change.PreviousAt = &previousAt
+			change.Diff = unifiedDiff(index.Content, content,
+				changeLabel(endpoint.URL, index.Timestamp), changeLabel(endpoint.URL, response.Timestamp))
+			if len(change.Diff) > maxDiffSize {
+				change.Diff = truncateLines(change.Diff, maxDiffSize)
+				change.DiffTruncated = true
+			}
+			changed = true
+		}
+		if err := putRecord(tx, changeBucket, id, change); err != nil {
+			return err
+		}
+
+		// Like results, only as many versions as the history size are kept.
+		index.IDs = append(index.IDs, id)
+		for len(index.IDs) > h.histSize {
+			if err := deleteRecord(tx, changeBucket, index.IDs[0]); err != nil {
+				return err
+			}
+			index.IDs = index.IDs[1:]
+		}
+		index.Hash, index.Timestamp, index.Content = hash, response.Timestamp, content
+		return putKeyedRecord(tx, changeIndexBucket, key, index)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record content change: %w", err)
+	}
+
+	response.ContentChanged = changed
+	return nil
+}
+
+// changeIndexKey identifies the versions of an endpoint seen from a location.
+func changeIndexKey(url, location string) string {
+	return url + "\x00" + location
+}
+
+func changeLabel(url string, timestamp time.Time) string {
+	return url + "\t" + timestamp.UTC().Format(time.RFC3339Nano)
+}
+
+// truncateLines cuts text to at most limit bytes, at the end of a line.
+func truncateLines(text string, limit int) string {
+	text = text[:limit]
+	for i := len(text) - 1; i >= 0; i-- {
+		if text[i] == '\n' {
+			return text[:i+1]
+		}
+	}
+	return ""
+}
+
+func (f ContentChangeFilter) Matches(change ContentChange) bool {
+	if f.URL != "" && change.URL != f.URL {
+		return false
+	}
+	return inRange(change.Timestamp, f.Since, f.Until)
+}
+
+// GetContentChanges returns the recorded versions matching the filter,
+// newest first, without their content.
+func (h *EndpointHandler) GetContentChanges(filter ContentChangeFilter) ([]ContentChange, error) {
+	var changes []ContentChange
+
+	err := h.store.View(func(tx RecordTx) error {
+		return forEachRecord(tx, changeBucket, func(c ContentChange) error {
+			if filter.Matches(c) {
+				changes = append(changes, c)
+			}
+			return nil
+		})
+	})
+
+	sort.Slice(changes, func(a, b int) bool {
+		return changes[a].ID > changes[b].ID
+	})
+
+	return changes, err
+}
+
+func (h *EndpointHandler) GetContentChange(id uint64) (ContentChange, error) {
+	var change ContentChange
+
+	err := h.store.View(func(tx RecordTx) error {
+		found, err := getRecord(tx, changeBucket, id, &change)
+		if err == nil && !found {
+			return ErrChangeNotFound
+		}
+		return err
+	})
+
+	return change, err
+}
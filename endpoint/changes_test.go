@@ -0,0 +1,258 @@
+package endpoint
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		patterns []string
+		want     string
+		wantErr  bool
+	}{
+		{"no patterns", "<p>Hi</p>", nil, "<p>Hi</p>", false},
+		{"timestamp", "Generated at 2024-03-01T12:00:00Z\n<p>Hi</p>", []string{`\d{4}-\d\d-\d\dT[\d:]+Z`}, "Generated at \n<p>Hi</p>", false},
+		{"several patterns", `<script nonce="abc123">x</script><!-- 17ms -->`, []string{`nonce="[^"]*"`, `<!--.*?-->`}, `<script >x</script>`, false},
+		{"invalid pattern", "<p>Hi</p>", []string{`(`}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeContent(tt.body, tt.patterns)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeContent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// contentResult is a successful check of the endpoint that returned body.
+func contentResult(endpoint EndpointRequest, body string, timestamp time.Time) EndpointResponse {
+	return EndpointResponse{
+		Endpoint:  endpoint,
+		Status:    http.StatusOK,
+		Body:      body,
+		BodyHash:  hashBody([]byte(body)),
+		BodySize:  int64(len(body)),
+		Timestamp: timestamp,
+	}
+}
+
+func TestDetectChange(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 3)
+	endpoint := EndpointRequest{
+		URL:           "https://onplug.io",
+		Domain:        "plug",
+		Status:        http.StatusOK,
+		DetectChanges: true,
+		IgnoreContent: []string{`nonce="\w+"`},
+	}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	checks := []struct {
+		body        string
+		location    string
+		failed      bool
+		wantChanged bool
+	}{
+		{"<h1>Plug</h1>\n<script nonce=\"a1\"></script>\n<p>Build 41</p>\n", "", false, false},
+		{"<h1>Plug</h1>\n<script nonce=\"b2\"></script>\n<p>Build 41</p>\n", "", false, false},
+		{"<h1>Bad Gateway</h1>\n", "", true, false},
+		{"<h1>Plug</h1>\n<script nonce=\"c3\"></script>\n<p>Build 42</p>\n", "", false, true},
+		{"<h1>Plug</h1>\n<script nonce=\"d4\"></script>\n<p>Build 41</p>\n", "fra", false, false},
+	}
+
+	for i, check := range checks {
+		result := contentResult(endpoint, check.body, start.Add(time.Duration(i)*time.Minute))
+		result.Location = check.location
+		if check.failed {
+			result.Status = http.StatusBadGateway
+			result.Error = errors.New("received error status code: 502")
+		}
+		handler.finishResult(&result)
+		if result.ContentChanged != check.wantChanged {
+			t.Errorf("Check %d: expected changed %v, got %v", i, check.wantChanged, result.ContentChanged)
+		}
+		if check.failed != (result.ContentHash == "") {
+			t.Errorf("Check %d: expected only successful checks to be hashed, got %q", i, result.ContentHash)
+		}
+	}
+
+	history, _ := handler.GetEndpointHistory(endpoint.URL)
+	if len(history) != 4 || !history[2].ContentChanged || history[2].ContentHash == "" {
+		t.Errorf("Expected the change to be stored with the result, got %+v", history)
+	}
+
+	changes, err := handler.GetContentChanges(ContentChangeFilter{URL: endpoint.URL})
+	if err != nil || len(changes) != 3 {
+		t.Fatalf("Expected 3 versions, got %d, %v", len(changes), err)
+	}
+	fra, changed, first := changes[0], changes[1], changes[2]
+	if fra.Location != "fra" || fra.PreviousHash != "" || fra.Diff != "" {
+		t.Errorf("Expected a first version for the new location, got %+v", fra)
+	}
+	if first.PreviousHash != "" || first.Diff != "" || !first.Timestamp.Equal(start) {
+		t.Errorf("Expected the first version without a diff, got %+v", first)
+	}
+	if changed.PreviousHash != first.Hash || changed.PreviousAt == nil || !changed.PreviousAt.Equal(start) {
+		t.Errorf("Expected the change to refer to the first version, got %+v", changed)
+	}
+	if !strings.Contains(changed.Diff, "-<p>Build 41</p>\n+<p>Build 42</p>\n") || strings.Contains(changed.Diff, "nonce") {
+		t.Errorf("Expected a diff of the build without the nonces, got:\n%s", changed.Diff)
+	}
+
+	// The index keeps the content of the latest version of each location,
+	// and only as many versions as the history size are kept.
+	for i, body := range []string{"<p>Build 43</p>\n", "<p>Build 44</p>\n", "<p>Build 45</p>\n"} {
+		result := contentResult(endpoint, body, start.Add(time.Duration(10+i)*time.Minute))
+		handler.finishResult(&result)
+	}
+	var kept []ContentChange
+	var index changeIndex
+	handler.store.View(func(tx RecordTx) error {
+		if _, err := getKeyedRecord(tx, changeIndexBucket, changeIndexKey(endpoint.URL, ""), &index); err != nil {
+			return err
+		}
+		return forEachRecord(tx, changeBucket, func(c ContentChange) error {
+			if c.Location == "" {
+				kept = append(kept, c)
+			}
+			return nil
+		})
+	})
+	if len(kept) != 3 || len(index.IDs) != 3 || index.IDs[0] != kept[0].ID || index.IDs[2] != kept[2].ID {
+		t.Errorf("Expected the newest 3 versions to be indexed, got %+v and %+v", kept, index)
+	}
+	if index.Content != "<p>Build 45</p>\n" || index.Hash != kept[2].Hash {
+		t.Errorf("Expected the index to hold the latest content, got %+v", index)
+	}
+
+	// Results older than the latest version are not compared.
+	late := contentResult(endpoint, "<p>Build 40</p>\n", start.Add(5*time.Minute))
+	handler.finishResult(&late)
+	if late.ContentChanged {
+		t.Errorf("Expected a late result not to count as a change")
+	}
+}
+
+func TestSchedulerContentChange(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+	alerts := make(channelNotifier, 16)
+	scheduler := NewScheduler(handler, time.Minute, nil)
+	scheduler.Alerter().Register(alerts)
+	scheduler.Alerter().publicURL = "https://cron.onplug.io"
+
+	start := time.Now()
+	for i, endpoint := range []EndpointRequest{
+		{URL: "https://onplug.io", Status: http.StatusOK, DetectChanges: true, AlertOnChange: true},
+		{URL: "https://docs.onplug.io", Status: http.StatusOK, DetectChanges: true},
+	} {
+		for j, body := range []string{"v1", "v2"} {
+			result := contentResult(endpoint, body, start.Add(time.Duration(i*2+j)*time.Minute))
+			handler.finishResult(&result)
+			scheduler.record(result)
+		}
+	}
+
+	select {
+	case alert := <-alerts:
+		if alert.Kind != AlertChanged || alert.URL != "https://onplug.io" || alert.Category != CategoryContentChanged {
+			t.Errorf("Expected a content change alert, got %+v", alert)
+		}
+		if alert.HistoryURL != "https://cron.onplug.io/changes?url=https%3A%2F%2Fonplug.io" {
+			t.Errorf("Expected the alert to link to the changes, got %q", alert.HistoryURL)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a content change alert")
+	}
+	select {
+	case alert := <-alerts:
+		t.Errorf("Expected no alert without AlertOnChange, got %+v", alert)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if active := scheduler.Alerter().ActiveAlerts(); len(active) != 0 {
+		t.Errorf("Expected a content change not to be tracked as an outage, got %+v", active)
+	}
+}
+
+func TestSchedulerContentChangeLocations(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+	alerts := make(channelNotifier, 16)
+	scheduler := NewScheduler(handler, time.Minute, nil)
+	scheduler.Alerter().Register(alerts)
+
+	endpoint := EndpointRequest{URL: "https://onplug.io", Status: http.StatusOK, DetectChanges: true, AlertOnChange: true}
+	start := time.Now()
+	// Every location sees the new build, then the old one again.
+	for i, body := range []string{"v1", "v2", "v1"} {
+		for j, location := range []string{"", "ams", "fra"} {
+			result := contentResult(endpoint, body, start.Add(time.Duration(i*3+j)*time.Second))
+			result.Location = location
+			handler.finishResult(&result)
+			scheduler.record(result)
+		}
+	}
+	scheduler.alerter.Wait()
+
+	if len(alerts) != 2 {
+		t.Fatalf("Expected one alert for each change, got %d", len(alerts))
+	}
+	if changes, _ := handler.GetContentChanges(ContentChangeFilter{}); len(changes) != 9 {
+		t.Errorf("Expected each location to record the changes, got %d versions", len(changes))
+	}
+}
+
+func TestContentChangesAPI(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+	api := NewAPI(handler, NewScheduler(handler, time.Minute, nil))
+
+	endpoint := EndpointRequest{URL: "https://onplug.io", Status: http.StatusOK, DetectChanges: true}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, body := range []string{"<p>Build 41</p>\n", "<p>Build 42</p>\n"} {
+		result := contentResult(endpoint, body, start.Add(time.Duration(i)*time.Hour))
+		handler.finishResult(&result)
+	}
+	changes, _ := handler.GetContentChanges(ContentChangeFilter{})
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		want       string
+	}{
+		{"list", "/changes?url=https://onplug.io", http.StatusOK, `"previous_hash":"` + changes[1].Hash + `"`},
+		{"since", "/changes?since=2024-03-01T12:30:00Z", http.StatusOK, `"diff":"--- https://onplug.io`},
+		{"unknown endpoint", "/changes?url=https://missing.com", http.StatusOK, `[]`},
+		{"invalid until", "/changes?until=noon", http.StatusBadRequest, "Invalid until"},
+		{"diff", "/changes/2/diff", http.StatusOK, "-<p>Build 41</p>\n+<p>Build 42</p>\n"},
+		{"first version", "/changes/1/diff", http.StatusOK, ""},
+		{"missing", "/changes/9/diff", http.StatusNotFound, "Change not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			api.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.want) {
+				t.Errorf("Expected body to contain %q, got %q", tt.want, rr.Body.String())
+			}
+			if strings.Contains(rr.Body.String(), `"content"`) {
+				t.Errorf("Expected no content in the response, got %s", rr.Body.String())
+			}
+		})
+	}
+}
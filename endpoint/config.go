@@ -1,6 +1,11 @@
 package endpoint
 
-import "time"
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 var DOMAIN_CONFIG = []DomainRequest{
 	{
@@ -19,3 +24,211 @@ var DOMAIN_CONFIG = []DomainRequest{
 		},
 	},
 }
+
+// MAINTENANCE_CONFIG lists maintenance windows that are always present, for
+// example a weekly deploy slot. Windows can also be managed through the API.
+var MAINTENANCE_CONFIG = []MaintenanceWindow{}
+
+// HEARTBEAT_CONFIG lists push-based monitors for jobs that cannot be probed.
+// Each one is pinged at /ping/{token}. Set Token, since the API does not
+// return the token of an existing heartbeat.
+var HEARTBEAT_CONFIG = []Heartbeat{}
+
+// SLO_CONFIG defines availability and latency objectives over rolling
+// windows for endpoints matched by URL, domain or label selector.
+var SLO_CONFIG = []SLO{}
+
+// FLAP_CONFIG marks an endpoint as flapping once at least Start of the
+// transitions between its last Window checks changed state, and as stable
+// again once the share falls to Stop or below. A zero Window disables it.
+var FLAP_CONFIG = FlapConfig{Window: 10, Start: 0.5, Stop: 0.25}
+
+// ANOMALY_CONFIG flags checks whose duration lies at least Threshold robust
+// standard deviations above the median of the endpoint's stored history once
+// it holds MinSamples successful checks. Seasonal compares against the latest
+// checks made in the same hour of the week, kept apart from the history. A
+// zero Threshold disables it.
+var ANOMALY_CONFIG = AnomalyConfig{MinSamples: 20, Threshold: 5}
+
+// NOTIFIER_CONFIG is read from the environment so credentials stay out of the
+// source. A notifier is enabled when its credentials are set.
+var NOTIFIER_CONFIG = NotifierConfig{
+	PublicURL: os.Getenv("CRON_PUBLIC_URL"),
+	Slack:     slackConfigFromEnv(),
+	Discord:   discordConfigFromEnv(),
+	Email:     emailConfigFromEnv(),
+	PagerDuty: pagerDutyConfigFromEnv(),
+	Opsgenie:  opsgenieConfigFromEnv(),
+}
+
+// STORAGE_CONFIG selects the storage driver from CRON_STORAGE: bolt (the
+// default), sqlite or memory. The memory driver keeps nothing across restarts.
+var STORAGE_CONFIG = StorageConfig{
+	Driver: os.Getenv("CRON_STORAGE"),
+}
+
+// BACKUP_CONFIG enables GET /admin/backup with CRON_ADMIN_TOKEN and a local
+// snapshot into CRON_SNAPSHOT_DIR every CRON_SNAPSHOT_INTERVAL (default 24h),
+// keeping the newest CRON_SNAPSHOT_KEEP (default 7).
+var BACKUP_CONFIG = backupConfigFromEnv()
+
+// LOCATION tags the results of checks made by this instance. On Fly.io it
+// defaults to the region the machine runs in.
+var LOCATION = locationFromEnv()
+
+// PROBE_CONFIG lists the probe agents allowed to report results, read from
+// CRON_PROBE_TOKENS as comma separated location=token pairs. Every probe
+// checks every endpoint unless it is limited to Domains or a Selector.
+var PROBE_CONFIG = probesFromEnv()
+
+// AGENT_CONFIG is used when running as a probe agent.
+var AGENT_CONFIG = AgentConfig{
+	ServerURL: os.Getenv("CRON_SERVER_URL"),
+	Token:     os.Getenv("CRON_PROBE_TOKEN"),
+}
+
+// ROUTING_CONFIG decides which notifiers receive an alert. Channels are
+// notifier names such as "slack" or "pagerduty". When no routes are defined
+// every alert goes to every notifier.
+var ROUTING_CONFIG = RoutingConfig{}
+
+// EMAIL_DOMAIN_ROUTES overrides the sender and recipients of email alerts for
+// endpoints in a domain.
+var EMAIL_DOMAIN_ROUTES = map[string]EmailRoute{}
+
+func slackConfigFromEnv() *SlackConfig {
+	if os.Getenv("CRON_SLACK_TOKEN") == "" {
+		return nil
+	}
+	return &SlackConfig{
+		Token:   os.Getenv("CRON_SLACK_TOKEN"),
+		Channel: os.Getenv("CRON_SLACK_CHANNEL"),
+		BaseURL: os.Getenv("CRON_SLACK_BASE_URL"),
+	}
+}
+
+func discordConfigFromEnv() *DiscordConfig {
+	if os.Getenv("CRON_DISCORD_WEBHOOK") == "" {
+		return nil
+	}
+	return &DiscordConfig{
+		WebhookURL: os.Getenv("CRON_DISCORD_WEBHOOK"),
+	}
+}
+
+func emailConfigFromEnv() *EmailConfig {
+	if os.Getenv("CRON_SMTP_HOST") == "" {
+		return nil
+	}
+
+	port, _ := strconv.Atoi(os.Getenv("CRON_SMTP_PORT"))
+	digest, _ := time.ParseDuration(os.Getenv("CRON_SMTP_DIGEST"))
+
+	var to []string
+	for _, address := range strings.Split(os.Getenv("CRON_SMTP_TO"), ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			to = append(to, address)
+		}
+	}
+
+	return &EmailConfig{
+		Host:       os.Getenv("CRON_SMTP_HOST"),
+		Port:       port,
+		Username:   os.Getenv("CRON_SMTP_USERNAME"),
+		Password:   os.Getenv("CRON_SMTP_PASSWORD"),
+		From:       os.Getenv("CRON_SMTP_FROM"),
+		To:         to,
+		Domains:    EMAIL_DOMAIN_ROUTES,
+		Digest:     digest,
+		RequireTLS: os.Getenv("CRON_SMTP_REQUIRE_TLS") == "true",
+	}
+}
+
+func pagerDutyConfigFromEnv() *PagerDutyConfig {
+	if os.Getenv("CRON_PAGERDUTY_ROUTING_KEY") == "" {
+		return nil
+	}
+	return &PagerDutyConfig{
+		RoutingKey: os.Getenv("CRON_PAGERDUTY_ROUTING_KEY"),
+		BaseURL:    os.Getenv("CRON_PAGERDUTY_BASE_URL"),
+	}
+}
+
+func opsgenieConfigFromEnv() *OpsgenieConfig {
+	if os.Getenv("CRON_OPSGENIE_API_KEY") == "" {
+		return nil
+	}
+	return &OpsgenieConfig{
+		APIKey:   os.Getenv("CRON_OPSGENIE_API_KEY"),
+		BaseURL:  os.Getenv("CRON_OPSGENIE_BASE_URL"),
+		Priority: os.Getenv("CRON_OPSGENIE_PRIORITY"),
+	}
+}
+
+func backupConfigFromEnv() BackupConfig {
+	config := BackupConfig{
+		AdminToken:       os.Getenv("CRON_ADMIN_TOKEN"),
+		SnapshotDir:      os.Getenv("CRON_SNAPSHOT_DIR"),
+		SnapshotInterval: 24 * time.Hour,
+		SnapshotKeep:     7,
+	}
+	if interval := os.Getenv("CRON_SNAPSHOT_INTERVAL"); interval != "" {
+		config.SnapshotInterval, _ = time.ParseDuration(interval)
+	}
+	if keep := os.Getenv("CRON_SNAPSHOT_KEEP"); keep != "" {
+		config.SnapshotKeep, _ = strconv.Atoi(keep)
+	}
+	return config
+}
+
+func locationFromEnv() string {
+	if location := os.Getenv("CRON_LOCATION"); location != "" {
+		return location
+	}
+	return os.Getenv("FLY_REGION")
+}
+
+func probesFromEnv() []Probe {
+	var probes []Probe
+	for _, pair := range strings.Split(os.Getenv("CRON_PROBE_TOKENS"), ",") {
+		location, token, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok {
+			probes = append(probes, Probe{Location: location, Token: token})
+		}
+	}
+	return probes
+}
+
+// Notifiers builds the notifiers enabled in the configuration.
+func (c NotifierConfig) Notifiers() []Notifier {
+	var notifiers []Notifier
+	if c.Slack != nil {
+		notifiers = append(notifiers, NewSlackNotifier(*c.Slack))
+	}
+	if c.Discord != nil {
+		notifiers = append(notifiers, NewDiscordNotifier(*c.Discord))
+	}
+	if c.Email != nil {
+		notifiers = append(notifiers, NewEmailNotifier(*c.Email))
+	}
+	if c.PagerDuty != nil {
+		notifiers = append(notifiers, NewPagerDutyNotifier(*c.PagerDuty))
+	}
+	if c.Opsgenie != nil {
+		notifiers = append(notifiers, NewOpsgenieNotifier(*c.Opsgenie))
+	}
+	return notifiers
+}
+
+// ConfiguredEndpoints flattens the domain configuration into the endpoints to
+// check, recording on each endpoint the domain it was configured under.
+func ConfiguredEndpoints(domains []DomainRequest) []EndpointRequest {
+	var endpoints []EndpointRequest
+	for _, domain := range domains {
+		for _, endpoint := range domain.Endpoints {
+			endpoint.Domain = domain.Domain
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
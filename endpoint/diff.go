@@ -0,0 +1,201 @@
+package endpoint
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// diffContext is the number of unchanged lines shown around changes.
+	diffContext = 3
+
+	// maxDiffEdits bounds the work spent finding the shortest diff. Texts
+	// that differ more are diffed as one replaced block.
+	maxDiffEdits = 2000
+)
+
+type diffLine struct {
+	op   byte // ' ', '-' or '+'
+	text string
+}
+
+// unifiedDiff returns the changes from one text to another in unified
+// format, or the empty string when they have the same lines.
+func unifiedDiff(from, to, fromLabel, toLabel string) string {
+	lines := diffLines(splitLines(from), splitLines(to))
+
+	var buf strings.Builder
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+
+		// A hunk runs until the unchanged lines between two changes are
+		// too many to be shared as context.
+		end := i
+		for j := i + 1; j < len(lines) && j-end <= 2*diffContext+1; j++ {
+			if lines[j].op != ' ' {
+				end = j
+			}
+		}
+		start := max(i-diffContext, 0)
+		stop := min(end+diffContext+1, len(lines))
+
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "--- %s\n+++ %s\n", fromLabel, toLabel)
+		}
+		fromStart, toStart := linePosition(lines[:start])
+		fromCount, toCount := linePosition(lines[start:stop])
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(fromStart, fromCount), hunkRange(toStart, toCount))
+		for _, line := range lines[start:stop] {
+			buf.WriteByte(line.op)
+			buf.WriteString(line.text)
+			buf.WriteByte('\n')
+		}
+		i = stop
+	}
+	return buf.String()
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// linePosition counts the lines of each text in the diff lines.
+func linePosition(lines []diffLine) (from, to int) {
+	for _, line := range lines {
+		if line.op != '+' {
+			from++
+		}
+		if line.op != '-' {
+			to++
+		}
+	}
+	return from, to
+}
+
+// hunkRange formats the lines of a hunk after skipping the given number of
+// lines. An empty range names the line before it.
+func hunkRange(skipped, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", skipped)
+	}
+	return fmt.Sprintf("%d,%d", skipped+1, count)
+}
+
+// diffLines returns the shortest edit from a to b, as the lines of both in
+// order. Lines the texts share at their start and end are kept as they are
+// before searching for the edit of the rest.
+func diffLines(a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var lines []diffLine
+	for _, text := range a[:prefix] {
+		lines = append(lines, diffLine{' ', text})
+	}
+	middle, ok := myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	if !ok {
+		middle = nil
+		for _, text := range a[prefix : len(a)-suffix] {
+			middle = append(middle, diffLine{'-', text})
+		}
+		for _, text := range b[prefix : len(b)-suffix] {
+			middle = append(middle, diffLine{'+', text})
+		}
+	}
+	lines = append(lines, middle...)
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', text})
+	}
+	return lines
+}
+
+// myersDiff finds the shortest edit from a to b with Myers' algorithm. It
+// gives up when the edit needs more than maxDiffEdits insertions and
+// deletions.
+func myersDiff(a, b []string) ([]diffLine, bool) {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+
+	// trace[d] holds the furthest x reached on each diagonal k in [-d, d]
+	// after d edits.
+	var trace [][]int
+	for d := 0; d <= maxDiffEdits; d++ {
+		done := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			done = done || (x >= n && y >= m)
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+
+		if done {
+			return backtrackDiff(a, b, trace), true
+		}
+	}
+	return nil, false
+}
+
+// backtrackDiff walks the trace of myersDiff back from the end of both
+// texts to recover the edit.
+func backtrackDiff(a, b []string, trace [][]int) []diffLine {
+	x, y := len(a), len(b)
+	var reversed []diffLine
+	for d := len(trace) - 1; d > 0; d-- {
+		previous := trace[d-1]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && previous[k-1+d-1] < previous[k+1+d-1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := previous[prevK+d-1]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, diffLine{' ', a[x]})
+		}
+		if prevK == k+1 {
+			reversed = append(reversed, diffLine{'+', b[prevY]})
+		} else {
+			reversed = append(reversed, diffLine{'-', a[prevX]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		reversed = append(reversed, diffLine{' ', a[x]})
+	}
+
+	lines := make([]diffLine, len(reversed))
+	for i, line := range reversed {
+		lines[len(lines)-1-i] = line
+	}
+	return lines
+}
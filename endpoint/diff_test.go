@@ -0,0 +1,117 @@
+package endpoint
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	page := "<html>\n<head>\n<title>Plug</title>\n</head>\n<body>\n<h1>Welcome</h1>\n<p>Build 41</p>\n</body>\n</html>\n"
+
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want string
+	}{
+		{"same", page, page, ""},
+		{
+			name: "changed line",
+			from: page,
+			to:   strings.Replace(page, "Build 41", "Build 42", 1),
+			want: "@@ -4,6 +4,6 @@\n" +
+				" </head>\n <body>\n <h1>Welcome</h1>\n-<p>Build 41</p>\n+<p>Build 42</p>\n </body>\n </html>\n",
+		},
+		{
+			name: "added line",
+			from: "a\nb\n",
+			to:   "a\nb\nc\n",
+			want: "@@ -1,2 +1,3 @@\n a\n b\n+c\n",
+		},
+		{
+			name: "from nothing",
+			from: "",
+			to:   "a\n",
+			want: "@@ -0,0 +1,1 @@\n+a\n",
+		},
+		{
+			name: "distant changes",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			to:   "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			want: "@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n" +
+				"@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+		{
+			name: "nearby changes",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			to:   "one\n2\n3\n4\n5\n6\n7\neight\n",
+			want: "@@ -1,8 +1,8 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unifiedDiff(tt.from, tt.to, "old", "new")
+			if tt.want != "" {
+				tt.want = "--- old\n+++ new\n" + tt.want
+			}
+			if got != tt.want {
+				t.Errorf("Expected diff:\n%s\ngot:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"abcabba", "cbabac"},
+		{"", "abc"},
+		{"abc", ""},
+		{"xaxbxc", "abc"},
+	}
+
+	for _, tt := range tests {
+		a, b := strings.Split(tt.a, ""), strings.Split(tt.b, "")
+		lines := diffLines(a, b)
+
+		// The lines must rebuild both texts.
+		var from, to []string
+		for _, line := range lines {
+			if line.op != '+' {
+				from = append(from, line.text)
+			}
+			if line.op != '-' {
+				to = append(to, line.text)
+			}
+		}
+		if strings.Join(from, "") != tt.a || strings.Join(to, "") != tt.b {
+			t.Errorf("diffLines(%q, %q) rebuilds %q and %q", tt.a, tt.b, strings.Join(from, ""), strings.Join(to, ""))
+		}
+	}
+
+	// The example from Myers' paper has a shortest edit of 5.
+	edits := 0
+	for _, line := range diffLines(strings.Split("abcabba", ""), strings.Split("cbabac", "")) {
+		if line.op != ' ' {
+			edits++
+		}
+	}
+	if edits != 5 {
+		t.Errorf("Expected 5 edits, got %d", edits)
+	}
+
+	var a, b []string
+	for i := 0; i < maxDiffEdits; i++ {
+		a = append(a, fmt.Sprintf("a%d", i))
+		b = append(b, fmt.Sprintf("b%d", i))
+	}
+	if _, ok := myersDiff(a, b); ok {
+		t.Errorf("Expected the search to give up beyond %d edits", maxDiffEdits)
+	}
+	if lines := diffLines(a, b); len(lines) != 2*maxDiffEdits || lines[0].op != '-' || lines[len(lines)-1].op != '+' {
+		t.Errorf("Expected the texts to be diffed as one replaced block")
+	}
+}
@@ -1,6 +1,23 @@
 package endpoint
 
-import "fmt"
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+)
+
+const (
+	CategoryRequest    = "request"
+	CategoryTimeout    = "timeout"
+	CategoryDNS        = "dns"
+	CategoryTLS        = "tls"
+	CategoryConnection = "connection"
+	CategoryStatus     = "http_status"
+	CategoryContent    = "content"
+)
 
 func (e *EndpointError) Error() string {
 	return fmt.Sprintf("%s (got: %d, want: %d)", e.Message, e.StatusCode, e.Expected)
@@ -13,3 +30,29 @@ func NewStatusError(got, want int) *EndpointError {
 		Message:    "unexpected status code",
 	}
 }
+
+// classifyRequestError maps an error returned by the HTTP client onto the
+// failure category recorded with the check result.
+func classifyRequestError(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return CategoryTimeout
+	case errors.As(err, &dnsErr):
+		return CategoryDNS
+	case errors.As(err, &certErr), errors.As(err, &recordErr), errors.As(err, &authorityErr),
+		errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return CategoryTLS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return CategoryTimeout
+	default:
+		return CategoryConnection
+	}
+}
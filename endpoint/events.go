@@ -0,0 +1,119 @@
+package endpoint
+
+const (
+	EventResult   = "result"
+	EventState    = "state"
+	EventIncident = "incident"
+	EventFlapping = "flapping"
+
+	StateUnknown     = "unknown"
+	StateUp          = "up"
+	StateDown        = "down"
+	StateDegraded    = "degraded"
+	StateMaintenance = "maintenance"
+
+	defaultEventBacklog     = 256
+	defaultSubscriberBuffer = 64
+)
+
+func NewBroadcaster(backlogSize, bufferSize int) *Broadcaster {
+	if backlogSize <= 0 {
+		backlogSize = defaultEventBacklog
+	}
+	if bufferSize <= 0 {
+		bufferSize = defaultSubscriberBuffer
+	}
+
+	return &Broadcaster{
+		backlogSize: backlogSize,
+		bufferSize:  bufferSize,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns the next event ID and fans the event out to every matching
+// subscriber. Subscribers whose buffer is full are dropped instead of blocking
+// the publisher, which is always a running check.
+func (b *Broadcaster) Publish(event Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	event.ID = b.nextID
+
+	b.backlog = append(b.backlog, event)
+	if len(b.backlog) > b.backlogSize {
+		b.backlog = b.backlog[len(b.backlog)-b.backlogSize:]
+	}
+
+	for sub := range b.subscribers {
+		if !sub.filter.Matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+
+	return event
+}
+
+// Subscribe registers a new subscriber and returns, atomically with the
+// registration, every backlog event newer than lastEventID that matches the
+// filter. A lastEventID of zero skips the replay.
+func (b *Broadcaster) Subscribe(filter EventFilter, lastEventID uint64) (*Subscription, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &Subscription{
+		events: make(chan Event, b.bufferSize),
+		filter: filter,
+	}
+	b.subscribers[sub] = struct{}{}
+
+	var replay []Event
+	if lastEventID > 0 {
+		for _, event := range b.backlog {
+			if event.ID > lastEventID && filter.Matches(event) {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	return sub, replay
+}
+
+func (b *Broadcaster) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+func (b *Broadcaster) SubscriberCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// Events returns the channel events are delivered on. It is closed when the
+// subscriber unsubscribes or is dropped for falling behind.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (f EventFilter) Matches(event Event) bool {
+	if f.URL != "" && event.URL != f.URL {
+		return false
+	}
+	if f.Domain != "" && event.Domain != f.Domain {
+		return false
+	}
+	return f.Selector.Matches(event.Labels)
+}
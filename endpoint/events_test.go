@@ -0,0 +1,170 @@
+package endpoint
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBroadcaster(t *testing.T) {
+	t.Run("fan out with filters", func(t *testing.T) {
+		b := NewBroadcaster(10, 10)
+
+		all, _ := b.Subscribe(EventFilter{}, 0)
+		one, _ := b.Subscribe(EventFilter{URL: "https://a.example.com"}, 0)
+		domain, _ := b.Subscribe(EventFilter{Domain: "b"}, 0)
+
+		b.Publish(Event{Type: EventResult, URL: "https://a.example.com", Domain: "a"})
+		b.Publish(Event{Type: EventResult, URL: "https://b.example.com", Domain: "b"})
+
+		if got := len(all.Events()); got != 2 {
+			t.Errorf("Expected 2 events for unfiltered subscriber, got %d", got)
+		}
+		if got := len(one.Events()); got != 1 {
+			t.Errorf("Expected 1 event for URL subscriber, got %d", got)
+		}
+		if got := len(domain.Events()); got != 1 {
+			t.Errorf("Expected 1 event for domain subscriber, got %d", got)
+		}
+	})
+
+	t.Run("slow subscribers are dropped", func(t *testing.T) {
+		b := NewBroadcaster(10, 1)
+		sub, _ := b.Subscribe(EventFilter{}, 0)
+
+		b.Publish(Event{Type: EventResult, URL: "https://a.example.com"})
+		b.Publish(Event{Type: EventResult, URL: "https://a.example.com"})
+
+		if b.SubscriberCount() != 0 {
+			t.Errorf("Expected slow subscriber to be dropped")
+		}
+
+		<-sub.Events()
+		if _, ok := <-sub.Events(); ok {
+			t.Errorf("Expected dropped subscriber channel to be closed")
+		}
+
+		b.Unsubscribe(sub)
+	})
+
+	t.Run("replay after last event id", func(t *testing.T) {
+		b := NewBroadcaster(3, 10)
+		for i := 0; i < 5; i++ {
+			b.Publish(Event{Type: EventResult, URL: "https://a.example.com"})
+		}
+
+		_, replay := b.Subscribe(EventFilter{}, 3)
+		if len(replay) != 2 {
+			t.Fatalf("Expected 2 replayed events, got %d", len(replay))
+		}
+		if replay[0].ID != 4 || replay[1].ID != 5 {
+			t.Errorf("Expected events 4 and 5, got %d and %d", replay[0].ID, replay[1].ID)
+		}
+
+		_, replay = b.Subscribe(EventFilter{}, 0)
+		if len(replay) != 0 {
+			t.Errorf("Expected no replay without last event id, got %d", len(replay))
+		}
+	})
+}
+
+func TestSchedulerPublishesEvents(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+
+	scheduler := NewScheduler(handler, time.Minute, nil)
+	sub, _ := scheduler.Events().Subscribe(EventFilter{}, 0)
+	defer scheduler.Events().Unsubscribe(sub)
+
+	endpoint := EndpointRequest{URL: "https://test.com", Status: http.StatusOK}
+	results := []error{nil, nil, errors.New("request failed"), nil}
+	for _, err := range results {
+		scheduler.record(EndpointResponse{
+			Endpoint:  endpoint,
+			Status:    http.StatusOK,
+			Error:     err,
+			Timestamp: time.Now(),
+		})
+	}
+
+	var transitions []string
+	var resultCount int
+	for len(sub.Events()) > 0 {
+		event := <-sub.Events()
+		switch event.Type {
+		case EventResult:
+			resultCount++
+		case EventState:
+			change := event.Data.(StateChange)
+			transitions = append(transitions, change.From+"->"+change.To)
+		}
+	}
+
+	if resultCount != len(results) {
+		t.Errorf("Expected %d result events, got %d", len(results), resultCount)
+	}
+
+	want := "unknown->up,up->down,down->up"
+	if got := strings.Join(transitions, ","); got != want {
+		t.Errorf("Expected transitions %s, got %s", want, got)
+	}
+}
+
+func TestEventsStream(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+
+	scheduler := NewScheduler(handler, time.Minute, nil)
+	server := httptest.NewServer(NewAPI(handler, scheduler))
+	defer server.Close()
+
+	first := scheduler.Events().Publish(Event{Type: EventResult, URL: "https://a.example.com"})
+	scheduler.Events().Publish(Event{Type: EventResult, URL: "https://b.example.com"})
+	scheduler.Events().Publish(Event{Type: EventState, URL: "https://a.example.com"})
+
+	req, err := http.NewRequest("GET", server.URL+"/events?url=https://a.example.com", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Last-Event-ID", "1")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect to stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %s", ct)
+	}
+
+	scheduler.Events().Publish(Event{Type: EventResult, URL: "https://a.example.com"})
+
+	reader := bufio.NewReader(resp.Body)
+	var events []Event
+	for len(events) < 2 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read stream: %v", err)
+		}
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var event Event
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			t.Fatalf("Failed to unmarshal event: %v", err)
+		}
+		events = append(events, event)
+	}
+
+	if events[0].ID != first.ID+2 || events[0].Type != EventState {
+		t.Errorf("Expected replayed state event %d, got %s event %d", first.ID+2, events[0].Type, events[0].ID)
+	}
+	if events[1].ID != first.ID+3 || events[1].URL != "https://a.example.com" {
+		t.Errorf("Expected live event %d, got %d for %s", first.ID+3, events[1].ID, events[1].URL)
+	}
+}
@@ -0,0 +1,430 @@
+package endpoint
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ExportCSV       = "csv"
+	ExportJSONLines = "jsonl"
+)
+
+var exportFormats = []string{ExportCSV, ExportJSONLines}
+
+// importBatchSize is the number of imported checks stored per transaction.
+const importBatchSize = 1000
+
+// exportColumns is the header of CSV exports. Imports accept the columns in
+// any order and only require url and timestamp.
+var exportColumns = []string{
+	"url", "domain", "location", "timestamp", "method", "status", "expected",
+	"up", "duration_ms", "error", "category", "degraded", "maintenance",
+}
+
+// ExportFormat returns the format of a file by its extension, or the empty
+// string when it is not known.
+func ExportFormat(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".csv"):
+		return ExportCSV
+	case strings.HasSuffix(path, ".jsonl"), strings.HasSuffix(path, ".ndjson"):
+		return ExportJSONLines
+	}
+	return ""
+}
+
+func validateExportFormat(format string) error {
+	if !contains(exportFormats, format) {
+		return fmt.Errorf("unknown format %q, expected one of %v", format, exportFormats)
+	}
+	return nil
+}
+
+// Export writes the stored checks matching the filter to w, oldest first
+// per endpoint. Only one endpoint's history is held in memory at a time. It
+// returns the number of checks written.
+func (h *EndpointHandler) Export(w io.Writer, format string, filter ExportFilter) (int, error) {
+	if err := validateExportFormat(format); err != nil {
+		return 0, err
+	}
+
+	endpoints, err := h.ListEndpoints(filter.Selector)
+	if err != nil {
+		return 0, err
+	}
+
+	var encode func(ExportRecord) error
+	var flush func() error
+	switch format {
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(exportColumns); err != nil {
+			return 0, err
+		}
+		encode = func(record ExportRecord) error { return cw.Write(record.csvRow()) }
+		flush = func() error { cw.Flush(); return cw.Error() }
+	case ExportJSONLines:
+		bw := bufio.NewWriter(w)
+		encoder := json.NewEncoder(bw)
+		encode = func(record ExportRecord) error { return encoder.Encode(record) }
+		flush = bw.Flush
+	}
+
+	count := 0
+	for _, endpoint := range endpoints {
+		if filter.Domain != "" && endpoint.Domain != filter.Domain {
+			continue
+		}
+		if len(filter.URLs) > 0 && !contains(filter.URLs, endpoint.URL) {
+			continue
+		}
+
+		results, err := h.store.Results(endpoint.URL, filter.Since, filter.Until)
+		if err != nil {
+			return count, err
+		}
+		for _, result := range results {
+			if err := encode(newExportRecord(result, endpoint.Domain)); err != nil {
+				return count, fmt.Errorf("failed to write export: %w", err)
+			}
+			count++
+		}
+		if err := flush(); err != nil {
+			return count, fmt.Errorf("failed to write export: %w", err)
+		}
+	}
+	return count, nil
+}
+
+// Import stores the checks read from r, skipping any with the URL and
+// timestamp of a check that is already stored. Like every check, imported
+// ones count towards the history size of their endpoint and location, so
+// the result counts the ones older than the kept history as dropped, and
+// importing them again drops them again. Checks before an invalid line stay
+// imported; importing the file again after fixing it skips them. An
+// endpoint without metadata is registered in the domain of its first
+// imported check that names one, so it shows up in domain views.
+func (h *EndpointHandler) Import(r io.Reader, format string) (ImportResult, error) {
+	var result ImportResult
+	if err := validateExportFormat(format); err != nil {
+		return result, err
+	}
+
+	var next func() (ExportRecord, error)
+	switch format {
+	case ExportCSV:
+		cr := csv.NewReader(r)
+		header, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to read header: %w", err)
+		}
+		columns, err := importColumns(header)
+		if err != nil {
+			return result, err
+		}
+		next = func() (ExportRecord, error) {
+			row, err := cr.Read()
+			if err != nil {
+				return ExportRecord{}, err
+			}
+			return parseCSVRecord(columns, row)
+		}
+	case ExportJSONLines:
+		decoder := json.NewDecoder(r)
+		next = func() (ExportRecord, error) {
+			record := ExportRecord{Up: true}
+			err := decoder.Decode(&record)
+			return record, err
+		}
+	}
+
+	// The stored checks per URL, loaded as URLs first appear. Accepted
+	// checks are stored in batches, with the metadata of endpoints that have
+	// none, and counted once their batch is stored.
+	histories := make(map[string]*importedHistory)
+	var batch []EndpointResponseStored
+	var metas []EndpointMeta
+	var imported, dropped int
+	flush := func() error {
+		if len(batch) > 0 {
+			if err := h.store.AppendResults(batch, h.histSize); err != nil {
+				return fmt.Errorf("failed to store records: %w", err)
+			}
+		}
+		if len(metas) > 0 {
+			if err := h.store.PutMeta(metas); err != nil {
+				return fmt.Errorf("failed to register endpoints: %w", err)
+			}
+		}
+		result.Imported += imported
+		result.Dropped += dropped
+		batch, metas, imported, dropped = nil, nil, 0, 0
+		return nil
+	}
+
+	for line := 1; ; line++ {
+		record, err := next()
+		if errors.Is(err, io.EOF) {
+			return result, flush()
+		}
+		if err == nil {
+			err = record.validate()
+		}
+		if err != nil {
+			if err := flush(); err != nil {
+				return result, err
+			}
+			return result, fmt.Errorf("record %d: %w", line, err)
+		}
+
+		history, ok := histories[record.URL]
+		if !ok {
+			stored, err := h.store.Results(record.URL, time.Time{}, time.Time{})
+			if err != nil {
+				return result, err
+			}
+			_, registered, err := h.store.Meta(record.URL)
+			if err != nil {
+				return result, err
+			}
+			history = newImportedHistory(stored, registered)
+			histories[record.URL] = history
+		}
+		timestamp := record.Timestamp.UnixNano()
+		if history.timestamps[timestamp] {
+			result.Duplicates++
+			continue
+		}
+		if history.beyondLimit(record.Location, timestamp, h.histSize) {
+			result.Dropped++
+			continue
+		}
+
+		batch = append(batch, record.stored())
+		if history.add(record.Location, timestamp, h.histSize) {
+			dropped++
+		} else {
+			imported++
+		}
+		if !history.registered && record.Domain != "" {
+			metas = append(metas, EndpointMeta{URL: record.URL, Domain: record.Domain})
+			history.registered = true
+		}
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+}
+
+// importedHistory follows the checks of an endpoint kept while importing, to
+// tell which imported ones the history size drops.
+type importedHistory struct {
+	// timestamps holds every check stored or imported, kept or not.
+	timestamps map[int64]bool
+	// kept holds the checks each location keeps, oldest first.
+	kept map[string][]importedCheck
+	// registered is set once the endpoint has metadata.
+	registered bool
+}
+
+type importedCheck struct {
+	timestamp int64
+	imported  bool
+}
+
+func newImportedHistory(stored []EndpointResponseStored, registered bool) *importedHistory {
+	history := &importedHistory{
+		timestamps: make(map[int64]bool, len(stored)),
+		kept:       make(map[string][]importedCheck),
+		registered: registered,
+	}
+	for _, result := range stored {
+		timestamp := result.Timestamp.UnixNano()
+		history.timestamps[timestamp] = true
+		history.kept[result.Location] = append(history.kept[result.Location], importedCheck{timestamp: timestamp})
+	}
+	return history
+}
+
+// beyondLimit reports whether a check is older than every check its location
+// keeps when it already keeps as many as the limit.
+func (h *importedHistory) beyondLimit(location string, timestamp int64, limit int) bool {
+	kept := h.kept[location]
+	return limit > 0 && len(kept) >= limit && timestamp < kept[0].timestamp
+}
+
+// add records an imported check in timestamp order, as AppendResults stores
+// it, and reports whether that pushed out an earlier imported check.
+func (h *importedHistory) add(location string, timestamp int64, limit int) bool {
+	h.timestamps[timestamp] = true
+
+	kept := h.kept[location]
+	i := len(kept)
+	for i > 0 && kept[i-1].timestamp > timestamp {
+		i--
+	}
+	kept = append(kept[:i], append([]importedCheck{{timestamp: timestamp, imported: true}}, kept[i:]...)...)
+
+	dropped := false
+	if limit > 0 && len(kept) > limit {
+		dropped = kept[0].imported
+		kept = kept[1:]
+	}
+	h.kept[location] = kept
+	return dropped
+}
+
+func newExportRecord(result EndpointResponseStored, domain string) ExportRecord {
+	return ExportRecord{
+		URL:         result.URL,
+		Domain:      domain,
+		Location:    result.Location,
+		Timestamp:   result.Timestamp.UTC(),
+		Method:      result.Method,
+		Status:      result.Status,
+		Expected:    result.Expected,
+		Up:          result.Error == "",
+		DurationMS:  float64(result.Duration) / float64(time.Millisecond),
+		Error:       result.Error,
+		Category:    result.Category,
+		Degraded:    result.Degraded,
+		Maintenance: result.Maintenance,
+	}
+}
+
+// stored converts an imported record. A check that is not up is stored with
+// an error, since that is what marks it as failed.
+func (r ExportRecord) stored() EndpointResponseStored {
+	stored := EndpointResponseStored{
+		URL:         r.URL,
+		Method:      r.Method,
+		Status:      r.Status,
+		Expected:    r.Expected,
+		Error:       r.Error,
+		Category:    r.Category,
+		Timestamp:   r.Timestamp,
+		Duration:    time.Duration(math.Round(r.DurationMS * float64(time.Millisecond))),
+		Degraded:    r.Degraded,
+		Maintenance: r.Maintenance,
+		Location:    r.Location,
+	}
+	if !r.Up && stored.Error == "" {
+		stored.Error = "down"
+	}
+	return stored
+}
+
+func (r ExportRecord) validate() error {
+	if r.URL == "" {
+		return errors.New("url is required")
+	}
+	if r.Timestamp.IsZero() {
+		return errors.New("timestamp is required")
+	}
+	if r.DurationMS < 0 {
+		return errors.New("duration must not be negative")
+	}
+	return nil
+}
+
+func (r ExportRecord) csvRow() []string {
+	return []string{
+		r.URL,
+		r.Domain,
+		r.Location,
+		r.Timestamp.Format(time.RFC3339Nano),
+		r.Method,
+		strconv.Itoa(r.Status),
+		strconv.Itoa(r.Expected),
+		strconv.FormatBool(r.Up),
+		strconv.FormatFloat(r.DurationMS, 'f', -1, 64),
+		r.Error,
+		r.Category,
+		r.Degraded,
+		strconv.FormatBool(r.Maintenance),
+	}
+}
+
+// importColumns maps the known columns of a CSV header to their index.
+// Unknown columns are ignored.
+func importColumns(header []string) (map[string]int, error) {
+	columns := make(map[string]int)
+	for i, name := range header {
+		// Spreadsheets save CSV with a byte order mark.
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if contains(exportColumns, name) {
+			columns[name] = i
+		}
+	}
+	for _, required := range []string{"url", "timestamp"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("the header has no %s column", required)
+		}
+	}
+	return columns, nil
+}
+
+func parseCSVRecord(columns map[string]int, row []string) (ExportRecord, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	record := ExportRecord{
+		URL:      field("url"),
+		Domain:   field("domain"),
+		Location: field("location"),
+		Method:   field("method"),
+		Error:    field("error"),
+		Category: field("category"),
+		Degraded: field("degraded"),
+		Up:       true,
+	}
+
+	var err error
+	if record.Timestamp, err = time.Parse(time.RFC3339, field("timestamp")); err != nil {
+		return record, fmt.Errorf("invalid timestamp: %w", err)
+	}
+	if value := field("status"); value != "" {
+		if record.Status, err = strconv.Atoi(value); err != nil {
+			return record, fmt.Errorf("invalid status: %w", err)
+		}
+	}
+	if value := field("expected"); value != "" {
+		if record.Expected, err = strconv.Atoi(value); err != nil {
+			return record, fmt.Errorf("invalid expected status: %w", err)
+		}
+	}
+	if value := field("up"); value != "" {
+		if record.Up, err = strconv.ParseBool(value); err != nil {
+			return record, fmt.Errorf("invalid up: %w", err)
+		}
+	}
+	if value := field("duration_ms"); value != "" {
+		if record.DurationMS, err = strconv.ParseFloat(value, 64); err != nil {
+			return record, fmt.Errorf("invalid duration: %w", err)
+		}
+	}
+	if value := field("maintenance"); value != "" {
+		if record.Maintenance, err = strconv.ParseBool(value); err != nil {
+			return record, fmt.Errorf("invalid maintenance: %w", err)
+		}
+	}
+	return record, nil
+}
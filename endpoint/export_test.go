@@ -0,0 +1,332 @@
+package endpoint
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newExportHandler returns a handler holding two checks of an endpoint in
+// the "plug" domain and one of an endpoint in "docs".
+func newExportHandler(t *testing.T) (*EndpointHandler, time.Time) {
+	t.Helper()
+
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+	if err := handler.RegisterEndpoints([]EndpointRequest{
+		{URL: "https://onplug.io", Domain: "plug", Labels: map[string]string{"env": "prod"}},
+		{URL: "https://docs.onplug.io", Domain: "docs"},
+	}); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	responses := []EndpointResponse{
+		{Endpoint: EndpointRequest{URL: "https://onplug.io", Method: "GET", Status: 200}, Status: 200, Timestamp: start, Duration: 120500 * time.Microsecond, Location: "dfw"},
+		{Endpoint: EndpointRequest{URL: "https://onplug.io", Method: "GET", Status: 200}, Status: 502, Timestamp: start.Add(time.Hour), Duration: 80 * time.Millisecond, Error: errors.New("received error status code: 502"), Category: "http_status"},
+		{Endpoint: EndpointRequest{URL: "https://docs.onplug.io", Method: "GET", Status: 200}, Status: 200, Timestamp: start.Add(2 * time.Hour), Duration: 40 * time.Millisecond},
+	}
+	for _, response := range responses {
+		if err := handler.storeResponse(response); err != nil {
+			t.Fatalf("Failed to store response: %v", err)
+		}
+	}
+	return handler, start
+}
+
+func TestExport(t *testing.T) {
+	handler, start := newExportHandler(t)
+	prod, _ := ParseSelector("env=prod")
+
+	tests := []struct {
+		name   string
+		filter ExportFilter
+		want   int
+	}{
+		{"everything", ExportFilter{}, 3},
+		{"url", ExportFilter{URLs: []string{"https://docs.onplug.io"}}, 1},
+		{"domain", ExportFilter{Domain: "plug"}, 2},
+		{"selector", ExportFilter{Selector: prod}, 2},
+		{"time range", ExportFilter{Since: start.Add(30 * time.Minute), Until: start.Add(90 * time.Minute)}, 1},
+	}
+
+	for _, tt := range tests {
+		for _, format := range exportFormats {
+			t.Run(tt.name+" "+format, func(t *testing.T) {
+				var buf bytes.Buffer
+				count, err := handler.Export(&buf, format, tt.filter)
+				if err != nil {
+					t.Fatalf("Export() error = %v", err)
+				}
+				if count != tt.want {
+					t.Errorf("Expected %d checks, got %d", tt.want, count)
+				}
+
+				lines := strings.Count(buf.String(), "\n")
+				if format == ExportCSV {
+					lines--
+				}
+				if lines != tt.want {
+					t.Errorf("Expected %d lines, got %d:\n%s", tt.want, lines, buf.String())
+				}
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := handler.Export(&buf, ExportCSV, ExportFilter{URLs: []string{"https://onplug.io"}}); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse export: %v", err)
+	}
+	want := []string{"https://onplug.io", "plug", "dfw", "2024-03-01T12:00:00Z", "GET", "200", "200", "true", "120.5", "", "", "", "false"}
+	if strings.Join(rows[1], ",") != strings.Join(want, ",") {
+		t.Errorf("Expected row %v, got %v", want, rows[1])
+	}
+	if rows[2][7] != "false" || rows[2][9] != "received error status code: 502" {
+		t.Errorf("Expected the failed check to be exported as down, got %v", rows[2])
+	}
+
+	if _, err := handler.Export(&buf, "parquet", ExportFilter{}); err == nil {
+		t.Errorf("Expected an unknown format to be refused")
+	}
+}
+
+func TestImport(t *testing.T) {
+	for _, format := range exportFormats {
+		t.Run("round trip "+format, func(t *testing.T) {
+			source, _ := newExportHandler(t)
+			var buf bytes.Buffer
+			if _, err := source.Export(&buf, format, ExportFilter{}); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+			data := buf.String()
+
+			target := NewStoreHandler(NewMemoryStore(), 10)
+			result, err := target.Import(strings.NewReader(data), format)
+			if err != nil || result.Imported != 3 || result.Duplicates != 0 {
+				t.Fatalf("Expected 3 checks to be imported, got %+v, %v", result, err)
+			}
+			result, err = target.Import(strings.NewReader(data), format)
+			if err != nil || result.Imported != 0 || result.Duplicates != 3 {
+				t.Errorf("Expected a second import to skip every check, got %+v, %v", result, err)
+			}
+
+			if urls, _ := target.GetDomainEndpoints("plug"); len(urls) != 1 || urls[0] != "https://onplug.io" {
+				t.Errorf("Expected the imported endpoint in its domain, got %v", urls)
+			}
+
+			want, _ := source.GetEndpointHistory("https://onplug.io")
+			got, _ := target.GetEndpointHistory("https://onplug.io")
+			if len(got) != len(want) {
+				t.Fatalf("Expected %d checks, got %d", len(want), len(got))
+			}
+			for i := range want {
+				if !got[i].Timestamp.Equal(want[i].Timestamp) || got[i].Duration != want[i].Duration ||
+					got[i].Status != want[i].Status || got[i].Location != want[i].Location ||
+					(got[i].Error == nil) != (want[i].Error == nil) {
+					t.Errorf("Check %d: expected %+v, got %+v", i, want[i], got[i])
+				}
+			}
+		})
+	}
+
+	tests := []struct {
+		name       string
+		format     string
+		input      string
+		wantStored int
+		wantErr    string
+	}{
+		{
+			name:   "columns from another monitor",
+			format: ExportCSV,
+			input: "\ufeffTimestamp,URL,Up,Response Time,duration_ms\n" +
+				"2024-03-01T12:00:00Z,https://example.com,true,ignored,100\n" +
+				"2024-03-01T12:05:00+01:00,https://example.com,false,ignored,\n",
+			wantStored: 2,
+		},
+		{
+			name:   "duplicates within the file",
+			format: ExportJSONLines,
+			input: `{"url":"https://example.com","timestamp":"2024-03-01T12:00:00Z"}
+{"url":"https://example.com","timestamp":"2024-03-01T13:00:00+01:00","up":false}
+`,
+			wantStored: 1,
+		},
+		{
+			name:       "missing column",
+			format:     ExportCSV,
+			input:      "url,status\nhttps://example.com,200\n",
+			wantStored: 0,
+			wantErr:    "no timestamp column",
+		},
+		{
+			name:   "invalid record",
+			format: ExportCSV,
+			input: "url,timestamp\n" +
+				"https://example.com,2024-03-01T12:00:00Z\n" +
+				"https://example.com,yesterday\n",
+			wantStored: 1,
+			wantErr:    "record 2: invalid timestamp",
+		},
+		{
+			name:       "missing url",
+			format:     ExportJSONLines,
+			input:      `{"timestamp":"2024-03-01T12:00:00Z"}`,
+			wantStored: 0,
+			wantErr:    "url is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewStoreHandler(NewMemoryStore(), 10)
+			_, err := handler.Import(strings.NewReader(tt.input), tt.format)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Import() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+
+			history, _ := handler.GetEndpointHistory("https://example.com")
+			if len(history) != tt.wantStored {
+				t.Errorf("Expected %d stored checks, got %d", tt.wantStored, len(history))
+			}
+		})
+	}
+
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+	if err := handler.RegisterEndpoints([]EndpointRequest{{URL: "https://example.com", Domain: "configured"}}); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
+	handler.Import(strings.NewReader("url,domain,timestamp,up\nhttps://example.com,imported,2024-03-01T12:00:00Z,false\n"), ExportCSV)
+	if history, _ := handler.GetEndpointHistory("https://example.com"); len(history) != 1 || history[0].Error == nil {
+		t.Errorf("Expected a check that was not up to be stored as failed, got %+v", history)
+	}
+	if meta, _, _ := handler.GetEndpointMeta("https://example.com"); meta.Domain != "configured" {
+		t.Errorf("Expected an import to keep the configured domain, got %q", meta.Domain)
+	}
+}
+
+func TestImportBatches(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("url,domain,timestamp\n")
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < importBatchSize*2+1; i++ {
+		fmt.Fprintf(&b, "https://example.com,example,%s\n", start.Add(time.Duration(i)*time.Minute).Format(time.RFC3339))
+	}
+	b.WriteString("https://example.com,example,yesterday\n")
+
+	handler := NewStoreHandler(NewMemoryStore(), importBatchSize)
+	result, err := handler.Import(strings.NewReader(b.String()), ExportCSV)
+	if err == nil {
+		t.Fatalf("Expected the invalid last record to be refused")
+	}
+	if want := (ImportResult{Imported: importBatchSize, Dropped: importBatchSize + 1}); result != want {
+		t.Errorf("Expected %+v, got %+v", want, result)
+	}
+
+	history, _ := handler.GetEndpointHistory("https://example.com")
+	if len(history) != importBatchSize || !history[0].Timestamp.Equal(start.Add(time.Duration(importBatchSize+1)*time.Minute)) {
+		t.Errorf("Expected the newest %d checks before the invalid record, got %d", importBatchSize, len(history))
+	}
+	if urls, _ := handler.GetDomainEndpoints("example"); len(urls) != 1 {
+		t.Errorf("Expected the endpoint to be registered once, got %v", urls)
+	}
+}
+
+func TestExportAPI(t *testing.T) {
+	handler, _ := newExportHandler(t)
+	api := NewAPI(handler, NewScheduler(handler, time.Minute, nil))
+	api.adminToken = "secret"
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       string
+		wantStatus int
+		want       string
+	}{
+		{"csv", "GET", "/export?domain=plug", "", "", http.StatusOK, "url,domain,location,timestamp"},
+		{"jsonl", "GET", "/export?format=jsonl&url=https://docs.onplug.io", "", "", http.StatusOK, `"url":"https://docs.onplug.io"`},
+		{"unknown format", "GET", "/export?format=xml", "", "", http.StatusBadRequest, "unknown format"},
+		{"invalid since", "GET", "/export?since=yesterday", "", "", http.StatusBadRequest, "Invalid since"},
+		{"import without token", "POST", "/admin/import?format=csv", "", "url,timestamp\n", http.StatusUnauthorized, "Unauthorized"},
+		{"import", "POST", "/admin/import?format=jsonl", "secret",
+			`{"url":"https://onplug.io","timestamp":"2024-03-01T12:00:00Z"}` + "\n" +
+				`{"url":"https://onplug.io","timestamp":"2024-03-02T12:00:00Z"}`,
+			http.StatusOK, `{"imported":1,"duplicates":1,"dropped":0}`},
+		{"invalid import", "POST", "/admin/import?format=csv", "secret", "url\nhttps://onplug.io\n", http.StatusBadRequest, "no timestamp column"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			api.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.want) {
+				t.Errorf("Expected body to contain %q, got %q", tt.want, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestImportHistoryLimit(t *testing.T) {
+	var lines []string
+	for i := 0; i < 5; i++ {
+		lines = append(lines, fmt.Sprintf(`{"url":"https://example.com","timestamp":"2024-03-01T12:0%d:00Z"}`, i))
+	}
+	lines = append(lines, `{"url":"https://example.com","location":"ams","timestamp":"2024-03-01T12:00:30Z"}`)
+	reversed := make([]string, len(lines))
+	for i, line := range lines {
+		reversed[len(lines)-1-i] = line
+	}
+
+	tests := []struct {
+		name  string
+		lines []string
+	}{
+		{"oldest first", lines},
+		{"newest first", reversed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewStoreHandler(NewMemoryStore(), 3)
+			input := strings.Join(tt.lines, "\n")
+
+			result, err := handler.Import(strings.NewReader(input), ExportJSONLines)
+			if err != nil || result != (ImportResult{Imported: 4, Dropped: 2}) {
+				t.Fatalf("Expected 4 checks imported and 2 dropped, got %+v, %v", result, err)
+			}
+			history, _ := handler.GetEndpointHistory("https://example.com")
+			if len(history) != 4 || !history[1].Timestamp.Equal(time.Date(2024, 3, 1, 12, 2, 0, 0, time.UTC)) {
+				t.Errorf("Expected the newest 3 checks and the one from ams, got %+v", history)
+			}
+
+			// The dropped checks are not stored by a second import either.
+			result, err = handler.Import(strings.NewReader(input), ExportJSONLines)
+			if err != nil || result != (ImportResult{Duplicates: 4, Dropped: 2}) {
+				t.Errorf("Expected a second import to skip every check, got %+v, %v", result, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package endpoint
+
+// Flapping decides whether the endpoint is flapping as of the latest entry
+// in its history. Entering and leaving use different thresholds so an
+// endpoint hovering around one of them does not toggle on every check.
+// Checks during maintenance are ignored and keep the previous decision.
+func (c FlapConfig) Flapping(history []EndpointResponse) bool {
+	if len(history) == 0 {
+		return false
+	}
+
+	var was bool
+	for i := len(history) - 2; i >= 0; i-- {
+		if !history[i].Maintenance {
+			was = history[i].Flapping
+			break
+		}
+	}
+	if history[len(history)-1].Maintenance {
+		return was
+	}
+
+	rate, ok := c.rate(history)
+	if !ok {
+		return false
+	}
+	if was {
+		return rate > c.Stop
+	}
+	return rate >= c.Start
+}
+
+// rate is the share of consecutive pairs among the last Window checks outside
+// maintenance whose state differs. It is only known once Window checks exist.
+func (c FlapConfig) rate(history []EndpointResponse) (float64, bool) {
+	if c.Window < 2 {
+		return 0, false
+	}
+
+	var checks []bool
+	for i := len(history) - 1; i >= 0 && len(checks) < c.Window; i-- {
+		if !history[i].Maintenance {
+			checks = append(checks, history[i].Error == nil)
+		}
+	}
+	if len(checks) < c.Window {
+		return 0, false
+	}
+
+	var changes int
+	for i := 1; i < len(checks); i++ {
+		if checks[i] != checks[i-1] {
+			changes++
+		}
+	}
+	return float64(changes) / float64(len(checks)-1), true
+}
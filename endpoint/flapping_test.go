@@ -0,0 +1,137 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func flapHistory(pattern string, flapping bool) []EndpointResponse {
+	var history []EndpointResponse
+	for _, c := range pattern {
+		response := EndpointResponse{Flapping: flapping}
+		switch c {
+		case 'd':
+			response.Error = errors.New("down")
+		case 'm':
+			response.Maintenance = true
+		}
+		history = append(history, response)
+	}
+	return history
+}
+
+func TestFlapping(t *testing.T) {
+	config := FlapConfig{Window: 5, Start: 0.5, Stop: 0.25}
+
+	tests := []struct {
+		name    string
+		history []EndpointResponse
+		want    bool
+	}{
+		{"too few checks", flapHistory("udud", false), false},
+		{"stable", flapHistory("uuuuu", false), false},
+		{"single outage", flapHistory("uuddd", false), false},
+		{"oscillating", flapHistory("ududu", false), true},
+		{"at start threshold", flapHistory("uudud", false), true},
+		{"settling stays flapping", flapHistory("uduuu", true), true},
+		{"at stop threshold", flapHistory("uuuud", true), false},
+		{"stable after flapping", flapHistory("uuuuu", true), false},
+		{"maintenance is skipped", flapHistory("udmudu", false), true},
+		{"maintenance keeps decision", append(flapHistory("uuuuu", true), flapHistory("m", false)...), true},
+		{"disabled", flapHistory("ududu", false), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := config
+			if tt.name == "disabled" {
+				c.Window = 0
+			}
+			if got := c.Flapping(tt.history); got != tt.want {
+				t.Errorf("Expected flapping %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+type channelNotifier chan Alert
+
+func (n channelNotifier) Name() string {
+	return "channel"
+}
+
+func (n channelNotifier) Notify(ctx context.Context, alert Alert) error {
+	n <- alert
+	return nil
+}
+
+func TestSchedulerFlapping(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 20)
+	handler.flap = FlapConfig{Window: 4, Start: 0.6, Stop: 0.3}
+
+	alerts := make(channelNotifier, 16)
+	scheduler := NewScheduler(handler, time.Minute, nil)
+	scheduler.Alerter().Register(alerts)
+	sub, _ := scheduler.Events().Subscribe(EventFilter{}, 0)
+	defer scheduler.Events().Unsubscribe(sub)
+
+	endpoint := EndpointRequest{URL: "https://test.com", Status: http.StatusOK}
+	start := time.Now()
+	for i, c := range "ududuuuu" {
+		result := EndpointResponse{Endpoint: endpoint, Status: http.StatusOK, Timestamp: start.Add(time.Duration(i) * time.Minute)}
+		if c == 'd' {
+			result.Error = errors.New("request failed")
+		}
+		handler.finishResult(&result)
+		scheduler.record(result)
+	}
+
+	var kinds []string
+	for i := 0; i < 4; i++ {
+		select {
+		case alert := <-alerts:
+			kinds = append(kinds, alert.Kind)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected 4 alerts, got %v", kinds)
+		}
+	}
+	select {
+	case alert := <-alerts:
+		t.Errorf("Unexpected alert %s", alert.Kind)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sort.Strings(kinds)
+	if got := strings.Join(kinds, ","); got != "down,flapping,recovered,recovered" {
+		t.Errorf("Expected one flapping alert instead of transitions, got %s", got)
+	}
+
+	var flaps []string
+	for len(sub.Events()) > 0 {
+		event := <-sub.Events()
+		if event.Type == EventFlapping {
+			change := event.Data.(FlapChange)
+			flaps = append(flaps, change.State)
+			if change.Flapping != (len(flaps) == 1) {
+				t.Errorf("Unexpected flap change %+v", change)
+			}
+		}
+	}
+	if got := strings.Join(flaps, ","); got != "down,up" {
+		t.Errorf("Expected flapping to start on down and settle on up, got %s", got)
+	}
+
+	history, err := handler.GetEndpointHistory(endpoint.URL)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	response := newHistoryResponse(EndpointMeta{URL: endpoint.URL}, history)
+	if response.Flapping || !response.History[4].Flapping {
+		t.Errorf("Expected flapping to be recorded in history and cleared once stable")
+	}
+}
@@ -2,53 +2,91 @@ package endpoint
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 	"terminally-online/cron/utils"
 	"time"
-
-	"go.etcd.io/bbolt"
 )
 
-const endpointBucket = "endpoints"
-
+// NewEndpointHandler opens the database at dbPath with the storage driver
+// selected by STORAGE_CONFIG and applies pending migrations, backing up an
+// existing database first.
 func NewEndpointHandler(dbPath string, histSize int) (*EndpointHandler, error) {
+	_, err := os.Stat(dbPath)
+	existed := err == nil
+
+	store, err := OpenStore(STORAGE_CONFIG.Driver, dbPath, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateStore(store, dbPath, existed); err != nil {
+		store.Close()
+		return nil, err
+	}
+	return NewStoreHandler(store, histSize), nil
+}
+
+// NewStoreHandler returns a handler keeping at most histSize results per
+// endpoint and location in the store.
+func NewStoreHandler(store Store, histSize int) *EndpointHandler {
 	if histSize <= 0 {
 		histSize = 48
 	}
 
-	db, err := bbolt.Open(dbPath, 0600, &bbolt.Options{
-		Timeout: 1 * time.Second,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+	return &EndpointHandler{
+		client:   &http.Client{},
+		store:    store,
+		histSize: histSize,
+		flap:     FLAP_CONFIG,
+		anomaly:  ANOMALY_CONFIG,
+		location: LOCATION,
 	}
+}
 
-	err = db.Update(func(tx *bbolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(endpointBucket))
-		return err
-	})
+// OpenEndpointHandler opens an existing database read-only, for inspecting
+// it next to a running server or from the command line. A bbolt database
+// held open for writing by a running server cannot be opened.
+func OpenEndpointHandler(dbPath string) (*EndpointHandler, error) {
+	store, err := OpenStore(STORAGE_CONFIG.Driver, dbPath, true)
 	if err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to create bucket: %w", err)
+		return nil, err
 	}
 
 	return &EndpointHandler{
 		client:   &http.Client{},
-		db:       db,
-		histSize: histSize,
+		store:    store,
+		flap:     FLAP_CONFIG,
+		anomaly:  ANOMALY_CONFIG,
+		location: LOCATION,
 	}, nil
 }
 
+// NewCheckHandler returns a handler for one-off checks. It has no database,
+// so only Check may be used.
+func NewCheckHandler() *EndpointHandler {
+	return &EndpointHandler{
+		client:   &http.Client{},
+		location: LOCATION,
+	}
+}
+
 func (h *EndpointHandler) Close() error {
-	return h.db.Close()
+	return h.store.Close()
 }
 
+// Handle checks the endpoint and stores the result.
 func (h *EndpointHandler) Handle(ctx context.Context, endpointRequest EndpointRequest) EndpointResponse {
+	response := h.Check(ctx, endpointRequest)
+	h.finishResult(&response)
+	return response
+}
+
+// Check runs the endpoint's check, retrying failures, without storing the
+// result. The result is tagged with the location of this instance.
+func (h *EndpointHandler) Check(ctx context.Context, endpointRequest EndpointRequest) EndpointResponse {
 	endpointRequest = getEndpointDefaults(endpointRequest)
 
 	retryConfig := h.getRetryConfig(endpointRequest)
@@ -61,7 +99,8 @@ func (h *EndpointHandler) Handle(ctx context.Context, endpointRequest EndpointRe
 	for attempt := 0; attempt <= retryConfig.Attempts; attempt++ {
 		if attempt > 0 {
 			if err := h.waitForRetry(timeoutCtx, attempt, retryConfig); err != nil {
-				return h.createTimeoutResponse(endpointRequest, attempt, lastError)
+				response = h.createTimeoutResponse(endpointRequest, attempt, lastError)
+				break
 			}
 		}
 
@@ -73,81 +112,223 @@ func (h *EndpointHandler) Handle(ctx context.Context, endpointRequest EndpointRe
 		log.Printf("Error checking %s: %v", response.Endpoint.URL, response.Error)
 	}
 
-	if err := h.storeResponse(response); err != nil {
+	response.Location = h.location
+	return response
+}
+
+// finishResult flags a result taken during a maintenance window, while the
+// endpoint is flapping, slower than its latency thresholds, unusually slow
+// compared to its history or serving changed content and stores it.
+func (h *EndpointHandler) finishResult(response *EndpointResponse) {
+	h.classifyResult(response)
+
+	history, err := h.GetEndpointHistory(response.Endpoint.URL)
+	if err != nil {
+		log.Printf("Failed to load history for flap and anomaly detection: %v", err)
+	}
+	// Locations differ in latency and in how reliably they reach the
+	// endpoint, so each is compared with its own checks only.
+	history = fromLocation(history, response.Location)
+	response.Flapping = h.flap.Flapping(append(history, *response))
+	var seasonal []time.Duration
+	if h.anomaly.Seasonal {
+		if seasonal, err = h.seasonalDurations(*response); err != nil {
+			log.Printf("Failed to load the seasonal baseline of %s: %v", response.Endpoint.URL, err)
+		}
+	}
+	response.Anomaly = h.anomaly.Score(history, seasonal, *response)
+	response.Anomalous = h.anomaly.Anomalous(response.Anomaly)
+	if h.anomaly.Seasonal {
+		if err := h.recordSeasonal(*response); err != nil {
+			log.Printf("Failed to update the seasonal baseline of %s: %v", response.Endpoint.URL, err)
+		}
+	}
+
+	if err := h.detectChange(response); err != nil {
+		log.Printf("Failed to detect content changes of %s: %v", response.Endpoint.URL, err)
+	}
+
+	if err := h.storeResponse(*response); err != nil {
 		log.Printf("Failed to store response: %v", err)
 	}
+}
 
-	return response
+// storeLateResult stores a result that arrived after newer ones without
+// comparing it with them, so it is not flagged as flapping, anomalous or
+// changed against checks it predates.
+func (h *EndpointHandler) storeLateResult(response *EndpointResponse) {
+	h.classifyResult(response)
+
+	if err := h.storeResponse(*response); err != nil {
+		log.Printf("Failed to store response: %v", err)
+	}
+}
+
+// classifyResult marks checks slower than the endpoint's latency thresholds
+// and checks made during maintenance.
+func (h *EndpointHandler) classifyResult(response *EndpointResponse) {
+	if response.Error == nil {
+		response.Degraded = response.Endpoint.latencyLevel(response.Duration)
+	}
+
+	window, err := h.ActiveMaintenance(response.Endpoint, response.Timestamp)
+	if err != nil {
+		log.Printf("Failed to look up maintenance windows: %v", err)
+	}
+	response.Maintenance = window != nil
 }
 
 func (h *EndpointHandler) GetEndpointHistory(url string) ([]EndpointResponse, error) {
+	return h.GetEndpointHistoryRange(url, time.Time{}, time.Time{})
+}
+
+// GetEndpointHistoryRange returns the stored results of the endpoint from
+// from up to and including to. A zero time leaves that end open.
+func (h *EndpointHandler) GetEndpointHistoryRange(url string, from, to time.Time) ([]EndpointResponse, error) {
+	stored, err := h.store.Results(url, from, to)
+	if err != nil {
+		return nil, err
+	}
+
 	var responses []EndpointResponse
+	if len(stored) > 0 {
+		responses = make([]EndpointResponse, len(stored))
+	}
+	for i, s := range stored {
+		responses[i] = EndpointResponse{
+			Endpoint: EndpointRequest{
+				URL:    s.URL,
+				Method: s.Method,
+				Status: s.Expected,
+			},
+			Status:         s.Status,
+			Category:       s.Category,
+			Timestamp:      s.Timestamp,
+			Duration:       s.Duration,
+			BodyHash:       s.BodyHash,
+			BodySize:       s.BodySize,
+			BodyTruncated:  s.BodyTruncated,
+			BodyStored:     s.BodyEncoding != "",
+			Maintenance:    s.Maintenance,
+			Flapping:       s.Flapping,
+			Degraded:       s.Degraded,
+			Anomaly:        s.Anomaly,
+			Anomalous:      s.Anomalous,
+			Location:       s.Location,
+			Ping:           s.Ping,
+			ContentHash:    s.ContentHash,
+			ContentChanged: s.ContentChanged,
+		}
+		if s.Error != "" {
+			responses[i].Error = fmt.Errorf("%s", s.Error)
+		}
+	}
+
+	return responses, nil
+}
+
+func (h *EndpointHandler) GetAllEndpoints() ([]string, error) {
+	return h.store.URLs()
+}
+
+// GetDomainEndpoints returns the endpoints configured under the given domain,
+// as recorded by RegisterEndpoints.
+func (h *EndpointHandler) GetDomainEndpoints(domain string) ([]string, error) {
+	var endpoints []string
 
-	err := h.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(endpointBucket))
-		data := b.Get([]byte(url))
-		if data == nil {
-			return nil
+	metas, err := h.GetAllEndpointMeta()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, meta := range metas {
+		if meta.Domain == domain {
+			endpoints = append(endpoints, meta.URL)
 		}
+	}
 
-		var stored []EndpointResponseStored
-		if err := json.Unmarshal(data, &stored); err != nil {
-			return fmt.Errorf("failed to unmarshal responses: %w", err)
+	return endpoints, nil
+}
+
+// ListEndpoints returns the metadata of every endpoint with stored history
+// whose labels match the selector. Endpoints that were never registered are
+// returned with only their URL set.
+func (h *EndpointHandler) ListEndpoints(selector Selector) ([]EndpointMeta, error) {
+	urls, err := h.store.URLs()
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []EndpointMeta
+	for _, url := range urls {
+		meta, found, err := h.store.Meta(url)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			meta = EndpointMeta{URL: url}
 		}
 
-		responses = make([]EndpointResponse, len(stored))
-		for i, s := range stored {
-			responses[i] = EndpointResponse{
-				Endpoint: EndpointRequest{
-					URL:    s.URL,
-					Method: s.Method,
-					Status: s.Expected,
-				},
-				Status:    s.Status,
-				Timestamp: s.Timestamp,
-				Duration:  s.Duration,
-				Body:      s.Body,
-			}
-			if s.Error != "" {
-				responses[i].Error = fmt.Errorf("%s", s.Error)
-			}
+		if selector.Matches(meta.Labels) {
+			endpoints = append(endpoints, meta)
 		}
+	}
 
-		return nil
+	return endpoints, nil
+}
+
+// RegisterEndpoints persists the configured domain membership and labels of
+// each endpoint so groups survive restarts and do not depend on the shape of
+// the URL. Endpoints no longer configured lose their metadata, so they leave
+// their domain and stop matching selectors. Heartbeats are registered
+// separately and are left alone.
+func (h *EndpointHandler) RegisterEndpoints(endpoints []EndpointRequest) error {
+	return h.syncMeta(endpoints, func(url string) bool {
+		return !strings.HasPrefix(url, heartbeatScheme)
 	})
+}
 
-	return responses, err
+// syncMeta stores the metadata of the endpoints and removes the metadata of
+// every other endpoint the caller owns.
+func (h *EndpointHandler) syncMeta(endpoints []EndpointRequest, owned func(url string) bool) error {
+	metas := make([]EndpointMeta, 0, len(endpoints))
+	configured := make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		metas = append(metas, endpointMeta(endpoint))
+		configured[endpoint.URL] = true
+	}
+	if err := h.store.PutMeta(metas); err != nil {
+		return err
+	}
+
+	existing, err := h.store.AllMeta()
+	if err != nil {
+		return err
+	}
+	var stale []string
+	for _, meta := range existing {
+		if owned(meta.URL) && !configured[meta.URL] {
+			stale = append(stale, meta.URL)
+		}
+	}
+	return h.store.DeleteMeta(stale)
 }
 
-func (h *EndpointHandler) GetAllEndpoints() ([]string, error) {
-	var urls []string
-
-	err := h.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(endpointBucket))
-		return b.ForEach(func(k, v []byte) error {
-			urls = append(urls, string(k))
-			return nil
-		})
-	})
+func endpointMeta(endpoint EndpointRequest) EndpointMeta {
+	return EndpointMeta{
+		URL:    endpoint.URL,
+		Domain: endpoint.Domain,
+		Labels: endpoint.Labels,
+		Quorum: endpoint.Quorum,
+	}
+}
 
-	return urls, err
+func (h *EndpointHandler) GetEndpointMeta(url string) (EndpointMeta, bool, error) {
+	return h.store.Meta(url)
 }
 
-func (h *EndpointHandler) GetDomainEndpoints(domain string) ([]string, error) {
-    var endpoints []string
-
-    err := h.db.View(func(tx *bbolt.Tx) error {
-        b := tx.Bucket([]byte(endpointBucket))
-        return b.ForEach(func(k, v []byte) error {
-            url := string(k)
-            if strings.Contains(url, domain) {
-                endpoints = append(endpoints, url)
-            }
-            return nil
-        })
-    })
-
-    return endpoints, err
+func (h *EndpointHandler) GetAllEndpointMeta() ([]EndpointMeta, error) {
+	return h.store.AllMeta()
 }
 
 func (h *EndpointHandler) isSuccessfulResponse(resp EndpointResponse) bool {
@@ -162,13 +343,10 @@ func (h *EndpointHandler) createTimeoutResponse(req EndpointRequest, attempt int
 		Endpoint:  req,
 		Status:    0,
 		Error:     fmt.Errorf("timeout reached after %d retries: %w", attempt, lastError),
+		Category:  CategoryTimeout,
 		Timestamp: time.Now(),
 	}
 
-	if err := h.storeResponse(response); err != nil {
-		log.Printf("Failed to store timeout response: %v", err)
-	}
-
 	return response
 }
 
@@ -178,6 +356,9 @@ func getEndpointDefaults(req EndpointRequest) EndpointRequest {
 	req.Status = utils.DefaultIfZero(req.Status, http.StatusOK)
 	req.RetryAttempts = utils.DefaultIfZero(req.RetryAttempts, 3)
 	req.RetryDelay = utils.DefaultIfZero(req.RetryDelay, time.Second)
+	req.BodyPolicy = utils.DefaultIfZero(req.BodyPolicy, BodyOnFailure)
+	req.BodyLimit = utils.DefaultIfZero(req.BodyLimit, defaultBodyLimit)
+	req.MaxBodySize = utils.DefaultIfZero(req.MaxBodySize, int64(defaultMaxBodySize))
 
 	return req
 }
@@ -210,6 +391,7 @@ func (h *EndpointHandler) performRequest(ctx context.Context, endpointRequest En
 	request, err := http.NewRequestWithContext(ctx, endpointRequest.Method, endpointRequest.URL, nil)
 	if err != nil {
 		endpointResponse.Error = fmt.Errorf("failed to create request: %w", err)
+		endpointResponse.Category = CategoryRequest
 		return endpointResponse
 	}
 
@@ -218,30 +400,38 @@ func (h *EndpointHandler) performRequest(ctx context.Context, endpointRequest En
 
 	if err != nil {
 		endpointResponse.Error = fmt.Errorf("request failed: %w", err)
+		endpointResponse.Category = classifyRequestError(err)
 		return endpointResponse
 	}
 	defer response.Body.Close()
 
-	body, err := io.ReadAll(response.Body)
+	body, truncated, err := readBody(response.Body, endpointRequest.MaxBodySize)
 	if err != nil {
 		endpointResponse.Error = fmt.Errorf("failed to read response body: %w", err)
+		endpointResponse.Category = classifyRequestError(err)
 		return endpointResponse
 	}
 	endpointResponse.Body = string(body)
+	endpointResponse.BodyHash = hashBody(body)
+	endpointResponse.BodySize = int64(len(body))
+	endpointResponse.BodyTruncated = truncated
 	endpointResponse.Status = response.StatusCode
 
 	if response.StatusCode >= 400 {
 		endpointResponse.Error = fmt.Errorf("received error status code: %d", response.StatusCode)
+		endpointResponse.Category = CategoryStatus
 		return endpointResponse
 	} else if response.StatusCode != endpointRequest.Status {
 		endpointResponse.Error = fmt.Errorf("unexpected status code: got %d, wanted %d",
 			response.StatusCode, endpointRequest.Status)
+		endpointResponse.Category = CategoryStatus
 		return endpointResponse
 	}
 
 	if endpointRequest.ExpectedContent != "" {
 		if !strings.Contains(endpointResponse.Body, endpointRequest.ExpectedContent) {
 			endpointResponse.Error = fmt.Errorf("expected content not found: %s", endpointRequest.ExpectedContent)
+			endpointResponse.Category = CategoryContent
 			return endpointResponse
 		}
 	}
@@ -251,39 +441,34 @@ func (h *EndpointHandler) performRequest(ctx context.Context, endpointRequest En
 
 func (h *EndpointHandler) storeResponse(response EndpointResponse) error {
 	stored := EndpointResponseStored{
-		URL:       response.Endpoint.URL,
-		Method:    response.Endpoint.Method,
-		Status:    response.Status,
-		Expected:  response.Endpoint.Status,
-		Timestamp: response.Timestamp,
-		Duration:  response.Duration,
-		Body:      response.Body,
+		URL:            response.Endpoint.URL,
+		Method:         response.Endpoint.Method,
+		Status:         response.Status,
+		Expected:       response.Endpoint.Status,
+		Timestamp:      response.Timestamp,
+		Duration:       response.Duration,
+		BodyHash:       response.BodyHash,
+		BodySize:       response.BodySize,
+		BodyTruncated:  response.BodyTruncated,
+		Category:       response.Category,
+		Maintenance:    response.Maintenance,
+		Flapping:       response.Flapping,
+		Degraded:       response.Degraded,
+		Anomaly:        response.Anomaly,
+		Anomalous:      response.Anomalous,
+		Location:       response.Location,
+		Ping:           response.Ping,
+		ContentHash:    response.ContentHash,
+		ContentChanged: response.ContentChanged,
 	}
 	if response.Error != nil {
 		stored.Error = response.Error.Error()
 	}
 
-	return h.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(endpointBucket))
-
-		var responses []EndpointResponseStored
-		data := b.Get([]byte(response.Endpoint.URL))
-		if data != nil {
-			if err := json.Unmarshal(data, &responses); err != nil {
-				return fmt.Errorf("failed to unmarshal existing responses: %w", err)
-			}
-		}
-
-		responses = append(responses, stored)
-		if len(responses) > h.histSize {
-			responses = responses[len(responses)-h.histSize:]
-		}
-
-		data, err := json.Marshal(responses)
-		if err != nil {
-			return fmt.Errorf("failed to marshal responses: %w", err)
-		}
+	var err error
+	if stored.Body, stored.BodyEncoding, err = encodeBody(response); err != nil {
+		return err
+	}
 
-		return b.Put([]byte(response.Endpoint.URL), data)
-	})
+	return h.store.AppendResult(stored, h.histSize)
 }
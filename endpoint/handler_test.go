@@ -4,23 +4,11 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 	"time"
-
-	"go.etcd.io/bbolt"
 )
 
 func TestEndpointHandler(t *testing.T) {
-	tmpDB := "test.db"
-	defer os.Remove(tmpDB)
-
-	handler, err := NewEndpointHandler(tmpDB, 10)
-	if err != nil {
-		t.Fatalf("Failed to create handler: %v", err)
-	}
-	defer handler.Close()
-
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
 		case "/success":
@@ -33,24 +21,18 @@ func TestEndpointHandler(t *testing.T) {
 		case "/content":
 			w.WriteHeader(http.StatusOK)
 			if _, err := w.Write([]byte("this is the expected text content")); err != nil {
-			    t.Fatalf("Failed to write response: %v", err)
+				t.Fatalf("Failed to write response: %v", err)
 			}
 		}
 	}))
 	defer server.Close()
 
-	if err := handler.db.Update(func(tx *bbolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(endpointBucket))
-		return err
-	}); err != nil {
-		t.Fatalf("Failed to create bucket: %v", err)
-	}
-
 	tests := []struct {
-		name     string
-		request  EndpointRequest
-		wantErr  bool
-		wantCode int
+		name         string
+		request      EndpointRequest
+		wantErr      bool
+		wantCode     int
+		wantCategory string
 	}{
 		{
 			name: "successful request",
@@ -74,8 +56,9 @@ func TestEndpointHandler(t *testing.T) {
 				RetryAttempts: 2,
 				RetryDelay:    100 * time.Millisecond,
 			},
-			wantErr:  true,
-			wantCode: http.StatusInternalServerError,
+			wantErr:      true,
+			wantCode:     http.StatusInternalServerError,
+			wantCategory: CategoryStatus,
 		},
 		{
 			name: "timeout",
@@ -86,8 +69,9 @@ func TestEndpointHandler(t *testing.T) {
 				Status:        http.StatusOK,
 				RetryAttempts: 1,
 			},
-			wantErr:  true,
-			wantCode: 0,
+			wantErr:      true,
+			wantCode:     0,
+			wantCategory: CategoryTimeout,
 		},
 		{
 			name: "content verification",
@@ -102,17 +86,41 @@ func TestEndpointHandler(t *testing.T) {
 			wantErr:  false,
 			wantCode: http.StatusOK,
 		},
+		{
+			name: "missing content",
+			request: EndpointRequest{
+				URL:             server.URL + "/content",
+				Method:          "GET",
+				Timeout:         time.Second,
+				Status:          http.StatusOK,
+				RetryAttempts:   1,
+				RetryDelay:      10 * time.Millisecond,
+				ExpectedContent: "missing text",
+			},
+			wantErr:      true,
+			wantCode:     http.StatusOK,
+			wantCategory: CategoryContent,
+		},
+		{
+			name: "connection refused",
+			request: EndpointRequest{
+				URL:           "http://127.0.0.1:1/refused",
+				Method:        "GET",
+				Timeout:       time.Second,
+				Status:        http.StatusOK,
+				RetryAttempts: 1,
+				RetryDelay:    10 * time.Millisecond,
+			},
+			wantErr:      true,
+			wantCode:     0,
+			wantCategory: CategoryConnection,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-
-			if err := handler.db.Update(func(tx *bbolt.Tx) error {
-				b := tx.Bucket([]byte(endpointBucket))
-				return b.Delete([]byte(tt.request.URL))
-			}); err != nil {
-				t.Fatalf("Failed to clear previous entries: %v", err)
-			}
+			handler := NewStoreHandler(NewMemoryStore(), 10)
+			defer handler.Close()
 
 			resp := handler.Handle(context.Background(), tt.request)
 
@@ -124,6 +132,10 @@ func TestEndpointHandler(t *testing.T) {
 				t.Errorf("Handle() status = %v, want %v", resp.Status, tt.wantCode)
 			}
 
+			if resp.Category != tt.wantCategory {
+				t.Errorf("Handle() category = %q, want %q", resp.Category, tt.wantCategory)
+			}
+
 			time.Sleep(100 * time.Millisecond)
 
 			history, err := handler.GetEndpointHistory(tt.request.URL)
@@ -132,34 +144,14 @@ func TestEndpointHandler(t *testing.T) {
 			}
 			if len(history) == 0 {
 				t.Error("No history entry created")
-
-				if err := handler.db.View(func(tx *bbolt.Tx) error {
-					b := tx.Bucket([]byte(endpointBucket))
-					if b == nil {
-						t.Log("Bucket does not exist")
-						return nil
-					}
-					return b.ForEach(func(k, v []byte) error {
-						t.Logf("Key: %s, Value length: %d", k, len(v))
-						return nil
-					})
-				}); err != nil {
-					t.Errorf("Failed to dump database: %v", err)
-				}
 			}
 		})
 	}
 }
 
 func TestHistoryLimit(t *testing.T) {
-	tmpDB := "test_history.db"
-	defer os.Remove(tmpDB)
-
 	histSize := 3
-	handler, err := NewEndpointHandler(tmpDB, histSize)
-	if err != nil {
-		t.Fatalf("Failed to create handler: %v", err)
-	}
+	handler := NewStoreHandler(NewMemoryStore(), histSize)
 	defer handler.Close()
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -187,3 +179,72 @@ func TestHistoryLimit(t *testing.T) {
 		t.Errorf("History size = %v, want %v", len(history), histSize)
 	}
 }
+
+func TestDomainEndpoints(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+
+	endpoints := ConfiguredEndpoints([]DomainRequest{
+		{
+			Domain: "plug",
+			Endpoints: []EndpointRequest{
+				{URL: "https://onplug.io"},
+				{URL: "https://docs.onplug.io"},
+			},
+		},
+		{
+			Domain: "other",
+			Endpoints: []EndpointRequest{
+				{URL: "https://unplugged.example.com"},
+			},
+		},
+	})
+	if err := handler.RegisterEndpoints(endpoints); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
+
+	got, err := handler.GetDomainEndpoints("plug")
+	if err != nil {
+		t.Fatalf("Failed to get domain endpoints: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 endpoints for plug, got %v", got)
+	}
+	for _, url := range got {
+		if url == "https://unplugged.example.com" {
+			t.Errorf("Expected unplugged.example.com to be excluded from plug")
+		}
+	}
+
+	meta, found, err := handler.GetEndpointMeta("https://unplugged.example.com")
+	if err != nil || !found {
+		t.Fatalf("Failed to get endpoint metadata: %v", err)
+	}
+	if meta.Domain != "other" {
+		t.Errorf("Expected domain other, got %s", meta.Domain)
+	}
+
+	// Endpoints removed from the config leave their domain, while
+	// heartbeats are registered on their own.
+	if err := handler.RegisterHeartbeats([]Heartbeat{{Name: "backup", Domain: "other", Period: time.Hour}}); err != nil {
+		t.Fatalf("Failed to register heartbeats: %v", err)
+	}
+	if err := handler.RegisterEndpoints(endpoints[:2]); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
+	if _, found, _ := handler.GetEndpointMeta("https://unplugged.example.com"); found {
+		t.Errorf("Expected the removed endpoint's metadata to be deleted")
+	}
+	if got, _ := handler.GetDomainEndpoints("other"); len(got) != 1 || got[0] != "heartbeat://backup" {
+		t.Errorf("Expected only the heartbeat in other, got %v", got)
+	}
+
+	if err := handler.RegisterHeartbeats(nil); err != nil {
+		t.Fatalf("Failed to register heartbeats: %v", err)
+	}
+	if got, _ := handler.GetDomainEndpoints("other"); len(got) != 0 {
+		t.Errorf("Expected the removed heartbeat to leave its domain, got %v", got)
+	}
+	if got, _ := handler.GetDomainEndpoints("plug"); len(got) != 2 {
+		t.Errorf("Expected the configured endpoints to be kept, got %v", got)
+	}
+}
@@ -0,0 +1,349 @@
+package endpoint
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	heartbeatBucket = "heartbeats"
+	heartbeatScheme = "heartbeat://"
+
+	PingSuccess = "success"
+	PingStart   = "start"
+	PingFail    = "fail"
+
+	CategoryHeartbeatMissed = "heartbeat_missed"
+	CategoryHeartbeatFailed = "heartbeat_failed"
+
+	// maxPingLog caps how much of a ping body is kept with the result.
+	maxPingLog = 4096
+)
+
+var (
+	ErrHeartbeatNotFound = errors.New("heartbeat not found")
+	ErrHeartbeatReadOnly = errors.New("heartbeat is managed by configuration")
+)
+
+// URL is the key the heartbeat's results are stored under, so it shares
+// history, stats and events with regular endpoints.
+func (hb Heartbeat) URL() string {
+	return heartbeatScheme + hb.Name
+}
+
+func (hb Heartbeat) Endpoint() EndpointRequest {
+	return EndpointRequest{
+		URL:    hb.URL(),
+		Domain: hb.Domain,
+		Labels: hb.Labels,
+		Method: "PING",
+	}
+}
+
+// Deadline is the time by which the next ping must arrive. A job that
+// reported its start has Grace to finish, otherwise a ping is due every
+// Period plus Grace after the last ping or missed deadline.
+func (hb Heartbeat) Deadline() time.Time {
+	base := hb.CreatedAt
+	if hb.LastPingAt != nil && hb.LastPingAt.After(base) {
+		base = *hb.LastPingAt
+	}
+	if hb.LastMissedAt != nil && hb.LastMissedAt.After(base) {
+		base = *hb.LastMissedAt
+	}
+
+	if hb.LastStartAt != nil && hb.LastStartAt.After(base) {
+		return hb.LastStartAt.Add(hb.Grace)
+	}
+	return base.Add(hb.Period + hb.Grace)
+}
+
+func (hb *Heartbeat) Validate() error {
+	if hb.Name == "" {
+		return errors.New("name is required")
+	}
+	if hb.Period <= 0 {
+		return errors.New("period must be positive")
+	}
+	if hb.Grace < 0 {
+		return errors.New("grace must not be negative")
+	}
+	return nil
+}
+
+func newHeartbeatToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// RegisterHeartbeats replaces the configured heartbeats with the given ones.
+// A configured heartbeat without a token keeps the token it was given on a
+// previous start, so jobs do not need to be reconfigured after a restart.
+func (h *EndpointHandler) RegisterHeartbeats(heartbeats []Heartbeat) error {
+	for i := range heartbeats {
+		if err := heartbeats[i].Validate(); err != nil {
+			return fmt.Errorf("invalid heartbeat %q: %w", heartbeats[i].Name, err)
+		}
+	}
+
+	err := h.store.Update(func(tx RecordTx) error {
+		existing := make(map[string]Heartbeat)
+		err := forEachRecord(tx, heartbeatBucket, func(hb Heartbeat) error {
+			if hb.Source == SourceConfig {
+				existing[hb.Name] = hb
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, hb := range heartbeats {
+			previous, ok := existing[hb.Name]
+			delete(existing, hb.Name)
+
+			if ok {
+				hb.ID = previous.ID
+				hb.CreatedAt = previous.CreatedAt
+				hb.LastPingAt = previous.LastPingAt
+				hb.LastStartAt = previous.LastStartAt
+				hb.LastMissedAt = previous.LastMissedAt
+				if hb.Token == "" {
+					hb.Token = previous.Token
+				}
+			} else {
+				if hb.ID, err = nextRecordID(tx, heartbeatBucket); err != nil {
+					return err
+				}
+				hb.CreatedAt = time.Now()
+			}
+
+			if hb.Token == "" {
+				if hb.Token, err = newHeartbeatToken(); err != nil {
+					return err
+				}
+			}
+			hb.Source = SourceConfig
+
+			if err := putRecord(tx, heartbeatBucket, hb.ID, hb); err != nil {
+				return err
+			}
+		}
+
+		for _, stale := range existing {
+			if err := deleteRecord(tx, heartbeatBucket, stale.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Heartbeats created through the API are kept, so the metadata is
+	// synced with every stored heartbeat.
+	stored, err := h.GetHeartbeats()
+	if err != nil {
+		return err
+	}
+	endpoints := make([]EndpointRequest, len(stored))
+	for i, hb := range stored {
+		endpoints[i] = hb.Endpoint()
+	}
+	return h.syncMeta(endpoints, func(url string) bool {
+		return strings.HasPrefix(url, heartbeatScheme)
+	})
+}
+
+func (h *EndpointHandler) CreateHeartbeat(hb Heartbeat) (Heartbeat, error) {
+	if err := hb.Validate(); err != nil {
+		return hb, err
+	}
+
+	err := h.store.Update(func(tx RecordTx) error {
+		var err error
+		err = forEachRecord(tx, heartbeatBucket, func(existing Heartbeat) error {
+			if existing.Name == hb.Name {
+				return fmt.Errorf("heartbeat %q already exists", hb.Name)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if hb.ID, err = nextRecordID(tx, heartbeatBucket); err != nil {
+			return err
+		}
+		if hb.Token, err = newHeartbeatToken(); err != nil {
+			return err
+		}
+		hb.Source = SourceAPI
+		hb.CreatedAt = time.Now()
+		hb.LastPingAt, hb.LastStartAt, hb.LastMissedAt = nil, nil, nil
+
+		return putRecord(tx, heartbeatBucket, hb.ID, hb)
+	})
+	if err != nil {
+		return hb, err
+	}
+
+	return hb, h.store.PutMeta([]EndpointMeta{endpointMeta(hb.Endpoint())})
+}
+
+func (h *EndpointHandler) DeleteHeartbeat(id uint64) error {
+	var hb Heartbeat
+	err := h.store.Update(func(tx RecordTx) error {
+		found, err := getRecord(tx, heartbeatBucket, id, &hb)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrHeartbeatNotFound
+		}
+		if hb.Source == SourceConfig {
+			return ErrHeartbeatReadOnly
+		}
+		return deleteRecord(tx, heartbeatBucket, id)
+	})
+	if err != nil {
+		return err
+	}
+	return h.store.DeleteMeta([]string{hb.URL()})
+}
+
+func (h *EndpointHandler) GetHeartbeat(id uint64) (Heartbeat, error) {
+	var hb Heartbeat
+
+	err := h.store.View(func(tx RecordTx) error {
+		found, err := getRecord(tx, heartbeatBucket, id, &hb)
+		if err == nil && !found {
+			return ErrHeartbeatNotFound
+		}
+		return err
+	})
+
+	return hb, err
+}
+
+func (h *EndpointHandler) GetHeartbeats() ([]Heartbeat, error) {
+	var heartbeats []Heartbeat
+
+	err := h.store.View(func(tx RecordTx) error {
+		return forEachRecord(tx, heartbeatBucket, func(hb Heartbeat) error {
+			heartbeats = append(heartbeats, hb)
+			return nil
+		})
+	})
+
+	return heartbeats, err
+}
+
+// RecordPing registers a ping for the heartbeat with the given token. Start
+// pings only open the job's grace period; success and fail pings produce a
+// result that is stored like any other check. The result is nil for start
+// pings.
+func (h *EndpointHandler) RecordPing(token string, payload PingPayload, at time.Time) (*EndpointResponse, error) {
+	var hb Heartbeat
+	var found bool
+
+	err := h.store.Update(func(tx RecordTx) error {
+		err := forEachRecord(tx, heartbeatBucket, func(existing Heartbeat) error {
+			if existing.Token == token {
+				hb, found = existing, true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrHeartbeatNotFound
+		}
+
+		if payload.Kind == PingStart {
+			hb.LastStartAt = &at
+		} else {
+			hb.LastPingAt = &at
+		}
+		return putRecord(tx, heartbeatBucket, hb.ID, hb)
+	})
+	if err != nil || payload.Kind == PingStart {
+		return nil, err
+	}
+
+	if len(payload.Log) > maxPingLog {
+		payload.Log = payload.Log[:maxPingLog]
+	}
+
+	response := EndpointResponse{
+		Endpoint:  hb.Endpoint(),
+		Timestamp: at,
+		Ping:      &payload,
+	}
+	if hb.LastStartAt != nil && hb.LastStartAt.Before(at) && at.Sub(*hb.LastStartAt) <= hb.Grace {
+		response.Duration = at.Sub(*hb.LastStartAt)
+	}
+
+	switch {
+	case payload.Kind == PingFail:
+		response.Error = errors.New("job reported failure")
+		response.Category = CategoryHeartbeatFailed
+	case payload.ExitCode != nil && *payload.ExitCode != 0:
+		response.Error = fmt.Errorf("job exited with code %d", *payload.ExitCode)
+		response.Category = CategoryHeartbeatFailed
+	}
+
+	h.finishResult(&response)
+	return &response, nil
+}
+
+// MissedHeartbeats records a failed result for every heartbeat whose deadline
+// passed before the given time and returns those results.
+func (h *EndpointHandler) MissedHeartbeats(now time.Time) ([]EndpointResponse, error) {
+	var missed []Heartbeat
+
+	err := h.store.Update(func(tx RecordTx) error {
+		err := forEachRecord(tx, heartbeatBucket, func(hb Heartbeat) error {
+			if now.After(hb.Deadline()) {
+				missed = append(missed, hb)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for i := range missed {
+			missed[i].LastMissedAt = &now
+			if err := putRecord(tx, heartbeatBucket, missed[i].ID, missed[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]EndpointResponse, len(missed))
+	for i, hb := range missed {
+		results[i] = EndpointResponse{
+			Endpoint:  hb.Endpoint(),
+			Error:     fmt.Errorf("no ping received within %v", hb.Period+hb.Grace),
+			Category:  CategoryHeartbeatMissed,
+			Timestamp: now,
+		}
+		h.finishResult(&results[i])
+	}
+
+	return results, nil
+}
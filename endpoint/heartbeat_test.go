@@ -0,0 +1,169 @@
+package endpoint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatPings(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+
+	scheduler := NewScheduler(handler, time.Minute, nil)
+	api := NewAPI(handler, scheduler)
+	api.adminToken = "secret"
+
+	create := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/heartbeats", bytes.NewBufferString(
+			`{"name":"nightly-batch","domain":"jobs","period":3600000000000,"grace":600000000000}`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		api.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := create(""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected creating without the admin token to be refused, got %d", rr.Code)
+	}
+	rr := create("secret")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	var hb Heartbeat
+	if err := json.Unmarshal(rr.Body.Bytes(), &hb); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if hb.Token == "" {
+		t.Fatalf("Expected heartbeat to be given a token")
+	}
+
+	// The token is only returned when the heartbeat is created.
+	for _, path := range []string{"/heartbeats", fmt.Sprintf("/heartbeats/%d", hb.ID)} {
+		rr := httptest.NewRecorder()
+		api.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), hb.Token) || strings.Contains(rr.Body.String(), `"token"`) {
+			t.Errorf("Expected %s to leave out the token, got %d: %s", path, rr.Code, rr.Body.String())
+		}
+	}
+	rr = httptest.NewRecorder()
+	api.ServeHTTP(rr, httptest.NewRequest("DELETE", fmt.Sprintf("/heartbeats/%d", hb.ID), nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected deleting without the admin token to be refused, got %d", rr.Code)
+	}
+
+	pings := []struct {
+		name           string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "start", path: "/ping/" + hb.Token + "/start", expectedStatus: http.StatusNoContent},
+		{name: "success", path: "/ping/" + hb.Token + "?exit_code=0", body: "processed 42 rows", expectedStatus: http.StatusNoContent},
+		{name: "fail", path: "/ping/" + hb.Token + "/fail?exit_code=3", body: "database locked", expectedStatus: http.StatusNoContent},
+		{name: "invalid exit code", path: "/ping/" + hb.Token + "?exit_code=oops", expectedStatus: http.StatusBadRequest},
+		{name: "unknown token", path: "/ping/unknown", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range pings {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+			api.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	history, err := handler.GetEndpointHistory(hb.URL())
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected success and fail results, got %d", len(history))
+	}
+
+	success, failure := history[0], history[1]
+	if success.Error != nil || success.Ping == nil || success.Ping.Log != "processed 42 rows" {
+		t.Errorf("Expected successful ping with log, got %+v", success)
+	}
+	if success.Duration <= 0 {
+		t.Errorf("Expected job duration to be measured from the start ping")
+	}
+	if failure.Error == nil || failure.Category != CategoryHeartbeatFailed || *failure.Ping.ExitCode != 3 {
+		t.Errorf("Expected failed ping with exit code 3, got %+v", failure)
+	}
+
+	incidents, err := handler.GetIncidents(IncidentFilter{URL: hb.URL(), Status: IncidentOpen})
+	if err != nil {
+		t.Fatalf("Failed to get incidents: %v", err)
+	}
+	if len(incidents) != 1 || incidents[0].Domain != "jobs" {
+		t.Errorf("Expected an open incident for the failed job, got %+v", incidents)
+	}
+}
+
+func TestHeartbeatMissed(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+
+	config := []Heartbeat{{Name: "backup", Period: time.Hour, Grace: 10 * time.Minute}}
+	if err := handler.RegisterHeartbeats(config); err != nil {
+		t.Fatalf("Failed to register heartbeats: %v", err)
+	}
+
+	heartbeats, err := handler.GetHeartbeats()
+	if err != nil || len(heartbeats) != 1 {
+		t.Fatalf("Failed to get heartbeats: %v", err)
+	}
+	hb := heartbeats[0]
+
+	if err := handler.RegisterHeartbeats(config); err != nil {
+		t.Fatalf("Failed to re-register heartbeats: %v", err)
+	}
+	heartbeats, _ = handler.GetHeartbeats()
+	if heartbeats[0].Token != hb.Token {
+		t.Errorf("Expected token to survive re-registration")
+	}
+
+	scheduler := NewScheduler(handler, time.Minute, nil)
+	sub, _ := scheduler.Events().Subscribe(EventFilter{URL: hb.URL()}, 0)
+	defer scheduler.Events().Unsubscribe(sub)
+
+	scheduler.checkHeartbeats(hb.CreatedAt.Add(time.Hour))
+	scheduler.checkHeartbeats(hb.CreatedAt.Add(71 * time.Minute))
+	scheduler.checkHeartbeats(hb.CreatedAt.Add(80 * time.Minute))
+
+	history, err := handler.GetEndpointHistory(hb.URL())
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("Expected one missed result per deadline, got %d", len(history))
+	}
+	if history[0].Category != CategoryHeartbeatMissed {
+		t.Errorf("Expected category %s, got %s", CategoryHeartbeatMissed, history[0].Category)
+	}
+
+	var states []string
+	for len(sub.Events()) > 0 {
+		if event := <-sub.Events(); event.Type == EventState {
+			states = append(states, event.Data.(StateChange).To)
+		}
+	}
+	if len(states) != 1 || states[0] != StateDown {
+		t.Errorf("Expected heartbeat to go down, got %v", states)
+	}
+
+	endpoints, err := handler.ListEndpoints(nil)
+	if err != nil || len(endpoints) != 1 || endpoints[0].URL != hb.URL() {
+		t.Errorf("Expected heartbeat to be listed as an endpoint, got %+v", endpoints)
+	}
+}
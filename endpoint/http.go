@@ -1,17 +1,33 @@
 package endpoint
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
 )
 
-func NewAPI(handler *EndpointHandler) *API {
+const (
+	eventKeepAlive = 15 * time.Second
+
+	DomainOperational   = "operational"
+	DomainPartialOutage = "partial_outage"
+	DomainMajorOutage   = "major_outage"
+	DomainMaintenance   = "maintenance"
+	DomainDegraded      = "degraded_performance"
+)
+
+func NewAPI(handler *EndpointHandler, scheduler *Scheduler) *API {
 	api := &API{
-		handler: handler,
-		router:  mux.NewRouter(),
+		handler:    handler,
+		scheduler:  scheduler,
+		router:     mux.NewRouter(),
+		adminToken: BACKUP_CONFIG.AdminToken,
 	}
 	api.setupRoutes()
 	return api
@@ -23,26 +39,82 @@ func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func (a *API) setupRoutes() {
 	a.router.HandleFunc("/endpoints", a.handleGetEndpoints).Methods("GET")
+	a.router.HandleFunc("/endpoints/history", a.handleGetEndpointsHistory).Methods("GET")
 	a.router.HandleFunc("/endpoint/history", a.handleGetEndpointHistory).Methods("GET")
+	a.router.HandleFunc("/endpoint/check", a.handleCheckEndpoint).Methods("POST")
+	a.router.HandleFunc("/endpoint/body", a.handleGetEndpointBody).Methods("GET")
 	a.router.HandleFunc("/domain/history", a.handleGetDomainHistory).Methods("GET")
+	a.router.HandleFunc("/events", a.handleEvents).Methods("GET")
+	a.router.HandleFunc("/metrics", a.handleMetrics).Methods("GET")
+	a.router.HandleFunc("/slo", a.handleGetSLOs).Methods("GET")
+	a.router.HandleFunc("/endpoint/reliability", a.handleGetReliability).Methods("GET")
+	a.router.HandleFunc("/changes", a.handleGetContentChanges).Methods("GET")
+	a.router.HandleFunc("/changes/{id:[0-9]+}/diff", a.handleGetContentChangeDiff).Methods("GET")
+	a.router.HandleFunc("/incidents", a.handleGetIncidents).Methods("GET")
+	a.router.HandleFunc("/incidents/{id:[0-9]+}", a.handleGetIncident).Methods("GET")
+	a.router.HandleFunc("/incidents/{id:[0-9]+}/notes", a.handleAddIncidentNote).Methods("POST")
+	a.router.HandleFunc("/incidents/{id:[0-9]+}/acknowledge", a.handleAcknowledgeIncident).Methods("POST")
+	a.router.HandleFunc("/maintenance", a.handleGetMaintenanceWindows).Methods("GET")
+	a.router.HandleFunc("/maintenance", a.handleCreateMaintenanceWindow).Methods("POST")
+	a.router.HandleFunc("/maintenance/{id:[0-9]+}", a.handleGetMaintenanceWindow).Methods("GET")
+	a.router.HandleFunc("/maintenance/{id:[0-9]+}", a.handleUpdateMaintenanceWindow).Methods("PUT")
+	a.router.HandleFunc("/maintenance/{id:[0-9]+}", a.handleDeleteMaintenanceWindow).Methods("DELETE")
+	a.router.HandleFunc("/status", a.handleGetStatus).Methods("GET")
+	a.router.HandleFunc("/status/locations", a.handleGetLocationStatus).Methods("GET")
+	a.router.HandleFunc("/silences", a.handleGetSilences).Methods("GET")
+	a.router.HandleFunc("/silences", a.handleCreateSilence).Methods("POST")
+	a.router.HandleFunc("/silences/{id:[0-9]+}", a.handleGetSilence).Methods("GET")
+	a.router.HandleFunc("/silences/{id:[0-9]+}", a.handleUpdateSilence).Methods("PUT")
+	a.router.HandleFunc("/silences/{id:[0-9]+}", a.handleDeleteSilence).Methods("DELETE")
+	a.router.HandleFunc("/alerts", a.handleGetAlerts).Methods("GET")
+	a.router.HandleFunc("/alerts/acknowledge", a.handleAcknowledgeAlert).Methods("POST")
+	a.router.HandleFunc("/routing", a.handleGetRouting).Methods("GET")
+	a.router.HandleFunc("/routing/dry-run", a.handleRoutingDryRun).Methods("POST")
+	a.router.HandleFunc("/heartbeats", a.handleGetHeartbeats).Methods("GET")
+	a.router.HandleFunc("/heartbeats", a.handleCreateHeartbeat).Methods("POST")
+	a.router.HandleFunc("/heartbeats/{id:[0-9]+}", a.handleGetHeartbeat).Methods("GET")
+	a.router.HandleFunc("/heartbeats/{id:[0-9]+}", a.handleDeleteHeartbeat).Methods("DELETE")
+	a.router.HandleFunc("/ping/{token}", a.handlePing(PingSuccess)).Methods("POST")
+	a.router.HandleFunc("/ping/{token}/start", a.handlePing(PingStart)).Methods("POST")
+	a.router.HandleFunc("/ping/{token}/fail", a.handlePing(PingFail)).Methods("POST")
+	a.router.HandleFunc("/probes", a.handleGetProbes).Methods("GET")
+	a.router.HandleFunc("/probes/assignment", a.handleGetProbeAssignment).Methods("GET")
+	a.router.HandleFunc("/probes/results", a.handlePostProbeResults).Methods("POST")
+	a.router.HandleFunc("/export", a.handleExport).Methods("GET")
+	a.router.HandleFunc("/admin/import", a.handleImport).Methods("POST")
+	a.router.HandleFunc("/admin/backup", a.handleBackup).Methods("GET")
+}
+
+func writeJSON(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
 }
 
 func (a *API) handleGetEndpoints(w http.ResponseWriter, r *http.Request) {
-	endpoints, err := a.handler.GetAllEndpoints()
+	selector, err := ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	endpoints, err := a.handler.ListEndpoints(selector)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	response := EndpointListResponse{
-		URLs: endpoints,
+		URLs:      make([]string, len(endpoints)),
+		Endpoints: endpoints,
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-		return
+	for i, endpoint := range endpoints {
+		response.URLs[i] = endpoint.URL
 	}
+
+	writeJSON(w, http.StatusOK, response)
 }
 
 func (a *API) handleGetEndpointHistory(w http.ResponseWriter, r *http.Request) {
@@ -52,60 +124,79 @@ func (a *API) handleGetEndpointHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	history, err := a.handler.GetEndpointHistory(url)
+	response, err := a.handler.GetHistoryResponse(url)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	if len(history) == 0 {
+	if response == nil {
 		http.Error(w, "Endpoint not found", http.StatusNotFound)
 		return
 	}
 
-	historyEntries := make([]HistoryEntry, len(history))
-	var successfulChecks int
-	var totalDuration time.Duration
-
-	for _, entry := range history {
-		var errorStr string
-		if entry.Error != nil {
-			errorStr = entry.Error.Error()
-		}
+	writeJSON(w, http.StatusOK, response)
+}
 
-		historyEntries = append(historyEntries, HistoryEntry{
-			Status:    entry.Status,
-			Expected:  entry.Endpoint.Status,
-			Error:     errorStr,
-			Timestamp: entry.Timestamp,
-			Duration:  entry.Duration,
-		})
+// handleGetEndpointBody returns the stored body of a check, as text since
+// the content type of the response is not stored.
+func (a *API) handleGetEndpointBody(w http.ResponseWriter, r *http.Request) {
+	url := r.URL.Query().Get("url")
+	if url == "" {
+		http.Error(w, "URL parameter is required", http.StatusBadRequest)
+		return
+	}
 
-		if entry.Error == nil {
-			successfulChecks++
+	var timestamp time.Time
+	if value := r.URL.Query().Get("timestamp"); value != "" {
+		var err error
+		if timestamp, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			http.Error(w, "Invalid timestamp parameter", http.StatusBadRequest)
+			return
 		}
-		totalDuration += entry.Duration
 	}
 
-	stats := EndpointStats{
-		TotalChecks:      len(history),
-		SuccessfulChecks: successfulChecks,
-		UpTimePercentage: float64(successfulChecks) / float64(len(history)) * 100,
-		AverageResponse:  totalDuration.Milliseconds() / int64(len(history)),
-		LastCheck:        history[len(history)-1].Timestamp.Format(time.RFC3339),
+	body, err := a.handler.GetBody(url, timestamp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if body == nil {
+		http.Error(w, "No body stored", http.StatusNotFound)
+		return
 	}
 
-	response := HistoryResponse{
-		URL:     url,
-		History: historyEntries,
-		Stats:   stats,
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Check-Timestamp", body.Timestamp.UTC().Format(time.RFC3339Nano))
+	w.Header().Set("X-Body-Hash", body.Hash)
+	w.Header().Set("X-Body-Size", strconv.FormatInt(body.Size, 10))
+	w.Header().Set("X-Body-Truncated", strconv.FormatBool(body.Truncated))
+	w.Header().Set("X-Stored-Size", strconv.FormatInt(body.StoredSize, 10))
+	w.Header().Set("X-Stored-Truncated", strconv.FormatBool(body.StoredTruncated))
+	w.Write(body.Data)
+}
+
+// handleCheckEndpoint checks an endpoint outside the schedule. It needs the
+// admin token, since every call makes a request to the endpoint, and the
+// check is stored even when the client disconnects before it finishes.
+func (a *API) handleCheckEndpoint(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	url := r.URL.Query().Get("url")
+	if url == "" {
+		http.Error(w, "URL parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	result, ok := a.scheduler.CheckNow(context.WithoutCancel(r.Context()), url)
+	if !ok {
+		http.Error(w, "Endpoint not found", http.StatusNotFound)
 		return
 	}
+
+	writeJSON(w, http.StatusOK, newHistoryEntry(result))
 }
 
 func (a *API) handleGetDomainHistory(w http.ResponseWriter, r *http.Request) {
@@ -115,6 +206,12 @@ func (a *API) handleGetDomainHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	selector, err := ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	endpoints, err := a.handler.GetDomainEndpoints(domain)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -126,63 +223,377 @@ func (a *API) handleGetDomainHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	endpointResponses := make([]HistoryResponse, 0, len(endpoints))
+	metas := make([]EndpointMeta, 0, len(endpoints))
 	for _, endpoint := range endpoints {
-		history, err := a.handler.GetEndpointHistory(endpoint)
+		meta, _, err := a.handler.GetEndpointMeta(endpoint)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-
-		if len(history) > 0 {
-			historyEntries := make([]HistoryEntry, len(history))
-			var successfulChecks int
-			var totalDuration time.Duration
-
-			for i, entry := range history {
-				var errorStr string
-				if entry.Error != nil {
-					errorStr = entry.Error.Error()
-				}
-
-				historyEntries[i] = HistoryEntry{
-					Status:    entry.Status,
-					Expected:  entry.Endpoint.Status,
-					Error:     errorStr,
-					Timestamp: entry.Timestamp,
-					Duration:  entry.Duration,
-				}
-
-				if entry.Error == nil {
-					successfulChecks++
-				}
-				totalDuration += entry.Duration
-			}
-
-			stats := EndpointStats{
-				TotalChecks:      len(history),
-				SuccessfulChecks: successfulChecks,
-				UpTimePercentage: float64(successfulChecks) / float64(len(history)) * 100,
-				AverageResponse:  totalDuration.Milliseconds() / int64(len(history)),
-				LastCheck:        history[len(history)-1].Timestamp.Format(time.RFC3339),
-			}
-
-			endpointResponses = append(endpointResponses, HistoryResponse{
-				URL:     endpoint,
-				History: historyEntries,
-				Stats:   stats,
-			})
+		if selector.Matches(meta.Labels) {
+			metas = append(metas, meta)
 		}
 	}
 
+	endpointResponses, err := a.historyResponses(metas)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	response := DomainResponse{
 		Domain:    domain,
 		Endpoints: endpointResponses,
+		Stats:     newDomainStats(endpointResponses),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *API) handleGetEndpointsHistory(w http.ResponseWriter, r *http.Request) {
+	selector, err := ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+
+	endpoints, err := a.handler.ListEndpoints(selector)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	endpointResponses, err := a.historyResponses(endpoints)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := HistoryListResponse{
+		Selector:  selector.String(),
+		Endpoints: endpointResponses,
+		Stats:     newDomainStats(endpointResponses),
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *API) handleGetStatus(w http.ResponseWriter, r *http.Request) {
+	response, err := a.handler.GetStatus(time.Now(), a.scheduler.quorumWindow())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *API) handleGetLocationStatus(w http.ResponseWriter, r *http.Request) {
+	response, err := a.handler.GetLocationStatus(a.scheduler.quorumWindow())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *API) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	selector, err := ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	endpoints, err := a.handler.ListEndpoints(selector)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	endpointResponses, err := a.historyResponses(endpoints)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slos, err := a.handler.GetSLOStatuses(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := writeMetrics(w, endpointResponses); err != nil {
+		http.Error(w, "Failed to write metrics", http.StatusInternalServerError)
+		return
+	}
+	if err := writeSLOMetrics(w, slos); err != nil {
+		http.Error(w, "Failed to write metrics", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *API) handleEvents(w http.ResponseWriter, r *http.Request) {
+	selector, err := ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := EventFilter{
+		URL:      r.URL.Query().Get("url"),
+		Domain:   r.URL.Query().Get("domain"),
+		Selector: selector,
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	var lastID uint64
+	if lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+
+	events := a.scheduler.Events()
+	sub, replay := events.Subscribe(filter, lastID)
+	defer events.Unsubscribe(sub)
+
+	// The server-wide write timeout would otherwise cut long-lived streams.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range replay {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+func newHistoryEntry(response EndpointResponse) HistoryEntry {
+	var errorStr string
+	if response.Error != nil {
+		errorStr = response.Error.Error()
+	}
+
+	return HistoryEntry{
+		Status:         response.Status,
+		Expected:       response.Endpoint.Status,
+		Error:          errorStr,
+		Category:       response.Category,
+		Timestamp:      response.Timestamp,
+		Duration:       response.Duration,
+		Maintenance:    response.Maintenance,
+		Flapping:       response.Flapping,
+		Degraded:       response.Degraded,
+		Anomaly:        response.Anomaly,
+		Anomalous:      response.Anomalous,
+		Location:       response.Location,
+		Ping:           response.Ping,
+		BodyHash:       response.BodyHash,
+		BodySize:       response.BodySize,
+		BodyStored:     response.BodyStored,
+		ContentHash:    response.ContentHash,
+		ContentChanged: response.ContentChanged,
+	}
+}
+
+// GetHistoryResponse returns the stored history of the endpoint with its
+// stats and maintenance windows, or nil when it has not been checked yet.
+func (h *EndpointHandler) GetHistoryResponse(url string) (*HistoryResponse, error) {
+	history, err := h.GetEndpointHistory(url)
+	if err != nil || len(history) == 0 {
+		return nil, err
+	}
+
+	meta, _, err := h.GetEndpointMeta(url)
+	if err != nil {
+		return nil, err
+	}
+	meta.URL = url
+
+	response := newHistoryResponse(meta, history)
+	response.Maintenance, err = h.EndpointMaintenanceWindows(meta, history[0].Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// historyResponses loads the history of each endpoint, skipping endpoints
+// that have not been checked yet.
+func (a *API) historyResponses(endpoints []EndpointMeta) ([]HistoryResponse, error) {
+	responses := make([]HistoryResponse, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		history, err := a.handler.GetEndpointHistory(endpoint.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(history) == 0 {
+			continue
+		}
+
+		response := newHistoryResponse(endpoint, history)
+		response.State, _ = quorumState(latestInWindow(history, a.scheduler.quorumWindow()), endpoint.Quorum)
+		response.Maintenance, err = a.handler.EndpointMaintenanceWindows(endpoint, history[0].Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+func newHistoryResponse(meta EndpointMeta, history []EndpointResponse) HistoryResponse {
+	historyEntries := make([]HistoryEntry, len(history))
+	var successfulChecks, maintenanceChecks, degradedChecks, anomalousChecks int
+	var totalDuration time.Duration
+
+	for i, entry := range history {
+		historyEntries[i] = newHistoryEntry(entry)
+		totalDuration += entry.Duration
+
+		// Checks run during maintenance are kept in the history but do not
+		// count towards uptime.
+		if entry.Maintenance {
+			maintenanceChecks++
+			continue
+		}
+		if entry.Error == nil {
+			successfulChecks++
+		}
+		if entry.Degraded != "" {
+			degradedChecks++
+		}
+		if entry.Anomalous {
+			anomalousChecks++
+		}
+	}
+
+	stats := EndpointStats{
+		TotalChecks:       len(history) - maintenanceChecks,
+		SuccessfulChecks:  successfulChecks,
+		MaintenanceChecks: maintenanceChecks,
+		DegradedChecks:    degradedChecks,
+		AnomalousChecks:   anomalousChecks,
+		UpTimePercentage:  100,
+		AverageResponse:   totalDuration.Milliseconds() / int64(len(history)),
+		LastCheck:         history[len(history)-1].Timestamp.Format(time.RFC3339),
+	}
+	if stats.TotalChecks > 0 {
+		stats.UpTimePercentage = float64(successfulChecks) / float64(stats.TotalChecks) * 100
+	}
+
+	return HistoryResponse{
+		URL:       meta.URL,
+		Domain:    meta.Domain,
+		Labels:    meta.Labels,
+		Flapping:  history[len(history)-1].Flapping,
+		History:   historyEntries,
+		Stats:     stats,
+		Locations: newLocationStats(history),
+	}
+}
+
+// newDomainStats aggregates the per-endpoint histories of a domain into
+// combined uptime, the least available endpoint and an overall status derived
+// from the state each endpoint's locations agree on and its most recent check.
+func newDomainStats(endpoints []HistoryResponse) DomainStats {
+	stats := DomainStats{
+		Status:      DomainOperational,
+		WorstUpTime: 100,
+	}
+
+	for _, endpoint := range endpoints {
+		stats.TotalChecks += endpoint.Stats.TotalChecks
+		stats.SuccessfulChecks += endpoint.Stats.SuccessfulChecks
+
+		if stats.WorstEndpoint == "" || endpoint.Stats.UpTimePercentage < stats.WorstUpTime {
+			stats.WorstEndpoint = endpoint.URL
+			stats.WorstUpTime = endpoint.Stats.UpTimePercentage
+		}
+
+		switch {
+		case len(endpoint.History) == 0:
+			stats.EndpointsUp++
+		case endpoint.History[len(endpoint.History)-1].Maintenance:
+			stats.EndpointsMaintenance++
+		case endpoint.State == StateDown:
+			stats.EndpointsDown++
+		case endpoint.History[len(endpoint.History)-1].Degraded != "":
+			stats.EndpointsUp++
+			stats.EndpointsDegraded++
+		default:
+			stats.EndpointsUp++
+		}
+	}
+
+	if stats.TotalChecks > 0 {
+		stats.UpTimePercentage = float64(stats.SuccessfulChecks) / float64(stats.TotalChecks) * 100
+	}
+
+	switch {
+	case stats.EndpointsDown == 0 && stats.EndpointsUp == 0 && stats.EndpointsMaintenance > 0:
+		stats.Status = DomainMaintenance
+	case stats.EndpointsDown == 0 && stats.EndpointsDegraded > 0:
+		stats.Status = DomainDegraded
+	case stats.EndpointsDown == 0:
+		stats.Status = DomainOperational
+	case stats.EndpointsUp == 0:
+		stats.Status = DomainMajorOutage
+	default:
+		stats.Status = DomainPartialOutage
+	}
+
+	return stats
 }
@@ -0,0 +1,67 @@
+package endpoint
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handleBackup streams a consistent copy of the database. Checks keep being
+// stored while it is written.
+func (a *API) handleBackup(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+
+	version, err := a.handler.SchemaVersion()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Large databases take longer than the server-wide write timeout.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	bw := &backupWriter{w: w}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="endpoints-%s.db"`, time.Now().UTC().Format(snapshotLayout)))
+	w.Header().Set("X-Schema-Version", strconv.Itoa(version))
+	if err := a.handler.Backup(bw); err != nil {
+		if !bw.written {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// The status has been sent, so the client only sees a truncated body.
+		log.Printf("Failed to stream backup: %v", err)
+	}
+}
+
+// authenticateAdmin checks the bearer token of the request against the admin
+// token, answering 401 when it does not match or none is configured.
+func (a *API) authenticateAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok && a.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.adminToken)) == 1 {
+		return true
+	}
+
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+// backupWriter records whether any of the backup reached the client.
+type backupWriter struct {
+	w       http.ResponseWriter
+	written bool
+}
+
+func (b *backupWriter) Write(p []byte) (int, error) {
+	b.written = true
+	return b.w.Write(p)
+}
@@ -0,0 +1,59 @@
+package endpoint
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func (a *API) handleGetContentChanges(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := ContentChangeFilter{URL: query.Get("url")}
+
+	var err error
+	if filter.Since, err = parseTimeParam(query.Get("since")); err != nil {
+		http.Error(w, "Invalid since parameter", http.StatusBadRequest)
+		return
+	}
+	if filter.Until, err = parseTimeParam(query.Get("until")); err != nil {
+		http.Error(w, "Invalid until parameter", http.StatusBadRequest)
+		return
+	}
+
+	changes, err := a.handler.GetContentChanges(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if changes == nil {
+		changes = []ContentChange{}
+	}
+
+	writeJSON(w, http.StatusOK, changes)
+}
+
+// handleGetContentChangeDiff returns the diff of a change as a patch, for
+// reading it in a terminal or applying it with patch.
+func (a *API) handleGetContentChangeDiff(w http.ResponseWriter, r *http.Request) {
+	change, err := a.handler.GetContentChange(changeID(r))
+	if errors.Is(err, ErrChangeNotFound) {
+		http.Error(w, "Change not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Diff-Truncated", strconv.FormatBool(change.DiffTruncated))
+	w.Write([]byte(change.Diff))
+}
+
+func changeID(r *http.Request) uint64 {
+	id, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	return id
+}
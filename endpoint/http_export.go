@@ -0,0 +1,77 @@
+package endpoint
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// maxImportBody bounds a single upload of checks to import.
+const maxImportBody = 256 << 20
+
+func (a *API) handleExport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = ExportCSV
+	}
+	if err := validateExportFormat(format); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	selector, err := ParseSelector(query.Get("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := ExportFilter{
+		URLs:     query["url"],
+		Domain:   query.Get("domain"),
+		Selector: selector,
+	}
+	if filter.Since, err = parseTimeParam(query.Get("since")); err != nil {
+		http.Error(w, "Invalid since parameter", http.StatusBadRequest)
+		return
+	}
+	if filter.Until, err = parseTimeParam(query.Get("until")); err != nil {
+		http.Error(w, "Invalid until parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Large exports take longer than the server-wide write timeout.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	contentType := "text/csv; charset=utf-8"
+	if format == ExportJSONLines {
+		contentType = "application/x-ndjson"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="history.%s"`, format))
+	if _, err := a.handler.Export(w, format, filter); err != nil {
+		// The status has been sent, so the client only sees a truncated body.
+		log.Printf("Failed to export history: %v", err)
+	}
+}
+
+func (a *API) handleImport(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if err := validateExportFormat(format); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := a.handler.Import(http.MaxBytesReader(w, r.Body, maxImportBody), format)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%v (imported %d checks before the error)", err, result.Imported), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
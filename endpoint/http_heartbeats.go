@@ -0,0 +1,120 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Tokens are left out of listed heartbeats, since a token is all it takes
+// to ping; it is only returned when the heartbeat is created.
+func (a *API) handleGetHeartbeats(w http.ResponseWriter, r *http.Request) {
+	heartbeats, err := a.handler.GetHeartbeats()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if heartbeats == nil {
+		heartbeats = []Heartbeat{}
+	}
+	for i := range heartbeats {
+		heartbeats[i].Token = ""
+	}
+
+	writeJSON(w, http.StatusOK, heartbeats)
+}
+
+func (a *API) handleGetHeartbeat(w http.ResponseWriter, r *http.Request) {
+	hb, err := a.handler.GetHeartbeat(heartbeatID(r))
+	if err != nil {
+		writeHeartbeatError(w, err)
+		return
+	}
+	hb.Token = ""
+
+	writeJSON(w, http.StatusOK, hb)
+}
+
+func (a *API) handleCreateHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+
+	var hb Heartbeat
+	if err := json.NewDecoder(r.Body).Decode(&hb); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	hb, err := a.handler.CreateHeartbeat(hb)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, hb)
+}
+
+func (a *API) handleDeleteHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+
+	if err := a.handler.DeleteHeartbeat(heartbeatID(r)); err != nil {
+		writeHeartbeatError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePing accepts a ping from a job. The request body is kept as the
+// job's log and an exit_code query parameter reports how the job ended.
+func (a *API) handlePing(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload := PingPayload{Kind: kind}
+
+		if value := r.URL.Query().Get("exit_code"); value != "" {
+			code, err := strconv.Atoi(value)
+			if err != nil {
+				http.Error(w, "Invalid exit_code parameter", http.StatusBadRequest)
+				return
+			}
+			payload.ExitCode = &code
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxPingLog))
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		payload.Log = string(body)
+
+		if _, err := a.scheduler.Ping(mux.Vars(r)["token"], payload); err != nil {
+			writeHeartbeatError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func heartbeatID(r *http.Request) uint64 {
+	id, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	return id
+}
+
+func writeHeartbeatError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrHeartbeatNotFound):
+		http.Error(w, "Heartbeat not found", http.StatusNotFound)
+	case errors.Is(err, ErrHeartbeatReadOnly):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,149 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func (a *API) handleGetIncidents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := IncidentFilter{
+		URL:    query.Get("url"),
+		Domain: query.Get("domain"),
+		Status: query.Get("status"),
+	}
+
+	if filter.Status != "" && filter.Status != IncidentOpen && filter.Status != IncidentResolved {
+		http.Error(w, "Status must be open or resolved", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if filter.Since, err = parseTimeParam(query.Get("since")); err != nil {
+		http.Error(w, "Invalid since parameter", http.StatusBadRequest)
+		return
+	}
+	if filter.Until, err = parseTimeParam(query.Get("until")); err != nil {
+		http.Error(w, "Invalid until parameter", http.StatusBadRequest)
+		return
+	}
+
+	incidents, err := a.handler.GetIncidents(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if incidents == nil {
+		incidents = []Incident{}
+	}
+
+	writeJSON(w, http.StatusOK, incidents)
+}
+
+func (a *API) handleGetIncident(w http.ResponseWriter, r *http.Request) {
+	incident, err := a.handler.GetIncident(incidentID(r))
+	if err != nil {
+		writeIncidentError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, incident)
+}
+
+func (a *API) handleAddIncidentNote(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+
+	var note IncidentNote
+	if err := json.NewDecoder(r.Body).Decode(&note); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if note.Text == "" {
+		http.Error(w, "Note text is required", http.StatusBadRequest)
+		return
+	}
+	note.CreatedAt = time.Now()
+
+	incident, err := a.handler.AddIncidentNote(incidentID(r), note)
+	if err != nil {
+		writeIncidentError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, incident)
+}
+
+func (a *API) handleAcknowledgeIncident(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+
+	var request AcknowledgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if request.By == "" {
+		http.Error(w, "Acknowledging operator is required", http.StatusBadRequest)
+		return
+	}
+
+	incident, err := a.handler.AcknowledgeIncident(incidentID(r), request.By)
+	if err != nil {
+		writeIncidentError(w, err)
+		return
+	}
+
+	for _, endpoint := range incident.Endpoints {
+		if endpoint.ResolvedAt == nil {
+			a.scheduler.Alerter().Acknowledge(endpoint.URL, request.By, time.Now())
+		}
+	}
+
+	writeJSON(w, http.StatusOK, incident)
+}
+
+func (a *API) handleGetReliability(w http.ResponseWriter, r *http.Request) {
+	url := r.URL.Query().Get("url")
+	if url == "" {
+		http.Error(w, "URL parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := a.handler.GetReliability(url)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func incidentID(r *http.Request) uint64 {
+	// The route only matches digits, so parsing can only fail on overflow,
+	// which is as good as a missing incident.
+	id, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	return id
+}
+
+func writeIncidentError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrIncidentNotFound) {
+		http.Error(w, "Incident not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,114 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func (a *API) handleGetMaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	windows, err := a.handler.GetMaintenanceWindows()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("active") == "true" {
+		now := time.Now()
+		active := windows[:0]
+		for _, window := range windows {
+			if window.ActiveAt(now) {
+				active = append(active, window)
+			}
+		}
+		windows = active
+	}
+	if windows == nil {
+		windows = []MaintenanceWindow{}
+	}
+
+	writeJSON(w, http.StatusOK, windows)
+}
+
+func (a *API) handleGetMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	window, err := a.handler.GetMaintenanceWindow(maintenanceID(r))
+	if err != nil {
+		writeMaintenanceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, window)
+}
+
+func (a *API) handleCreateMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+
+	var window MaintenanceWindow
+	if err := json.NewDecoder(r.Body).Decode(&window); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	window, err := a.handler.CreateMaintenanceWindow(window)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, window)
+}
+
+func (a *API) handleUpdateMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+
+	var window MaintenanceWindow
+	if err := json.NewDecoder(r.Body).Decode(&window); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	window, err := a.handler.UpdateMaintenanceWindow(maintenanceID(r), window)
+	if err != nil {
+		writeMaintenanceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, window)
+}
+
+func (a *API) handleDeleteMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+
+	if err := a.handler.DeleteMaintenanceWindow(maintenanceID(r)); err != nil {
+		writeMaintenanceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func maintenanceID(r *http.Request) uint64 {
+	id, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	return id
+}
+
+func writeMaintenanceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrMaintenanceNotFound):
+		http.Error(w, "Maintenance window not found", http.StatusNotFound)
+	case errors.Is(err, ErrMaintenanceReadOnly):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,54 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxProbeResultsBody bounds a single upload of probe results.
+const maxProbeResultsBody = 16 << 20
+
+func (a *API) handleGetProbes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.scheduler.Probes())
+}
+
+func (a *API) handleGetProbeAssignment(w http.ResponseWriter, r *http.Request) {
+	probe, ok := a.authenticateProbe(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.scheduler.Assignment(probe, time.Now()))
+}
+
+func (a *API) handlePostProbeResults(w http.ResponseWriter, r *http.Request) {
+	probe, ok := a.authenticateProbe(w, r)
+	if !ok {
+		return
+	}
+
+	var results []ProbeResult
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxProbeResultsBody)).Decode(&results); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.scheduler.Ingest(probe, results, time.Now()))
+}
+
+// authenticateProbe looks up the probe by the bearer token of the request,
+// answering 401 when there is none.
+func (a *API) authenticateProbe(w http.ResponseWriter, r *http.Request) (Probe, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok {
+		if probe, found := a.scheduler.Probe(token); found {
+			return probe, true
+		}
+	}
+
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return Probe{}, false
+}
@@ -0,0 +1,47 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+func (a *API) handleGetRouting(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.scheduler.Alerter().Routing())
+}
+
+// handleRoutingDryRun reports how an alert would be routed. The domain and
+// labels of a known endpoint are filled in when the request leaves them out.
+func (a *API) handleRoutingDryRun(w http.ResponseWriter, r *http.Request) {
+	var alert Alert
+	if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if alert.URL == "" {
+		http.Error(w, "URL is required", http.StatusBadRequest)
+		return
+	}
+	if alert.Kind == "" {
+		alert.Kind = AlertDown
+	}
+	if alert.Timestamp.IsZero() {
+		alert.Timestamp = time.Now()
+	}
+
+	meta, found, err := a.handler.GetEndpointMeta(alert.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if found {
+		if alert.Domain == "" {
+			alert.Domain = meta.Domain
+		}
+		if alert.Labels == nil {
+			alert.Labels = meta.Labels
+		}
+	}
+
+	writeJSON(w, http.StatusOK, a.scheduler.Alerter().Plan(alert, alert.Timestamp))
+}
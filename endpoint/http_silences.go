@@ -0,0 +1,152 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func (a *API) handleGetSilences(w http.ResponseWriter, r *http.Request) {
+	silences, err := a.handler.GetSilences()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	status := r.URL.Query().Get("status")
+	filtered := []Silence{}
+	for _, silence := range silences {
+		silence.Status = silence.StatusAt(now)
+		if status == "" || silence.Status == status {
+			filtered = append(filtered, silence)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, filtered)
+}
+
+func (a *API) handleGetSilence(w http.ResponseWriter, r *http.Request) {
+	silence, err := a.handler.GetSilence(silenceID(r))
+	if err != nil {
+		writeSilenceError(w, err)
+		return
+	}
+
+	silence.Status = silence.StatusAt(time.Now())
+	writeJSON(w, http.StatusOK, silence)
+}
+
+func (a *API) handleCreateSilence(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+
+	var silence Silence
+	if err := json.NewDecoder(r.Body).Decode(&silence); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	silence, err := a.handler.CreateSilence(silence, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	silence.Status = silence.StatusAt(now)
+	writeJSON(w, http.StatusCreated, silence)
+}
+
+func (a *API) handleUpdateSilence(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+
+	var silence Silence
+	if err := json.NewDecoder(r.Body).Decode(&silence); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	silence, err := a.handler.UpdateSilence(silenceID(r), silence, now)
+	if err != nil {
+		writeSilenceError(w, err)
+		return
+	}
+
+	silence.Status = silence.StatusAt(now)
+	writeJSON(w, http.StatusOK, silence)
+}
+
+// handleDeleteSilence expires the silence; it stays listed for audit.
+func (a *API) handleDeleteSilence(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+
+	now := time.Now()
+	silence, err := a.handler.ExpireSilence(silenceID(r), now)
+	if err != nil {
+		writeSilenceError(w, err)
+		return
+	}
+
+	silence.Status = silence.StatusAt(now)
+	writeJSON(w, http.StatusOK, silence)
+}
+
+func (a *API) handleGetAlerts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.scheduler.Alerter().ActiveAlerts())
+}
+
+func (a *API) handleAcknowledgeAlert(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+
+	var request AcknowledgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if request.URL == "" || request.By == "" {
+		http.Error(w, "URL and acknowledging operator are required", http.StatusBadRequest)
+		return
+	}
+
+	if !a.scheduler.Alerter().Acknowledge(request.URL, request.By, time.Now()) {
+		http.Error(w, "No active alert for URL", http.StatusNotFound)
+		return
+	}
+
+	for _, alert := range a.scheduler.Alerter().ActiveAlerts() {
+		if alert.Alert.URL == request.URL {
+			writeJSON(w, http.StatusOK, alert)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func silenceID(r *http.Request) uint64 {
+	id, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	return id
+}
+
+func writeSilenceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrSilenceNotFound):
+		http.Error(w, "Silence not found", http.StatusNotFound)
+	case errors.Is(err, ErrSilenceExpired):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
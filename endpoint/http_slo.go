@@ -0,0 +1,27 @@
+package endpoint
+
+import (
+	"net/http"
+	"time"
+)
+
+func (a *API) handleGetSLOs(w http.ResponseWriter, r *http.Request) {
+	statuses, err := a.handler.GetSLOStatuses(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if name := r.URL.Query().Get("name"); name != "" {
+		for _, status := range statuses {
+			if status.Name == name {
+				writeJSON(w, http.StatusOK, status)
+				return
+			}
+		}
+		http.Error(w, "SLO not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
@@ -1,32 +1,40 @@
 package endpoint
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"strings"
 	"testing"
 	"time"
 )
 
 func TestAPI(t *testing.T) {
-	tmpDB := "test_api.db"
-	defer os.Remove(tmpDB)
+	handler := NewStoreHandler(NewMemoryStore(), 10)
 
-	handler, err := NewEndpointHandler(tmpDB, 10)
-	if err != nil {
-		t.Fatalf("Failed to create handler: %v", err)
-	}
-	defer handler.Close()
-
-	api := NewAPI(handler)
+	api := NewAPI(handler, NewScheduler(handler, time.Minute, nil))
 
 	testEndpoint := EndpointRequest{
 		URL:     "https://test.com",
+		Domain:  "test",
+		Labels:  map[string]string{"env": "prod", "team": "payments"},
 		Method:  "GET",
 		Timeout: time.Second,
 		Status:  http.StatusOK,
 	}
+	failingEndpoint := EndpointRequest{
+		URL:     "https://failing.test.com",
+		Domain:  "test",
+		Labels:  map[string]string{"env": "staging"},
+		Method:  "GET",
+		Timeout: time.Second,
+		Status:  http.StatusOK,
+	}
+	if err := handler.RegisterEndpoints([]EndpointRequest{testEndpoint, failingEndpoint}); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
 
 	for i := 0; i < 3; i++ {
 		response := EndpointResponse{
@@ -40,6 +48,16 @@ func TestAPI(t *testing.T) {
 		}
 	}
 
+	failure := EndpointResponse{
+		Endpoint:  failingEndpoint,
+		Status:    http.StatusBadGateway,
+		Error:     fmt.Errorf("received error status code: %d", http.StatusBadGateway),
+		Timestamp: time.Now(),
+	}
+	if err := handler.storeResponse(failure); err != nil {
+		t.Fatalf("Failed to store test response: %v", err)
+	}
+
 	tests := []struct {
 		name           string
 		path           string
@@ -55,11 +73,61 @@ func TestAPI(t *testing.T) {
 				if err := json.Unmarshal(body, &response); err != nil {
 					t.Fatalf("Failed to unmarshal response: %v", err)
 				}
-				if len(response.URLs) != 1 {
-					t.Errorf("Expected 1 endpoint, got %d", len(response.URLs))
+				if len(response.URLs) != 2 {
+					t.Errorf("Expected 2 endpoints, got %d", len(response.URLs))
 				}
-				if response.URLs[0] != "https://test.com" {
-					t.Errorf("Expected URL https://test.com, got %s", response.URLs[0])
+			},
+		},
+		{
+			name:           "get endpoints list - selector",
+			path:           "/endpoints?selector=env=prod,team=payments",
+			expectedStatus: http.StatusOK,
+			validateBody: func(t *testing.T, body []byte) {
+				var response EndpointListResponse
+				if err := json.Unmarshal(body, &response); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if len(response.Endpoints) != 1 {
+					t.Fatalf("Expected 1 endpoint, got %d", len(response.Endpoints))
+				}
+				if response.Endpoints[0].Labels["team"] != "payments" {
+					t.Errorf("Expected team label payments, got %v", response.Endpoints[0].Labels)
+				}
+			},
+		},
+		{
+			name:           "get endpoints list - invalid selector",
+			path:           "/endpoints?selector==prod",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "get endpoints history - selector",
+			path:           "/endpoints/history?selector=env!=prod",
+			expectedStatus: http.StatusOK,
+			validateBody: func(t *testing.T, body []byte) {
+				var response HistoryListResponse
+				if err := json.Unmarshal(body, &response); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if len(response.Endpoints) != 1 || response.Endpoints[0].URL != "https://failing.test.com" {
+					t.Fatalf("Expected only https://failing.test.com, got %+v", response.Endpoints)
+				}
+				if response.Stats.Status != DomainMajorOutage {
+					t.Errorf("Expected status %s, got %s", DomainMajorOutage, response.Stats.Status)
+				}
+			},
+		},
+		{
+			name:           "get metrics - selector",
+			path:           "/metrics?selector=team=payments",
+			expectedStatus: http.StatusOK,
+			validateBody: func(t *testing.T, body []byte) {
+				want := `cron_endpoint_up{url="https://test.com",domain="test",env="prod",team="payments"} 1`
+				if !strings.Contains(string(body), want) {
+					t.Errorf("Expected metrics to contain %s, got:\n%s", want, body)
+				}
+				if strings.Contains(string(body), "failing.test.com") {
+					t.Errorf("Expected failing.test.com to be filtered out")
 				}
 			},
 		},
@@ -78,8 +146,39 @@ func TestAPI(t *testing.T) {
 				if response.Stats.TotalChecks != 3 {
 					t.Errorf("Expected 3 total checks, got %d", response.Stats.TotalChecks)
 				}
+				if response.Domain != "test" || response.Labels["env"] != "prod" {
+					t.Errorf("Expected domain and labels, got %s %v", response.Domain, response.Labels)
+				}
 			},
 		},
+		{
+			name:           "get domain history",
+			path:           "/domain/history?domain=test",
+			expectedStatus: http.StatusOK,
+			validateBody: func(t *testing.T, body []byte) {
+				var response DomainResponse
+				if err := json.Unmarshal(body, &response); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if len(response.Endpoints) != 2 {
+					t.Errorf("Expected 2 endpoints, got %d", len(response.Endpoints))
+				}
+				if response.Stats.TotalChecks != 4 || response.Stats.SuccessfulChecks != 3 {
+					t.Errorf("Expected 3/4 successful checks, got %d/%d", response.Stats.SuccessfulChecks, response.Stats.TotalChecks)
+				}
+				if response.Stats.WorstEndpoint != "https://failing.test.com" {
+					t.Errorf("Expected worst endpoint https://failing.test.com, got %s", response.Stats.WorstEndpoint)
+				}
+				if response.Stats.Status != DomainPartialOutage {
+					t.Errorf("Expected status %s, got %s", DomainPartialOutage, response.Stats.Status)
+				}
+			},
+		},
+		{
+			name:           "get domain history - substring does not match",
+			path:           "/domain/history?domain=tes",
+			expectedStatus: http.StatusNotFound,
+		},
 		{
 			name:           "get endpoint history - missing url",
 			path:           "/endpoint/history",
@@ -109,3 +208,61 @@ func TestAPI(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckEndpointAPI(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ep := EndpointRequest{URL: server.URL, Domain: "test", Method: "GET", Timeout: time.Second, Status: http.StatusOK}
+	if err := handler.RegisterEndpoints([]EndpointRequest{ep}); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
+	api := NewAPI(handler, NewScheduler(handler, time.Minute, []EndpointRequest{ep}))
+	api.adminToken = "secret"
+
+	tests := []struct {
+		name           string
+		path           string
+		token          string
+		expectedStatus int
+	}{
+		{"no token", "/endpoint/check?url=" + server.URL, "", http.StatusUnauthorized},
+		{"wrong token", "/endpoint/check?url=" + server.URL, "other", http.StatusUnauthorized},
+		{"missing url", "/endpoint/check", "secret", http.StatusBadRequest},
+		{"unknown endpoint", "/endpoint/check?url=https://nonexistent.com", "secret", http.StatusNotFound},
+		{"configured endpoint", "/endpoint/check?url=" + server.URL, "secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			api.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+
+	// A client that disconnects does not cancel the check.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("POST", "/endpoint/check?url="+server.URL, nil).WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer secret")
+	api.ServeHTTP(httptest.NewRecorder(), req)
+
+	history, err := handler.GetEndpointHistory(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if len(history) != 2 || history[0].Status != http.StatusOK || history[1].Status != http.StatusOK {
+		t.Errorf("Expected both checks to be stored, got %+v", history)
+	}
+}
@@ -0,0 +1,275 @@
+package endpoint
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+const (
+	incidentBucket = "incidents"
+
+	IncidentOpen     = "open"
+	IncidentResolved = "resolved"
+)
+
+var ErrIncidentNotFound = errors.New("incident not found")
+
+// RecordIncidentTransition opens or resolves incidents from an endpoint state
+// change. An endpoint going down joins the open incident of its domain if
+// there is one, so a domain-wide outage is tracked as a single incident. The
+// touched incident is returned, or nil when the change did not affect one.
+func (h *EndpointHandler) RecordIncidentTransition(change StateChange) (*Incident, error) {
+	switch {
+	case change.To == StateDown:
+		return h.openIncident(change)
+	case change.From == StateDown:
+		return h.resolveIncident(change)
+	}
+	return nil, nil
+}
+
+func (h *EndpointHandler) openIncident(change StateChange) (*Incident, error) {
+	var incident *Incident
+
+	err := h.store.Update(func(tx RecordTx) error {
+		var domainIncident *Incident
+		var alreadyOpen bool
+
+		err := forEachRecord(tx, incidentBucket, func(i Incident) error {
+			if i.Status != IncidentOpen {
+				return nil
+			}
+			if i.activeEndpoint(change.URL) != nil {
+				alreadyOpen = true
+			}
+			if change.Domain != "" && i.Domain == change.Domain {
+				domainIncident = &i
+			}
+			return nil
+		})
+		if err != nil || alreadyOpen {
+			return err
+		}
+
+		span := IncidentEndpoint{
+			URL:       change.URL,
+			StartedAt: change.Timestamp,
+			Error:     change.Error,
+			Category:  change.Category,
+		}
+
+		if domainIncident != nil {
+			domainIncident.Endpoints = append(domainIncident.Endpoints, span)
+			incident = domainIncident
+			return putRecord(tx, incidentBucket, incident.ID, incident)
+		}
+
+		id, err := nextRecordID(tx, incidentBucket)
+		if err != nil {
+			return err
+		}
+
+		incident = &Incident{
+			ID:         id,
+			Domain:     change.Domain,
+			Status:     IncidentOpen,
+			StartedAt:  change.Timestamp,
+			FirstError: change.Error,
+			Category:   change.Category,
+			Endpoints:  []IncidentEndpoint{span},
+			Notes:      []IncidentNote{},
+		}
+		return putRecord(tx, incidentBucket, id, incident)
+	})
+
+	return incident, err
+}
+
+func (h *EndpointHandler) resolveIncident(change StateChange) (*Incident, error) {
+	var incident *Incident
+
+	err := h.store.Update(func(tx RecordTx) error {
+		err := forEachRecord(tx, incidentBucket, func(i Incident) error {
+			if i.Status == IncidentOpen && i.activeEndpoint(change.URL) != nil {
+				incident = &i
+			}
+			return nil
+		})
+		if err != nil || incident == nil {
+			return err
+		}
+
+		resolvedAt := change.Timestamp
+		incident.activeEndpoint(change.URL).ResolvedAt = &resolvedAt
+
+		for _, endpoint := range incident.Endpoints {
+			if endpoint.ResolvedAt == nil {
+				return putRecord(tx, incidentBucket, incident.ID, incident)
+			}
+		}
+
+		incident.Status = IncidentResolved
+		incident.ResolvedAt = &resolvedAt
+		incident.Duration = resolvedAt.Sub(incident.StartedAt)
+		return putRecord(tx, incidentBucket, incident.ID, incident)
+	})
+
+	return incident, err
+}
+
+// GetIncidents returns the incidents matching the filter, newest first.
+func (h *EndpointHandler) GetIncidents(filter IncidentFilter) ([]Incident, error) {
+	var incidents []Incident
+
+	err := h.store.View(func(tx RecordTx) error {
+		return forEachRecord(tx, incidentBucket, func(i Incident) error {
+			if filter.Matches(i) {
+				incidents = append(incidents, i)
+			}
+			return nil
+		})
+	})
+
+	sort.Slice(incidents, func(a, b int) bool {
+		return incidents[a].ID > incidents[b].ID
+	})
+
+	return incidents, err
+}
+
+func (h *EndpointHandler) GetIncident(id uint64) (Incident, error) {
+	var incident Incident
+
+	err := h.store.View(func(tx RecordTx) error {
+		found, err := getRecord(tx, incidentBucket, id, &incident)
+		if err == nil && !found {
+			return ErrIncidentNotFound
+		}
+		return err
+	})
+
+	return incident, err
+}
+
+func (h *EndpointHandler) AddIncidentNote(id uint64, note IncidentNote) (Incident, error) {
+	return h.updateIncident(id, func(incident *Incident) {
+		if note.CreatedAt.IsZero() {
+			note.CreatedAt = time.Now()
+		}
+		incident.Notes = append(incident.Notes, note)
+	})
+}
+
+// AcknowledgeIncident marks an incident as being handled. Acknowledging an
+// incident twice keeps the original acknowledgement.
+func (h *EndpointHandler) AcknowledgeIncident(id uint64, by string) (Incident, error) {
+	return h.updateIncident(id, func(incident *Incident) {
+		if incident.AcknowledgedAt != nil {
+			return
+		}
+		now := time.Now()
+		incident.AcknowledgedAt = &now
+		incident.AcknowledgedBy = by
+	})
+}
+
+func (h *EndpointHandler) updateIncident(id uint64, update func(*Incident)) (Incident, error) {
+	var incident Incident
+
+	err := h.store.Update(func(tx RecordTx) error {
+		found, err := getRecord(tx, incidentBucket, id, &incident)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrIncidentNotFound
+		}
+
+		update(&incident)
+		return putRecord(tx, incidentBucket, id, &incident)
+	})
+
+	return incident, err
+}
+
+// GetReliability computes the mean time to recovery and the mean time between
+// failures of an endpoint from its resolved incident spans.
+func (h *EndpointHandler) GetReliability(url string) (ReliabilityStats, error) {
+	stats := ReliabilityStats{URL: url}
+
+	incidents, err := h.GetIncidents(IncidentFilter{URL: url})
+	if err != nil {
+		return stats, err
+	}
+
+	var spans []IncidentEndpoint
+	for _, incident := range incidents {
+		for _, endpoint := range incident.Endpoints {
+			if endpoint.URL != url {
+				continue
+			}
+			stats.Incidents++
+			if endpoint.ResolvedAt == nil {
+				stats.Ongoing = true
+				continue
+			}
+			spans = append(spans, endpoint)
+		}
+	}
+
+	sort.Slice(spans, func(a, b int) bool {
+		return spans[a].StartedAt.Before(spans[b].StartedAt)
+	})
+
+	var downtime, uptime time.Duration
+	for i, span := range spans {
+		downtime += span.ResolvedAt.Sub(span.StartedAt)
+		if i > 0 {
+			uptime += span.StartedAt.Sub(*spans[i-1].ResolvedAt)
+		}
+	}
+
+	stats.TotalDowntimeSeconds = downtime.Seconds()
+	if len(spans) > 0 {
+		stats.MTTRSeconds = downtime.Seconds() / float64(len(spans))
+	}
+	if len(spans) > 1 {
+		stats.MTBFSeconds = uptime.Seconds() / float64(len(spans)-1)
+	}
+
+	return stats, nil
+}
+
+func (i *Incident) activeEndpoint(url string) *IncidentEndpoint {
+	for j := range i.Endpoints {
+		if i.Endpoints[j].URL == url && i.Endpoints[j].ResolvedAt == nil {
+			return &i.Endpoints[j]
+		}
+	}
+	return nil
+}
+
+func (f IncidentFilter) Matches(incident Incident) bool {
+	if f.Status != "" && incident.Status != f.Status {
+		return false
+	}
+	if f.Domain != "" && incident.Domain != f.Domain {
+		return false
+	}
+	if !f.Since.IsZero() && incident.StartedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && incident.StartedAt.After(f.Until) {
+		return false
+	}
+	if f.URL == "" {
+		return true
+	}
+	for _, endpoint := range incident.Endpoints {
+		if endpoint.URL == f.URL {
+			return true
+		}
+	}
+	return false
+}
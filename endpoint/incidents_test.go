@@ -0,0 +1,224 @@
+package endpoint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIncidentLifecycle(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+
+	start := time.Date(2024, 11, 15, 10, 0, 0, 0, time.UTC)
+	transitions := []StateChange{
+		{URL: "https://a.test.com", Domain: "test", From: StateUp, To: StateDown, Timestamp: start, Error: "received error status code: 502", Category: CategoryStatus},
+		{URL: "https://b.test.com", Domain: "test", From: StateUp, To: StateDown, Timestamp: start.Add(time.Minute), Category: CategoryTimeout},
+		{URL: "https://a.test.com", Domain: "test", From: StateDown, To: StateUp, Timestamp: start.Add(10 * time.Minute)},
+		{URL: "https://b.test.com", Domain: "test", From: StateDown, To: StateUp, Timestamp: start.Add(21 * time.Minute)},
+		{URL: "https://a.test.com", Domain: "test", From: StateUp, To: StateDown, Timestamp: start.Add(70 * time.Minute)},
+		{URL: "https://a.test.com", Domain: "test", From: StateDown, To: StateDown, Timestamp: start.Add(80 * time.Minute)},
+		{URL: "https://a.test.com", Domain: "test", From: StateDown, To: StateUp, Timestamp: start.Add(90 * time.Minute)},
+	}
+
+	for _, change := range transitions {
+		if _, err := handler.RecordIncidentTransition(change); err != nil {
+			t.Fatalf("Failed to record transition: %v", err)
+		}
+	}
+
+	incidents, err := handler.GetIncidents(IncidentFilter{})
+	if err != nil {
+		t.Fatalf("Failed to get incidents: %v", err)
+	}
+	if len(incidents) != 2 {
+		t.Fatalf("Expected 2 incidents, got %d", len(incidents))
+	}
+
+	first := incidents[1]
+	if len(first.Endpoints) != 2 {
+		t.Errorf("Expected domain outage to group 2 endpoints, got %d", len(first.Endpoints))
+	}
+	if first.Status != IncidentResolved || first.Duration != 21*time.Minute {
+		t.Errorf("Expected resolved incident lasting 21m, got %s lasting %v", first.Status, first.Duration)
+	}
+	if first.FirstError != "received error status code: 502" || first.Category != CategoryStatus {
+		t.Errorf("Expected first error and category to be kept, got %q %q", first.FirstError, first.Category)
+	}
+
+	stats, err := handler.GetReliability("https://a.test.com")
+	if err != nil {
+		t.Fatalf("Failed to get reliability: %v", err)
+	}
+	if stats.Incidents != 2 {
+		t.Errorf("Expected 2 incidents, got %d", stats.Incidents)
+	}
+	if stats.MTTRSeconds != (15 * time.Minute).Seconds() {
+		t.Errorf("Expected MTTR of 15m, got %vs", stats.MTTRSeconds)
+	}
+	if stats.MTBFSeconds != (60 * time.Minute).Seconds() {
+		t.Errorf("Expected MTBF of 60m, got %vs", stats.MTBFSeconds)
+	}
+
+	filtered, err := handler.GetIncidents(IncidentFilter{URL: "https://b.test.com"})
+	if err != nil {
+		t.Fatalf("Failed to get incidents: %v", err)
+	}
+	if len(filtered) != 1 {
+		t.Errorf("Expected 1 incident for b.test.com, got %d", len(filtered))
+	}
+}
+
+func TestIncidentAPI(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+
+	scheduler := NewScheduler(handler, time.Minute, nil)
+	api := NewAPI(handler, scheduler)
+	api.adminToken = "secret"
+
+	endpoint := EndpointRequest{URL: "https://test.com", Domain: "test", Status: http.StatusOK}
+	scheduler.record(EndpointResponse{Endpoint: endpoint, Status: http.StatusOK, Timestamp: time.Now()})
+	scheduler.record(EndpointResponse{
+		Endpoint:  endpoint,
+		Status:    http.StatusServiceUnavailable,
+		Error:     fmt.Errorf("received error status code: %d", http.StatusServiceUnavailable),
+		Category:  CategoryStatus,
+		Timestamp: time.Now(),
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+		validateBody   func(t *testing.T, body []byte)
+	}{
+		{
+			name:           "list open incidents",
+			method:         "GET",
+			path:           "/incidents?status=open&domain=test",
+			expectedStatus: http.StatusOK,
+			validateBody: func(t *testing.T, body []byte) {
+				var incidents []Incident
+				if err := json.Unmarshal(body, &incidents); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if len(incidents) != 1 {
+					t.Fatalf("Expected 1 open incident, got %d", len(incidents))
+				}
+				if incidents[0].Category != CategoryStatus {
+					t.Errorf("Expected category %s, got %s", CategoryStatus, incidents[0].Category)
+				}
+			},
+		},
+		{
+			name:           "list incidents - invalid status",
+			method:         "GET",
+			path:           "/incidents?status=closed",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "add note - no token",
+			method:         "POST",
+			path:           "/incidents/1/notes",
+			body:           `{"author":"alice","text":"Upstream provider is degraded"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "add note",
+			method:         "POST",
+			path:           "/incidents/1/notes",
+			token:          "secret",
+			body:           `{"author":"alice","text":"Upstream provider is degraded"}`,
+			expectedStatus: http.StatusOK,
+			validateBody: func(t *testing.T, body []byte) {
+				var incident Incident
+				if err := json.Unmarshal(body, &incident); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if len(incident.Notes) != 1 || incident.Notes[0].Author != "alice" {
+					t.Errorf("Expected note from alice, got %+v", incident.Notes)
+				}
+			},
+		},
+		{
+			name:           "add note - empty text",
+			method:         "POST",
+			path:           "/incidents/1/notes",
+			token:          "secret",
+			body:           `{"author":"alice"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "acknowledge - wrong token",
+			method:         "POST",
+			path:           "/incidents/1/acknowledge",
+			token:          "other",
+			body:           `{"by":"bob"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "acknowledge",
+			method:         "POST",
+			path:           "/incidents/1/acknowledge",
+			token:          "secret",
+			body:           `{"by":"bob"}`,
+			expectedStatus: http.StatusOK,
+			validateBody: func(t *testing.T, body []byte) {
+				var incident Incident
+				if err := json.Unmarshal(body, &incident); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if incident.AcknowledgedAt == nil || incident.AcknowledgedBy != "bob" {
+					t.Errorf("Expected incident acknowledged by bob, got %+v", incident)
+				}
+			},
+		},
+		{
+			name:           "get incident - not found",
+			method:         "GET",
+			path:           "/incidents/42",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "reliability",
+			method:         "GET",
+			path:           "/endpoint/reliability?url=https://test.com",
+			expectedStatus: http.StatusOK,
+			validateBody: func(t *testing.T, body []byte) {
+				var stats ReliabilityStats
+				if err := json.Unmarshal(body, &stats); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if stats.Incidents != 1 || !stats.Ongoing {
+					t.Errorf("Expected 1 ongoing incident, got %+v", stats)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+
+			api.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+
+			if tt.validateBody != nil && rr.Code == http.StatusOK {
+				tt.validateBody(t, rr.Body.Bytes())
+			}
+		})
+	}
+}
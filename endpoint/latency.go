@@ -0,0 +1,17 @@
+package endpoint
+
+import "time"
+
+// latencyLevel classifies a successful check by its duration against the
+// endpoint's latency thresholds, returning the severity of the threshold it
+// reached or an empty string when it is within both.
+func (e EndpointRequest) latencyLevel(d time.Duration) string {
+	switch {
+	case e.LatencyCritical > 0 && d >= e.LatencyCritical:
+		return SeverityCritical
+	case e.LatencyWarning > 0 && d >= e.LatencyWarning:
+		return SeverityWarning
+	default:
+		return ""
+	}
+}
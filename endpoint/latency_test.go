@@ -0,0 +1,104 @@
+package endpoint
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencyLevel(t *testing.T) {
+	endpoint := EndpointRequest{LatencyWarning: 2 * time.Second, LatencyCritical: 5 * time.Second}
+
+	tests := []struct {
+		name     string
+		endpoint EndpointRequest
+		duration time.Duration
+		want     string
+	}{
+		{"fast", endpoint, time.Second, ""},
+		{"warning", endpoint, 2 * time.Second, SeverityWarning},
+		{"critical", endpoint, 9 * time.Second, SeverityCritical},
+		{"no thresholds", EndpointRequest{}, time.Minute, ""},
+		{"critical only", EndpointRequest{LatencyCritical: 5 * time.Second}, 3 * time.Second, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.endpoint.latencyLevel(tt.duration); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSchedulerDegraded(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 20)
+
+	endpoint := EndpointRequest{
+		URL:             "https://test.com",
+		Status:          http.StatusOK,
+		LatencyWarning:  2 * time.Second,
+		LatencyCritical: 5 * time.Second,
+		DegradedAfter:   2,
+	}
+	if err := handler.RegisterEndpoints([]EndpointRequest{endpoint}); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
+
+	alerts := make(channelNotifier, 16)
+	scheduler := NewScheduler(handler, time.Minute, nil)
+	scheduler.Alerter().Register(alerts)
+
+	start := time.Now()
+	durations := []time.Duration{time.Second, 9 * time.Second, 3 * time.Second, time.Second, 3 * time.Second}
+	for i, duration := range durations {
+		result := EndpointResponse{Endpoint: endpoint, Status: http.StatusOK, Duration: duration, Timestamp: start.Add(time.Duration(i) * time.Minute)}
+		handler.finishResult(&result)
+		scheduler.record(result)
+	}
+
+	var kinds []string
+	for i := 0; i < 2; i++ {
+		select {
+		case alert := <-alerts:
+			kinds = append(kinds, alert.Kind)
+			if alert.Kind == AlertDegraded && alert.Degraded != SeverityWarning {
+				t.Errorf("Expected degraded alert at the latest check's level, got %q", alert.Degraded)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected 2 alerts, got %v", kinds)
+		}
+	}
+	select {
+	case alert := <-alerts:
+		t.Errorf("Unexpected alert %s", alert.Kind)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sort.Strings(kinds)
+	if got := strings.Join(kinds, ","); got != "degraded,recovered" {
+		t.Errorf("Expected sustained degradation to alert and recover, got %s", got)
+	}
+
+	history, err := handler.GetEndpointHistory(endpoint.URL)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	response := newHistoryResponse(EndpointMeta{URL: endpoint.URL}, history)
+	if response.Stats.DegradedChecks != 3 || response.Stats.SuccessfulChecks != 5 {
+		t.Errorf("Expected degraded checks to count as successful, got %+v", response.Stats)
+	}
+	if response.History[1].Degraded != SeverityCritical {
+		t.Errorf("Expected critical degradation in history, got %q", response.History[1].Degraded)
+	}
+
+	status, err := handler.GetStatus(time.Now(), 0)
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if status.Status != DomainDegraded || status.Endpoints[0].State != StateDegraded {
+		t.Errorf("Expected degraded status page, got %+v", status)
+	}
+}
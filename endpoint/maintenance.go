@@ -0,0 +1,367 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maintenanceBucket = "maintenance"
+
+	MaintenanceSkip = "skip"
+	MaintenanceMark = "mark"
+
+	SourceConfig = "config"
+	SourceAPI    = "api"
+)
+
+var (
+	ErrMaintenanceNotFound = errors.New("maintenance window not found")
+	ErrMaintenanceReadOnly = errors.New("maintenance window is managed by configuration")
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Validate checks the window and fills in defaults. One-off windows need a
+// start and an end; recurring windows repeat daily or on the listed weekdays
+// between Start and End when those are set.
+func (w *MaintenanceWindow) Validate() error {
+	if w.Mode == "" {
+		w.Mode = MaintenanceMark
+	}
+	if w.Mode != MaintenanceSkip && w.Mode != MaintenanceMark {
+		return fmt.Errorf("mode must be %s or %s", MaintenanceSkip, MaintenanceMark)
+	}
+
+	if w.Recurrence == nil {
+		if w.Start.IsZero() || w.End.IsZero() {
+			return errors.New("one-off windows require a start and an end")
+		}
+		if !w.End.After(w.Start) {
+			return errors.New("end must be after start")
+		}
+		return nil
+	}
+
+	if err := w.Recurrence.Validate(); err != nil {
+		return err
+	}
+	if !w.Start.IsZero() && !w.End.IsZero() && !w.End.After(w.Start) {
+		return errors.New("end must be after start")
+	}
+
+	return nil
+}
+
+// Applies reports whether the window covers the endpoint. A window without
+// any scope covers every endpoint.
+func (w MaintenanceWindow) Applies(url, domain string, labels map[string]string) bool {
+	if len(w.URLs) == 0 && len(w.Domains) == 0 && len(w.Selector) == 0 {
+		return true
+	}
+	for _, u := range w.URLs {
+		if u == url {
+			return true
+		}
+	}
+	for _, d := range w.Domains {
+		if d == domain {
+			return true
+		}
+	}
+	return len(w.Selector) > 0 && w.Selector.Matches(labels)
+}
+
+func (w MaintenanceWindow) ActiveAt(t time.Time) bool {
+	start, _, ok := w.NextOccurrence(t)
+	return ok && !t.Before(start)
+}
+
+// NextOccurrence returns the first occurrence of the window that has not ended
+// by the given time. The occurrence may already be in progress.
+func (w MaintenanceWindow) NextOccurrence(after time.Time) (time.Time, time.Time, bool) {
+	if w.Recurrence == nil {
+		return w.Start, w.End, w.End.After(after)
+	}
+
+	location, err := time.LoadLocation(w.Recurrence.Timezone)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	startClock, err := parseClock(w.Recurrence.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	endClock, err := parseClock(w.Recurrence.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	length := endClock - startClock
+	if length <= 0 {
+		length += 24 * time.Hour
+	}
+
+	local := after.In(location)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+
+	// Starting a day early catches an occurrence that crosses midnight.
+	for i := -1; i <= 7; i++ {
+		date := day.AddDate(0, 0, i)
+		if !w.Recurrence.onWeekday(date.Weekday()) {
+			continue
+		}
+
+		start := date.Add(startClock)
+		end := start.Add(length)
+		if !w.Start.IsZero() && start.Before(w.Start) {
+			continue
+		}
+		if !w.End.IsZero() && !start.Before(w.End) {
+			return time.Time{}, time.Time{}, false
+		}
+		if end.After(after) {
+			return start, end, true
+		}
+	}
+
+	return time.Time{}, time.Time{}, false
+}
+
+func (r *Recurrence) Validate() error {
+	if _, err := time.LoadLocation(r.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %w", err)
+	}
+	start, err := parseClock(r.Start)
+	if err != nil {
+		return fmt.Errorf("invalid recurrence start: %w", err)
+	}
+	end, err := parseClock(r.End)
+	if err != nil {
+		return fmt.Errorf("invalid recurrence end: %w", err)
+	}
+	if start == end {
+		return errors.New("recurrence start and end must differ")
+	}
+	for _, day := range r.Weekdays {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("invalid weekday %q", day)
+		}
+	}
+	return nil
+}
+
+// ActiveAt reports whether the time falls inside an occurrence.
+func (r *Recurrence) ActiveAt(t time.Time) bool {
+	return MaintenanceWindow{Recurrence: r}.ActiveAt(t)
+}
+
+func (r *Recurrence) onWeekday(day time.Weekday) bool {
+	if len(r.Weekdays) == 0 {
+		return true
+	}
+	for _, name := range r.Weekdays {
+		if weekdays[strings.ToLower(name)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+func parseClock(value string) (time.Duration, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+// RegisterMaintenanceWindows replaces the configured maintenance windows with
+// the given ones. Windows created through the API are left untouched.
+func (h *EndpointHandler) RegisterMaintenanceWindows(windows []MaintenanceWindow) error {
+	for i := range windows {
+		if err := windows[i].Validate(); err != nil {
+			return fmt.Errorf("invalid maintenance window %q: %w", windows[i].Name, err)
+		}
+	}
+
+	return h.store.Update(func(tx RecordTx) error {
+		var stale []uint64
+		err := forEachRecord(tx, maintenanceBucket, func(w MaintenanceWindow) error {
+			if w.Source == SourceConfig {
+				stale = append(stale, w.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range stale {
+			if err := deleteRecord(tx, maintenanceBucket, id); err != nil {
+				return err
+			}
+		}
+
+		for _, window := range windows {
+			id, err := nextRecordID(tx, maintenanceBucket)
+			if err != nil {
+				return err
+			}
+			window.ID = id
+			window.Source = SourceConfig
+			if err := putRecord(tx, maintenanceBucket, id, window); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (h *EndpointHandler) CreateMaintenanceWindow(window MaintenanceWindow) (MaintenanceWindow, error) {
+	if err := window.Validate(); err != nil {
+		return window, err
+	}
+	window.Source = SourceAPI
+
+	err := h.store.Update(func(tx RecordTx) error {
+		id, err := nextRecordID(tx, maintenanceBucket)
+		if err != nil {
+			return err
+		}
+		window.ID = id
+		return putRecord(tx, maintenanceBucket, id, window)
+	})
+
+	return window, err
+}
+
+func (h *EndpointHandler) UpdateMaintenanceWindow(id uint64, window MaintenanceWindow) (MaintenanceWindow, error) {
+	if err := window.Validate(); err != nil {
+		return window, err
+	}
+
+	err := h.store.Update(func(tx RecordTx) error {
+		var existing MaintenanceWindow
+		found, err := getRecord(tx, maintenanceBucket, id, &existing)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrMaintenanceNotFound
+		}
+		if existing.Source == SourceConfig {
+			return ErrMaintenanceReadOnly
+		}
+
+		window.ID = id
+		window.Source = SourceAPI
+		return putRecord(tx, maintenanceBucket, id, window)
+	})
+
+	return window, err
+}
+
+func (h *EndpointHandler) DeleteMaintenanceWindow(id uint64) error {
+	return h.store.Update(func(tx RecordTx) error {
+		var existing MaintenanceWindow
+		found, err := getRecord(tx, maintenanceBucket, id, &existing)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrMaintenanceNotFound
+		}
+		if existing.Source == SourceConfig {
+			return ErrMaintenanceReadOnly
+		}
+		return deleteRecord(tx, maintenanceBucket, id)
+	})
+}
+
+func (h *EndpointHandler) GetMaintenanceWindow(id uint64) (MaintenanceWindow, error) {
+	var window MaintenanceWindow
+
+	err := h.store.View(func(tx RecordTx) error {
+		found, err := getRecord(tx, maintenanceBucket, id, &window)
+		if err == nil && !found {
+			return ErrMaintenanceNotFound
+		}
+		return err
+	})
+
+	return window, err
+}
+
+func (h *EndpointHandler) GetMaintenanceWindows() ([]MaintenanceWindow, error) {
+	var windows []MaintenanceWindow
+
+	err := h.store.View(func(tx RecordTx) error {
+		return forEachRecord(tx, maintenanceBucket, func(w MaintenanceWindow) error {
+			windows = append(windows, w)
+			return nil
+		})
+	})
+
+	return windows, err
+}
+
+// EndpointMaintenanceWindows returns the windows covering the endpoint that
+// have not ended by the given time, ordered by their next occurrence.
+func (h *EndpointHandler) EndpointMaintenanceWindows(meta EndpointMeta, after time.Time) ([]MaintenanceWindow, error) {
+	windows, err := h.GetMaintenanceWindows()
+	if err != nil {
+		return nil, err
+	}
+
+	var applicable []MaintenanceWindow
+	for _, window := range windows {
+		if !window.Applies(meta.URL, meta.Domain, meta.Labels) {
+			continue
+		}
+		if _, _, ok := window.NextOccurrence(after); ok {
+			applicable = append(applicable, window)
+		}
+	}
+
+	sort.Slice(applicable, func(a, b int) bool {
+		startA, _, _ := applicable[a].NextOccurrence(after)
+		startB, _, _ := applicable[b].NextOccurrence(after)
+		return startA.Before(startB)
+	})
+
+	return applicable, nil
+}
+
+// ActiveMaintenance returns the window the endpoint is in at the given time,
+// or nil. When several windows overlap, one that skips checks wins.
+func (h *EndpointHandler) ActiveMaintenance(endpoint EndpointRequest, at time.Time) (*MaintenanceWindow, error) {
+	windows, err := h.GetMaintenanceWindows()
+	if err != nil {
+		return nil, err
+	}
+
+	var active *MaintenanceWindow
+	for i, window := range windows {
+		if !window.Applies(endpoint.URL, endpoint.Domain, endpoint.Labels) || !window.ActiveAt(at) {
+			continue
+		}
+		if active == nil || window.Mode == MaintenanceSkip {
+			active = &windows[i]
+		}
+	}
+
+	return active, nil
+}
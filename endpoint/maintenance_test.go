@@ -0,0 +1,329 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindowActive(t *testing.T) {
+	start := time.Date(2024, 11, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		window MaintenanceWindow
+		at     time.Time
+		want   bool
+	}{
+		{
+			name:   "one-off inside",
+			window: MaintenanceWindow{Start: start, End: start.Add(time.Hour)},
+			at:     start.Add(30 * time.Minute),
+			want:   true,
+		},
+		{
+			name:   "one-off after end",
+			window: MaintenanceWindow{Start: start, End: start.Add(time.Hour)},
+			at:     start.Add(time.Hour),
+			want:   false,
+		},
+		{
+			name:   "daily",
+			window: MaintenanceWindow{Recurrence: &Recurrence{Start: "09:30", End: "10:30"}},
+			at:     start,
+			want:   true,
+		},
+		{
+			name:   "daily outside",
+			window: MaintenanceWindow{Recurrence: &Recurrence{Start: "11:00", End: "12:00"}},
+			at:     start,
+			want:   false,
+		},
+		{
+			name:   "crosses midnight",
+			window: MaintenanceWindow{Recurrence: &Recurrence{Weekdays: []string{"thu"}, Start: "23:00", End: "11:00"}},
+			at:     start,
+			want:   true,
+		},
+		{
+			name:   "other weekday",
+			window: MaintenanceWindow{Recurrence: &Recurrence{Weekdays: []string{"mon"}, Start: "09:00", End: "11:00"}},
+			at:     start,
+			want:   false,
+		},
+		{
+			name:   "timezone",
+			window: MaintenanceWindow{Recurrence: &Recurrence{Start: "04:00", End: "05:00", Timezone: "America/Chicago"}},
+			at:     start,
+			want:   true,
+		},
+		{
+			name: "recurrence before start",
+			window: MaintenanceWindow{
+				Start:      start.Add(24 * time.Hour),
+				Recurrence: &Recurrence{Start: "09:00", End: "11:00"},
+			},
+			at:   start,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.window.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if got := tt.window.ActiveAt(tt.at); got != tt.want {
+				t.Errorf("ActiveAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaintenanceWindowValidate(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name   string
+		window MaintenanceWindow
+	}{
+		{name: "missing end", window: MaintenanceWindow{Start: start}},
+		{name: "end before start", window: MaintenanceWindow{Start: start, End: start.Add(-time.Hour)}},
+		{name: "invalid mode", window: MaintenanceWindow{Mode: "pause", Start: start, End: start.Add(time.Hour)}},
+		{name: "invalid clock", window: MaintenanceWindow{Recurrence: &Recurrence{Start: "25:00", End: "01:00"}}},
+		{name: "invalid weekday", window: MaintenanceWindow{Recurrence: &Recurrence{Weekdays: []string{"funday"}, Start: "01:00", End: "02:00"}}},
+		{name: "invalid timezone", window: MaintenanceWindow{Recurrence: &Recurrence{Start: "01:00", End: "02:00", Timezone: "Mars/Olympus"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.window.Validate(); err == nil {
+				t.Errorf("Expected validation error")
+			}
+		})
+	}
+}
+
+func TestMaintenanceChecks(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	marked := EndpointRequest{URL: server.URL + "/marked", Domain: "test", Timeout: time.Second, RetryAttempts: 1, RetryDelay: 10 * time.Millisecond}
+	skipped := EndpointRequest{URL: server.URL + "/skipped", Domain: "test", Labels: map[string]string{"tier": "batch"}, Timeout: time.Second}
+
+	err := handler.RegisterMaintenanceWindows([]MaintenanceWindow{
+		{Name: "deploy", Mode: MaintenanceMark, Start: time.Now().Add(-time.Hour), End: time.Now().Add(time.Hour), URLs: []string{marked.URL}},
+		{Name: "batch", Mode: MaintenanceSkip, Start: time.Now().Add(-time.Hour), End: time.Now().Add(time.Hour), Selector: Selector{{Key: "tier", Operator: SelectorEquals, Value: "batch"}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to register maintenance windows: %v", err)
+	}
+
+	scheduler := NewScheduler(handler, time.Minute, []EndpointRequest{skipped})
+	sub, _ := scheduler.Events().Subscribe(EventFilter{}, 0)
+	defer scheduler.Events().Unsubscribe(sub)
+
+	scheduler.checkAll()
+	time.Sleep(100 * time.Millisecond)
+	if hits.Load() != 0 {
+		t.Errorf("Expected skipped endpoint not to be checked, got %d requests", hits.Load())
+	}
+
+	result := handler.Handle(context.Background(), marked)
+	if !result.Maintenance {
+		t.Fatalf("Expected result to be marked as maintenance")
+	}
+	scheduler.record(result)
+
+	for len(sub.Events()) > 0 {
+		if event := <-sub.Events(); event.Type != EventResult {
+			t.Errorf("Expected no %s event during maintenance", event.Type)
+		}
+	}
+
+	incidents, err := handler.GetIncidents(IncidentFilter{})
+	if err != nil {
+		t.Fatalf("Failed to get incidents: %v", err)
+	}
+	if len(incidents) != 0 {
+		t.Errorf("Expected no incidents during maintenance, got %d", len(incidents))
+	}
+
+	history, err := handler.GetEndpointHistory(marked.URL)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	stats := newHistoryResponse(EndpointMeta{URL: marked.URL}, history).Stats
+	if stats.TotalChecks != 0 || stats.MaintenanceChecks != 1 || stats.UpTimePercentage != 100 {
+		t.Errorf("Expected maintenance check to be excluded from uptime, got %+v", stats)
+	}
+}
+
+func TestMaintenanceAPI(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+
+	api := NewAPI(handler, NewScheduler(handler, time.Minute, nil))
+	api.adminToken = "secret"
+
+	err := handler.RegisterMaintenanceWindows([]MaintenanceWindow{
+		{Name: "weekly deploy", Recurrence: &Recurrence{Weekdays: []string{"tue"}, Start: "14:00", End: "15:00"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to register maintenance windows: %v", err)
+	}
+
+	endpoint := EndpointRequest{URL: "https://test.com", Domain: "test", Status: http.StatusOK}
+	if err := handler.RegisterEndpoints([]EndpointRequest{endpoint}); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
+	if err := handler.storeResponse(EndpointResponse{Endpoint: endpoint, Status: http.StatusOK, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Failed to store test response: %v", err)
+	}
+
+	active := `{"name":"migration","mode":"mark","start":"` + time.Now().Add(-time.Hour).Format(time.RFC3339) +
+		`","end":"` + time.Now().Add(time.Hour).Format(time.RFC3339) + `","domains":["test"]}`
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+		validateBody   func(t *testing.T, body []byte)
+	}{
+		{
+			name:           "create window - no token",
+			method:         "POST",
+			path:           "/maintenance",
+			body:           active,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "create window",
+			method:         "POST",
+			path:           "/maintenance",
+			token:          "secret",
+			body:           active,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "create window - invalid",
+			method:         "POST",
+			path:           "/maintenance",
+			token:          "secret",
+			body:           `{"name":"broken","mode":"mark"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "list active windows",
+			method:         "GET",
+			path:           "/maintenance?active=true",
+			expectedStatus: http.StatusOK,
+			validateBody: func(t *testing.T, body []byte) {
+				var windows []MaintenanceWindow
+				if err := json.Unmarshal(body, &windows); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if len(windows) != 1 || windows[0].Name != "migration" {
+					t.Errorf("Expected only the migration window to be active, got %+v", windows)
+				}
+			},
+		},
+		{
+			name:           "update config window",
+			method:         "PUT",
+			path:           "/maintenance/1",
+			token:          "secret",
+			body:           active,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "status shows maintenance",
+			method:         "GET",
+			path:           "/status",
+			expectedStatus: http.StatusOK,
+			validateBody: func(t *testing.T, body []byte) {
+				var status StatusResponse
+				if err := json.Unmarshal(body, &status); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if len(status.Endpoints) != 1 || status.Endpoints[0].State != StateMaintenance {
+					t.Fatalf("Expected endpoint in maintenance, got %+v", status.Endpoints)
+				}
+				if status.Status != DomainMaintenance {
+					t.Errorf("Expected status %s, got %s", DomainMaintenance, status.Status)
+				}
+				if len(status.Maintenance) != 2 {
+					t.Errorf("Expected active and upcoming windows, got %d", len(status.Maintenance))
+				}
+			},
+		},
+		{
+			name:           "history shows windows",
+			method:         "GET",
+			path:           "/endpoint/history?url=https://test.com",
+			expectedStatus: http.StatusOK,
+			validateBody: func(t *testing.T, body []byte) {
+				var response HistoryResponse
+				if err := json.Unmarshal(body, &response); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if len(response.Maintenance) != 2 {
+					t.Errorf("Expected 2 maintenance windows, got %d", len(response.Maintenance))
+				}
+			},
+		},
+		{
+			name:           "delete window - wrong token",
+			method:         "DELETE",
+			path:           "/maintenance/2",
+			token:          "other",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "delete window",
+			method:         "DELETE",
+			path:           "/maintenance/2",
+			token:          "secret",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "get deleted window",
+			method:         "GET",
+			path:           "/maintenance/2",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+
+			api.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+
+			if tt.validateBody != nil && rr.Code == http.StatusOK {
+				tt.validateBody(t, rr.Body.Bytes())
+			}
+		})
+	}
+}
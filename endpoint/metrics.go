@@ -0,0 +1,202 @@
+package endpoint
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type metric struct {
+	name  string
+	help  string
+	value func(HistoryResponse) float64
+}
+
+var endpointMetrics = []metric{
+	{
+		name: "cron_endpoint_up",
+		help: "Whether the latest check of the endpoint succeeded.",
+		value: func(r HistoryResponse) float64 {
+			if r.History[len(r.History)-1].Error != "" {
+				return 0
+			}
+			return 1
+		},
+	},
+	{
+		name: "cron_endpoint_maintenance",
+		help: "Whether the latest check of the endpoint ran during a maintenance window.",
+		value: func(r HistoryResponse) float64 {
+			if r.History[len(r.History)-1].Maintenance {
+				return 1
+			}
+			return 0
+		},
+	},
+	{
+		name: "cron_endpoint_degraded",
+		help: "Whether the latest check of the endpoint exceeded a latency threshold.",
+		value: func(r HistoryResponse) float64 {
+			if r.History[len(r.History)-1].Degraded != "" {
+				return 1
+			}
+			return 0
+		},
+	},
+	{
+		name: "cron_endpoint_anomaly_score",
+		help: "Robust standard deviations the latest check's duration lies above the endpoint's usual latency.",
+		value: func(r HistoryResponse) float64 {
+			return r.History[len(r.History)-1].Anomaly
+		},
+	},
+	{
+		name: "cron_endpoint_flapping",
+		help: "Whether the endpoint is flapping between up and down.",
+		value: func(r HistoryResponse) float64 {
+			if r.Flapping {
+				return 1
+			}
+			return 0
+		},
+	},
+	{
+		name: "cron_endpoint_uptime_ratio",
+		help: "Share of stored checks outside maintenance that succeeded.",
+		value: func(r HistoryResponse) float64 {
+			return r.Stats.UpTimePercentage / 100
+		},
+	},
+	{
+		name: "cron_endpoint_checks",
+		help: "Number of stored checks outside maintenance.",
+		value: func(r HistoryResponse) float64 {
+			return float64(r.Stats.TotalChecks)
+		},
+	},
+	{
+		name: "cron_endpoint_last_duration_seconds",
+		help: "Duration of the latest check.",
+		value: func(r HistoryResponse) float64 {
+			return r.History[len(r.History)-1].Duration.Seconds()
+		},
+	},
+	{
+		name: "cron_endpoint_average_duration_seconds",
+		help: "Average duration of stored checks.",
+		value: func(r HistoryResponse) float64 {
+			return float64(r.Stats.AverageResponse) / 1000
+		},
+	},
+}
+
+// writeMetrics renders the endpoints in the Prometheus text exposition format,
+// carrying each endpoint's URL, domain and labels as metric labels.
+func writeMetrics(w io.Writer, endpoints []HistoryResponse) error {
+	for _, m := range endpointMetrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name); err != nil {
+			return err
+		}
+
+		for _, endpoint := range endpoints {
+			if len(endpoint.History) == 0 {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "%s{%s} %g\n", m.name, metricLabels(endpoint), m.value(endpoint)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func metricLabels(endpoint HistoryResponse) string {
+	pairs := []string{
+		fmt.Sprintf(`url="%s"`, escapeLabelValue(endpoint.URL)),
+		fmt.Sprintf(`domain="%s"`, escapeLabelValue(endpoint.Domain)),
+	}
+
+	// Distinct keys such as team-name and team.name map onto the same name,
+	// so later ones in key order are numbered to keep names unique.
+	used := map[string]bool{"url": true, "domain": true}
+	for _, key := range sortedLabelKeys(endpoint.Labels) {
+		name := metricLabelName(key)
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s_%d", metricLabelName(key), i)
+		}
+		used[name] = true
+
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabelValue(endpoint.Labels[key])))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// metricLabelName maps an endpoint label key onto a valid Prometheus label
+// name, prefixing keys that would collide with the built-in url and domain
+// labels or use the reserved __ prefix.
+func metricLabelName(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9' && i > 0:
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	name := b.String()
+	if name == "" || name == "url" || name == "domain" || strings.HasPrefix(name, "__") {
+		name = "label_" + name
+	}
+	return name
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// writeSLOMetrics renders attainment, remaining error budget and burn rates
+// of each SLO, labelled with the SLO's name and kind.
+func writeSLOMetrics(w io.Writer, slos []SLOStatus) error {
+	gauges := []struct {
+		name  string
+		help  string
+		value func(SLOStatus) float64
+	}{
+		{"cron_slo_objective_ratio", "Target share of good checks.", func(s SLOStatus) float64 { return s.Objective / 100 }},
+		{"cron_slo_attainment_ratio", "Share of good checks within the SLO window.", func(s SLOStatus) float64 { return s.Attainment / 100 }},
+		{"cron_slo_error_budget_remaining_ratio", "Share of the error budget left within the SLO window.", func(s SLOStatus) float64 { return s.BudgetRemaining }},
+	}
+
+	for _, g := range gauges {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name); err != nil {
+			return err
+		}
+		for _, slo := range slos {
+			if _, err := fmt.Fprintf(w, "%s{%s} %g\n", g.name, sloLabels(slo), g.value(slo)); err != nil {
+				return err
+			}
+		}
+	}
+
+	const burnRate = "cron_slo_burn_rate"
+	if _, err := fmt.Fprintf(w, "# HELP %s Rate the error budget is spent at, relative to lasting the SLO window.\n# TYPE %s gauge\n", burnRate, burnRate); err != nil {
+		return err
+	}
+	for _, slo := range slos {
+		for _, rate := range slo.BurnRates {
+			if _, err := fmt.Fprintf(w, "%s{%s,window=\"%s\"} %g\n", burnRate, sloLabels(slo), rate.Window, rate.Rate); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func sloLabels(slo SLOStatus) string {
+	return fmt.Sprintf(`slo="%s",kind="%s"`, escapeLabelValue(slo.Name), slo.Kind)
+}
@@ -0,0 +1,31 @@
+package endpoint
+
+import "testing"
+
+func TestMetricLabels(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   string
+	}{
+		{"no labels", nil, `url="https://onplug.io",domain="plug"`},
+		{"invalid characters", map[string]string{"team-name": "payments", "1st": "yes"}, `url="https://onplug.io",domain="plug",_st="yes",team_name="payments"`},
+		{"built-in names", map[string]string{"url": "x", "domain": "y"}, `url="https://onplug.io",domain="plug",label_domain="y",label_url="x"`},
+		{"reserved prefix", map[string]string{"__name__": "x", "": "empty"}, `url="https://onplug.io",domain="plug",label_="empty",label___name__="x"`},
+		{
+			"colliding keys",
+			map[string]string{"team-name": "a", "team.name": "b", "team_name": "c", "team_name_2": "d"},
+			`url="https://onplug.io",domain="plug",team_name="a",team_name_2="b",team_name_3="c",team_name_2_2="d"`,
+		},
+		{"colliding with a prefixed name", map[string]string{"label_url": "a", "url": "b"}, `url="https://onplug.io",domain="plug",label_url="a",label_url_2="b"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint := HistoryResponse{URL: "https://onplug.io", Domain: "plug", Labels: tt.labels}
+			if got := metricLabels(endpoint); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
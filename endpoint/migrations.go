@@ -0,0 +1,316 @@
+package endpoint
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+const (
+	metadataBucket   = "metadata"
+	schemaVersionKey = "schema_version"
+)
+
+// boltMigrations change the layout of bbolt databases. Append new migrations
+// with the next version; released ones must not be edited or reordered.
+var boltMigrations = []boltMigration{
+	{
+		Migration: Migration{Version: 1, Description: "Create the buckets and record the schema version"},
+		up: func(tx *bbolt.Tx) error {
+			// The buckets of this release, since recordBuckets grows with
+			// later ones.
+			buckets := []string{
+				metadataBucket, endpointBucket, endpointMetaBucket,
+				incidentBucket, maintenanceBucket, heartbeatBucket, silenceBucket, outboxBucket,
+			}
+			for _, bucket := range buckets {
+				if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+					return fmt.Errorf("failed to create bucket %s: %w", bucket, err)
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Migration: Migration{Version: 2, Description: "Move response bodies out of the results"},
+		up:        moveBoltBodies,
+	},
+	{
+		Migration: Migration{Version: 3, Description: "Create the content changes buckets"},
+		up: func(tx *bbolt.Tx) error {
+			for _, bucket := range []string{changeBucket, changeIndexBucket} {
+				if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+					return fmt.Errorf("failed to create bucket %s: %w", bucket, err)
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Migration: Migration{Version: 4, Description: "Create the seasonal latency baselines bucket"},
+		up: func(tx *bbolt.Tx) error {
+			if _, err := tx.CreateBucketIfNotExists([]byte(baselineBucket)); err != nil {
+				return fmt.Errorf("failed to create bucket %s: %w", baselineBucket, err)
+			}
+			return nil
+		},
+	},
+}
+
+// sqliteMigrations change the tables of SQLite databases, under the same
+// rules as boltMigrations.
+var sqliteMigrations = []sqliteMigration{
+	{
+		Migration: Migration{Version: 1, Description: "Create the results, endpoint metadata and record tables"},
+		up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(sqliteSchema)
+			return err
+		},
+	},
+	{
+		Migration: Migration{Version: 2, Description: "Move response bodies out of the results"},
+		up:        moveSQLiteBodies,
+	},
+	{
+		Migration: Migration{Version: 3, Description: "Add the content hash of results"},
+		up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+ALTER TABLE results ADD COLUMN content_hash    TEXT    NOT NULL DEFAULT '';
+ALTER TABLE results ADD COLUMN content_changed INTEGER NOT NULL DEFAULT 0;
+`)
+			return err
+		},
+	},
+}
+
+// migratedBody returns what the body policy of the endpoint configured at url
+// keeps of a body stored before policies existed, as encodeBody does for new
+// checks. Endpoints no longer configured get the default policy.
+func migratedBody(endpoints map[string]EndpointRequest, url, failure string, body []byte) ([]byte, string, error) {
+	response := EndpointResponse{Endpoint: endpoints[url], Body: string(body)}
+	if failure != "" {
+		response.Error = errors.New(failure)
+	}
+	return encodeBody(response)
+}
+
+func configuredEndpointsByURL() map[string]EndpointRequest {
+	endpoints := make(map[string]EndpointRequest)
+	for _, endpoint := range ConfiguredEndpoints(DOMAIN_CONFIG) {
+		endpoints[endpoint.URL] = endpoint
+	}
+	return endpoints
+}
+
+// moveBoltBodies stores the part of the bodies kept in each endpoint's list
+// of results that its body policy keeps in the bodies bucket instead, and
+// records the hash and size of every body.
+func moveBoltBodies(tx *bbolt.Tx) error {
+	bodies, err := tx.CreateBucketIfNotExists([]byte(bodyBucket))
+	if err != nil {
+		return fmt.Errorf("failed to create bucket %s: %w", bodyBucket, err)
+	}
+
+	endpoints := configuredEndpointsByURL()
+	b := tx.Bucket([]byte(endpointBucket))
+	updated := make(map[string][]byte)
+	err = b.ForEach(func(k, v []byte) error {
+		var results []EndpointResponseStored
+		var legacy []struct{ Body string }
+		if err := json.Unmarshal(v, &results); err != nil {
+			return fmt.Errorf("failed to unmarshal responses of %s: %w", k, err)
+		}
+		if err := json.Unmarshal(v, &legacy); err != nil {
+			return fmt.Errorf("failed to unmarshal responses of %s: %w", k, err)
+		}
+
+		for i := range results {
+			if legacy[i].Body == "" {
+				continue
+			}
+			body := []byte(legacy[i].Body)
+			results[i].BodyHash = hashBody(body)
+			results[i].BodySize = int64(len(body))
+
+			data, encoding, err := migratedBody(endpoints, string(k), results[i].Error, body)
+			if err != nil {
+				return err
+			}
+			if data == nil {
+				continue
+			}
+			results[i].BodyEncoding = encoding
+			if err := bodies.Put(bodyKey(string(k), results[i].Timestamp), data); err != nil {
+				return err
+			}
+		}
+
+		data, err := json.Marshal(results)
+		if err != nil {
+			return fmt.Errorf("failed to marshal responses of %s: %w", k, err)
+		}
+		updated[string(k)] = data
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// A bucket cannot be changed while it is iterated.
+	for url, data := range updated {
+		if err := b.Put([]byte(url), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveSQLiteBodies moves what the body policies keep of the body column of
+// the results into a table of its own and records the hash and size of each
+// body.
+func moveSQLiteBodies(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+CREATE TABLE bodies (
+	url       TEXT    NOT NULL,
+	timestamp INTEGER NOT NULL,
+	data      BLOB    NOT NULL,
+	PRIMARY KEY (url, timestamp)
+);
+ALTER TABLE results ADD COLUMN body_encoding  TEXT    NOT NULL DEFAULT '';
+ALTER TABLE results ADD COLUMN body_hash      TEXT    NOT NULL DEFAULT '';
+ALTER TABLE results ADD COLUMN body_size      INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE results ADD COLUMN body_truncated INTEGER NOT NULL DEFAULT 0;
+`)
+	if err != nil {
+		return err
+	}
+
+	// The rows are read before updating them, since the transaction has a
+	// single connection. Only the hashes are kept, not the bodies.
+	rows, err := tx.Query(`SELECT id, url, timestamp, error, CAST(body AS BLOB) FROM results WHERE body != ''`)
+	if err != nil {
+		return err
+	}
+	type bodyInfo struct {
+		id        int64
+		url       string
+		timestamp int64
+		hash      string
+		size      int
+		data      []byte
+		encoding  string
+	}
+	endpoints := configuredEndpointsByURL()
+	var infos []bodyInfo
+	for rows.Next() {
+		var info bodyInfo
+		var failure string
+		var body []byte
+		if err := rows.Scan(&info.id, &info.url, &info.timestamp, &failure, &body); err != nil {
+			rows.Close()
+			return err
+		}
+		info.hash, info.size = hashBody(body), len(body)
+		if info.data, info.encoding, err = migratedBody(endpoints, info.url, failure, body); err != nil {
+			rows.Close()
+			return err
+		}
+		infos = append(infos, info)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		_, err := tx.Exec(`UPDATE results SET body_encoding = ?, body_hash = ?, body_size = ? WHERE id = ?`,
+			info.encoding, info.hash, info.size, info.id)
+		if err != nil {
+			return err
+		}
+		if info.data == nil {
+			continue
+		}
+		_, err = tx.Exec(`INSERT OR REPLACE INTO bodies (url, timestamp, data) VALUES (?, ?, ?)`,
+			info.url, info.timestamp, info.data)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`ALTER TABLE results DROP COLUMN body`)
+	return err
+}
+
+// pendingMigrations returns the migrations after version, or an error when
+// the database was written by a newer build.
+func pendingMigrations(version int, migrations []Migration) ([]Migration, error) {
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+	if version > latest {
+		return nil, fmt.Errorf("database schema version %d is newer than version %d supported by this build", version, latest)
+	}
+
+	var pending []Migration
+	for _, migration := range migrations {
+		if migration.Version > version {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// migrateStore brings the store at path up to date. A database that existed
+// before is backed up next to it first, so a failed or unwanted migration
+// can be undone by restoring the copy.
+func migrateStore(store Store, path string, existed bool) error {
+	pending, err := store.PendingMigrations()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if existed {
+		version, err := store.SchemaVersion()
+		if err != nil {
+			return err
+		}
+		backup := fmt.Sprintf("%s.v%d-%s.bak", path, version, time.Now().Format("20060102150405"))
+		if err := backupStoreTo(store, backup); err != nil {
+			return fmt.Errorf("failed to back up database before migrating: %w", err)
+		}
+		log.Printf("Backed up database to %s before migrating", backup)
+	}
+
+	applied, err := store.Migrate()
+	for _, migration := range applied {
+		log.Printf("Applied migration %d: %s", migration.Version, migration.Description)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return nil
+}
+
+func backupStoreTo(store Store, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := store.Backup(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
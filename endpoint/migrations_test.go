@@ -0,0 +1,311 @@
+package endpoint
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestPendingMigrations(t *testing.T) {
+	migrations := []Migration{{Version: 1}, {Version: 2}, {Version: 3}}
+
+	tests := []struct {
+		version int
+		want    int
+		wantErr bool
+	}{
+		{0, 3, false},
+		{2, 1, false},
+		{3, 0, false},
+		{4, 0, true},
+	}
+
+	for _, tt := range tests {
+		pending, err := pendingMigrations(tt.version, migrations)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("version %d: error = %v, wantErr %v", tt.version, err, tt.wantErr)
+		}
+		if len(pending) != tt.want {
+			t.Errorf("version %d: expected %d pending migrations, got %d", tt.version, tt.want, len(pending))
+		}
+	}
+}
+
+func TestBoltMigrations(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "endpoints.db")
+
+	defer func(config StorageConfig) { STORAGE_CONFIG = config }(STORAGE_CONFIG)
+	STORAGE_CONFIG = StorageConfig{Driver: StorageBolt}
+	defer func(migrations []boltMigration) { boltMigrations = migrations }(boltMigrations)
+	latest := len(boltMigrations)
+
+	backups := func() []string {
+		matches, _ := filepath.Glob(path + ".v*.bak")
+		return matches
+	}
+
+	handler, err := NewEndpointHandler(path, 10)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	if len(backups()) != 0 {
+		t.Errorf("Expected a new database not to be backed up, got %v", backups())
+	}
+	endpoint := EndpointRequest{URL: "https://test.com", Method: "GET", Status: http.StatusOK}
+	handler.storeResponse(EndpointResponse{Endpoint: endpoint, Status: http.StatusOK, Timestamp: time.Now()})
+	handler.Close()
+
+	// A later release renames the method of every stored result.
+	boltMigrations = append(boltMigrations, boltMigration{
+		Migration: Migration{Version: latest + 1, Description: "Rename methods"},
+		up: func(tx *bbolt.Tx) error {
+			b := tx.Bucket([]byte(endpointBucket))
+			return b.ForEach(func(k, v []byte) error {
+				var results []EndpointResponseStored
+				if err := json.Unmarshal(v, &results); err != nil {
+					return err
+				}
+				for i := range results {
+					results[i].Method = "HEAD"
+				}
+				data, err := json.Marshal(results)
+				if err != nil {
+					return err
+				}
+				return b.Put(k, data)
+			})
+		},
+	})
+
+	handler, err = NewEndpointHandler(path, 10)
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	history, _ := handler.GetEndpointHistory(endpoint.URL)
+	if len(history) != 1 || history[0].Endpoint.Method != "HEAD" {
+		t.Errorf("Expected the migration to rewrite the history, got %+v", history)
+	}
+	if version, _ := handler.store.SchemaVersion(); version != latest+1 {
+		t.Errorf("Expected schema version %d, got %d", latest+1, version)
+	}
+	handler.Close()
+
+	if len(backups()) != 1 || !strings.Contains(backups()[0], fmt.Sprintf(".v%d-", latest)) {
+		t.Fatalf("Expected one backup of version %d, got %v", latest, backups())
+	}
+	backup, err := NewBoltStore(backups()[0], true)
+	if err != nil {
+		t.Fatalf("Failed to open backup: %v", err)
+	}
+	results, _ := backup.Results(endpoint.URL, time.Time{}, time.Time{})
+	if version, _ := backup.SchemaVersion(); version != latest || len(results) != 1 || results[0].Method != "GET" {
+		t.Errorf("Expected the backup to hold version %d, got version %d with %+v", latest, version, results)
+	}
+	backup.Close()
+
+	// A failing migration leaves the database at the last good version.
+	errBroken := errors.New("broken")
+	boltMigrations = append(boltMigrations, boltMigration{
+		Migration: Migration{Version: latest + 2, Description: "Broken"},
+		up: func(tx *bbolt.Tx) error {
+			if _, err := tx.CreateBucket([]byte("partial")); err != nil {
+				return err
+			}
+			return errBroken
+		},
+	})
+	if _, err := NewEndpointHandler(path, 10); !errors.Is(err, errBroken) {
+		t.Errorf("Expected the failing migration's error, got %v", err)
+	}
+	boltMigrations = boltMigrations[:len(boltMigrations)-1]
+
+	store, err := NewBoltStore(path, true)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if version, _ := store.SchemaVersion(); version != latest+1 {
+		t.Errorf("Expected schema version %d after the failed migration, got %d", latest+1, version)
+	}
+	store.(*boltStore).db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte("partial")) != nil {
+			t.Errorf("Expected the failed migration to be rolled back")
+		}
+		return nil
+	})
+	store.Close()
+
+	// Older builds refuse to open a database they do not understand.
+	boltMigrations = boltMigrations[:latest]
+	if _, err := NewEndpointHandler(path, 10); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("Expected a newer database to be refused, got %v", err)
+	}
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints.sqlite")
+
+	defer func(migrations []sqliteMigration) { sqliteMigrations = migrations }(sqliteMigrations)
+	latest := len(sqliteMigrations)
+
+	store, err := NewSQLiteStore(path, false)
+	if err != nil {
+		t.Skipf("SQLite is unavailable: %v", err)
+	}
+	pending, err := store.PendingMigrations()
+	if err != nil || len(pending) != latest {
+		t.Fatalf("Expected %d pending migrations on a new database, got %v, %v", latest, pending, err)
+	}
+	if _, err := store.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if err := store.AppendResult(storedResult("https://test.com", time.Now()), 10); err != nil {
+		t.Fatalf("Failed to append result: %v", err)
+	}
+
+	errBroken := errors.New("broken")
+	sqliteMigrations = append(sqliteMigrations, sqliteMigration{
+		Migration: Migration{Version: latest + 1, Description: "Broken"},
+		up: func(tx *sql.Tx) error {
+			if _, err := tx.Exec(`ALTER TABLE results ADD COLUMN region TEXT`); err != nil {
+				return err
+			}
+			return errBroken
+		},
+	})
+	if _, err := store.Migrate(); !errors.Is(err, errBroken) {
+		t.Errorf("Expected the failing migration's error, got %v", err)
+	}
+	if version, _ := store.SchemaVersion(); version != latest {
+		t.Errorf("Expected schema version %d after the failed migration, got %d", latest, version)
+	}
+	if err := store.AppendResult(storedResult("https://test.com", time.Now()), 10); err != nil {
+		t.Errorf("Expected the store to keep working, got %v", err)
+	}
+
+	var backup bytes.Buffer
+	if err := store.Backup(&backup); err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	store.Close()
+
+	restored := filepath.Join(t.TempDir(), "restored.sqlite")
+	if err := os.WriteFile(restored, backup.Bytes(), 0600); err != nil {
+		t.Fatalf("Failed to write backup: %v", err)
+	}
+	copied, err := NewSQLiteStore(restored, true)
+	if err != nil {
+		t.Fatalf("Failed to open backup: %v", err)
+	}
+	defer copied.Close()
+	results, err := copied.Results("https://test.com", time.Time{}, time.Time{})
+	if err != nil || len(results) != 2 {
+		t.Errorf("Expected the backup to hold 2 results, got %d, %v", len(results), err)
+	}
+}
+
+func TestBodyMigrations(t *testing.T) {
+	timestamp := time.Unix(1700000000, 0)
+	legacy := []byte(`[{"URL":"https://test.com","Method":"GET","Status":502,"Expected":200,` +
+		`"Error":"received error status code: 502","Timestamp":"2023-11-14T22:13:20Z","Body":"bad gateway"},` +
+		`{"URL":"https://test.com","Method":"GET","Status":200,"Expected":200,` +
+		`"Timestamp":"2023-11-14T22:14:20Z","Body":"<p>ok</p>"}]`)
+
+	// The bodies are cut down to what the endpoint's policy keeps.
+	defer func(domains []DomainRequest) { DOMAIN_CONFIG = domains }(DOMAIN_CONFIG)
+	DOMAIN_CONFIG = []DomainRequest{{Domain: "test", Endpoints: []EndpointRequest{{URL: "https://test.com", BodyLimit: 3}}}}
+
+	check := func(t *testing.T, store Store) {
+		t.Helper()
+		results, err := store.Results("https://test.com", time.Time{}, time.Time{})
+		if err != nil || len(results) != 2 {
+			t.Fatalf("Expected 2 results, got %d, %v", len(results), err)
+		}
+		failed, ok := results[0], results[1]
+		if failed.BodyEncoding != bodyIdentity || failed.BodySize != 11 || failed.BodyHash != hashBody([]byte("bad gateway")) {
+			t.Errorf("Expected the body's hash and size to be recorded, got %+v", failed)
+		}
+		if body, err := store.Body("https://test.com", timestamp); err != nil || string(body) != "bad" {
+			t.Errorf("Expected the body to be moved within the limit, got %q, %v", body, err)
+		}
+		if ok.BodyEncoding != "" || ok.BodySize != 9 || ok.BodyHash != hashBody([]byte("<p>ok</p>")) {
+			t.Errorf("Expected only the hash and size of a successful check's body, got %+v", ok)
+		}
+		if body, err := store.Body("https://test.com", ok.Timestamp); err != nil || body != nil {
+			t.Errorf("Expected the body of a successful check to be dropped, got %q, %v", body, err)
+		}
+	}
+
+	t.Run("bolt", func(t *testing.T) {
+		defer func(migrations []boltMigration) { boltMigrations = migrations }(boltMigrations)
+		migrations := boltMigrations
+		boltMigrations = boltMigrations[:1]
+
+		store, err := NewBoltStore(filepath.Join(t.TempDir(), "endpoints.db"), false)
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer store.Close()
+		if _, err := store.Migrate(); err != nil {
+			t.Fatalf("Failed to migrate to version 1: %v", err)
+		}
+		store.(*boltStore).db.Update(func(tx *bbolt.Tx) error {
+			for _, bucket := range []string{changeBucket, baselineBucket} {
+				if tx.Bucket([]byte(bucket)) != nil {
+					t.Errorf("Expected version 1 not to create the later bucket %s", bucket)
+				}
+			}
+			return tx.Bucket([]byte(endpointBucket)).Put([]byte("https://test.com"), legacy)
+		})
+
+		boltMigrations = migrations
+		if _, err := store.Migrate(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+		check(t, store)
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		defer func(migrations []sqliteMigration) { sqliteMigrations = migrations }(sqliteMigrations)
+		migrations := sqliteMigrations
+		sqliteMigrations = sqliteMigrations[:1]
+
+		store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "endpoints.sqlite"), false)
+		if err != nil {
+			t.Skipf("SQLite is unavailable: %v", err)
+		}
+		defer store.Close()
+		if _, err := store.Migrate(); err != nil {
+			t.Fatalf("Failed to migrate to version 1: %v", err)
+		}
+		db := store.(*sqliteStore).db
+		_, err = db.Exec(`INSERT INTO results (url, method, status, expected, error, category, timestamp, duration,
+			body, maintenance, flapping, degraded, anomaly, anomalous, location)
+			VALUES ('https://test.com', 'GET', 502, 200, 'received error status code: 502', '', ?, 0,
+			'bad gateway', 0, 0, '', 0, 0, ''),
+			('https://test.com', 'GET', 200, 200, '', '', ?, 0,
+			'<p>ok</p>', 0, 0, '', 0, 0, '')`, timestamp.UnixNano(), timestamp.Add(time.Minute).UnixNano())
+		if err != nil {
+			t.Fatalf("Failed to insert a version 1 result: %v", err)
+		}
+
+		sqliteMigrations = migrations
+		if _, err := store.Migrate(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+		check(t, store)
+		if _, err := db.Exec(`SELECT body FROM results`); err == nil {
+			t.Errorf("Expected the body column to be dropped")
+		}
+	})
+}
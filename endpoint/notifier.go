@@ -0,0 +1,323 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AlertDown      = "down"
+	AlertRecovered = "recovered"
+	AlertDegraded  = "degraded"
+	AlertFlapping  = "flapping"
+	AlertBurnRate  = "burn_rate"
+	AlertAnomaly   = "anomaly"
+	AlertChanged   = "content_changed"
+
+	notifyTimeout = 10 * time.Second
+
+	sloScheme = "slo://"
+)
+
+func NewAlerter(publicURL string) *Alerter {
+	a := &Alerter{
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		outages:   make(map[string]*outage),
+	}
+	a.idle = sync.NewCond(&a.queueMu)
+	return a
+}
+
+// Register adds a notifier that receives every alert dispatched afterwards.
+func (a *Alerter) Register(notifier Notifier) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.notifiers = append(a.notifiers, notifier)
+}
+
+func (a *Alerter) Notifiers() []Notifier {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]Notifier(nil), a.notifiers...)
+}
+
+// Dispatch routes the alert and sends it to the notifiers it is due at
+// concurrently, waiting for them to finish. Failures are logged and returned
+// keyed by notifier name.
+func (a *Alerter) Dispatch(ctx context.Context, alert Alert) map[string]error {
+	if alert.HistoryURL == "" && a.publicURL != "" {
+		alert.HistoryURL = a.publicURL + "/endpoint/history?url=" + url.QueryEscape(alert.URL)
+	}
+
+	return a.deliver(ctx, alert, a.route(alert, a.silenced(alert, time.Now())))
+}
+
+// Enqueue dispatches the alert in the background, after everything enqueued
+// before it has been sent. Checks do not wait for notifiers, yet a recovery
+// is never sent ahead of the down alert it follows.
+func (a *Alerter) Enqueue(alert Alert) {
+	a.enqueue(func() {
+		a.Dispatch(context.Background(), alert)
+	})
+}
+
+func (a *Alerter) enqueue(job func()) {
+	a.queueMu.Lock()
+	defer a.queueMu.Unlock()
+
+	a.queue = append(a.queue, job)
+	if !a.sending {
+		a.sending = true
+		go a.send()
+	}
+}
+
+// send runs the queued work in order until the queue is empty.
+func (a *Alerter) send() {
+	for {
+		a.queueMu.Lock()
+		if len(a.queue) == 0 {
+			a.sending = false
+			a.idle.Broadcast()
+			a.queueMu.Unlock()
+			return
+		}
+		job := a.queue[0]
+		a.queue = a.queue[1:]
+		a.queueMu.Unlock()
+
+		job()
+	}
+}
+
+// Wait blocks until every enqueued alert has been sent.
+func (a *Alerter) Wait() {
+	a.queueMu.Lock()
+	defer a.queueMu.Unlock()
+	for a.sending {
+		a.idle.Wait()
+	}
+}
+
+// silenced reports whether an active silence mutes the alert.
+func (a *Alerter) silenced(alert Alert, at time.Time) bool {
+	if a.silences == nil {
+		return false
+	}
+
+	silence, err := a.silences.ActiveSilence(alert, at)
+	if err != nil {
+		log.Printf("Failed to look up silences for %s: %v", alert.URL, err)
+	}
+	if silence == nil {
+		return false
+	}
+	log.Printf("Silenced %s alert for %s by silence %d", alert.Kind, alert.URL, silence.ID)
+	return true
+}
+
+// deliver sends the alert to the given channels.
+func (a *Alerter) deliver(ctx context.Context, alert Alert, channels []string) map[string]error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	errs := make(map[string]error)
+
+	for _, notifier := range a.Notifiers() {
+		if !contains(channels, notifier.Name()) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(notifier Notifier) {
+			defer wg.Done()
+			if err := notifier.Notify(ctx, alert); err != nil {
+				log.Printf("Failed to send %s alert for %s via %s: %v", alert.Kind, alert.URL, notifier.Name(), err)
+				mu.Lock()
+				errs[notifier.Name()] = err
+				mu.Unlock()
+			}
+		}(notifier)
+	}
+
+	wg.Wait()
+	return errs
+}
+
+// Flush delivers alerts held back by notifiers that batch them, such as the
+// email digest, so that nothing is lost on shutdown.
+func (a *Alerter) Flush(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	for _, notifier := range a.Notifiers() {
+		flusher, ok := notifier.(interface{ Flush(context.Context) error })
+		if !ok {
+			continue
+		}
+		if err := flusher.Flush(ctx); err != nil {
+			log.Printf("Failed to flush %s alerts: %v", notifier.Name(), err)
+		}
+	}
+}
+
+func newAlert(kind string, result EndpointResponse) Alert {
+	alert := Alert{
+		Kind:      kind,
+		URL:       result.Endpoint.URL,
+		Domain:    result.Endpoint.Domain,
+		Labels:    result.Endpoint.Labels,
+		Category:  result.Category,
+		Status:    result.Status,
+		Duration:  result.Duration,
+		Degraded:  result.Degraded,
+		Anomaly:   result.Anomaly,
+		Timestamp: result.Timestamp,
+	}
+	if result.Error != nil {
+		alert.Error = result.Error.Error()
+	}
+	return alert
+}
+
+// newSLOAlert describes an SLO burning its error budget. SLOs have no URL of
+// their own, so the alert carries the SLO name under an slo:// scheme.
+func newSLOAlert(status SLOStatus, at time.Time) Alert {
+	alert := Alert{
+		Kind:      AlertBurnRate,
+		URL:       sloScheme + status.Name,
+		Category:  CategorySLOSlowBurn,
+		Timestamp: at,
+		Error: fmt.Sprintf("%.2f%% of checks good against a %.2f%% objective, %.0f%% of the error budget left",
+			status.Attainment, status.Objective, status.BudgetRemaining*100),
+	}
+	if status.Burn == SLOBurnFast {
+		alert.Category = CategorySLOFastBurn
+	}
+	if len(status.Domains) == 1 {
+		alert.Domain = status.Domains[0]
+	}
+	return alert
+}
+
+func (alert Alert) Title() string {
+	switch alert.Kind {
+	case AlertDown:
+		return fmt.Sprintf("%s is down", alert.URL)
+	case AlertRecovered:
+		return fmt.Sprintf("%s has recovered", alert.URL)
+	case AlertDegraded:
+		return fmt.Sprintf("%s is degraded", alert.URL)
+	case AlertFlapping:
+		return fmt.Sprintf("%s is flapping", alert.URL)
+	case AlertAnomaly:
+		return fmt.Sprintf("%s is slower than usual", alert.URL)
+	case AlertChanged:
+		return fmt.Sprintf("The content of %s has changed", alert.URL)
+	case AlertBurnRate:
+		return fmt.Sprintf("SLO %s is burning its error budget", strings.TrimPrefix(alert.URL, sloScheme))
+	default:
+		return fmt.Sprintf("%s: %s", alert.URL, alert.Kind)
+	}
+}
+
+// dedupKey identifies an endpoint to incident management services so that
+// repeated alerts for the same outage are merged and the recovery resolves it.
+func dedupKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return "cron-" + hex.EncodeToString(sum[:12])
+}
+
+// alertDetails lists the alert fields as key/value pairs for services that
+// accept arbitrary details.
+func alertDetails(alert Alert) map[string]string {
+	details := map[string]string{
+		"url":     alert.URL,
+		"status":  formatStatus(alert.Status),
+		"latency": formatLatency(alert.Duration),
+	}
+	if alert.Domain != "" {
+		details["domain"] = alert.Domain
+	}
+	if alert.Category != "" {
+		details["failure"] = alert.Category
+	}
+	if alert.Error != "" {
+		details["error"] = alert.Error
+	}
+	if alert.HistoryURL != "" {
+		details["history"] = alert.HistoryURL
+	}
+	for key, value := range alert.Labels {
+		details["label:"+key] = value
+	}
+	return details
+}
+
+// postJSON sends a JSON payload and returns the response body, treating any
+// non-2xx status as an error.
+func postJSON(ctx context.Context, client *http.Client, target string, headers map[string]string, payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return body, fmt.Errorf("received error status code: %d", resp.StatusCode)
+	}
+
+	return body, nil
+}
+
+func formatLatency(d time.Duration) string {
+	if d == 0 {
+		return "n/a"
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+func formatStatus(status int) string {
+	if status == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%d", status)
+}
+
+func valueOrNA(value string) string {
+	if value == "" {
+		return "n/a"
+	}
+	return value
+}
@@ -0,0 +1,61 @@
+package endpoint
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	discordRed    = 0xE74C3C
+	discordGreen  = 0x2ECC71
+	discordYellow = 0xF1C40F
+)
+
+// NewDiscordNotifier posts embeds to a Discord channel webhook.
+func NewDiscordNotifier(config DiscordConfig) *DiscordNotifier {
+	if config.Username == "" {
+		config.Username = "cron"
+	}
+
+	return &DiscordNotifier{
+		config: config,
+		client: &http.Client{},
+	}
+}
+
+func (n *DiscordNotifier) Name() string {
+	return "discord"
+}
+
+func (n *DiscordNotifier) Notify(ctx context.Context, alert Alert) error {
+	color := map[string]int{
+		AlertDown:      discordRed,
+		AlertRecovered: discordGreen,
+		AlertDegraded:  discordYellow,
+		AlertFlapping:  discordYellow,
+		AlertBurnRate:  discordRed,
+		AlertAnomaly:   discordYellow,
+		AlertChanged:   discordYellow,
+	}[alert.Kind]
+
+	embed := discordEmbed{
+		Title:       alert.Title(),
+		URL:         alert.HistoryURL,
+		Description: alert.Error,
+		Color:       color,
+		Timestamp:   alert.Timestamp.UTC().Format("2006-01-02T15:04:05Z"),
+		Fields: []discordField{
+			{Name: "URL", Value: alert.URL},
+			{Name: "Domain", Value: valueOrNA(alert.Domain), Inline: true},
+			{Name: "Failure", Value: valueOrNA(alert.Category), Inline: true},
+			{Name: "Status", Value: formatStatus(alert.Status), Inline: true},
+			{Name: "Latency", Value: formatLatency(alert.Duration), Inline: true},
+		},
+	}
+
+	_, err := postJSON(ctx, n.client, n.config.WebhookURL, nil, discordMessage{
+		Username: n.config.Username,
+		Embeds:   []discordEmbed{embed},
+	})
+	return err
+}
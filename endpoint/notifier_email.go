@@ -0,0 +1,288 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const defaultSMTPPort = 587
+
+var emailText = template.Must(template.New("text").Funcs(emailFuncs).Parse(
+	`{{range .}}{{.Title}}
+
+  URL:      {{.URL}}
+  Domain:   {{na .Domain}}
+  Failure:  {{na .Category}}
+  Status:   {{status .Status}}
+  Latency:  {{latency .Duration}}
+  Time:     {{.Timestamp.UTC.Format "2006-01-02 15:04:05 MST"}}
+{{if .Error}}  Error:    {{.Error}}
+{{end}}{{if .HistoryURL}}  History:  {{.HistoryURL}}
+{{end}}
+{{end}}`))
+
+var emailHTML = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap(emailFuncs)).Parse(
+	`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+{{range .}}<h3 style="color: {{color .Kind}};">{{.Title}}</h3>
+<table cellpadding="4">
+<tr><th align="left">URL</th><td>{{.URL}}</td></tr>
+<tr><th align="left">Domain</th><td>{{na .Domain}}</td></tr>
+<tr><th align="left">Failure</th><td>{{na .Category}}</td></tr>
+<tr><th align="left">Status</th><td>{{status .Status}}</td></tr>
+<tr><th align="left">Latency</th><td>{{latency .Duration}}</td></tr>
+<tr><th align="left">Time</th><td>{{.Timestamp.UTC.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+{{if .Error}}<tr><th align="left">Error</th><td><code>{{.Error}}</code></td></tr>
+{{end}}</table>
+{{if .HistoryURL}}<p><a href="{{.HistoryURL}}">View history</a></p>
+{{end}}{{end}}</body>
+</html>
+`))
+
+var emailFuncs = template.FuncMap{
+	"na":      valueOrNA,
+	"status":  formatStatus,
+	"latency": formatLatency,
+	"color": func(kind string) string {
+		switch kind {
+		case AlertDown:
+			return "#c0392b"
+		case AlertRecovered:
+			return "#27ae60"
+		default:
+			return "#d4ac0d"
+		}
+	},
+}
+
+// NewEmailNotifier sends alerts over SMTP, upgrading the connection with
+// STARTTLS whenever the server offers it. With a digest window configured,
+// alerts are batched per recipient list and sent as one email per window.
+func NewEmailNotifier(config EmailConfig) *EmailNotifier {
+	if config.Port == 0 {
+		config.Port = defaultSMTPPort
+	}
+
+	return &EmailNotifier{
+		config:  config,
+		pending: make(map[string]*emailBatch),
+	}
+}
+
+func (n *EmailNotifier) Name() string {
+	return "email"
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, alert Alert) error {
+	route := n.route(alert.Domain)
+	if len(route.To) == 0 {
+		return nil
+	}
+
+	if n.config.Digest <= 0 {
+		return n.send(ctx, route, []Alert{alert})
+	}
+
+	key := route.From + "|" + strings.Join(route.To, ",")
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	batch, ok := n.pending[key]
+	if !ok {
+		batch = &emailBatch{route: route}
+		n.pending[key] = batch
+		time.AfterFunc(n.config.Digest, func() {
+			if err := n.flushBatch(context.Background(), key); err != nil {
+				log.Printf("Failed to send alert digest to %s: %v", strings.Join(route.To, ", "), err)
+			}
+		})
+	}
+	batch.alerts = append(batch.alerts, alert)
+
+	return nil
+}
+
+// Flush sends every pending digest immediately.
+func (n *EmailNotifier) Flush(ctx context.Context) error {
+	n.mu.Lock()
+	keys := make([]string, 0, len(n.pending))
+	for key := range n.pending {
+		keys = append(keys, key)
+	}
+	n.mu.Unlock()
+
+	var errs []error
+	for _, key := range keys {
+		if err := n.flushBatch(ctx, key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (n *EmailNotifier) flushBatch(ctx context.Context, key string) error {
+	n.mu.Lock()
+	batch, ok := n.pending[key]
+	delete(n.pending, key)
+	n.mu.Unlock()
+
+	if !ok || len(batch.alerts) == 0 {
+		return nil
+	}
+	return n.send(ctx, batch.route, batch.alerts)
+}
+
+func (n *EmailNotifier) route(domain string) EmailRoute {
+	route := EmailRoute{From: n.config.From, To: n.config.To}
+	if override, ok := n.config.Domains[domain]; ok {
+		if override.From != "" {
+			route.From = override.From
+		}
+		if len(override.To) > 0 {
+			route.To = override.To
+		}
+	}
+	return route
+}
+
+func (n *EmailNotifier) send(ctx context.Context, route EmailRoute, alerts []Alert) error {
+	message, err := buildEmail(route, alerts)
+	if err != nil {
+		return err
+	}
+
+	address := net.JoinHostPort(n.config.Host, fmt.Sprintf("%d", n.config.Port))
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, n.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		tlsConfig := &tls.Config{ServerName: n.config.Host, RootCAs: n.config.RootCAs}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	} else if n.config.RequireTLS {
+		return errors.New("server does not support STARTTLS")
+	}
+
+	if n.config.Username != "" {
+		auth := smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	if err := client.Mail(route.From); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	for _, to := range route.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("failed to add recipient %s: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start message: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// buildEmail renders the alerts as a multipart/alternative message with a
+// plaintext and an HTML part.
+func buildEmail(route EmailRoute, alerts []Alert) ([]byte, error) {
+	var subject string
+	if len(alerts) == 1 {
+		subject = "[cron] " + alerts[0].Title()
+	} else {
+		sorted := append([]Alert(nil), alerts...)
+		sort.SliceStable(sorted, func(a, b int) bool {
+			return sorted[a].Timestamp.Before(sorted[b].Timestamp)
+		})
+		alerts = sorted
+		subject = fmt.Sprintf("[cron] Alert digest: %d events", len(alerts))
+	}
+
+	var text, html bytes.Buffer
+	if err := emailText.Execute(&text, alerts); err != nil {
+		return nil, fmt.Errorf("failed to render text body: %w", err)
+	}
+	if err := emailHTML.Execute(&html, alerts); err != nil {
+		return nil, fmt.Errorf("failed to render HTML body: %w", err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+		pw, err := mw.CreatePart(header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create message part: %w", err)
+		}
+		qp := quotedprintable.NewWriter(pw)
+		if _, err := qp.Write(part.content); err != nil {
+			return nil, fmt.Errorf("failed to write message part: %w", err)
+		}
+		if err := qp.Close(); err != nil {
+			return nil, fmt.Errorf("failed to write message part: %w", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish message: %w", err)
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", route.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(route.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	message.Write(body.Bytes())
+
+	return message.Bytes(), nil
+}
@@ -0,0 +1,87 @@
+package endpoint
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultOpsgenieBaseURL  = "https://api.opsgenie.com"
+	defaultOpsgeniePriority = "P1"
+
+	opsgenieMessageLimit = 130
+)
+
+// NewOpsgenieNotifier creates Opsgenie alerts aliased by endpoint, so repeated
+// alerts are deduplicated and recoveries close the open alert. Content changes
+// are not sent, since nothing would close their alert.
+func NewOpsgenieNotifier(config OpsgenieConfig) *OpsgenieNotifier {
+	if config.BaseURL == "" {
+		config.BaseURL = defaultOpsgenieBaseURL
+	}
+	if config.Priority == "" {
+		config.Priority = defaultOpsgeniePriority
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+
+	return &OpsgenieNotifier{
+		config: config,
+		client: &http.Client{},
+	}
+}
+
+func (n *OpsgenieNotifier) Name() string {
+	return "opsgenie"
+}
+
+func (n *OpsgenieNotifier) Notify(ctx context.Context, alert Alert) error {
+	if alert.Kind == AlertChanged {
+		return nil
+	}
+
+	headers := map[string]string{"Authorization": "GenieKey " + n.config.APIKey}
+	alias := dedupKey(alert.URL)
+
+	if alert.Kind == AlertRecovered {
+		target := n.config.BaseURL + "/v2/alerts/" + url.PathEscape(alias) + "/close?identifierType=alias"
+		_, err := postJSON(ctx, n.client, target, headers, opsgenieClose{
+			Source: "cron",
+			Note:   alert.Title(),
+		})
+		return err
+	}
+
+	message := alert.Title()
+	if len(message) > opsgenieMessageLimit {
+		message = message[:opsgenieMessageLimit]
+	}
+
+	priority := n.config.Priority
+	if alert.Severity() == SeverityWarning {
+		priority = "P3"
+	}
+
+	var tags []string
+	if alert.Domain != "" {
+		tags = append(tags, alert.Domain)
+	}
+	for key, value := range alert.Labels {
+		tags = append(tags, key+":"+value)
+	}
+	sort.Strings(tags)
+
+	_, err := postJSON(ctx, n.client, n.config.BaseURL+"/v2/alerts", headers, opsgenieAlert{
+		Message:     message,
+		Alias:       alias,
+		Description: alert.Error,
+		Source:      "cron",
+		Entity:      alert.URL,
+		Priority:    priority,
+		Tags:        tags,
+		Details:     alertDetails(alert),
+	})
+	return err
+}
@@ -0,0 +1,61 @@
+package endpoint
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+const defaultPagerDutyBaseURL = "https://events.pagerduty.com"
+
+// NewPagerDutyNotifier sends Events API v2 events. Down, degraded and
+// flapping alerts trigger an incident keyed by endpoint, recoveries resolve it.
+// Content changes are not sent, since nothing would resolve their incident.
+func NewPagerDutyNotifier(config PagerDutyConfig) *PagerDutyNotifier {
+	if config.BaseURL == "" {
+		config.BaseURL = defaultPagerDutyBaseURL
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+
+	return &PagerDutyNotifier{
+		config: config,
+		client: &http.Client{},
+	}
+}
+
+func (n *PagerDutyNotifier) Name() string {
+	return "pagerduty"
+}
+
+func (n *PagerDutyNotifier) Notify(ctx context.Context, alert Alert) error {
+	if alert.Kind == AlertChanged {
+		return nil
+	}
+
+	event := pagerDutyEvent{
+		RoutingKey: n.config.RoutingKey,
+		DedupKey:   dedupKey(alert.URL),
+	}
+
+	switch alert.Kind {
+	case AlertRecovered:
+		event.EventAction = "resolve"
+	default:
+		event.EventAction = "trigger"
+		event.Payload = &pagerDutyPayload{
+			Summary:       alert.Title(),
+			Source:        alert.URL,
+			Severity:      alert.Severity(),
+			Timestamp:     alert.Timestamp.UTC().Format("2006-01-02T15:04:05Z"),
+			Group:         alert.Domain,
+			Class:         alert.Category,
+			CustomDetails: alertDetails(alert),
+		}
+		if alert.HistoryURL != "" {
+			event.Links = []pagerDutyLink{{Href: alert.HistoryURL, Text: "View history"}}
+		}
+	}
+
+	_, err := postJSON(ctx, n.client, n.config.BaseURL+"/v2/enqueue", nil, event)
+	return err
+}
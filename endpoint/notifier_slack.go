@@ -0,0 +1,120 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const defaultSlackBaseURL = "https://slack.com/api"
+
+// NewSlackNotifier posts Block Kit messages with chat.postMessage. A bot token
+// is used rather than an incoming webhook because only the Web API returns
+// the message timestamp needed to thread the recovery under the outage.
+func NewSlackNotifier(config SlackConfig) *SlackNotifier {
+	if config.BaseURL == "" {
+		config.BaseURL = defaultSlackBaseURL
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+
+	return &SlackNotifier{
+		config:  config,
+		client:  &http.Client{},
+		threads: make(map[string]string),
+	}
+}
+
+func (n *SlackNotifier) Name() string {
+	return "slack"
+}
+
+func (n *SlackNotifier) Notify(ctx context.Context, alert Alert) error {
+	message := slackMessage{
+		Channel: n.config.Channel,
+		Text:    alert.Title(),
+		Blocks:  slackBlocks(alert),
+	}
+
+	if alert.Kind == AlertRecovered {
+		n.mu.Lock()
+		message.ThreadTS = n.threads[alert.URL]
+		n.mu.Unlock()
+		message.ReplyBroadcast = message.ThreadTS != ""
+	}
+
+	body, err := postJSON(ctx, n.client, n.config.BaseURL+"/chat.postMessage", map[string]string{
+		"Authorization": "Bearer " + n.config.Token,
+	}, message)
+	if err != nil {
+		return err
+	}
+
+	var response slackResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if !response.OK {
+		return errors.New("slack error: " + response.Error)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	switch alert.Kind {
+	case AlertDown:
+		n.threads[alert.URL] = response.TS
+	case AlertRecovered:
+		delete(n.threads, alert.URL)
+	}
+
+	return nil
+}
+
+func slackBlocks(alert Alert) []slackBlock {
+	emoji := map[string]string{
+		AlertDown:      ":red_circle:",
+		AlertRecovered: ":large_green_circle:",
+		AlertDegraded:  ":large_yellow_circle:",
+		AlertFlapping:  ":warning:",
+		AlertBurnRate:  ":fire:",
+		AlertAnomaly:   ":snail:",
+		AlertChanged:   ":pencil2:",
+	}[alert.Kind]
+
+	blocks := []slackBlock{
+		{
+			Type: "section",
+			Text: &slackText{Type: "mrkdwn", Text: strings.TrimSpace(emoji + " *" + alert.Title() + "*")},
+		},
+		{
+			Type: "section",
+			Fields: []slackText{
+				{Type: "mrkdwn", Text: "*URL*\n" + alert.URL},
+				{Type: "mrkdwn", Text: "*Domain*\n" + valueOrNA(alert.Domain)},
+				{Type: "mrkdwn", Text: "*Failure*\n" + valueOrNA(alert.Category)},
+				{Type: "mrkdwn", Text: "*Status*\n" + formatStatus(alert.Status)},
+				{Type: "mrkdwn", Text: "*Latency*\n" + formatLatency(alert.Duration)},
+			},
+		},
+	}
+
+	if alert.Error != "" {
+		blocks = append(blocks, slackBlock{
+			Type: "section",
+			Text: &slackText{Type: "mrkdwn", Text: "```" + alert.Error + "```"},
+		})
+	}
+
+	context := "Checked at " + alert.Timestamp.UTC().Format("2006-01-02 15:04:05 MST")
+	if alert.HistoryURL != "" {
+		context += " · <" + alert.HistoryURL + "|View history>"
+	}
+	blocks = append(blocks, slackBlock{
+		Type:     "context",
+		Elements: []slackText{{Type: "mrkdwn", Text: context}},
+	})
+
+	return blocks
+}
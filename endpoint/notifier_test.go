@@ -0,0 +1,599 @@
+package endpoint
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testAlert(kind string) Alert {
+	alert := Alert{
+		Kind:      kind,
+		URL:       "https://onplug.io",
+		Domain:    "plug",
+		Status:    http.StatusOK,
+		Duration:  120 * time.Millisecond,
+		Timestamp: time.Date(2024, 11, 15, 10, 0, 0, 0, time.UTC),
+	}
+	if kind == AlertDown {
+		alert.Status = http.StatusBadGateway
+		alert.Category = CategoryStatus
+		alert.Error = "received error status code: 502"
+	}
+	return alert
+}
+
+func TestSlackNotifier(t *testing.T) {
+	var mu sync.Mutex
+	var messages []slackMessage
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat.postMessage" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+			return
+		}
+
+		var message slackMessage
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Errorf("Failed to decode message: %v", err)
+		}
+
+		mu.Lock()
+		messages = append(messages, message)
+		ts := fmt.Sprintf("1700000000.%06d", len(messages))
+		mu.Unlock()
+
+		fmt.Fprintf(w, `{"ok":true,"ts":"%s"}`, ts)
+	}))
+	defer server.Close()
+
+	alerter := NewAlerter("https://cron.example.com")
+	alerter.Register(NewSlackNotifier(SlackConfig{Token: "xoxb-test", Channel: "#alerts", BaseURL: server.URL}))
+
+	if errs := alerter.Dispatch(context.Background(), testAlert(AlertDown)); len(errs) != 0 {
+		t.Fatalf("Failed to send down alert: %v", errs)
+	}
+	if errs := alerter.Dispatch(context.Background(), testAlert(AlertRecovered)); len(errs) != 0 {
+		t.Fatalf("Failed to send recovered alert: %v", errs)
+	}
+
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(messages))
+	}
+
+	down, recovered := messages[0], messages[1]
+	if down.Channel != "#alerts" || down.ThreadTS != "" {
+		t.Errorf("Expected top level message in #alerts, got %+v", down)
+	}
+	if recovered.ThreadTS != "1700000000.000001" {
+		t.Errorf("Expected recovery threaded under the outage, got thread %q", recovered.ThreadTS)
+	}
+
+	blocks, err := json.Marshal(down.Blocks)
+	if err != nil {
+		t.Fatalf("Failed to marshal blocks: %v", err)
+	}
+	for _, want := range []string{"https://onplug.io", "plug", CategoryStatus, "502", "120ms", "https://cron.example.com/endpoint/history?url=https%3A%2F%2Fonplug.io"} {
+		if !strings.Contains(string(blocks), want) {
+			t.Errorf("Expected blocks to contain %q, got %s", want, blocks)
+		}
+	}
+
+	unauthorized := NewSlackNotifier(SlackConfig{Token: "wrong", BaseURL: server.URL})
+	if err := unauthorized.Notify(context.Background(), testAlert(AlertDown)); err == nil || !strings.Contains(err.Error(), "invalid_auth") {
+		t.Errorf("Expected invalid_auth error, got %v", err)
+	}
+}
+
+func TestAlerterQueueOrder(t *testing.T) {
+	var mu sync.Mutex
+	var messages []slackMessage
+
+	// The down alert is slow to post, so a recovery sent alongside it would
+	// arrive first and have no thread to reply to.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message slackMessage
+		json.NewDecoder(r.Body).Decode(&message)
+		if message.ThreadTS == "" {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		mu.Lock()
+		messages = append(messages, message)
+		ts := fmt.Sprintf("1700000000.%06d", len(messages))
+		mu.Unlock()
+
+		fmt.Fprintf(w, `{"ok":true,"ts":"%s"}`, ts)
+	}))
+	defer server.Close()
+
+	alerter := NewAlerter("")
+	alerter.Register(NewSlackNotifier(SlackConfig{Token: "xoxb-test", Channel: "#alerts", BaseURL: server.URL}))
+
+	alerter.Enqueue(testAlert(AlertDown))
+	alerter.Enqueue(testAlert(AlertRecovered))
+	alerter.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(messages))
+	}
+	if messages[0].ThreadTS != "" || messages[1].ThreadTS != "1700000000.000001" {
+		t.Errorf("Expected the recovery threaded under the down alert, got %+v", messages)
+	}
+	if active := alerter.ActiveAlerts(); len(active) != 0 {
+		t.Errorf("Expected the outage to be resolved, got %+v", active)
+	}
+}
+
+func TestDiscordNotifier(t *testing.T) {
+	var message discordMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Errorf("Failed to decode message: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	alerter := NewAlerter("https://cron.example.com/")
+	alerter.Register(NewDiscordNotifier(DiscordConfig{WebhookURL: server.URL}))
+
+	if errs := alerter.Dispatch(context.Background(), testAlert(AlertDown)); len(errs) != 0 {
+		t.Fatalf("Failed to send down alert: %v", errs)
+	}
+
+	if len(message.Embeds) != 1 {
+		t.Fatalf("Expected 1 embed, got %d", len(message.Embeds))
+	}
+
+	embed := message.Embeds[0]
+	if embed.Color != discordRed {
+		t.Errorf("Expected red embed, got %x", embed.Color)
+	}
+	if embed.URL != "https://cron.example.com/endpoint/history?url=https%3A%2F%2Fonplug.io" {
+		t.Errorf("Expected history link, got %s", embed.URL)
+	}
+	if embed.Description != "received error status code: 502" {
+		t.Errorf("Expected error as description, got %s", embed.Description)
+	}
+
+	fields := make(map[string]string)
+	for _, field := range embed.Fields {
+		fields[field.Name] = field.Value
+	}
+	if fields["Domain"] != "plug" || fields["Failure"] != CategoryStatus || fields["Status"] != "502" || fields["Latency"] != "120ms" {
+		t.Errorf("Unexpected fields %v", fields)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer failing.Close()
+
+	alerter = NewAlerter("")
+	alerter.Register(NewDiscordNotifier(DiscordConfig{WebhookURL: failing.URL}))
+	if errs := alerter.Dispatch(context.Background(), testAlert(AlertRecovered)); errs["discord"] == nil {
+		t.Errorf("Expected discord error to be reported")
+	}
+}
+
+type smtpMessage struct {
+	from string
+	to   []string
+	auth string
+	tls  bool
+	data string
+}
+
+// smtpServer is a minimal SMTP stand-in that accepts every message and offers
+// STARTTLS when given a certificate.
+type smtpServer struct {
+	listener net.Listener
+	tls      *tls.Config
+	mu       sync.Mutex
+	messages []smtpMessage
+}
+
+func newSMTPServer(t *testing.T, config *tls.Config) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	server := &smtpServer{listener: listener, tls: config}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+
+	return server
+}
+
+func (s *smtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP")
+
+	var message smtpMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch command {
+		case "EHLO", "HELO":
+			text.PrintfLine("250-localhost")
+			if s.tls != nil && !message.tls {
+				text.PrintfLine("250-STARTTLS")
+			}
+			text.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			text.PrintfLine("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			message.tls = true
+		case "AUTH":
+			fields := strings.Fields(line)
+			decoded, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+			message.auth = string(decoded)
+			text.PrintfLine("235 Authenticated")
+		case "MAIL":
+			message.from = strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			message.to = append(message.to, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 Go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message.data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+			message = smtpMessage{tls: message.tls}
+			text.PrintfLine("250 Queued")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+// readEmail parses a message into its headers and decoded text and HTML parts.
+func readEmail(t *testing.T, data string) (mail.Header, string, string) {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Failed to parse content type: %v", err)
+	}
+
+	var text, html string
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		body, _ := io.ReadAll(part)
+		switch {
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain"):
+			text = string(body)
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/html"):
+			html = string(body)
+		}
+	}
+	return msg.Header, text, html
+}
+
+func TestEmailNotifier(t *testing.T) {
+	certServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer certServer.Close()
+
+	server := newSMTPServer(t, certServer.TLS)
+	notifier := NewEmailNotifier(EmailConfig{
+		Host:       "127.0.0.1",
+		Port:       server.port(),
+		Username:   "cron",
+		Password:   "secret",
+		From:       "cron@example.com",
+		To:         []string{"ops@example.com"},
+		Domains:    map[string]EmailRoute{"plug": {To: []string{"plug@example.com", "lead@example.com"}}},
+		RequireTLS: true,
+		RootCAs:    certServer.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs,
+	})
+
+	alerter := NewAlerter("https://cron.example.com")
+	alerter.Register(notifier)
+	if errs := alerter.Dispatch(context.Background(), testAlert(AlertDown)); len(errs) != 0 {
+		t.Fatalf("Failed to send alert: %v", errs)
+	}
+
+	other := testAlert(AlertDown)
+	other.Domain = "other"
+	if errs := alerter.Dispatch(context.Background(), other); len(errs) != 0 {
+		t.Fatalf("Failed to send alert: %v", errs)
+	}
+
+	messages := server.received()
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(messages))
+	}
+
+	routed := messages[0]
+	if !routed.tls {
+		t.Errorf("Expected the session to be upgraded with STARTTLS")
+	}
+	if routed.auth != "\x00cron\x00secret" {
+		t.Errorf("Expected PLAIN auth for cron, got %q", routed.auth)
+	}
+	if routed.from != "cron@example.com" || strings.Join(routed.to, ",") != "plug@example.com,lead@example.com" {
+		t.Errorf("Expected domain recipients, got from %s to %v", routed.from, routed.to)
+	}
+	if strings.Join(messages[1].to, ",") != "ops@example.com" {
+		t.Errorf("Expected default recipients for other domains, got %v", messages[1].to)
+	}
+
+	header, text, html := readEmail(t, routed.data)
+	if header.Get("Subject") != "[cron] https://onplug.io is down" {
+		t.Errorf("Unexpected subject %q", header.Get("Subject"))
+	}
+	for _, want := range []string{"https://onplug.io", CategoryStatus, "502", "120ms", "https://cron.example.com/endpoint/history?url=https%3A%2F%2Fonplug.io"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected text body to contain %q, got %s", want, text)
+		}
+	}
+	if !strings.Contains(html, `<a href="https://cron.example.com/endpoint/history?url=https%3A%2F%2Fonplug.io">`) {
+		t.Errorf("Expected HTML body to link to history, got %s", html)
+	}
+
+	plain := newSMTPServer(t, nil)
+	insecure := NewEmailNotifier(EmailConfig{Host: "127.0.0.1", Port: plain.port(), From: "cron@example.com", To: []string{"ops@example.com"}, RequireTLS: true})
+	if err := insecure.Notify(context.Background(), testAlert(AlertDown)); err == nil {
+		t.Errorf("Expected an error when STARTTLS is required but not offered")
+	}
+}
+
+func TestEmailDigest(t *testing.T) {
+	server := newSMTPServer(t, nil)
+	notifier := NewEmailNotifier(EmailConfig{
+		Host:   "127.0.0.1",
+		Port:   server.port(),
+		From:   "cron@example.com",
+		To:     []string{"ops@example.com"},
+		Digest: time.Hour,
+	})
+
+	down := testAlert(AlertDown)
+	recovered := testAlert(AlertRecovered)
+	recovered.Timestamp = down.Timestamp.Add(5 * time.Minute)
+
+	for _, alert := range []Alert{recovered, down} {
+		if err := notifier.Notify(context.Background(), alert); err != nil {
+			t.Fatalf("Failed to queue alert: %v", err)
+		}
+	}
+	if len(server.received()) != 0 {
+		t.Fatalf("Expected alerts to be held until the digest is flushed")
+	}
+
+	if err := notifier.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush digest: %v", err)
+	}
+
+	messages := server.received()
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 digest, got %d", len(messages))
+	}
+
+	header, text, html := readEmail(t, messages[0].data)
+	if header.Get("Subject") != "[cron] Alert digest: 2 events" {
+		t.Errorf("Unexpected subject %q", header.Get("Subject"))
+	}
+	if strings.Index(text, "is down") > strings.Index(text, "has recovered") {
+		t.Errorf("Expected events in chronological order, got %s", text)
+	}
+	if !strings.Contains(html, "https://onplug.io has recovered") {
+		t.Errorf("Expected HTML body to contain both events, got %s", html)
+	}
+
+	if err := notifier.Flush(context.Background()); err != nil || len(server.received()) != 1 {
+		t.Errorf("Expected an empty flush to send nothing")
+	}
+}
+
+func TestPagerDutyNotifier(t *testing.T) {
+	var mu sync.Mutex
+	var events []pagerDutyEvent
+	open := make(map[string]bool)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/enqueue" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+
+		var event pagerDutyEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Failed to decode event: %v", err)
+		}
+
+		mu.Lock()
+		events = append(events, event)
+		switch event.EventAction {
+		case "trigger":
+			open[event.DedupKey] = true
+		case "resolve":
+			delete(open, event.DedupKey)
+		}
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, `{"status":"success","dedup_key":"%s"}`, event.DedupKey)
+	}))
+	defer server.Close()
+
+	alerter := NewAlerter("https://cron.example.com")
+	alerter.Register(NewPagerDutyNotifier(PagerDutyConfig{RoutingKey: "routing", BaseURL: server.URL + "/"}))
+
+	for _, kind := range []string{AlertDown, AlertDown, AlertChanged} {
+		if errs := alerter.Dispatch(context.Background(), testAlert(kind)); len(errs) != 0 {
+			t.Fatalf("Failed to send alert: %v", errs)
+		}
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected the content change not to be sent, got %d events", len(events))
+	}
+	if len(open) != 1 {
+		t.Fatalf("Expected repeated triggers to share one incident, got %d", len(open))
+	}
+
+	trigger := events[0]
+	if trigger.RoutingKey != "routing" || trigger.DedupKey != events[1].DedupKey || trigger.DedupKey != dedupKey("https://onplug.io") {
+		t.Errorf("Expected stable dedup key, got %+v", events)
+	}
+	if trigger.Payload == nil || trigger.Payload.Severity != "critical" || trigger.Payload.Summary != "https://onplug.io is down" {
+		t.Errorf("Unexpected payload %+v", trigger.Payload)
+	}
+	if trigger.Payload.CustomDetails["failure"] != CategoryStatus || len(trigger.Links) != 1 {
+		t.Errorf("Expected details and history link, got %+v", trigger)
+	}
+
+	if errs := alerter.Dispatch(context.Background(), testAlert(AlertRecovered)); len(errs) != 0 {
+		t.Fatalf("Failed to send recovery: %v", errs)
+	}
+	if len(open) != 0 {
+		t.Errorf("Expected recovery to resolve the incident")
+	}
+	if resolve := events[2]; resolve.EventAction != "resolve" || resolve.Payload != nil {
+		t.Errorf("Expected bare resolve event, got %+v", resolve)
+	}
+}
+
+func TestOpsgenieNotifier(t *testing.T) {
+	var mu sync.Mutex
+	var created []opsgenieAlert
+	open := make(map[string]bool)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "GenieKey key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/v2/alerts":
+			var alert opsgenieAlert
+			if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+				t.Errorf("Failed to decode alert: %v", err)
+			}
+			created = append(created, alert)
+			open[alert.Alias] = true
+		case strings.HasSuffix(r.URL.Path, "/close"):
+			if r.URL.Query().Get("identifierType") != "alias" {
+				t.Errorf("Expected close by alias, got %s", r.URL.RawQuery)
+			}
+			alias := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v2/alerts/"), "/close")
+			delete(open, alias)
+		default:
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"result":"Request will be processed"}`))
+	}))
+	defer server.Close()
+
+	alerter := NewAlerter("")
+	alerter.Register(NewOpsgenieNotifier(OpsgenieConfig{APIKey: "key", BaseURL: server.URL}))
+
+	down := testAlert(AlertDown)
+	down.Labels = map[string]string{"team": "web"}
+	for i := 0; i < 2; i++ {
+		if errs := alerter.Dispatch(context.Background(), down); len(errs) != 0 {
+			t.Fatalf("Failed to send alert: %v", errs)
+		}
+	}
+	if errs := alerter.Dispatch(context.Background(), testAlert(AlertChanged)); len(errs) != 0 {
+		t.Fatalf("Failed to send alert: %v", errs)
+	}
+	if len(created) != 2 {
+		t.Fatalf("Expected the content change not to be sent, got %+v", created)
+	}
+	if len(open) != 1 || created[0].Alias != created[1].Alias {
+		t.Fatalf("Expected repeated alerts to share one alias, got %+v", created)
+	}
+
+	alert := created[0]
+	if alert.Priority != "P1" || alert.Entity != "https://onplug.io" || alert.Description != "received error status code: 502" {
+		t.Errorf("Unexpected alert %+v", alert)
+	}
+	if strings.Join(alert.Tags, ",") != "plug,team:web" {
+		t.Errorf("Expected domain and label tags, got %v", alert.Tags)
+	}
+
+	if errs := alerter.Dispatch(context.Background(), testAlert(AlertRecovered)); len(errs) != 0 {
+		t.Fatalf("Failed to close alert: %v", errs)
+	}
+	if len(open) != 0 {
+		t.Errorf("Expected recovery to close the alert")
+	}
+
+	unauthorized := NewOpsgenieNotifier(OpsgenieConfig{APIKey: "wrong", BaseURL: server.URL})
+	if err := unauthorized.Notify(context.Background(), down); err == nil {
+		t.Errorf("Expected unauthorized error")
+	}
+}
@@ -0,0 +1,217 @@
+package endpoint
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// SetProbes validates and installs the probe agents allowed to report
+// results. Each probe is identified by its token and reports from its
+// location.
+func (s *Scheduler) SetProbes(probes []Probe) error {
+	if err := validateProbes(probes); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.probes = probes
+	return nil
+}
+
+func validateProbes(probes []Probe) error {
+	locations := make(map[string]bool)
+	for _, probe := range probes {
+		if probe.Location == "" {
+			return errors.New("probes require a location")
+		}
+		owner := fmt.Sprintf("probe %q", probe.Location)
+		if probe.Token == "" {
+			return fmt.Errorf("%s: a token is required", owner)
+		}
+		if locations[probe.Location] {
+			return fmt.Errorf("%s: defined more than once", owner)
+		}
+		locations[probe.Location] = true
+	}
+	return nil
+}
+
+// Probe returns the probe the token belongs to.
+func (s *Scheduler) Probe(token string) (Probe, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, probe := range s.probes {
+		if subtle.ConstantTimeCompare([]byte(probe.Token), []byte(token)) == 1 {
+			return probe, true
+		}
+	}
+	return Probe{}, false
+}
+
+// Probes lists the registered probes with the number of endpoints assigned
+// to them and when they last reported.
+func (s *Scheduler) Probes() []ProbeStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := []ProbeStatus{}
+	for _, probe := range s.probes {
+		status := ProbeStatus{Location: probe.Location}
+		for _, endpoint := range s.endpoints {
+			if probe.assigned(endpoint) {
+				status.Endpoints++
+			}
+		}
+		if seen, ok := s.lastSeen[probe.Location]; ok {
+			status.LastSeen = &seen
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Assignment lists the endpoints the probe should check and how often.
+// Endpoints in a maintenance window that skips checks are left out.
+func (s *Scheduler) Assignment(probe Probe, now time.Time) ProbeAssignment {
+	s.seen(probe, now)
+
+	assignment := ProbeAssignment{
+		Location:  probe.Location,
+		Interval:  s.interval,
+		Endpoints: []EndpointRequest{},
+	}
+	for _, endpoint := range s.endpoints {
+		if !probe.assigned(endpoint) {
+			continue
+		}
+		window, err := s.handler.ActiveMaintenance(endpoint, now)
+		if err == nil && window != nil && window.Mode == MaintenanceSkip {
+			continue
+		}
+		assignment.Endpoints = append(assignment.Endpoints, endpoint)
+	}
+	return assignment
+}
+
+// Ingest stores results reported by the probe and feeds them through the
+// same state tracking as local checks, oldest first. Results for endpoints
+// not assigned to the probe are rejected. Late results, such as ones the
+// agent buffered while the server was unreachable, are only stored: the
+// outages they describe are over or have been decided without them.
+func (s *Scheduler) Ingest(probe Probe, results []ProbeResult, now time.Time) ProbeResultsResponse {
+	s.seen(probe, now)
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Timestamp.Before(results[j].Timestamp)
+	})
+
+	var response ProbeResultsResponse
+	for _, result := range results {
+		endpoint, ok := s.endpoint(result.URL)
+		if !ok || !probe.assigned(endpoint) {
+			response.Rejected++
+			continue
+		}
+
+		checked := EndpointResponse{
+			Endpoint:      getEndpointDefaults(endpoint),
+			Status:        result.Status,
+			Category:      result.Category,
+			Timestamp:     result.Timestamp,
+			Duration:      result.Duration,
+			Body:          result.Body,
+			BodyHash:      result.BodyHash,
+			BodySize:      result.BodySize,
+			BodyTruncated: result.BodyTruncated,
+			Location:      probe.Location,
+		}
+		if result.Error != "" {
+			checked.Error = errors.New(result.Error)
+		}
+
+		response.Accepted++
+		if s.late(checked, now) {
+			s.handler.storeLateResult(&checked)
+			response.Late++
+			continue
+		}
+		s.handler.finishResult(&checked)
+		s.record(checked)
+	}
+	return response
+}
+
+// late reports whether a probe result is too old to take part in deciding
+// the endpoint's state: it was checked before the quorum window, or before
+// the latest check already recorded from its location.
+func (s *Scheduler) late(result EndpointResponse, now time.Time) bool {
+	if now.Sub(result.Timestamp) > s.quorumWindow() {
+		return true
+	}
+
+	history, err := s.handler.GetEndpointHistory(result.Endpoint.URL)
+	if err != nil {
+		log.Printf("Failed to load history of %s: %v", result.Endpoint.URL, err)
+		return false
+	}
+	for _, previous := range fromLocation(history, result.Location) {
+		if !result.Timestamp.After(previous.Timestamp) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scheduler) endpoint(url string) (EndpointRequest, bool) {
+	for _, endpoint := range s.endpoints {
+		if endpoint.URL == url {
+			return endpoint, true
+		}
+	}
+	return EndpointRequest{}, false
+}
+
+func (s *Scheduler) seen(probe Probe, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSeen[probe.Location] = now
+}
+
+// assigned reports whether the probe checks the endpoint. Probes without
+// domains or a selector check every endpoint.
+func (p Probe) assigned(endpoint EndpointRequest) bool {
+	if len(p.Domains) > 0 && !contains(p.Domains, endpoint.Domain) {
+		return false
+	}
+	return len(p.Selector) == 0 || p.Selector.Matches(endpoint.Labels)
+}
+
+// newProbeResult converts a check made by an agent. Only the part of the
+// body the endpoint's policy stores is sent, unless the endpoint has change
+// detection.
+func newProbeResult(response EndpointResponse) ProbeResult {
+	result := ProbeResult{
+		URL:           response.Endpoint.URL,
+		Status:        response.Status,
+		Category:      response.Category,
+		Timestamp:     response.Timestamp,
+		Duration:      response.Duration,
+		Body:          keptBody(response),
+		BodyHash:      response.BodyHash,
+		BodySize:      response.BodySize,
+		BodyTruncated: response.BodyTruncated,
+	}
+	if response.Endpoint.DetectChanges {
+		result.Body = response.Body
+	}
+	if response.Error != nil {
+		result.Error = response.Error.Error()
+	}
+	return result
+}
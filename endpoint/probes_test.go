@@ -0,0 +1,230 @@
+package endpoint
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbeAgent(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+
+	endpoints := []EndpointRequest{
+		{URL: target.URL, Domain: "test", Timeout: time.Second},
+		{URL: target.URL + "/other", Domain: "other", Timeout: time.Second},
+	}
+	if err := handler.RegisterEndpoints(endpoints); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
+
+	scheduler := NewScheduler(handler, time.Minute, endpoints)
+	if err := scheduler.SetProbes([]Probe{{Location: "ams", Token: "secret", Domains: []string{"test"}}}); err != nil {
+		t.Fatalf("Failed to set probes: %v", err)
+	}
+	server := httptest.NewServer(NewAPI(handler, scheduler))
+
+	agentHandler := NewStoreHandler(NewMemoryStore(), 1)
+	agent := NewAgent(agentHandler, AgentConfig{ServerURL: server.URL, Token: "secret"})
+
+	if wait := agent.Cycle(context.Background()); wait != time.Minute {
+		t.Errorf("Expected the server's interval, got %v", wait)
+	}
+	if len(agent.assignment.Endpoints) != 1 || agent.assignment.Location != "ams" {
+		t.Fatalf("Expected one endpoint assigned to ams, got %+v", agent.assignment)
+	}
+
+	history, err := handler.GetEndpointHistory(target.URL)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if len(history) != 1 || history[0].Location != "ams" || history[0].Error != nil {
+		t.Fatalf("Expected a successful result from ams, got %+v", history)
+	}
+
+	// While the server is down results are buffered and sent once it is back,
+	// checking the endpoints of the last assignment in the meantime.
+	server.Close()
+	agent.Cycle(context.Background())
+	agent.Cycle(context.Background())
+	if count, _ := agent.Buffered(); count != 2 {
+		t.Fatalf("Expected 2 buffered results, got %d", count)
+	}
+
+	server = httptest.NewServer(NewAPI(handler, scheduler))
+	defer server.Close()
+	agent.config.ServerURL = server.URL
+	agent.Cycle(context.Background())
+
+	if count, _ := agent.Buffered(); count != 0 {
+		t.Errorf("Expected the buffer to be sent, got %d results left", count)
+	}
+	history, _ = handler.GetEndpointHistory(target.URL)
+	if len(history) != 4 {
+		t.Errorf("Expected 4 results, got %d", len(history))
+	}
+	for i := 1; i < len(history); i++ {
+		if history[i].Timestamp.Before(history[i-1].Timestamp) {
+			t.Errorf("Expected history in timestamp order")
+		}
+	}
+
+	probes := scheduler.Probes()
+	if len(probes) != 1 || probes[0].Endpoints != 1 || probes[0].LastSeen == nil {
+		t.Errorf("Expected probe status, got %+v", probes)
+	}
+}
+
+func TestAgentBatchBytes(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+	scheduler := NewScheduler(handler, time.Minute, nil)
+	if err := scheduler.SetProbes([]Probe{{Location: "ams", Token: "secret"}}); err != nil {
+		t.Fatalf("Failed to set probes: %v", err)
+	}
+	server := httptest.NewServer(NewAPI(handler, scheduler))
+	defer server.Close()
+
+	// Together the results are larger than the server accepts at once.
+	agent := NewAgent(NewStoreHandler(NewMemoryStore(), 1), AgentConfig{ServerURL: server.URL, Token: "secret"})
+	body := strings.Repeat("a", 3<<20)
+	var results []ProbeResult
+	for i := 0; i < 6; i++ {
+		results = append(results, ProbeResult{URL: "https://test.com", Status: http.StatusOK, Timestamp: time.Now(), Body: body})
+	}
+	if err := agent.buffer(results); err != nil {
+		t.Fatalf("Failed to buffer results: %v", err)
+	}
+
+	if _, batch, err := agent.nextBatch(); err != nil || len(batch) != 2 {
+		t.Fatalf("Expected a batch of 2 results, got %d, %v", len(batch), err)
+	}
+	agent.flush(context.Background())
+	if count, _ := agent.Buffered(); count != 0 {
+		t.Errorf("Expected every batch to be sent, got %d results left", count)
+	}
+}
+
+func TestProbeAuthentication(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+
+	endpoints := []EndpointRequest{{URL: "https://test.com", Domain: "test"}}
+	scheduler := NewScheduler(handler, time.Minute, endpoints)
+	if err := scheduler.SetProbes([]Probe{{Location: "ams", Token: "secret", Domains: []string{"other"}}}); err != nil {
+		t.Fatalf("Failed to set probes: %v", err)
+	}
+	api := NewAPI(handler, scheduler)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"no token", "GET", "/probes/assignment", "", "", http.StatusUnauthorized, ""},
+		{"wrong token", "GET", "/probes/assignment", "other", "", http.StatusUnauthorized, ""},
+		{"assignment", "GET", "/probes/assignment", "secret", "", http.StatusOK, `"endpoints":[]`},
+		{"invalid body", "POST", "/probes/results", "secret", "{", http.StatusBadRequest, ""},
+		{
+			"unassigned endpoint",
+			"POST",
+			"/probes/results",
+			"secret",
+			`[{"url":"https://test.com","status":200,"timestamp":"2024-11-15T10:00:00Z"}]`,
+			http.StatusOK,
+			`{"accepted":0,"rejected":1,"late":0}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %s, got %s", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+
+	if err := scheduler.SetProbes([]Probe{{Location: "ams", Token: "a"}, {Location: "ams", Token: "b"}}); err == nil {
+		t.Error("Expected duplicate locations to be rejected")
+	}
+}
+
+func TestProbeLateResults(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+	endpoints := []EndpointRequest{{URL: "https://test.com", Domain: "test", Status: http.StatusOK}}
+	if err := handler.RegisterEndpoints(endpoints); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
+
+	alerts := make(channelNotifier, 16)
+	scheduler := NewScheduler(handler, time.Minute, endpoints)
+	scheduler.Alerter().Register(alerts)
+	probe := Probe{Location: "ams", Token: "secret"}
+	if err := scheduler.SetProbes([]Probe{probe}); err != nil {
+		t.Fatalf("Failed to set probes: %v", err)
+	}
+
+	now := time.Now()
+	up := ProbeResult{URL: "https://test.com", Status: http.StatusOK, Timestamp: now}
+	if response := scheduler.Ingest(probe, []ProbeResult{up}, now); response.Accepted != 1 || response.Late != 0 {
+		t.Fatalf("Expected the current result to be evaluated, got %+v", response)
+	}
+
+	// A batch the agent buffered while the server was unreachable: failures
+	// from before the quorum window and one older than the latest check.
+	var batch []ProbeResult
+	for _, age := range []time.Duration{10 * time.Minute, 9 * time.Minute, 8 * time.Minute, 30 * time.Second} {
+		batch = append(batch, ProbeResult{
+			URL:       "https://test.com",
+			Status:    http.StatusBadGateway,
+			Error:     "received error status code: 502",
+			Timestamp: now.Add(-age),
+		})
+	}
+	response := scheduler.Ingest(probe, batch, now.Add(time.Second))
+	if response.Accepted != 4 || response.Late != 4 {
+		t.Errorf("Expected the replayed results to be stored as late, got %+v", response)
+	}
+
+	scheduler.alerter.Wait()
+	select {
+	case alert := <-alerts:
+		t.Errorf("Expected no alert for replayed results, got %+v", alert)
+	default:
+	}
+	scheduler.mu.Lock()
+	state := scheduler.states["https://test.com"]
+	scheduler.mu.Unlock()
+	if state != StateUp {
+		t.Errorf("Expected the endpoint to stay up, got %s", state)
+	}
+
+	history, _ := handler.GetEndpointHistory("https://test.com")
+	if len(history) != 5 {
+		t.Fatalf("Expected the replayed results in the history, got %d", len(history))
+	}
+	for _, result := range history {
+		if result.Flapping || result.Anomalous {
+			t.Errorf("Expected late results not to be evaluated, got %+v", result)
+		}
+	}
+}
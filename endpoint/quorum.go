@@ -0,0 +1,205 @@
+package endpoint
+
+import (
+	"sort"
+	"time"
+)
+
+// latestByLocation returns the most recent check from each location made at
+// or after since, leaving out checks during maintenance.
+func latestByLocation(history []EndpointResponse, since time.Time) map[string]EndpointResponse {
+	latest := make(map[string]EndpointResponse)
+	for _, result := range history {
+		if result.Maintenance || result.Timestamp.Before(since) {
+			continue
+		}
+		if previous, ok := latest[result.Location]; !ok || !result.Timestamp.Before(previous.Timestamp) {
+			latest[result.Location] = result
+		}
+	}
+	return latest
+}
+
+// latestInWindow returns the latest check of each location within window of
+// the endpoint's latest check, so that a probe that stopped reporting no
+// longer counts. A zero window counts every location.
+func latestInWindow(history []EndpointResponse, window time.Duration) map[string]EndpointResponse {
+	var since time.Time
+	if window > 0 && len(history) > 0 {
+		since = history[len(history)-1].Timestamp.Add(-window)
+	}
+	return latestByLocation(history, since)
+}
+
+func fromLocation(history []EndpointResponse, location string) []EndpointResponse {
+	var results []EndpointResponse
+	for _, result := range history {
+		if result.Location == location {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// locationKey identifies the checks of an endpoint from one location.
+func locationKey(url, location string) string {
+	if location == "" {
+		return url
+	}
+	return url + "@" + location
+}
+
+// requiredFailures is the number of failing locations needed to declare the
+// endpoint down. Without a quorum a majority of the reporting locations must
+// fail. A quorum larger than the number of reporting locations is lowered to
+// it, so an endpoint can still go down while probes are missing.
+func requiredFailures(quorum, reporting int) int {
+	if quorum <= 0 {
+		quorum = reporting/2 + 1
+	}
+	if quorum > reporting {
+		quorum = reporting
+	}
+	return quorum
+}
+
+// quorumState decides the endpoint's state from the latest check of each
+// location, returning it with the number of failing locations.
+func quorumState(latest map[string]EndpointResponse, quorum int) (string, int) {
+	failing := 0
+	for _, result := range latest {
+		if result.Error != nil {
+			failing++
+		}
+	}
+
+	if len(latest) > 0 && failing >= requiredFailures(quorum, len(latest)) {
+		return StateDown, failing
+	}
+	return StateUp, failing
+}
+
+// quorumWindow is how far back the scheduler looks for each location's
+// latest check. It spans one and a half intervals so that probes whose
+// checks drift against the server's are still counted.
+func (s *Scheduler) quorumWindow() time.Duration {
+	return s.interval + s.interval/2
+}
+
+// state decides the endpoint's state as of the result from the latest check
+// of every location within the quorum window.
+func (s *Scheduler) state(result EndpointResponse) string {
+	history, err := s.handler.GetEndpointHistory(result.Endpoint.URL)
+	if err != nil {
+		history = nil
+	}
+
+	latest := latestByLocation(append(history, result), result.Timestamp.Add(-s.quorumWindow()))
+	state, _ := quorumState(latest, result.Endpoint.Quorum)
+	return state
+}
+
+// GetLocationStatus lists the latest check of every endpoint from every
+// location within the quorum window together with the state the locations
+// agree on.
+func (h *EndpointHandler) GetLocationStatus(window time.Duration) (LocationStatusResponse, error) {
+	response := LocationStatusResponse{
+		Locations: []string{},
+		Endpoints: []EndpointLocationStatus{},
+	}
+
+	endpoints, err := h.ListEndpoints(nil)
+	if err != nil {
+		return response, err
+	}
+
+	locations := make(map[string]bool)
+	for _, meta := range endpoints {
+		history, err := h.GetEndpointHistory(meta.URL)
+		if err != nil {
+			return response, err
+		}
+		latest := latestInWindow(history, window)
+		if len(latest) == 0 {
+			continue
+		}
+
+		status := EndpointLocationStatus{
+			URL:       meta.URL,
+			Domain:    meta.Domain,
+			Labels:    meta.Labels,
+			Locations: make(map[string]LocationCheck),
+		}
+		status.State, status.Failing = quorumState(latest, meta.Quorum)
+		status.Required = requiredFailures(meta.Quorum, len(latest))
+
+		for location, result := range latest {
+			locations[location] = true
+			check := LocationCheck{
+				State:     StateUp,
+				Timestamp: result.Timestamp,
+				Duration:  result.Duration,
+			}
+			if result.Error != nil {
+				check.State = StateDown
+				check.Error = result.Error.Error()
+			}
+			status.Locations[location] = check
+		}
+		response.Endpoints = append(response.Endpoints, status)
+	}
+
+	for location := range locations {
+		response.Locations = append(response.Locations, location)
+	}
+	sort.Strings(response.Locations)
+	return response, nil
+}
+
+// newLocationStats breaks the history's stats down by the location the
+// checks were made from. Histories from a single location have none.
+func newLocationStats(history []EndpointResponse) []LocationStats {
+	byLocation := make(map[string][]EndpointResponse)
+	for _, result := range history {
+		byLocation[result.Location] = append(byLocation[result.Location], result)
+	}
+	if len(byLocation) < 2 {
+		return nil
+	}
+
+	var stats []LocationStats
+	for location, results := range byLocation {
+		var successful, total int
+		var duration time.Duration
+		for _, result := range results {
+			duration += result.Duration
+			if result.Maintenance {
+				continue
+			}
+			total++
+			if result.Error == nil {
+				successful++
+			}
+		}
+
+		last := results[len(results)-1]
+		entry := LocationStats{
+			Location:         location,
+			TotalChecks:      total,
+			SuccessfulChecks: successful,
+			UpTimePercentage: 100,
+			AverageResponse:  duration.Milliseconds() / int64(len(results)),
+			LastCheck:        last.Timestamp.Format(time.RFC3339),
+			Up:               last.Error == nil,
+		}
+		if total > 0 {
+			entry.UpTimePercentage = float64(successful) / float64(total) * 100
+		}
+		stats = append(stats, entry)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Location < stats[j].Location
+	})
+	return stats
+}
@@ -0,0 +1,221 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQuorumState(t *testing.T) {
+	up := EndpointResponse{}
+	down := EndpointResponse{Error: errors.New("timeout")}
+
+	tests := []struct {
+		name   string
+		checks []EndpointResponse
+		quorum int
+		want   string
+	}{
+		{"single location up", []EndpointResponse{up}, 0, StateUp},
+		{"single location down", []EndpointResponse{down}, 0, StateDown},
+		{"one of three failing", []EndpointResponse{down, up, up}, 0, StateUp},
+		{"two of three failing", []EndpointResponse{down, down, up}, 0, StateDown},
+		{"one of two failing", []EndpointResponse{down, up}, 0, StateUp},
+		{"quorum of one", []EndpointResponse{down, up, up}, 1, StateDown},
+		{"quorum of three", []EndpointResponse{down, down, up}, 3, StateUp},
+		{"quorum above reporting locations", []EndpointResponse{down, down}, 3, StateDown},
+		{"no locations", nil, 0, StateUp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			latest := make(map[string]EndpointResponse)
+			for i, check := range tt.checks {
+				latest[string(rune('a'+i))] = check
+			}
+			if got, _ := quorumState(latest, tt.quorum); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLatestByLocation(t *testing.T) {
+	start := time.Date(2024, 11, 15, 10, 0, 0, 0, time.UTC)
+	history := []EndpointResponse{
+		{Location: "ams", Timestamp: start},
+		{Location: "sin", Timestamp: start.Add(time.Minute), Error: errors.New("timeout")},
+		{Location: "ams", Timestamp: start.Add(2 * time.Minute), Error: errors.New("timeout")},
+		{Location: "dfw", Timestamp: start.Add(3 * time.Minute), Maintenance: true},
+	}
+
+	latest := latestByLocation(history, start.Add(30*time.Second))
+	if len(latest) != 2 || latest["ams"].Error == nil || latest["sin"].Error == nil {
+		t.Errorf("Expected the latest failing checks of ams and sin, got %+v", latest)
+	}
+}
+
+func TestSchedulerQuorum(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 50)
+
+	endpoints := []EndpointRequest{{URL: "https://test.com", Domain: "test", Quorum: 2}}
+	if err := handler.RegisterEndpoints(endpoints); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
+
+	alerts := make(channelNotifier, 16)
+	scheduler := NewScheduler(handler, time.Minute, endpoints)
+	scheduler.Alerter().Register(alerts)
+
+	probes := []Probe{{Location: "ams", Token: "a"}, {Location: "dfw", Token: "b"}, {Location: "sin", Token: "c"}}
+	if err := scheduler.SetProbes(probes); err != nil {
+		t.Fatalf("Failed to set probes: %v", err)
+	}
+
+	// Each round every location reports once; which locations fail changes
+	// from round to round.
+	rounds := [][]bool{
+		{false, false, false},
+		{true, false, false},
+		{true, false, false},
+		{true, true, false},
+		{false, false, false},
+	}
+	expected := []string{StateUp, StateUp, StateUp, StateDown, StateUp}
+
+	start := time.Now().Add(-time.Hour)
+	for i, round := range rounds {
+		for j, fail := range round {
+			result := ProbeResult{URL: "https://test.com", Status: http.StatusOK, Timestamp: start.Add(time.Duration(i)*time.Minute + time.Duration(j)*time.Second)}
+			if fail {
+				result.Status = http.StatusBadGateway
+				result.Error = "received error status code: 502"
+			}
+			if response := scheduler.Ingest(probes[j], []ProbeResult{result}, result.Timestamp); response.Accepted != 1 {
+				t.Fatalf("Expected the result to be accepted, got %+v", response)
+			}
+		}
+
+		scheduler.mu.Lock()
+		state := scheduler.states["https://test.com"]
+		scheduler.mu.Unlock()
+		if state != expected[i] {
+			t.Errorf("Round %d: expected %s, got %s", i+1, expected[i], state)
+		}
+	}
+
+	var kinds []string
+	for i := 0; i < 2; i++ {
+		select {
+		case alert := <-alerts:
+			kinds = append(kinds, alert.Kind)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected a down and a recovery alert, got %v", kinds)
+		}
+	}
+	select {
+	case alert := <-alerts:
+		t.Errorf("Unexpected alert %s", alert.Kind)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	api := NewAPI(handler, scheduler)
+
+	req := httptest.NewRequest("GET", "/status/locations", nil)
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	var matrix LocationStatusResponse
+	json.Unmarshal(w.Body.Bytes(), &matrix)
+	if len(matrix.Locations) != 3 || len(matrix.Endpoints) != 1 {
+		t.Fatalf("Expected a status matrix of 3 locations, got %+v", matrix)
+	}
+	if status := matrix.Endpoints[0]; status.State != StateUp || status.Required != 2 || status.Locations["ams"].State != StateUp {
+		t.Errorf("Expected every location up, got %+v", status)
+	}
+
+	req = httptest.NewRequest("GET", "/endpoint/history?url=https://test.com", nil)
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	var history HistoryResponse
+	json.Unmarshal(w.Body.Bytes(), &history)
+	if len(history.Locations) != 3 || history.Locations[0].Location != "ams" || history.Locations[0].SuccessfulChecks != 2 {
+		t.Errorf("Expected per-location stats, got %+v", history.Locations)
+	}
+}
+
+func TestQuorumViews(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 50)
+	endpoints := []EndpointRequest{
+		{URL: "https://test.com", Domain: "test"},
+		{URL: "https://stale.test.com", Domain: "test"},
+	}
+	if err := handler.RegisterEndpoints(endpoints); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
+	api := NewAPI(handler, NewScheduler(handler, time.Minute, endpoints))
+
+	now := time.Now()
+	failed := errors.New("received error status code: 502")
+	results := []EndpointResponse{
+		// A single failing probe does not take the endpoint down.
+		{Endpoint: endpoints[0], Status: http.StatusOK, Timestamp: now.Add(-2 * time.Second)},
+		{Endpoint: endpoints[0], Location: "ams", Status: http.StatusBadGateway, Error: failed, Timestamp: now.Add(-time.Second)},
+		// A probe that stopped reporting long ago does not keep it up.
+		{Endpoint: endpoints[1], Location: "ams", Status: http.StatusOK, Timestamp: now.Add(-time.Hour)},
+		{Endpoint: endpoints[1], Status: http.StatusBadGateway, Error: failed, Timestamp: now},
+	}
+	for _, result := range results {
+		if err := handler.storeResponse(result); err != nil {
+			t.Fatalf("Failed to store result: %v", err)
+		}
+	}
+
+	get := func(path string, v interface{}) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("Failed to decode %s: %v", path, err)
+		}
+	}
+
+	var domain DomainResponse
+	get("/domain/history?domain=test", &domain)
+	if domain.Stats.EndpointsDown != 1 || domain.Stats.EndpointsUp != 1 || domain.Stats.Status != DomainPartialOutage {
+		t.Errorf("Expected only the stale endpoint down, got %+v", domain.Stats)
+	}
+	for _, endpoint := range domain.Endpoints {
+		want := StateUp
+		if endpoint.URL == "https://stale.test.com" {
+			want = StateDown
+		}
+		if endpoint.State != want {
+			t.Errorf("Expected %s to be %s, got %s", endpoint.URL, want, endpoint.State)
+		}
+	}
+
+	var status StatusResponse
+	get("/status", &status)
+	if len(status.Endpoints) != 2 {
+		t.Fatalf("Expected both endpoints on the status page, got %+v", status.Endpoints)
+	}
+	for _, endpoint := range status.Endpoints {
+		if (endpoint.URL == "https://stale.test.com") != (endpoint.State == StateDown) {
+			t.Errorf("Expected only the stale endpoint down, got %s for %s", endpoint.State, endpoint.URL)
+		}
+	}
+
+	var matrix LocationStatusResponse
+	get("/status/locations", &matrix)
+	if len(matrix.Endpoints) != 2 {
+		t.Fatalf("Expected both endpoints in the location status, got %+v", matrix.Endpoints)
+	}
+	for _, endpoint := range matrix.Endpoints {
+		if endpoint.URL == "https://stale.test.com" && (endpoint.State != StateDown || len(endpoint.Locations) != 1) {
+			t.Errorf("Expected the stale probe to be left out, got %+v", endpoint)
+		}
+	}
+}
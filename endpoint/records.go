@@ -0,0 +1,108 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+// Records are JSON documents stored under a sequential ID in their own
+// bucket. Incidents and other operator managed objects are kept this way.
+
+func nextRecordID(tx RecordTx, bucket string) (uint64, error) {
+	return tx.NextID(bucket)
+}
+
+func putRecord(tx RecordTx, bucket string, id uint64, record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal record: %w", err)
+	}
+	return tx.Put(bucket, id, data)
+}
+
+func getRecord(tx RecordTx, bucket string, id uint64, record interface{}) (bool, error) {
+	data, err := tx.Get(bucket, id)
+	if err != nil {
+		return false, err
+	}
+	if data == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, record); err != nil {
+		return true, fmt.Errorf("failed to unmarshal record: %w", err)
+	}
+	return true, nil
+}
+
+func deleteRecord(tx RecordTx, bucket string, id uint64) error {
+	return tx.Delete(bucket, id)
+}
+
+// forEachRecord decodes every record in the bucket, in ID order.
+func forEachRecord[T any](tx RecordTx, bucket string, fn func(T) error) error {
+	return tx.ForEach(bucket, func(id uint64, data []byte) error {
+		var record T
+		if err := json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("failed to unmarshal record: %w", err)
+		}
+		return fn(record)
+	})
+}
+
+// Keyed records are found by a string key rather than a sequential ID. The
+// ID is derived from the key, moving on to the next ID while another key
+// holds it, and the key is stored with the record to tell them apart. Keyed
+// records are never deleted, so no key is lost behind a gap.
+type keyedRecord struct {
+	Key    string          `json:"key"`
+	Record json.RawMessage `json:"record"`
+}
+
+// keyedRecordID returns the ID the key is stored under, or the free ID to
+// store it under, along with the stored record if there is one.
+func keyedRecordID(tx RecordTx, bucket, key string) (uint64, *keyedRecord, error) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// SQLite stores IDs as signed integers.
+	id := h.Sum64() & math.MaxInt64
+
+	for {
+		data, err := tx.Get(bucket, id)
+		if err != nil || data == nil {
+			return id, nil, err
+		}
+		var record keyedRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return 0, nil, fmt.Errorf("failed to unmarshal record: %w", err)
+		}
+		if record.Key == key {
+			return id, &record, nil
+		}
+		id = (id + 1) & math.MaxInt64
+	}
+}
+
+func getKeyedRecord(tx RecordTx, bucket, key string, record interface{}) (bool, error) {
+	_, stored, err := keyedRecordID(tx, bucket, key)
+	if err != nil || stored == nil {
+		return false, err
+	}
+	if err := json.Unmarshal(stored.Record, record); err != nil {
+		return true, fmt.Errorf("failed to unmarshal record: %w", err)
+	}
+	return true, nil
+}
+
+func putKeyedRecord(tx RecordTx, bucket, key string, record interface{}) error {
+	id, _, err := keyedRecordID(tx, bucket, key)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal record: %w", err)
+	}
+	return putRecord(tx, bucket, id, keyedRecord{Key: key, Record: data})
+}
@@ -0,0 +1,540 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+var alertCategories = []string{
+	CategoryRequest,
+	CategoryTimeout,
+	CategoryDNS,
+	CategoryTLS,
+	CategoryConnection,
+	CategoryStatus,
+	CategoryContent,
+	CategoryHeartbeatMissed,
+	CategoryHeartbeatFailed,
+	CategorySLOFastBurn,
+	CategorySLOSlowBurn,
+	CategoryContentChanged,
+}
+
+func (alert Alert) Severity() string {
+	switch alert.Kind {
+	case AlertDown:
+		return SeverityCritical
+	case AlertDegraded:
+		if alert.Degraded == SeverityCritical {
+			return SeverityCritical
+		}
+		return SeverityWarning
+	case AlertFlapping, AlertAnomaly, AlertChanged:
+		return SeverityWarning
+	case AlertBurnRate:
+		if alert.Category == CategorySLOFastBurn {
+			return SeverityCritical
+		}
+		return SeverityWarning
+	default:
+		return SeverityInfo
+	}
+}
+
+// Validate checks the routing configuration against the names of the
+// registered notifiers and names unnamed routes after their position.
+func (c *RoutingConfig) Validate(channels []string) error {
+	known := make(map[string]bool)
+	for _, channel := range channels {
+		known[channel] = true
+	}
+	checkChannels := func(owner string, list []string) error {
+		for _, channel := range list {
+			if !known[channel] {
+				return fmt.Errorf("%s: unknown channel %q", owner, channel)
+			}
+		}
+		return nil
+	}
+
+	policies := make(map[string]bool)
+	for _, policy := range c.Escalations {
+		owner := fmt.Sprintf("escalation %q", policy.Name)
+		if policy.Name == "" {
+			return errors.New("escalation policies require a name")
+		}
+		if policies[policy.Name] {
+			return fmt.Errorf("%s: defined more than once", owner)
+		}
+		policies[policy.Name] = true
+
+		if len(policy.Steps) == 0 {
+			return fmt.Errorf("%s: at least one step is required", owner)
+		}
+		for i, step := range policy.Steps {
+			if step.After < 0 {
+				return fmt.Errorf("%s: step %d has a negative delay", owner, i+1)
+			}
+			if i > 0 && step.After < policy.Steps[i-1].After {
+				return fmt.Errorf("%s: steps must be in order of delay", owner)
+			}
+			if len(step.Channels) == 0 {
+				return fmt.Errorf("%s: step %d has no channels", owner, i+1)
+			}
+			if err := checkChannels(owner, step.Channels); err != nil {
+				return err
+			}
+		}
+	}
+
+	routes := make(map[string]bool)
+	for i := range c.Routes {
+		route := &c.Routes[i]
+		if route.Name == "" {
+			route.Name = fmt.Sprintf("route-%d", i+1)
+		}
+		owner := fmt.Sprintf("route %q", route.Name)
+		if routes[route.Name] {
+			return fmt.Errorf("%s: defined more than once", owner)
+		}
+		routes[route.Name] = true
+
+		if len(route.Channels) == 0 && route.Escalation == "" {
+			return fmt.Errorf("%s: channels or an escalation policy are required", owner)
+		}
+		if err := checkChannels(owner, route.Channels); err != nil {
+			return err
+		}
+		if route.Escalation != "" && !policies[route.Escalation] {
+			return fmt.Errorf("%s: unknown escalation policy %q", owner, route.Escalation)
+		}
+		for _, category := range route.Categories {
+			if !contains(alertCategories, category) {
+				return fmt.Errorf("%s: unknown category %q", owner, category)
+			}
+		}
+		for _, severity := range route.Severities {
+			if severity != SeverityCritical && severity != SeverityWarning && severity != SeverityInfo {
+				return fmt.Errorf("%s: unknown severity %q", owner, severity)
+			}
+		}
+		if route.Repeat < 0 {
+			return fmt.Errorf("%s: repeat interval must not be negative", owner)
+		}
+		for j := range route.QuietHours {
+			if err := route.QuietHours[j].Validate(); err != nil {
+				return fmt.Errorf("%s: quiet hours: %w", owner, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Matches reports whether the route applies to the alert. Every condition
+// that is set must match. Recoveries carry no failure category, so only the
+// domain and selector are considered for them.
+func (r Route) Matches(alert Alert) bool {
+	if len(r.Domains) > 0 && !contains(r.Domains, alert.Domain) {
+		return false
+	}
+	if len(r.Selector) > 0 && !r.Selector.Matches(alert.Labels) {
+		return false
+	}
+	if alert.Kind == AlertRecovered {
+		return true
+	}
+	if len(r.Categories) > 0 && !contains(r.Categories, alert.Category) {
+		return false
+	}
+	if len(r.Severities) > 0 && !contains(r.Severities, alert.Severity()) {
+		return false
+	}
+	return true
+}
+
+func (r Route) quietAt(t time.Time) bool {
+	for i := range r.QuietHours {
+		if r.QuietHours[i].ActiveAt(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns the routes the alert is sent through. Routes are evaluated
+// in order and evaluation stops at the first match unless it sets Continue.
+func (c RoutingConfig) Match(alert Alert) []Route {
+	var matched []Route
+	for _, route := range c.Routes {
+		if !route.Matches(alert) {
+			continue
+		}
+		matched = append(matched, route)
+		if !route.Continue {
+			break
+		}
+	}
+	return matched
+}
+
+// steps lists the route's own channels as an immediate first step followed
+// by the steps of its escalation policy.
+func (c RoutingConfig) steps(route Route) []EscalationStep {
+	var steps []EscalationStep
+	if len(route.Channels) > 0 {
+		steps = append(steps, EscalationStep{Channels: route.Channels})
+	}
+	for _, policy := range c.Escalations {
+		if policy.Name == route.Escalation {
+			steps = append(steps, policy.Steps...)
+		}
+	}
+	return steps
+}
+
+// SetRouting validates the configuration against the registered notifiers
+// and replaces the active routing. Without any routes every alert is sent to
+// every notifier.
+func (a *Alerter) SetRouting(config RoutingConfig) error {
+	var channels []string
+	for _, notifier := range a.Notifiers() {
+		channels = append(channels, notifier.Name())
+	}
+	if err := config.Validate(channels); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.routing = config
+	a.outages = make(map[string]*outage)
+	return nil
+}
+
+func (a *Alerter) Routing() RoutingConfig {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.routing
+}
+
+// Plan describes how the alert would be routed without sending anything.
+func (a *Alerter) Plan(alert Alert, now time.Time) RoutingPlan {
+	plan := RoutingPlan{
+		Alert:    alert,
+		Severity: alert.Severity(),
+		Routes:   []RoutePlan{},
+	}
+
+	a.mu.Lock()
+	plan.Default = len(a.routing.Routes) == 0
+	a.mu.Unlock()
+
+	routing := a.effectiveRouting()
+	for _, route := range routing.Match(alert) {
+		plan.Routes = append(plan.Routes, RoutePlan{
+			Route:  route.Name,
+			Steps:  routing.steps(route),
+			Repeat: route.Repeat,
+			Quiet:  route.quietAt(now),
+		})
+	}
+	return plan
+}
+
+// Acknowledge stops escalation and repeats for the ongoing outages of an
+// endpoint. The recoveries are still sent to everyone who was notified. It
+// reports whether the endpoint had an active alert.
+func (a *Alerter) Acknowledge(url, by string, at time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	found := false
+	for _, o := range a.outages {
+		if o.alert.URL != url {
+			continue
+		}
+		found = true
+		if o.acknowledgedAt == nil {
+			o.acknowledgedAt = &at
+			o.acknowledgedBy = by
+		}
+	}
+	return found
+}
+
+// ActiveAlerts lists the endpoints with an ongoing outage, oldest first.
+func (a *Alerter) ActiveAlerts() []ActiveAlert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	alerts := []ActiveAlert{}
+	for _, o := range a.outages {
+		active := ActiveAlert{
+			Alert:          o.alert,
+			StartedAt:      o.started,
+			AcknowledgedAt: o.acknowledgedAt,
+			AcknowledgedBy: o.acknowledgedBy,
+			Channels:       []string{},
+		}
+		for _, state := range o.routes {
+			active.Routes = append(active.Routes, state.route.Name)
+			for channel := range state.notified {
+				active.Channels = append(active.Channels, channel)
+			}
+		}
+		active.Channels = uniqueSorted(active.Channels)
+		alerts = append(alerts, active)
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].StartedAt.Before(alerts[j].StartedAt)
+	})
+	return alerts
+}
+
+// Tick sends escalations, repeats and notifications held back by quiet hours
+// that have become due.
+func (a *Alerter) Tick(ctx context.Context, now time.Time) {
+	type delivery struct {
+		alert    Alert
+		channels []string
+	}
+
+	// Silences are looked up outside the lock, since that reads the store.
+	a.mu.Lock()
+	outages := make([]*outage, 0, len(a.outages))
+	for _, o := range a.outages {
+		outages = append(outages, o)
+	}
+	a.mu.Unlock()
+
+	silenced := make(map[*outage]bool, len(outages))
+	for _, o := range outages {
+		silenced[o] = a.silenced(o.alert, now)
+	}
+
+	a.mu.Lock()
+	var deliveries []delivery
+	for _, o := range outages {
+		if a.outages[outageKey(o.alert)] != o {
+			continue
+		}
+		if channels := o.advance(now, silenced[o]); len(channels) > 0 {
+			deliveries = append(deliveries, delivery{alert: o.alert, channels: channels})
+		}
+	}
+	a.mu.Unlock()
+
+	for _, d := range deliveries {
+		a.deliver(ctx, d.alert, d.channels)
+	}
+}
+
+// route tracks the outage the alert belongs to and returns the channels to
+// notify now. A silenced alert notifies no one: a silenced outage is tracked
+// without recording anyone as notified, and a silenced recovery ends the
+// outage quietly.
+func (a *Alerter) route(alert Alert, silenced bool) []string {
+	routing := a.effectiveRouting()
+
+	now := alert.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := outageKey(alert)
+	if alert.Kind == AlertRecovered {
+		o, ok := a.outages[key]
+		if !ok {
+			// The outage started before a restart, so notify the channels the
+			// alert it ends would have been sent to first. Recoveries carry
+			// the category of the failure when it is known.
+			original := alert
+			original.Kind = alert.resolves()
+			return routing.firstChannels(original)
+		}
+
+		delete(a.outages, key)
+		if silenced {
+			return nil
+		}
+		var channels []string
+		for _, state := range o.routes {
+			for channel := range state.notified {
+				channels = append(channels, channel)
+			}
+		}
+		return uniqueSorted(channels)
+	}
+
+	// Content changes are not outages: they are sent once, without
+	// escalations or repeats, and leave an ongoing outage of the endpoint
+	// alone.
+	if alert.Kind == AlertChanged {
+		if silenced {
+			return nil
+		}
+		return routing.firstChannels(alert)
+	}
+
+	o := &outage{alert: alert, started: now}
+	for _, route := range routing.Match(alert) {
+		o.routes = append(o.routes, &routeState{
+			route:    route,
+			steps:    routing.steps(route),
+			notified: make(map[string]bool),
+		})
+	}
+	// An alert no route matches is still tracked, so that its recovery is
+	// not sent to channels that never heard of the outage.
+	a.outages[key] = o
+	return o.advance(now, silenced)
+}
+
+// resolves returns the kind of alert a recovery ends.
+func (alert Alert) resolves() string {
+	if alert.Resolves == "" {
+		return AlertDown
+	}
+	return alert.Resolves
+}
+
+// outageKey identifies the outage an alert starts or ends. An endpoint can be
+// down, degraded and anomalous at once, and each is escalated and recovered
+// on its own. Flapping takes the place of the down state while it lasts.
+func outageKey(alert Alert) string {
+	kind := alert.Kind
+	if kind == AlertRecovered {
+		kind = alert.resolves()
+	}
+	if kind == AlertFlapping {
+		kind = AlertDown
+	}
+	return alert.URL + "\x00" + kind
+}
+
+// firstChannels returns the channels of the first step of every route the
+// alert matches.
+func (c RoutingConfig) firstChannels(alert Alert) []string {
+	var channels []string
+	for _, route := range c.Match(alert) {
+		if steps := c.steps(route); len(steps) > 0 {
+			channels = append(channels, steps[0].Channels...)
+		}
+	}
+	return uniqueSorted(channels)
+}
+
+// advance moves the outage to the given time and returns the channels to
+// notify. While the outage is silenced nothing is due and its escalation
+// stands still, resuming where it left off once the silence ends.
+func (o *outage) advance(now time.Time, silenced bool) []string {
+	if silenced {
+		if o.silencedAt == nil {
+			o.silencedAt = &now
+		}
+		return nil
+	}
+	if o.silencedAt != nil {
+		o.paused += now.Sub(*o.silencedAt)
+		o.silencedAt = nil
+	}
+	return o.due(now)
+}
+
+// due advances the outage to the given time and returns the channels that
+// have a notification due: escalation steps whose delay has passed and
+// repeats of routes that have been quiet for their repeat interval. Nothing
+// is sent during a route's quiet hours, so what falls inside them is sent
+// once they end.
+func (o *outage) due(now time.Time) []string {
+	if o.acknowledgedAt != nil {
+		return nil
+	}
+
+	var channels []string
+	for _, state := range o.routes {
+		if state.route.quietAt(now) {
+			continue
+		}
+
+		sent := false
+		for state.fired < len(state.steps) && now.Sub(o.started)-o.paused >= state.steps[state.fired].After {
+			for _, channel := range state.steps[state.fired].Channels {
+				state.notified[channel] = true
+				channels = append(channels, channel)
+			}
+			state.fired++
+			sent = true
+		}
+
+		if !sent && state.route.Repeat > 0 && len(state.notified) > 0 && now.Sub(state.lastSent) >= state.route.Repeat {
+			for channel := range state.notified {
+				channels = append(channels, channel)
+			}
+			sent = true
+		}
+
+		if sent {
+			state.lastSent = now
+		}
+	}
+
+	return uniqueSorted(channels)
+}
+
+// effectiveRouting returns the configured routing, or a single route to every
+// notifier when none is configured.
+func (a *Alerter) effectiveRouting() RoutingConfig {
+	a.mu.Lock()
+	routing := a.routing
+	a.mu.Unlock()
+
+	if len(routing.Routes) == 0 {
+		routing.Routes = []Route{{Name: "default", Channels: a.channels()}}
+	}
+	return routing
+}
+
+func (a *Alerter) channels() []string {
+	var channels []string
+	for _, notifier := range a.Notifiers() {
+		channels = append(channels, notifier.Name())
+	}
+	return channels
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
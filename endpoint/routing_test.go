@@ -0,0 +1,451 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingNotifier struct {
+	name   string
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+func (n *recordingNotifier) Name() string {
+	return n.name
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, alert Alert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func (n *recordingNotifier) kinds() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var kinds []string
+	for _, alert := range n.alerts {
+		kinds = append(kinds, alert.Kind)
+	}
+	return strings.Join(kinds, ",")
+}
+
+func newRoutedAlerter(t *testing.T, config RoutingConfig, names ...string) (*Alerter, map[string]*recordingNotifier) {
+	t.Helper()
+
+	alerter := NewAlerter("")
+	notifiers := make(map[string]*recordingNotifier)
+	for _, name := range names {
+		notifiers[name] = &recordingNotifier{name: name}
+		alerter.Register(notifiers[name])
+	}
+	if err := alerter.SetRouting(config); err != nil {
+		t.Fatalf("Failed to set routing: %v", err)
+	}
+	return alerter, notifiers
+}
+
+func TestRoutingValidate(t *testing.T) {
+	quiet := Recurrence{Start: "22:00", End: "07:00"}
+
+	tests := []struct {
+		name    string
+		config  RoutingConfig
+		wantErr string
+	}{
+		{
+			name: "valid",
+			config: RoutingConfig{
+				Routes:      []Route{{Channels: []string{"slack"}, Escalation: "oncall", QuietHours: []Recurrence{quiet}}},
+				Escalations: []EscalationPolicy{{Name: "oncall", Steps: []EscalationStep{{After: 15 * time.Minute, Channels: []string{"pagerduty"}}}}},
+			},
+		},
+		{
+			name:    "unknown channel",
+			config:  RoutingConfig{Routes: []Route{{Channels: []string{"sms"}}}},
+			wantErr: `unknown channel "sms"`,
+		},
+		{
+			name:    "no channels",
+			config:  RoutingConfig{Routes: []Route{{Domains: []string{"plug"}}}},
+			wantErr: "channels or an escalation policy are required",
+		},
+		{
+			name:    "unknown escalation",
+			config:  RoutingConfig{Routes: []Route{{Escalation: "oncall"}}},
+			wantErr: `unknown escalation policy "oncall"`,
+		},
+		{
+			name:    "unknown category",
+			config:  RoutingConfig{Routes: []Route{{Channels: []string{"slack"}, Categories: []string{"bogus"}}}},
+			wantErr: `unknown category "bogus"`,
+		},
+		{
+			name:    "unknown severity",
+			config:  RoutingConfig{Routes: []Route{{Channels: []string{"slack"}, Severities: []string{"fatal"}}}},
+			wantErr: `unknown severity "fatal"`,
+		},
+		{
+			name:    "duplicate route",
+			config:  RoutingConfig{Routes: []Route{{Name: "a", Channels: []string{"slack"}}, {Name: "a", Channels: []string{"slack"}}}},
+			wantErr: "defined more than once",
+		},
+		{
+			name:    "invalid quiet hours",
+			config:  RoutingConfig{Routes: []Route{{Channels: []string{"slack"}, QuietHours: []Recurrence{{Start: "22:00", End: "22:00"}}}}},
+			wantErr: "quiet hours",
+		},
+		{
+			name: "steps out of order",
+			config: RoutingConfig{Escalations: []EscalationPolicy{{Name: "oncall", Steps: []EscalationStep{
+				{After: time.Hour, Channels: []string{"slack"}},
+				{After: time.Minute, Channels: []string{"pagerduty"}},
+			}}}},
+			wantErr: "steps must be in order",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate([]string{"slack", "pagerduty"})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected valid config, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRouteMatch(t *testing.T) {
+	config := RoutingConfig{Routes: []Route{
+		{Name: "dns", Categories: []string{CategoryDNS}, Channels: []string{"slack"}, Continue: true},
+		{Name: "plug", Domains: []string{"plug"}, Severities: []string{SeverityCritical}, Channels: []string{"pagerduty"}},
+		{Name: "web", Selector: Selector{{Key: "team", Operator: SelectorEquals, Value: "web"}}, Channels: []string{"email"}},
+		{Name: "catch-all", Channels: []string{"slack"}},
+	}}
+
+	tests := []struct {
+		name  string
+		alert Alert
+		want  string
+	}{
+		{"first match wins", Alert{Kind: AlertDown, Domain: "plug", Labels: map[string]string{"team": "web"}}, "plug"},
+		{"continue", Alert{Kind: AlertDown, Domain: "plug", Category: CategoryDNS}, "dns,plug"},
+		{"severity", Alert{Kind: AlertDegraded, Domain: "plug", Labels: map[string]string{"team": "web"}}, "web"},
+		{"selector", Alert{Kind: AlertDown, Labels: map[string]string{"team": "web"}}, "web"},
+		{"fallback", Alert{Kind: AlertDown, Domain: "other"}, "catch-all"},
+		{"recovery ignores category and severity", Alert{Kind: AlertRecovered, Domain: "plug"}, "dns,plug"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for _, route := range config.Match(tt.alert) {
+				names = append(names, route.Name)
+			}
+			if got := strings.Join(names, ","); got != tt.want {
+				t.Errorf("Expected routes %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+// switchSilence silences every alert while it is on.
+type switchSilence struct {
+	on bool
+}
+
+func (s *switchSilence) ActiveSilence(alert Alert, at time.Time) (*Silence, error) {
+	if !s.on {
+		return nil, nil
+	}
+	return &Silence{ID: 1}, nil
+}
+
+func TestEscalation(t *testing.T) {
+	start := time.Date(2024, 11, 15, 10, 0, 0, 0, time.UTC)
+	config := RoutingConfig{
+		Routes: []Route{{Channels: []string{"slack"}, Escalation: "oncall", Repeat: time.Hour}},
+		Escalations: []EscalationPolicy{{Name: "oncall", Steps: []EscalationStep{
+			{After: 15 * time.Minute, Channels: []string{"pagerduty"}},
+		}}},
+	}
+
+	t.Run("escalates and repeats", func(t *testing.T) {
+		alerter, notifiers := newRoutedAlerter(t, config, "slack", "pagerduty", "email")
+		down := testAlert(AlertDown)
+		down.Timestamp = start
+
+		alerter.Dispatch(context.Background(), down)
+		alerter.Tick(context.Background(), start.Add(10*time.Minute))
+		if notifiers["slack"].kinds() != "down" || notifiers["pagerduty"].kinds() != "" {
+			t.Fatalf("Expected only slack before escalation, got slack=%s pagerduty=%s", notifiers["slack"].kinds(), notifiers["pagerduty"].kinds())
+		}
+
+		alerter.Tick(context.Background(), start.Add(15*time.Minute))
+		if notifiers["pagerduty"].kinds() != "down" {
+			t.Errorf("Expected escalation to pagerduty after 15 minutes, got %s", notifiers["pagerduty"].kinds())
+		}
+
+		alerter.Tick(context.Background(), start.Add(75*time.Minute))
+		if notifiers["slack"].kinds() != "down,down" || notifiers["pagerduty"].kinds() != "down,down" {
+			t.Errorf("Expected a repeat to every notified channel, got slack=%s pagerduty=%s", notifiers["slack"].kinds(), notifiers["pagerduty"].kinds())
+		}
+
+		recovered := testAlert(AlertRecovered)
+		recovered.Timestamp = start.Add(80 * time.Minute)
+		alerter.Dispatch(context.Background(), recovered)
+		if notifiers["slack"].kinds() != "down,down,recovered" || notifiers["pagerduty"].kinds() != "down,down,recovered" {
+			t.Errorf("Expected recovery on notified channels, got slack=%s pagerduty=%s", notifiers["slack"].kinds(), notifiers["pagerduty"].kinds())
+		}
+		if notifiers["email"].kinds() != "" {
+			t.Errorf("Expected unrouted channel to stay silent, got %s", notifiers["email"].kinds())
+		}
+	})
+
+	t.Run("acknowledge stops escalation", func(t *testing.T) {
+		alerter, notifiers := newRoutedAlerter(t, config, "slack", "pagerduty")
+		down := testAlert(AlertDown)
+		down.Timestamp = start
+
+		alerter.Dispatch(context.Background(), down)
+		alerter.Acknowledge(down.URL, "oncall", start)
+		alerter.Tick(context.Background(), start.Add(2*time.Hour))
+
+		if notifiers["slack"].kinds() != "down" || notifiers["pagerduty"].kinds() != "" {
+			t.Errorf("Expected no escalation after acknowledgement, got slack=%s pagerduty=%s", notifiers["slack"].kinds(), notifiers["pagerduty"].kinds())
+		}
+	})
+
+	t.Run("silences pause escalation", func(t *testing.T) {
+		alerter, notifiers := newRoutedAlerter(t, config, "slack", "pagerduty")
+		silence := &switchSilence{on: true}
+		alerter.silences = silence
+
+		down := testAlert(AlertDown)
+		down.Timestamp = start
+		alerter.Dispatch(context.Background(), down)
+		alerter.Tick(context.Background(), start.Add(20*time.Minute))
+		if notifiers["slack"].kinds() != "" || notifiers["pagerduty"].kinds() != "" {
+			t.Fatalf("Expected nothing while silenced, got slack=%s pagerduty=%s", notifiers["slack"].kinds(), notifiers["pagerduty"].kinds())
+		}
+		if active := alerter.ActiveAlerts(); len(active) != 1 || len(active[0].Channels) != 0 {
+			t.Errorf("Expected the silenced outage to be tracked without notified channels, got %+v", active)
+		}
+
+		// The 30 silenced minutes do not count towards the escalation.
+		silence.on = false
+		alerter.Tick(context.Background(), start.Add(30*time.Minute))
+		if notifiers["slack"].kinds() != "down" || notifiers["pagerduty"].kinds() != "" {
+			t.Fatalf("Expected the first step once the silence ended, got slack=%s pagerduty=%s", notifiers["slack"].kinds(), notifiers["pagerduty"].kinds())
+		}
+		alerter.Tick(context.Background(), start.Add(45*time.Minute))
+		if notifiers["pagerduty"].kinds() != "down" {
+			t.Errorf("Expected escalation 15 unsilenced minutes in, got %s", notifiers["pagerduty"].kinds())
+		}
+	})
+
+	t.Run("quiet hours defer notifications", func(t *testing.T) {
+		quiet := config
+		quiet.Routes = []Route{{Channels: []string{"slack"}, QuietHours: []Recurrence{{Start: "09:00", End: "11:00"}}}}
+		alerter, notifiers := newRoutedAlerter(t, quiet, "slack", "pagerduty")
+
+		down := testAlert(AlertDown)
+		down.Timestamp = start
+
+		alerter.Dispatch(context.Background(), down)
+		if notifiers["slack"].kinds() != "" {
+			t.Fatalf("Expected nothing during quiet hours, got %s", notifiers["slack"].kinds())
+		}
+
+		alerter.Tick(context.Background(), start.Add(time.Hour))
+		if notifiers["slack"].kinds() != "down" {
+			t.Errorf("Expected alert once quiet hours end, got %s", notifiers["slack"].kinds())
+		}
+	})
+}
+
+func TestOverlappingOutages(t *testing.T) {
+	start := time.Date(2024, 11, 15, 10, 0, 0, 0, time.UTC)
+	config := RoutingConfig{
+		Routes: []Route{{Channels: []string{"slack"}, Escalation: "oncall"}},
+		Escalations: []EscalationPolicy{{Name: "oncall", Steps: []EscalationStep{
+			{After: 15 * time.Minute, Channels: []string{"pagerduty"}},
+		}}},
+	}
+	alerter, notifiers := newRoutedAlerter(t, config, "slack", "pagerduty")
+
+	at := func(kind, resolves string, offset time.Duration) {
+		alert := testAlert(kind)
+		alert.Resolves = resolves
+		alert.Timestamp = start.Add(offset)
+		alerter.Dispatch(context.Background(), alert)
+	}
+
+	// A degraded alert while the endpoint is down does not restart the
+	// escalation of the outage.
+	at(AlertDown, "", 0)
+	at(AlertDegraded, "", 5*time.Minute)
+	alerter.Tick(context.Background(), start.Add(15*time.Minute))
+	if notifiers["pagerduty"].kinds() != "down" {
+		t.Fatalf("Expected the down alert to escalate, got %s", notifiers["pagerduty"].kinds())
+	}
+	at(AlertAnomaly, "", 16*time.Minute)
+	if active := alerter.ActiveAlerts(); len(active) != 3 {
+		t.Fatalf("Expected 3 active alerts, got %+v", active)
+	}
+
+	// Each recovery ends its own outage and reaches who was told about it.
+	at(AlertRecovered, AlertDegraded, 17*time.Minute)
+	at(AlertRecovered, AlertAnomaly, 18*time.Minute)
+	at(AlertRecovered, "", 19*time.Minute)
+	if got := notifiers["slack"].kinds(); got != "down,degraded,anomaly,recovered,recovered,recovered" {
+		t.Errorf("Expected one recovery per outage on slack, got %s", got)
+	}
+	if got := notifiers["pagerduty"].kinds(); got != "down,recovered" {
+		t.Errorf("Expected only the down recovery on pagerduty, got %s", got)
+	}
+	if active := alerter.ActiveAlerts(); len(active) != 0 {
+		t.Errorf("Expected no active alerts, got %+v", active)
+	}
+}
+
+func TestRecoveryRouting(t *testing.T) {
+	config := RoutingConfig{Routes: []Route{
+		{Name: "dns", Categories: []string{CategoryDNS}, Channels: []string{"slack"}},
+	}}
+
+	t.Run("unrouted outage", func(t *testing.T) {
+		alerter, notifiers := newRoutedAlerter(t, config, "slack")
+		alerter.Dispatch(context.Background(), testAlert(AlertDown))
+		alerter.Dispatch(context.Background(), testAlert(AlertRecovered))
+		if notifiers["slack"].kinds() != "" {
+			t.Errorf("Expected no recovery for an outage no route matched, got %s", notifiers["slack"].kinds())
+		}
+	})
+
+	// After a restart the outage is unknown, so the recovery goes to the
+	// channels the down alert of its failure category would have reached.
+	tests := []struct {
+		name     string
+		category string
+		want     string
+	}{
+		{"matching category", CategoryDNS, "recovered"},
+		{"other category", CategoryStatus, ""},
+		{"unknown category", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alerter, notifiers := newRoutedAlerter(t, config, "slack")
+			recovered := testAlert(AlertRecovered)
+			recovered.Category = tt.category
+			alerter.Dispatch(context.Background(), recovered)
+			if notifiers["slack"].kinds() != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, notifiers["slack"].kinds())
+			}
+		})
+	}
+}
+
+func TestSchedulerRecoveryCategory(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+	alerts := make(channelNotifier, 16)
+	scheduler := NewScheduler(handler, time.Minute, nil)
+	scheduler.Alerter().Register(alerts)
+
+	endpoint := EndpointRequest{URL: "https://onplug.io", Domain: "plug", Status: http.StatusOK}
+	start := time.Now()
+	scheduler.record(EndpointResponse{Endpoint: endpoint, Status: http.StatusOK, Timestamp: start})
+	scheduler.record(EndpointResponse{
+		Endpoint:  endpoint,
+		Error:     errors.New("no such host"),
+		Category:  CategoryDNS,
+		Timestamp: start.Add(time.Minute),
+	})
+	scheduler.record(EndpointResponse{Endpoint: endpoint, Status: http.StatusOK, Timestamp: start.Add(2 * time.Minute)})
+	scheduler.alerter.Wait()
+
+	var kinds, categories []string
+	for len(alerts) > 0 {
+		alert := <-alerts
+		kinds = append(kinds, alert.Kind)
+		categories = append(categories, alert.Category)
+	}
+	if strings.Join(kinds, ",") != "down,recovered" || strings.Join(categories, ",") != "dns,dns" {
+		t.Errorf("Expected the recovery to carry the failure category, got %v %v", kinds, categories)
+	}
+}
+
+func TestRoutingAPI(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+
+	endpoint := EndpointRequest{URL: "https://test.com", Domain: "test", Labels: map[string]string{"tier": "1"}}
+	if err := handler.RegisterEndpoints([]EndpointRequest{endpoint}); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
+
+	scheduler := NewScheduler(handler, time.Minute, nil)
+	scheduler.Alerter().Register(&recordingNotifier{name: "slack"})
+	scheduler.Alerter().Register(&recordingNotifier{name: "pagerduty"})
+	err := scheduler.Alerter().SetRouting(RoutingConfig{Routes: []Route{
+		{Name: "tier-1", Selector: Selector{{Key: "tier", Operator: SelectorEquals, Value: "1"}}, Channels: []string{"pagerduty"}},
+		{Name: "rest", Channels: []string{"slack"}},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to set routing: %v", err)
+	}
+	api := NewAPI(handler, scheduler)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedRoute  string
+	}{
+		{"known endpoint", `{"url":"https://test.com"}`, http.StatusOK, "tier-1"},
+		{"unknown endpoint", `{"url":"https://other.com","domain":"other"}`, http.StatusOK, "rest"},
+		{"missing url", `{"kind":"down"}`, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/routing/dry-run", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var plan RoutingPlan
+			if err := json.NewDecoder(w.Body).Decode(&plan); err != nil {
+				t.Fatalf("Failed to decode plan: %v", err)
+			}
+			if len(plan.Routes) != 1 || plan.Routes[0].Route != tt.expectedRoute {
+				t.Errorf("Expected route %s, got %+v", tt.expectedRoute, plan.Routes)
+			}
+			if plan.Severity != SeverityCritical {
+				t.Errorf("Expected critical severity, got %s", plan.Severity)
+			}
+		})
+	}
+}
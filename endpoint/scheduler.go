@@ -3,19 +3,45 @@ package endpoint
 import (
 	"context"
 	"log"
-	"sync"
+	"net/url"
 	"time"
 )
 
+// heartbeatSweep is how often heartbeats are checked for missed deadlines.
+const heartbeatSweep = 30 * time.Second
+
 func NewScheduler(handler *EndpointHandler, interval time.Duration, endpoints []EndpointRequest) *Scheduler {
+	alerter := NewAlerter(NOTIFIER_CONFIG.PublicURL)
+	alerter.silences = handler
+
 	return &Scheduler{
 		handler:   handler,
+		events:    NewBroadcaster(defaultEventBacklog, defaultSubscriberBuffer),
+		alerter:   alerter,
 		interval:  interval,
 		endpoints: endpoints,
+		states:    make(map[string]string),
+		flapping:  make(map[string]bool),
+		degraded:  make(map[string]int),
+		anomalous: make(map[string]int),
+		burning:   make(map[string]string),
+		changes:   make(map[string]string),
+		lastSeen:  make(map[string]time.Time),
 		done:      make(chan struct{}),
 	}
 }
 
+// Alerter returns the alerter that state changes are dispatched to.
+func (s *Scheduler) Alerter() *Alerter {
+	return s.alerter
+}
+
+// Events returns the broadcaster every completed check and state change is
+// published into.
+func (s *Scheduler) Events() *Broadcaster {
+	return s.events
+}
+
 func (s *Scheduler) Start() {
 	s.wg.Add(1)
 	go s.run()
@@ -25,6 +51,8 @@ func (s *Scheduler) Start() {
 func (s *Scheduler) Stop() {
 	close(s.done)
 	s.wg.Wait()
+	s.alerter.Wait()
+	s.alerter.Flush(context.Background())
 }
 
 func (s *Scheduler) run() {
@@ -35,34 +63,410 @@ func (s *Scheduler) run() {
 	ticker := time.NewTicker(s.interval)
 	defer ticker.Stop()
 
+	heartbeats := time.NewTicker(heartbeatSweep)
+	defer heartbeats.Stop()
+
 	for {
 		select {
 		case <-ticker.C:
 			s.checkAll()
+		case now := <-heartbeats.C:
+			s.checkHeartbeats(now)
+			s.alerter.enqueue(func() {
+				s.alerter.Tick(context.Background(), now)
+			})
 		case <-s.done:
 			return
 		}
 	}
 }
 
-func (s *Scheduler) checkAll() {
-	var wg sync.WaitGroup
-	results := make(chan EndpointResponse, len(s.endpoints))
+// Ping records a heartbeat ping and feeds the resulting check through the
+// same state tracking as scheduled checks.
+func (s *Scheduler) Ping(token string, payload PingPayload) (*EndpointResponse, error) {
+	result, err := s.handler.RecordPing(token, payload, time.Now())
+	if err != nil || result == nil {
+		return result, err
+	}
+
+	s.record(*result)
+	return result, nil
+}
 
+// CheckNow checks a configured endpoint immediately, outside its schedule,
+// and records the result like a scheduled check. It reports false when the
+// endpoint is not configured.
+func (s *Scheduler) CheckNow(ctx context.Context, url string) (EndpointResponse, bool) {
+	endpoint, ok := s.endpoint(url)
+	if !ok {
+		return EndpointResponse{}, false
+	}
+
+	result := s.handler.Handle(ctx, endpoint)
+	s.record(result)
+	return result, true
+}
+
+func (s *Scheduler) checkHeartbeats(now time.Time) {
+	results, err := s.handler.MissedHeartbeats(now)
+	if err != nil {
+		log.Printf("Failed to check heartbeats: %v", err)
+		return
+	}
+
+	for _, result := range results {
+		log.Printf("Heartbeat %s missed: %v", result.Endpoint.URL, result.Error)
+		s.record(result)
+	}
+}
+
+func (s *Scheduler) checkAll() {
 	for _, ep := range s.endpoints {
-		wg.Add(1)
+		window, err := s.handler.ActiveMaintenance(ep, time.Now())
+		if err != nil {
+			log.Printf("Failed to look up maintenance windows for %s: %v", ep.URL, err)
+		}
+		if window != nil && window.Mode == MaintenanceSkip {
+			log.Printf("Skipping %s during maintenance window %q", ep.URL, window.Name)
+			continue
+		}
+
 		go func(endpoint EndpointRequest) {
-			defer wg.Done()
 			ctx, cancel := context.WithTimeout(context.Background(), endpoint.Timeout)
 			defer cancel()
 
 			result := s.handler.Handle(ctx, endpoint)
-			results <- result
+			s.record(result)
 		}(ep)
 	}
+}
+
+func (s *Scheduler) record(result EndpointResponse) {
+	url := result.Endpoint.URL
+
+	s.events.Publish(Event{
+		Type:      EventResult,
+		URL:       url,
+		Domain:    result.Endpoint.Domain,
+		Labels:    result.Endpoint.Labels,
+		Timestamp: result.Timestamp,
+		Data:      newHistoryEntry(result),
+	})
+
+	// Results from maintenance windows are published but never move the
+	// endpoint's state, so they raise no state changes or incidents.
+	if result.Maintenance {
+		return
+	}
+
+	// The state is shared by every location, while flapping, degradation and
+	// anomalies are tracked for each location on its own.
+	state := s.state(result)
+	key := locationKey(url, result.Location)
+
+	s.mu.Lock()
+	previous, ok := s.states[url]
+	wasFlapping, seen := s.flapping[key]
+	if !ok || !seen {
+		lastState, lastFlapping := s.previousState(result)
+		if !ok {
+			previous = lastState
+		}
+		if !seen {
+			wasFlapping = lastFlapping
+		}
+	}
+	s.states[url] = state
+	s.flapping[key] = result.Flapping
+	s.mu.Unlock()
+
+	if result.Flapping != wasFlapping {
+		s.recordFlapping(result, state)
+	}
+	s.recordDegraded(result, state)
+	s.recordAnomaly(result, state)
+	s.recordChange(result)
+	s.recordSLOs(result)
+
+	if previous == state {
+		return
+	}
+
+	change := StateChange{
+		URL:       url,
+		Domain:    result.Endpoint.Domain,
+		From:      previous,
+		To:        state,
+		Timestamp: result.Timestamp,
+		Category:  result.Category,
+	}
+	if result.Error != nil {
+		change.Error = result.Error.Error()
+	}
+
+	log.Printf("State of %s changed from %s to %s", url, previous, state)
+	s.events.Publish(Event{
+		Type:      EventState,
+		URL:       url,
+		Domain:    result.Endpoint.Domain,
+		Labels:    result.Endpoint.Labels,
+		Timestamp: result.Timestamp,
+		Data:      change,
+	})
+
+	// Transitions while flapping are only alerted once the endpoint settles.
+	switch {
+	case result.Flapping || wasFlapping:
+	case state == StateDown:
+		s.alerter.Enqueue(newAlert(AlertDown, result))
+	case previous == StateDown:
+		s.alerter.Enqueue(s.recovery(result))
+	}
+
+	incident, err := s.handler.RecordIncidentTransition(change)
+	if err != nil {
+		log.Printf("Failed to record incident for %s: %v", url, err)
+		return
+	}
+	if incident != nil {
+		s.events.Publish(Event{
+			Type:      EventIncident,
+			URL:       url,
+			Domain:    result.Endpoint.Domain,
+			Labels:    result.Endpoint.Labels,
+			Timestamp: result.Timestamp,
+			Data:      incident,
+		})
+	}
+}
+
+// recordFlapping publishes the start or end of flapping. Starting sends a
+// single flapping alert in place of the individual transitions; settling
+// sends the state the endpoint settled in.
+func (s *Scheduler) recordFlapping(result EndpointResponse, state string) {
+	url := result.Endpoint.URL
+	if result.Flapping {
+		log.Printf("%s is flapping", url)
+	} else {
+		log.Printf("%s stopped flapping and is %s", url, state)
+	}
+
+	s.events.Publish(Event{
+		Type:      EventFlapping,
+		URL:       url,
+		Domain:    result.Endpoint.Domain,
+		Labels:    result.Endpoint.Labels,
+		Timestamp: result.Timestamp,
+		Data: FlapChange{
+			URL:       url,
+			Domain:    result.Endpoint.Domain,
+			Flapping:  result.Flapping,
+			State:     state,
+			Timestamp: result.Timestamp,
+		},
+	})
+
+	switch {
+	case result.Flapping:
+		s.alerter.Enqueue(newAlert(AlertFlapping, result))
+	case state == StateDown:
+		s.alerter.Enqueue(newAlert(AlertDown, result))
+	default:
+		s.alerter.Enqueue(s.recovery(result))
+	}
+}
+
+// recovery describes the end of an outage. It carries the failure category
+// of the endpoint's open incident, so that after a restart it is routed like
+// the down alert was.
+func (s *Scheduler) recovery(result EndpointResponse) Alert {
+	alert := newAlert(AlertRecovered, result)
+
+	url := result.Endpoint.URL
+	incidents, err := s.handler.GetIncidents(IncidentFilter{URL: url, Status: IncidentOpen})
+	if err != nil {
+		log.Printf("Failed to get the open incident of %s: %v", url, err)
+		return alert
+	}
+	for _, incident := range incidents {
+		for _, endpoint := range incident.Endpoints {
+			if endpoint.URL == url && endpoint.ResolvedAt == nil {
+				alert.Category = endpoint.Category
+			}
+		}
+	}
+	return alert
+}
+
+// recordDegraded counts consecutive degraded checks and, for endpoints with
+// DegradedAfter set, alerts once the degradation has lasted that many checks
+// and again when it ends while the endpoint is still up.
+func (s *Scheduler) recordDegraded(result EndpointResponse, state string) {
+	url := result.Endpoint.URL
+	key := locationKey(url, result.Location)
+	after := result.Endpoint.DegradedAfter
+
+	s.mu.Lock()
+	previous := s.degraded[key]
+	count := 0
+	if result.Degraded != "" {
+		count = previous + 1
+	}
+	s.degraded[key] = count
+	s.mu.Unlock()
+
+	if after <= 0 || result.Flapping {
+		return
+	}
+
+	switch {
+	case count == after:
+		log.Printf("%s has been degraded for %d checks", url, count)
+		s.alerter.Enqueue(newAlert(AlertDegraded, result))
+	case count == 0 && previous >= after && state == StateUp:
+		log.Printf("%s is no longer degraded", url)
+		alert := newAlert(AlertRecovered, result)
+		alert.Resolves = AlertDegraded
+		s.alerter.Enqueue(alert)
+	}
+}
+
+// recordAnomaly counts consecutive anomalous checks and, for endpoints with
+// AnomalyAfter set, alerts once they have been unusually slow for that many
+// checks and again when their latency is back to normal.
+func (s *Scheduler) recordAnomaly(result EndpointResponse, state string) {
+	url := result.Endpoint.URL
+	key := locationKey(url, result.Location)
+	after := result.Endpoint.AnomalyAfter
+
+	s.mu.Lock()
+	previous := s.anomalous[key]
+	count := 0
+	if result.Anomalous {
+		count = previous + 1
+	}
+	s.anomalous[key] = count
+	s.mu.Unlock()
+
+	if after <= 0 || result.Flapping {
+		return
+	}
+
+	switch {
+	case count == after:
+		log.Printf("%s has been slower than usual for %d checks", url, count)
+		s.alerter.Enqueue(newAlert(AlertAnomaly, result))
+	case count == 0 && previous >= after && state == StateUp:
+		log.Printf("%s is no longer slower than usual", url)
+		alert := newAlert(AlertRecovered, result)
+		alert.Resolves = AlertAnomaly
+		s.alerter.Enqueue(alert)
+	}
+}
+
+// recordChange alerts when the content of an endpoint with AlertOnChange set
+// has changed. The alert links to the endpoint's recorded changes. Every
+// location records the change, so it is only reported by the first one to
+// see the new content.
+func (s *Scheduler) recordChange(result EndpointResponse) {
+	if !result.ContentChanged {
+		return
+	}
+
+	endpoint := result.Endpoint
+	s.mu.Lock()
+	reported := s.changes[endpoint.URL] == result.ContentHash
+	s.changes[endpoint.URL] = result.ContentHash
+	s.mu.Unlock()
+	if reported {
+		return
+	}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
+	log.Printf("Content of %s has changed", endpoint.URL)
+	if !endpoint.AlertOnChange {
+		return
+	}
+
+	alert := newAlert(AlertChanged, result)
+	alert.Category = CategoryContentChanged
+	if s.alerter.publicURL != "" {
+		alert.HistoryURL = s.alerter.publicURL + "/changes?url=" + url.QueryEscape(endpoint.URL)
+	}
+	s.alerter.Enqueue(alert)
+}
+
+// recordSLOs re-evaluates the SLOs covering the endpoint and alerts when one
+// starts burning its error budget too fast, escalates from a slow to a fast
+// burn, or stops burning.
+func (s *Scheduler) recordSLOs(result EndpointResponse) {
+	endpoint := result.Endpoint
+	for _, slo := range s.handler.SLOs() {
+		if !slo.Applies(endpoint.URL, endpoint.Domain, endpoint.Labels) {
+			continue
+		}
+
+		status, err := s.handler.GetSLOStatus(slo, result.Timestamp)
+		if err != nil {
+			log.Printf("Failed to evaluate SLO %s: %v", slo.Name, err)
+			continue
+		}
+
+		s.mu.Lock()
+		previous := s.burning[slo.Name]
+		s.burning[slo.Name] = status.Burn
+		s.mu.Unlock()
+
+		// A fast burn easing into a slow one is still the same alert.
+		if status.Burn == previous || (previous == SLOBurnFast && status.Burn == SLOBurnSlow) {
+			continue
+		}
+
+		alert := newSLOAlert(status, result.Timestamp)
+		if s.alerter.publicURL != "" {
+			alert.HistoryURL = s.alerter.publicURL + "/slo?name=" + url.QueryEscape(slo.Name)
+		}
+		if status.Burn == "" {
+			log.Printf("SLO %s stopped burning its error budget", slo.Name)
+			alert.Kind = AlertRecovered
+			alert.Resolves = AlertBurnRate
+		} else {
+			log.Printf("SLO %s has a %s burn of its error budget", slo.Name, status.Burn)
+		}
+		s.alerter.Enqueue(alert)
+	}
+}
+
+// previousState recovers the state an endpoint was in before the result,
+// and whether the result's location was flapping, from stored history so
+// restarts do not report spurious transitions. Checks made during
+// maintenance are skipped as they never changed the state.
+func (s *Scheduler) previousState(result EndpointResponse) (string, bool) {
+	history, err := s.handler.GetEndpointHistory(result.Endpoint.URL)
+	if err != nil {
+		return StateUnknown, false
+	}
+
+	// The result itself has usually been stored already.
+	var earlier []EndpointResponse
+	for _, entry := range history {
+		if entry.Location != result.Location || !entry.Timestamp.Equal(result.Timestamp) {
+			earlier = append(earlier, entry)
+		}
+	}
+
+	state, flapping := StateUnknown, false
+	for i := len(earlier) - 1; i >= 0; i-- {
+		if earlier[i].Maintenance {
+			continue
+		}
+		if state == StateUnknown {
+			latest := latestByLocation(earlier[:i+1], earlier[i].Timestamp.Add(-s.quorumWindow()))
+			state, _ = quorumState(latest, result.Endpoint.Quorum)
+		}
+		if earlier[i].Location == result.Location {
+			flapping = earlier[i].Flapping
+			break
+		}
+	}
+	return state, flapping
 }
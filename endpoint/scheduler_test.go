@@ -3,20 +3,12 @@ package endpoint
 import (
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 	"time"
 )
 
 func TestScheduler(t *testing.T) {
-	tmpDB := "test_scheduler.db"
-	defer os.Remove(tmpDB)
-
-	handler, err := NewEndpointHandler(tmpDB, 10)
-	if err != nil {
-		t.Fatalf("Failed to create handler: %v", err)
-	}
-	defer handler.Close()
+	handler := NewStoreHandler(NewMemoryStore(), 10)
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
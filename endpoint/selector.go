@@ -0,0 +1,115 @@
+package endpoint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	SelectorEquals       = "="
+	SelectorNotEquals    = "!="
+	SelectorExists       = "exists"
+	SelectorDoesNotExist = "!exists"
+)
+
+// ParseSelector parses a comma separated list of label requirements such as
+// "env=prod,team!=payments,canary,!legacy". An empty string selects every
+// endpoint.
+func ParseSelector(selector string) (Selector, error) {
+	var requirements Selector
+
+	for _, part := range strings.Split(selector, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var requirement SelectorRequirement
+		switch {
+		case strings.Contains(part, "!="):
+			key, value, _ := strings.Cut(part, "!=")
+			requirement = SelectorRequirement{Key: key, Operator: SelectorNotEquals, Value: value}
+		case strings.Contains(part, "="):
+			key, value, _ := strings.Cut(part, "=")
+			requirement = SelectorRequirement{Key: key, Operator: SelectorEquals, Value: strings.TrimPrefix(value, "=")}
+		case strings.HasPrefix(part, "!"):
+			requirement = SelectorRequirement{Key: strings.TrimPrefix(part, "!"), Operator: SelectorDoesNotExist}
+		default:
+			requirement = SelectorRequirement{Key: part, Operator: SelectorExists}
+		}
+
+		requirement.Key = strings.TrimSpace(requirement.Key)
+		requirement.Value = strings.TrimSpace(requirement.Value)
+		if requirement.Key == "" {
+			return nil, fmt.Errorf("invalid selector %q: missing label key", part)
+		}
+
+		requirements = append(requirements, requirement)
+	}
+
+	return requirements, nil
+}
+
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, requirement := range s {
+		value, ok := labels[requirement.Key]
+
+		switch requirement.Operator {
+		case SelectorEquals:
+			if !ok || value != requirement.Value {
+				return false
+			}
+		case SelectorNotEquals:
+			if ok && value == requirement.Value {
+				return false
+			}
+		case SelectorExists:
+			if !ok {
+				return false
+			}
+		case SelectorDoesNotExist:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	parts := make([]string, len(s))
+	for i, requirement := range s {
+		switch requirement.Operator {
+		case SelectorExists:
+			parts[i] = requirement.Key
+		case SelectorDoesNotExist:
+			parts[i] = "!" + requirement.Key
+		default:
+			parts[i] = requirement.Key + requirement.Operator + requirement.Value
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func (s Selector) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Selector) UnmarshalText(text []byte) error {
+	selector, err := ParseSelector(string(text))
+	if err != nil {
+		return err
+	}
+	*s = selector
+	return nil
+}
+
+func sortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
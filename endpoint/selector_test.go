@@ -0,0 +1,54 @@
+package endpoint
+
+import "testing"
+
+func TestSelector(t *testing.T) {
+	labels := map[string]string{
+		"env":  "prod",
+		"team": "payments",
+		"tier": "1",
+	}
+
+	tests := []struct {
+		name     string
+		selector string
+		want     bool
+		wantErr  bool
+	}{
+		{name: "empty", selector: "", want: true},
+		{name: "equals", selector: "env=prod", want: true},
+		{name: "double equals", selector: "env==prod", want: true},
+		{name: "multiple", selector: "env=prod, team=payments", want: true},
+		{name: "mismatch", selector: "env=prod,team=search", want: false},
+		{name: "not equals", selector: "team!=search", want: true},
+		{name: "not equals mismatch", selector: "team!=payments", want: false},
+		{name: "exists", selector: "tier", want: true},
+		{name: "missing", selector: "region", want: false},
+		{name: "does not exist", selector: "!region", want: true},
+		{name: "missing key", selector: "=prod", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := ParseSelector(tt.selector)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSelector() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got := selector.Matches(labels); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+
+			roundTrip, err := ParseSelector(selector.String())
+			if err != nil {
+				t.Fatalf("Failed to parse %q: %v", selector.String(), err)
+			}
+			if roundTrip.String() != selector.String() {
+				t.Errorf("Round trip = %q, want %q", roundTrip.String(), selector.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package endpoint
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	silenceBucket = "silences"
+
+	SilencePending = "pending"
+	SilenceActive  = "active"
+	SilenceExpired = "expired"
+)
+
+var (
+	ErrSilenceNotFound = errors.New("silence not found")
+	ErrSilenceExpired  = errors.New("silence has expired")
+)
+
+// Validate checks the silence and fills in defaults. A silence has to match
+// something, so at least one URL, domain or selector requirement is needed.
+func (s *Silence) Validate(now time.Time) error {
+	if len(s.URLs) == 0 && len(s.Domains) == 0 && len(s.Selector) == 0 {
+		return errors.New("at least one url, domain or selector is required")
+	}
+	if s.CreatedBy == "" {
+		return errors.New("created_by is required")
+	}
+	if s.Start.IsZero() {
+		s.Start = now
+	}
+	if s.End.IsZero() {
+		return errors.New("end is required")
+	}
+	if !s.End.After(s.Start) {
+		return errors.New("end must be after start")
+	}
+	if !s.End.After(now) {
+		return errors.New("end must be in the future")
+	}
+	return nil
+}
+
+func (s Silence) Matches(alert Alert) bool {
+	if len(s.URLs) > 0 && !contains(s.URLs, alert.URL) {
+		return false
+	}
+	if len(s.Domains) > 0 && !contains(s.Domains, alert.Domain) {
+		return false
+	}
+	return len(s.Selector) == 0 || s.Selector.Matches(alert.Labels)
+}
+
+func (s Silence) StatusAt(t time.Time) string {
+	switch {
+	case t.Before(s.Start):
+		return SilencePending
+	case t.Before(s.End):
+		return SilenceActive
+	default:
+		return SilenceExpired
+	}
+}
+
+func (h *EndpointHandler) CreateSilence(silence Silence, now time.Time) (Silence, error) {
+	if err := silence.Validate(now); err != nil {
+		return silence, err
+	}
+	silence.CreatedAt = now
+	silence.Status = ""
+
+	err := h.store.Update(func(tx RecordTx) error {
+		id, err := nextRecordID(tx, silenceBucket)
+		if err != nil {
+			return err
+		}
+		silence.ID = id
+		return putRecord(tx, silenceBucket, id, silence)
+	})
+
+	return silence, err
+}
+
+// UpdateSilence replaces a silence that has not expired yet. Its creation
+// time is kept.
+func (h *EndpointHandler) UpdateSilence(id uint64, silence Silence, now time.Time) (Silence, error) {
+	if err := silence.Validate(now); err != nil {
+		return silence, err
+	}
+
+	err := h.store.Update(func(tx RecordTx) error {
+		var existing Silence
+		found, err := getRecord(tx, silenceBucket, id, &existing)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrSilenceNotFound
+		}
+		if existing.StatusAt(now) == SilenceExpired {
+			return ErrSilenceExpired
+		}
+
+		silence.ID = id
+		silence.CreatedAt = existing.CreatedAt
+		silence.Status = ""
+		return putRecord(tx, silenceBucket, id, silence)
+	})
+
+	return silence, err
+}
+
+// ExpireSilence ends a silence now. Expired silences are kept for audit
+// rather than deleted.
+func (h *EndpointHandler) ExpireSilence(id uint64, now time.Time) (Silence, error) {
+	var silence Silence
+
+	err := h.store.Update(func(tx RecordTx) error {
+		found, err := getRecord(tx, silenceBucket, id, &silence)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrSilenceNotFound
+		}
+		if silence.StatusAt(now) == SilenceExpired {
+			return ErrSilenceExpired
+		}
+
+		if silence.Start.After(now) {
+			silence.Start = now
+		}
+		silence.End = now
+		return putRecord(tx, silenceBucket, id, silence)
+	})
+
+	return silence, err
+}
+
+func (h *EndpointHandler) GetSilence(id uint64) (Silence, error) {
+	var silence Silence
+
+	err := h.store.View(func(tx RecordTx) error {
+		found, err := getRecord(tx, silenceBucket, id, &silence)
+		if err == nil && !found {
+			return ErrSilenceNotFound
+		}
+		return err
+	})
+
+	return silence, err
+}
+
+func (h *EndpointHandler) GetSilences() ([]Silence, error) {
+	var silences []Silence
+
+	err := h.store.View(func(tx RecordTx) error {
+		return forEachRecord(tx, silenceBucket, func(s Silence) error {
+			silences = append(silences, s)
+			return nil
+		})
+	})
+
+	return silences, err
+}
+
+// ActiveSilence returns a silence muting the alert at the given time, or nil.
+func (h *EndpointHandler) ActiveSilence(alert Alert, at time.Time) (*Silence, error) {
+	silences, err := h.GetSilences()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, silence := range silences {
+		if silence.StatusAt(at) == SilenceActive && silence.Matches(alert) {
+			return &silences[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,275 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSilenceValidate(t *testing.T) {
+	now := time.Date(2024, 11, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		silence Silence
+		wantErr bool
+	}{
+		{"valid", Silence{Domains: []string{"plug"}, CreatedBy: "alice", End: now.Add(time.Hour)}, false},
+		{"no matchers", Silence{CreatedBy: "alice", End: now.Add(time.Hour)}, true},
+		{"no creator", Silence{URLs: []string{"https://onplug.io"}, End: now.Add(time.Hour)}, true},
+		{"no end", Silence{URLs: []string{"https://onplug.io"}, CreatedBy: "alice"}, true},
+		{"already over", Silence{URLs: []string{"https://onplug.io"}, CreatedBy: "alice", Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.silence.Validate(now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSilencedAlerts(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+
+	notifier := &recordingNotifier{name: "slack"}
+	scheduler := NewScheduler(handler, time.Minute, nil)
+	scheduler.Alerter().Register(notifier)
+
+	now := time.Now()
+	silence, err := handler.CreateSilence(Silence{
+		Selector:  Selector{{Key: "team", Operator: SelectorEquals, Value: "web"}},
+		CreatedBy: "alice",
+		Comment:   "investigating",
+		End:       now.Add(time.Hour),
+	}, now)
+	if err != nil {
+		t.Fatalf("Failed to create silence: %v", err)
+	}
+
+	down := testAlert(AlertDown)
+	down.Labels = map[string]string{"team": "web"}
+	scheduler.Alerter().Dispatch(context.Background(), down)
+
+	other := testAlert(AlertDown)
+	other.URL = "https://other.com"
+	scheduler.Alerter().Dispatch(context.Background(), other)
+
+	if len(notifier.alerts) != 1 || notifier.alerts[0].URL != other.URL {
+		t.Fatalf("Expected only the unsilenced alert to be sent, got %+v", notifier.alerts)
+	}
+	if active := scheduler.Alerter().ActiveAlerts(); len(active) != 2 {
+		t.Errorf("Expected silenced outages to still be tracked, got %d", len(active))
+	}
+
+	if _, err := handler.ExpireSilence(silence.ID, time.Now()); err != nil {
+		t.Fatalf("Failed to expire silence: %v", err)
+	}
+	if _, err := handler.ExpireSilence(silence.ID, time.Now()); !errors.Is(err, ErrSilenceExpired) {
+		t.Errorf("Expected expiring twice to fail, got %v", err)
+	}
+
+	// The outage went down while silenced, so no one is told it recovered.
+	recovered := testAlert(AlertRecovered)
+	recovered.Labels = down.Labels
+	scheduler.Alerter().Dispatch(context.Background(), recovered)
+	if len(notifier.alerts) != 1 {
+		t.Errorf("Expected no recovery for an outage no one was notified of, got %+v", notifier.alerts)
+	}
+
+	// An outage still ongoing when its silence ends is sent on the next tick,
+	// and its recovery follows.
+	silence, err = handler.CreateSilence(Silence{URLs: []string{down.URL}, CreatedBy: "alice", End: time.Now().Add(time.Hour)}, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to create silence: %v", err)
+	}
+	scheduler.Alerter().Dispatch(context.Background(), down)
+	scheduler.Alerter().Tick(context.Background(), time.Now())
+	if len(notifier.alerts) != 1 {
+		t.Fatalf("Expected nothing while silenced, got %+v", notifier.alerts)
+	}
+	if _, err := handler.ExpireSilence(silence.ID, time.Now()); err != nil {
+		t.Fatalf("Failed to expire silence: %v", err)
+	}
+	scheduler.Alerter().Tick(context.Background(), time.Now())
+	scheduler.Alerter().Dispatch(context.Background(), recovered)
+	if len(notifier.alerts) != 3 || notifier.alerts[1].Kind != AlertDown || notifier.alerts[2].Kind != AlertRecovered {
+		t.Errorf("Expected alerts to flow once the silence expired, got %+v", notifier.alerts)
+	}
+
+	silences, err := handler.GetSilences()
+	if err != nil || len(silences) != 2 || silences[0].StatusAt(time.Now()) != SilenceExpired {
+		t.Errorf("Expected expired silence to be kept, got %+v (%v)", silences, err)
+	}
+}
+
+func TestSilenceAPI(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 10)
+
+	scheduler := NewScheduler(handler, time.Minute, nil)
+	scheduler.Alerter().Register(&recordingNotifier{name: "slack"})
+	scheduler.Alerter().Dispatch(context.Background(), testAlert(AlertDown))
+	api := NewAPI(handler, scheduler)
+	api.adminToken = "secret"
+
+	end := time.Now().Add(time.Hour).Format(time.RFC3339)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+		validateBody   func(t *testing.T, body []byte)
+	}{
+		{
+			name:           "create silence - no token",
+			method:         "POST",
+			path:           "/silences",
+			body:           `{"domains":["plug"],"end":"` + end + `","created_by":"alice"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "create silence",
+			method:         "POST",
+			path:           "/silences",
+			token:          "secret",
+			body:           `{"domains":["plug"],"end":"` + end + `","created_by":"alice","comment":"deploying"}`,
+			expectedStatus: http.StatusCreated,
+			validateBody: func(t *testing.T, body []byte) {
+				var silence Silence
+				json.Unmarshal(body, &silence)
+				if silence.ID != 1 || silence.Status != SilenceActive || silence.CreatedAt.IsZero() {
+					t.Errorf("Unexpected silence %+v", silence)
+				}
+			},
+		},
+		{
+			name:           "create silence - invalid",
+			method:         "POST",
+			path:           "/silences",
+			token:          "secret",
+			body:           `{"end":"` + end + `","created_by":"alice"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "update silence",
+			method:         "PUT",
+			path:           "/silences/1",
+			token:          "secret",
+			body:           `{"urls":["https://onplug.io"],"end":"` + end + `","created_by":"alice","comment":"narrowed"}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "expire silence",
+			method:         "DELETE",
+			path:           "/silences/1",
+			token:          "secret",
+			expectedStatus: http.StatusOK,
+			validateBody: func(t *testing.T, body []byte) {
+				var silence Silence
+				json.Unmarshal(body, &silence)
+				if silence.Status != SilenceExpired || silence.Comment != "narrowed" {
+					t.Errorf("Expected expired silence, got %+v", silence)
+				}
+			},
+		},
+		{
+			name:           "update expired silence",
+			method:         "PUT",
+			path:           "/silences/1",
+			token:          "secret",
+			body:           `{"urls":["https://onplug.io"],"end":"` + end + `","created_by":"alice"}`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "list expired silences",
+			method:         "GET",
+			path:           "/silences?status=expired",
+			expectedStatus: http.StatusOK,
+			validateBody: func(t *testing.T, body []byte) {
+				var silences []Silence
+				json.Unmarshal(body, &silences)
+				if len(silences) != 1 {
+					t.Errorf("Expected expired silence to be listed, got %d", len(silences))
+				}
+			},
+		},
+		{
+			name:           "get missing silence",
+			method:         "GET",
+			path:           "/silences/9",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "acknowledge alert - wrong token",
+			method:         "POST",
+			path:           "/alerts/acknowledge",
+			token:          "other",
+			body:           `{"url":"https://onplug.io","by":"bob"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "acknowledge alert",
+			method:         "POST",
+			path:           "/alerts/acknowledge",
+			token:          "secret",
+			body:           `{"url":"https://onplug.io","by":"bob"}`,
+			expectedStatus: http.StatusOK,
+			validateBody: func(t *testing.T, body []byte) {
+				var alert ActiveAlert
+				json.Unmarshal(body, &alert)
+				if alert.AcknowledgedBy != "bob" || alert.AcknowledgedAt == nil {
+					t.Errorf("Expected acknowledged alert, got %+v", alert)
+				}
+			},
+		},
+		{
+			name:           "acknowledge unknown alert",
+			method:         "POST",
+			path:           "/alerts/acknowledge",
+			token:          "secret",
+			body:           `{"url":"https://other.com","by":"bob"}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "list alerts",
+			method:         "GET",
+			path:           "/alerts",
+			expectedStatus: http.StatusOK,
+			validateBody: func(t *testing.T, body []byte) {
+				var alerts []ActiveAlert
+				json.Unmarshal(body, &alerts)
+				if len(alerts) != 1 || alerts[0].Channels[0] != "slack" {
+					t.Errorf("Expected one active alert sent to slack, got %+v", alerts)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.validateBody != nil {
+				tt.validateBody(t, w.Body.Bytes())
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	SLOAvailability = "availability"
+	SLOLatency      = "latency"
+
+	SLOBurnFast = "fast"
+	SLOBurnSlow = "slow"
+
+	CategorySLOFastBurn = "slo_fast_burn"
+	CategorySLOSlowBurn = "slo_slow_burn"
+)
+
+// burnAlerts are the multi-window burn rate conditions: both the long and
+// the short window must burn the error budget at least threshold times faster
+// than it would last for the SLO window. The fast burn is checked first.
+var burnAlerts = []burnAlert{
+	{name: SLOBurnFast, long: time.Hour, short: 5 * time.Minute, threshold: 14.4},
+	{name: SLOBurnSlow, long: 6 * time.Hour, short: 30 * time.Minute, threshold: 6},
+}
+
+var burnWindows = []time.Duration{5 * time.Minute, 30 * time.Minute, time.Hour, 6 * time.Hour}
+
+// Validate checks the SLO and fills in the default window. SLOs are
+// computed from stored results, so the window may not be longer than the
+// retained history, which is also the default. A zero retention skips that
+// check.
+func (s *SLO) Validate(retention time.Duration) error {
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+	if s.Kind != SLOAvailability && s.Kind != SLOLatency {
+		return fmt.Errorf("kind must be %s or %s", SLOAvailability, SLOLatency)
+	}
+	if s.Kind == SLOLatency && s.LatencyThreshold <= 0 {
+		return errors.New("latency SLOs require a latency threshold")
+	}
+	if s.Objective <= 0 || s.Objective >= 100 {
+		return errors.New("objective must be a percentage between 0 and 100")
+	}
+	if s.Window == 0 {
+		s.Window = retention
+	}
+	if s.Window < 0 {
+		return errors.New("window must be positive")
+	}
+	if retention > 0 && s.Window > retention {
+		return fmt.Errorf("window of %v is longer than the %v of history kept, raise -history or shorten the window", s.Window, retention)
+	}
+	if len(s.URLs) == 0 && len(s.Domains) == 0 && len(s.Selector) == 0 {
+		return errors.New("at least one url, domain or selector is required")
+	}
+	return nil
+}
+
+// Applies reports whether the endpoint is covered by the SLO. It matches any
+// of the listed URLs or domains, or the selector.
+func (s SLO) Applies(url, domain string, labels map[string]string) bool {
+	return contains(s.URLs, url) || contains(s.Domains, domain) ||
+		(len(s.Selector) > 0 && s.Selector.Matches(labels))
+}
+
+func (s SLO) good(result EndpointResponse) bool {
+	if result.Error != nil {
+		return false
+	}
+	return s.Kind != SLOLatency || result.Duration <= s.LatencyThreshold
+}
+
+// RegisterSLOs validates and installs the configured SLOs. The retention is
+// how far back the stored history reaches, the history size times the check
+// interval.
+func (h *EndpointHandler) RegisterSLOs(slos []SLO, retention time.Duration) error {
+	if err := validateSLOs(slos, retention); err != nil {
+		return err
+	}
+
+	h.slos = slos
+	return nil
+}
+
+func validateSLOs(slos []SLO, retention time.Duration) error {
+	names := make(map[string]bool)
+	for i := range slos {
+		if err := slos[i].Validate(retention); err != nil {
+			return fmt.Errorf("SLO %q: %w", slos[i].Name, err)
+		}
+		if names[slos[i].Name] {
+			return fmt.Errorf("SLO %q: defined more than once", slos[i].Name)
+		}
+		names[slos[i].Name] = true
+	}
+	return nil
+}
+
+func (h *EndpointHandler) SLOs() []SLO {
+	return h.slos
+}
+
+// GetSLOStatuses evaluates every SLO at the given time.
+func (h *EndpointHandler) GetSLOStatuses(now time.Time) ([]SLOStatus, error) {
+	statuses := []SLOStatus{}
+	for _, slo := range h.slos {
+		status, err := h.GetSLOStatus(slo, now)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// GetSLOStatus computes attainment, remaining error budget and burn rates of
+// the SLO from the stored results of its endpoints. Only stored results can
+// be used, so Coverage reports how much of the window they span. Checks made
+// during maintenance are left out.
+func (h *EndpointHandler) GetSLOStatus(slo SLO, now time.Time) (SLOStatus, error) {
+	status := SLOStatus{
+		SLO:             slo,
+		Endpoints:       []string{},
+		Attainment:      100,
+		BudgetRemaining: 1,
+		BurnRates:       []BurnRate{},
+	}
+
+	endpoints, err := h.ListEndpoints(nil)
+	if err != nil {
+		return status, err
+	}
+
+	var checks []sloCheck
+	for _, meta := range endpoints {
+		if !slo.Applies(meta.URL, meta.Domain, meta.Labels) {
+			continue
+		}
+		status.Endpoints = append(status.Endpoints, meta.URL)
+
+		history, err := h.GetEndpointHistory(meta.URL)
+		if err != nil {
+			return status, err
+		}
+		for _, result := range history {
+			if result.Maintenance || result.Timestamp.After(now) || now.Sub(result.Timestamp) > slo.Window {
+				continue
+			}
+			checks = append(checks, sloCheck{timestamp: result.Timestamp, good: slo.good(result)})
+		}
+	}
+	if len(checks) == 0 {
+		return status, nil
+	}
+
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].timestamp.Before(checks[j].timestamp)
+	})
+
+	status.TotalChecks = len(checks)
+	for _, check := range checks {
+		if check.good {
+			status.GoodChecks++
+		}
+	}
+	status.Coverage = now.Sub(checks[0].timestamp)
+	status.Attainment = float64(status.GoodChecks) / float64(status.TotalChecks) * 100
+
+	budget := 1 - slo.Objective/100
+	status.BudgetRemaining = 1 - float64(status.TotalChecks-status.GoodChecks)/float64(status.TotalChecks)/budget
+
+	rates := make(map[time.Duration]float64)
+	for _, window := range burnWindows {
+		ratio, ok := errorRatio(checks, now, window)
+		if !ok {
+			continue
+		}
+		rates[window] = ratio / budget
+		status.BurnRates = append(status.BurnRates, BurnRate{Window: window, Rate: rates[window]})
+	}
+
+	// A burn needs checks in both of its windows.
+	for _, alert := range burnAlerts {
+		long, hasLong := rates[alert.long]
+		short, hasShort := rates[alert.short]
+		if hasLong && hasShort && long >= alert.threshold && short >= alert.threshold {
+			status.Burn = alert.name
+			break
+		}
+	}
+
+	return status, nil
+}
+
+// errorRatio is the share of failed checks within the window before now. It
+// reports false when the window holds no checks, such as a window shorter
+// than the check interval, rather than guessing from older checks.
+func errorRatio(checks []sloCheck, now time.Time, window time.Duration) (float64, bool) {
+	var total, bad int
+	for _, check := range checks {
+		if now.Sub(check.timestamp) > window {
+			continue
+		}
+		total++
+		if !check.good {
+			bad++
+		}
+	}
+
+	if total == 0 {
+		return 0, false
+	}
+	return float64(bad) / float64(total), true
+}
@@ -0,0 +1,187 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSLOValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		slo     SLO
+		wantErr bool
+	}{
+		{"availability", SLO{Name: "web", Kind: SLOAvailability, Objective: 99.9, Domains: []string{"plug"}}, false},
+		{"latency", SLO{Name: "web", Kind: SLOLatency, Objective: 95, LatencyThreshold: time.Second, URLs: []string{"https://onplug.io"}}, false},
+		{"no name", SLO{Kind: SLOAvailability, Objective: 99, Domains: []string{"plug"}}, true},
+		{"unknown kind", SLO{Name: "web", Kind: "errors", Objective: 99, Domains: []string{"plug"}}, true},
+		{"latency without threshold", SLO{Name: "web", Kind: SLOLatency, Objective: 99, Domains: []string{"plug"}}, true},
+		{"objective of 100", SLO{Name: "web", Kind: SLOAvailability, Objective: 100, Domains: []string{"plug"}}, true},
+		{"negative window", SLO{Name: "web", Kind: SLOAvailability, Objective: 99, Window: -time.Hour, Domains: []string{"plug"}}, true},
+		{"window within history", SLO{Name: "web", Kind: SLOAvailability, Objective: 99, Window: 24 * time.Hour, Domains: []string{"plug"}}, false},
+		{"window beyond history", SLO{Name: "web", Kind: SLOAvailability, Objective: 99, Window: 30 * 24 * time.Hour, Domains: []string{"plug"}}, true},
+		{"no endpoints", SLO{Name: "web", Kind: SLOAvailability, Objective: 99}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.slo.Validate(24 * time.Hour)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.slo.Window != 24*time.Hour {
+				t.Errorf("Expected the window to default to the retained history, got %s", tt.slo.Window)
+			}
+		})
+	}
+}
+
+func TestSLONoData(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 48)
+	endpoint := EndpointRequest{URL: "https://test.com", Domain: "test", Status: http.StatusOK}
+	if err := handler.RegisterEndpoints([]EndpointRequest{endpoint}); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
+	slo := SLO{Name: "test", Kind: SLOAvailability, Objective: 99, Domains: []string{"test"}}
+	if err := handler.RegisterSLOs([]SLO{slo}, 24*time.Hour); err != nil {
+		t.Fatalf("Failed to register SLOs: %v", err)
+	}
+
+	// Checks every 30 minutes, the latest of which failed 10 minutes ago,
+	// leave the 5 minute window empty.
+	now := time.Now()
+	for i, status := range []int{http.StatusOK, http.StatusBadGateway} {
+		result := EndpointResponse{Endpoint: endpoint, Status: status, Timestamp: now.Add(time.Duration(i*30-40) * time.Minute)}
+		if status != http.StatusOK {
+			result.Error = errors.New("received error status code: 502")
+		}
+		handler.finishResult(&result)
+	}
+
+	status, err := handler.GetSLOStatus(handler.SLOs()[0], now)
+	if err != nil {
+		t.Fatalf("Failed to get SLO status: %v", err)
+	}
+	if status.Burn == SLOBurnFast {
+		t.Errorf("Expected no fast burn without checks in its short window")
+	}
+	for _, rate := range status.BurnRates {
+		if rate.Window == 5*time.Minute {
+			t.Errorf("Expected no burn rate for the empty 5 minute window, got %v", rate.Rate)
+		}
+	}
+	if len(status.BurnRates) != 3 {
+		t.Errorf("Expected burn rates for the windows with checks, got %+v", status.BurnRates)
+	}
+}
+
+func TestSLOBurnRates(t *testing.T) {
+	handler := NewStoreHandler(NewMemoryStore(), 500)
+
+	endpoint := EndpointRequest{URL: "https://test.com", Domain: "test", Status: http.StatusOK}
+	if err := handler.RegisterEndpoints([]EndpointRequest{endpoint}); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
+	slo := SLO{Name: "test", Kind: SLOAvailability, Objective: 99, Domains: []string{"test"}}
+	if err := handler.RegisterSLOs([]SLO{slo}, 500*time.Minute); err != nil {
+		t.Fatalf("Failed to register SLOs: %v", err)
+	}
+
+	alerts := make(channelNotifier, 512)
+	scheduler := NewScheduler(handler, time.Minute, nil)
+	scheduler.Alerter().Register(alerts)
+
+	// Two hours of good checks, ten failures and then another hour of good
+	// checks, one check a minute.
+	start := time.Now().Add(-4 * time.Hour).Truncate(time.Minute)
+	var now time.Time
+	for i := 0; i < 190; i++ {
+		now = start.Add(time.Duration(i) * time.Minute)
+		result := EndpointResponse{Endpoint: endpoint, Status: http.StatusOK, Timestamp: now}
+		if i >= 120 && i < 130 {
+			result.Status = http.StatusBadGateway
+			result.Error = errors.New("received error status code: 502")
+		}
+		handler.finishResult(&result)
+		scheduler.record(result)
+
+		if i == 129 {
+			status, err := handler.GetSLOStatus(handler.SLOs()[0], now)
+			if err != nil {
+				t.Fatalf("Failed to get SLO status: %v", err)
+			}
+			if status.Burn != SLOBurnFast || status.TotalChecks != 130 || status.GoodChecks != 120 {
+				t.Errorf("Expected a fast burn after 10 failures, got %+v", status)
+			}
+			if status.BudgetRemaining >= 0 {
+				t.Errorf("Expected the error budget to be overspent, got %f", status.BudgetRemaining)
+			}
+		}
+	}
+
+	var burns []string
+	timeout := time.After(time.Second)
+	for len(burns) < 3 {
+		select {
+		case alert := <-alerts:
+			if !strings.HasPrefix(alert.URL, sloScheme) {
+				continue
+			}
+			if alert.URL != "slo://test" || alert.Domain != "test" {
+				t.Errorf("Expected alert for the SLO, got %+v", alert)
+			}
+			burns = append(burns, alert.Kind+":"+alert.Severity())
+		case <-timeout:
+			t.Fatalf("Expected slow burn, fast burn and recovery alerts, got %v", burns)
+		}
+	}
+
+	sort.Strings(burns)
+	if got := strings.Join(burns, ","); got != "burn_rate:critical,burn_rate:warning,recovered:info" {
+		t.Errorf("Expected slow burn, fast burn and recovery alerts, got %s", got)
+	}
+
+	status, err := handler.GetSLOStatus(handler.SLOs()[0], now)
+	if err != nil {
+		t.Fatalf("Failed to get SLO status: %v", err)
+	}
+	if status.Burn != "" || status.BurnRates[0].Rate != 0 {
+		t.Errorf("Expected the burn to have stopped, got %+v", status)
+	}
+
+	api := NewAPI(handler, scheduler)
+
+	req := httptest.NewRequest("GET", "/slo?name=test", nil)
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response SLOStatus
+	json.Unmarshal(w.Body.Bytes(), &response)
+	// The last check was 50 minutes ago, so only the 1 and 6 hour windows
+	// hold checks.
+	if response.Name != "test" || len(response.Endpoints) != 1 || len(response.BurnRates) != 2 {
+		t.Errorf("Expected SLO status, got %+v", response)
+	}
+
+	req = httptest.NewRequest("GET", "/slo?name=other", nil)
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/metrics", nil)
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `cron_slo_burn_rate{slo="test",kind="availability",window="1h0m0s"}`) {
+		t.Errorf("Expected SLO metrics, got %s", w.Body.String())
+	}
+}
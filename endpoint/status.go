@@ -0,0 +1,97 @@
+package endpoint
+
+import "time"
+
+// statusLookahead is how far ahead upcoming maintenance windows are listed on
+// the status page.
+const statusLookahead = 7 * 24 * time.Hour
+
+// GetStatus summarises the current state of every checked endpoint together
+// with the maintenance windows that are active or start soon. Locations count
+// towards the state with their latest check within the quorum window.
+func (h *EndpointHandler) GetStatus(now time.Time, quorumWindow time.Duration) (StatusResponse, error) {
+	response := StatusResponse{
+		Endpoints:   []EndpointStatus{},
+		Maintenance: []MaintenanceWindow{},
+	}
+
+	endpoints, err := h.ListEndpoints(nil)
+	if err != nil {
+		return response, err
+	}
+
+	var up, down, degraded, maintenance int
+	for _, meta := range endpoints {
+		history, err := h.GetEndpointHistory(meta.URL)
+		if err != nil {
+			return response, err
+		}
+		if len(history) == 0 {
+			continue
+		}
+
+		last := history[len(history)-1]
+		status := EndpointStatus{
+			URL:          meta.URL,
+			Domain:       meta.Domain,
+			Labels:       meta.Labels,
+			State:        StateUp,
+			LastCheck:    last.Timestamp,
+			LastDuration: last.Duration,
+			UpTime:       newHistoryResponse(meta, history).Stats.UpTimePercentage,
+			Flapping:     last.Flapping,
+		}
+
+		endpoint := EndpointRequest{URL: meta.URL, Domain: meta.Domain, Labels: meta.Labels}
+		window, err := h.ActiveMaintenance(endpoint, now)
+		if err != nil {
+			return response, err
+		}
+
+		state, _ := quorumState(latestInWindow(history, quorumWindow), meta.Quorum)
+
+		switch {
+		case window != nil:
+			status.State = StateMaintenance
+			status.Maintenance = window
+			maintenance++
+		case state == StateDown:
+			status.State = StateDown
+			down++
+		case last.Degraded != "":
+			status.State = StateDegraded
+			status.Degraded = last.Degraded
+			degraded++
+		default:
+			up++
+		}
+
+		response.Endpoints = append(response.Endpoints, status)
+	}
+
+	switch {
+	case down == 0 && up == 0 && degraded == 0 && maintenance > 0:
+		response.Status = DomainMaintenance
+	case down == 0 && degraded > 0:
+		response.Status = DomainDegraded
+	case down == 0:
+		response.Status = DomainOperational
+	case up == 0 && degraded == 0 && maintenance == 0:
+		response.Status = DomainMajorOutage
+	default:
+		response.Status = DomainPartialOutage
+	}
+
+	windows, err := h.GetMaintenanceWindows()
+	if err != nil {
+		return response, err
+	}
+	for _, window := range windows {
+		start, _, ok := window.NextOccurrence(now)
+		if ok && start.Before(now.Add(statusLookahead)) {
+			response.Maintenance = append(response.Maintenance, window)
+		}
+	}
+
+	return response, nil
+}
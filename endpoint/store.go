@@ -0,0 +1,134 @@
+package endpoint
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	StorageBolt   = "bolt"
+	StorageSQLite = "sqlite"
+	StorageMemory = "memory"
+)
+
+var storageDrivers = []string{StorageBolt, StorageSQLite, StorageMemory}
+
+// recordBuckets lists the buckets records are stored in.
+var recordBuckets = []string{incidentBucket, maintenanceBucket, heartbeatBucket, silenceBucket, outboxBucket, changeBucket, baselineBucket, changeIndexBucket}
+
+// OpenStore opens the database at path with the given driver. The memory
+// driver ignores the path and cannot be opened read-only, since there would
+// be nothing to read.
+func OpenStore(driver, path string, readOnly bool) (Store, error) {
+	switch driver {
+	case StorageBolt, "":
+		return NewBoltStore(path, readOnly)
+	case StorageSQLite:
+		return NewSQLiteStore(path, readOnly)
+	case StorageMemory:
+		if readOnly {
+			return nil, fmt.Errorf("the %s storage driver cannot be opened read-only", driver)
+		}
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
+
+// Validate checks that the driver is known.
+func (c StorageConfig) Validate() error {
+	if c.Driver != "" && !contains(storageDrivers, c.Driver) {
+		return fmt.Errorf("unknown storage driver %q, expected one of %v", c.Driver, storageDrivers)
+	}
+	return nil
+}
+
+// insertResults inserts each added result after every result with the same
+// or an earlier timestamp and drops the oldest results of each location
+// beyond the limit, returning the kept and the dropped results. Results
+// buffered by probe agents can arrive after newer ones, and every location
+// keeps its own history so probes do not push out each other's checks.
+func insertResults(results, added []EndpointResponseStored, limit int) (kept, dropped []EndpointResponseStored) {
+	results = append(append([]EndpointResponseStored(nil), results...), added...)
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Timestamp.Before(results[j].Timestamp)
+	})
+	if limit <= 0 {
+		return results, nil
+	}
+
+	counts := make(map[string]int)
+	drop := make([]bool, len(results))
+	for i := len(results) - 1; i >= 0; i-- {
+		counts[results[i].Location]++
+		drop[i] = counts[results[i].Location] > limit
+	}
+	for i, result := range results {
+		if drop[i] {
+			dropped = append(dropped, result)
+		} else {
+			kept = append(kept, result)
+		}
+	}
+	return kept, dropped
+}
+
+// groupByURL splits results by endpoint, keeping their order and the order
+// in which the endpoints first appear.
+func groupByURL(results []EndpointResponseStored) (urls []string, groups map[string][]EndpointResponseStored) {
+	groups = make(map[string][]EndpointResponseStored)
+	for _, result := range results {
+		if _, ok := groups[result.URL]; !ok {
+			urls = append(urls, result.URL)
+		}
+		groups[result.URL] = append(groups[result.URL], result)
+	}
+	return urls, groups
+}
+
+// droppedBodies returns the timestamps of the dropped results whose bodies
+// are no longer needed. Bodies are stored by timestamp, so one shared with a
+// kept result of another location stays.
+func droppedBodies(kept, dropped []EndpointResponseStored) []time.Time {
+	var timestamps []time.Time
+	for _, result := range dropped {
+		shared := false
+		for _, other := range kept {
+			if other.Timestamp.Equal(result.Timestamp) {
+				shared = true
+				break
+			}
+		}
+		if !shared {
+			timestamps = append(timestamps, result.Timestamp)
+		}
+	}
+	return timestamps
+}
+
+func inRange(t, from, to time.Time) bool {
+	if !from.IsZero() && t.Before(from) {
+		return false
+	}
+	if !to.IsZero() && t.After(to) {
+		return false
+	}
+	return true
+}
+
+func filterResults(results []EndpointResponseStored, from, to time.Time) []EndpointResponseStored {
+	var filtered []EndpointResponseStored
+	for _, result := range results {
+		if inRange(result.Timestamp, from, to) {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
+
+func sortMeta(metas []EndpointMeta) {
+	sort.Slice(metas, func(i, j int) bool {
+		return metas[i].URL < metas[j].URL
+	})
+}
@@ -0,0 +1,397 @@
+package endpoint
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+const (
+	endpointBucket     = "endpoints"
+	endpointMetaBucket = "endpoint_meta"
+	bodyBucket         = "bodies"
+)
+
+// NewBoltStore opens a bbolt database, creating it unless it is opened
+// read-only. Its buckets are created by the first migration. Results are
+// kept as one JSON list per endpoint and records under their big-endian ID.
+// A database held open for writing by a running server cannot be opened.
+func NewBoltStore(path string, readOnly bool) (Store, error) {
+	if readOnly {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+	}
+
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{
+		Timeout:  1 * time.Second,
+		ReadOnly: readOnly,
+	})
+	if readOnly && errors.Is(err, bbolt.ErrTimeout) {
+		return nil, fmt.Errorf("database %s is in use by a running server, query its API instead", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) AppendResult(result EndpointResponseStored, limit int) error {
+	return s.AppendResults([]EndpointResponseStored{result}, limit)
+}
+
+func (s *boltStore) AppendResults(added []EndpointResponseStored, limit int) error {
+	urls, groups := groupByURL(added)
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(endpointBucket))
+		bodies := tx.Bucket([]byte(bodyBucket))
+
+		for _, url := range urls {
+			var results []EndpointResponseStored
+			if data := b.Get([]byte(url)); data != nil {
+				if err := json.Unmarshal(data, &results); err != nil {
+					return fmt.Errorf("failed to unmarshal existing responses: %w", err)
+				}
+			}
+
+			results, dropped := insertResults(results, groups[url], limit)
+			data, err := json.Marshal(results)
+			if err != nil {
+				return fmt.Errorf("failed to marshal responses: %w", err)
+			}
+			if err := b.Put([]byte(url), data); err != nil {
+				return err
+			}
+
+			for _, result := range groups[url] {
+				if len(result.Body) > 0 {
+					if err := bodies.Put(bodyKey(url, result.Timestamp), result.Body); err != nil {
+						return err
+					}
+				}
+			}
+			for _, timestamp := range droppedBodies(results, dropped) {
+				if err := bodies.Delete(bodyKey(url, timestamp)); err != nil {
+					return err
+				}
+			}
+			if err := pruneBodies(bodies, url, results[0].Timestamp); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// bodyKey orders the bodies of an endpoint by timestamp.
+func bodyKey(url string, timestamp time.Time) []byte {
+	key := make([]byte, len(url)+9)
+	copy(key, url)
+	binary.BigEndian.PutUint64(key[len(url)+1:], uint64(timestamp.UnixNano()))
+	return key
+}
+
+// pruneBodies removes the endpoint's bodies from before its oldest result.
+func pruneBodies(bodies *bbolt.Bucket, url string, oldest time.Time) error {
+	prefix := append([]byte(url), 0)
+	end := bodyKey(url, oldest)
+
+	var stale [][]byte
+	c := bodies.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix) && bytes.Compare(k, end) < 0; k, _ = c.Next() {
+		stale = append(stale, k)
+	}
+	for _, k := range stale {
+		if err := bodies.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *boltStore) Body(url string, timestamp time.Time) ([]byte, error) {
+	var body []byte
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		if data := tx.Bucket([]byte(bodyBucket)).Get(bodyKey(url, timestamp)); data != nil {
+			body = append([]byte(nil), data...)
+		}
+		return nil
+	})
+
+	return body, err
+}
+
+func (s *boltStore) Results(url string, from, to time.Time) ([]EndpointResponseStored, error) {
+	var results []EndpointResponseStored
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket([]byte(endpointBucket)).Get([]byte(url))
+		if data == nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, &results); err != nil {
+			return fmt.Errorf("failed to unmarshal responses: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return filterResults(results, from, to), nil
+}
+
+func (s *boltStore) URLs() ([]string, error) {
+	var urls []string
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(endpointBucket)).ForEach(func(k, v []byte) error {
+			urls = append(urls, string(k))
+			return nil
+		})
+	})
+
+	return urls, err
+}
+
+func (s *boltStore) PutMeta(metas []EndpointMeta) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(endpointMetaBucket))
+		for _, meta := range metas {
+			data, err := json.Marshal(meta)
+			if err != nil {
+				return fmt.Errorf("failed to marshal endpoint metadata: %w", err)
+			}
+			if err := b.Put([]byte(meta.URL), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) DeleteMeta(urls []string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(endpointMetaBucket))
+		for _, url := range urls {
+			if err := b.Delete([]byte(url)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Meta(url string) (EndpointMeta, bool, error) {
+	var meta EndpointMeta
+	var found bool
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket([]byte(endpointMetaBucket)).Get([]byte(url))
+		if data == nil {
+			return nil
+		}
+
+		found = true
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return fmt.Errorf("failed to unmarshal endpoint metadata: %w", err)
+		}
+		return nil
+	})
+
+	return meta, found, err
+}
+
+func (s *boltStore) AllMeta() ([]EndpointMeta, error) {
+	var metas []EndpointMeta
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(endpointMetaBucket)).ForEach(func(k, v []byte) error {
+			var meta EndpointMeta
+			if err := json.Unmarshal(v, &meta); err != nil {
+				return fmt.Errorf("failed to unmarshal endpoint metadata: %w", err)
+			}
+			metas = append(metas, meta)
+			return nil
+		})
+	})
+
+	return metas, err
+}
+
+func (s *boltStore) View(fn func(tx RecordTx) error) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return fn(boltTx{tx: tx})
+	})
+}
+
+func (s *boltStore) Update(fn func(tx RecordTx) error) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return fn(boltTx{tx: tx})
+	})
+}
+
+func (s *boltStore) SchemaVersion() (int, error) {
+	var version int
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		version, err = boltSchemaVersion(tx)
+		return err
+	})
+
+	return version, err
+}
+
+func boltSchemaVersion(tx *bbolt.Tx) (int, error) {
+	b := tx.Bucket([]byte(metadataBucket))
+	if b == nil {
+		return 0, nil
+	}
+	data := b.Get([]byte(schemaVersionKey))
+	if data == nil {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q: %w", data, err)
+	}
+	return version, nil
+}
+
+func (s *boltStore) PendingMigrations() ([]Migration, error) {
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	return pendingMigrations(version, s.migrations())
+}
+
+func (s *boltStore) Migrate() ([]Migration, error) {
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pendingMigrations(version, s.migrations()); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range boltMigrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		err := s.db.Update(func(tx *bbolt.Tx) error {
+			if err := migration.up(tx); err != nil {
+				return err
+			}
+			b, err := tx.CreateBucketIfNotExists([]byte(metadataBucket))
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte(schemaVersionKey), []byte(strconv.Itoa(migration.Version)))
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %d: %w", migration.Version, err)
+		}
+		applied = append(applied, migration.Migration)
+	}
+
+	return applied, nil
+}
+
+func (s *boltStore) migrations() []Migration {
+	migrations := make([]Migration, len(boltMigrations))
+	for i, migration := range boltMigrations {
+		migrations[i] = migration.Migration
+	}
+	return migrations
+}
+
+// Backup writes the database file as of a read transaction, so writes can
+// continue while it is copied.
+func (s *boltStore) Backup(w io.Writer) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		_, err := tx.WriteTo(w)
+		return err
+	})
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+func recordKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+func (t boltTx) bucket(name string) (*bbolt.Bucket, error) {
+	b := t.tx.Bucket([]byte(name))
+	if b == nil {
+		return nil, fmt.Errorf("unknown bucket %q", name)
+	}
+	return b, nil
+}
+
+func (t boltTx) NextID(bucket string) (uint64, error) {
+	b, err := t.bucket(bucket)
+	if err != nil {
+		return 0, err
+	}
+	return b.NextSequence()
+}
+
+func (t boltTx) Put(bucket string, id uint64, data []byte) error {
+	b, err := t.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	return b.Put(recordKey(id), data)
+}
+
+func (t boltTx) Get(bucket string, id uint64) ([]byte, error) {
+	b, err := t.bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return b.Get(recordKey(id)), nil
+}
+
+func (t boltTx) Delete(bucket string, id uint64) error {
+	b, err := t.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	return b.Delete(recordKey(id))
+}
+
+func (t boltTx) ForEach(bucket string, fn func(id uint64, data []byte) error) error {
+	b, err := t.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	return b.ForEach(func(k, v []byte) error {
+		return fn(binary.BigEndian.Uint64(k), v)
+	})
+}
+
+func (t boltTx) Count(bucket string) (int, error) {
+	b, err := t.bucket(bucket)
+	if err != nil {
+		return 0, err
+	}
+	return b.Stats().KeyN, nil
+}
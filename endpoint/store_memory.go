@@ -0,0 +1,288 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// NewMemoryStore keeps everything in memory, for tests and for instances
+// that do not need history to survive a restart.
+func NewMemoryStore() Store {
+	records := make(map[string]map[uint64][]byte)
+	for _, bucket := range recordBuckets {
+		records[bucket] = make(map[uint64][]byte)
+	}
+
+	return &memoryStore{
+		results:   make(map[string][]EndpointResponseStored),
+		bodies:    make(map[string]map[int64][]byte),
+		meta:      make(map[string]EndpointMeta),
+		records:   records,
+		sequences: make(map[string]uint64),
+	}
+}
+
+func (s *memoryStore) AppendResult(result EndpointResponseStored, limit int) error {
+	return s.AppendResults([]EndpointResponseStored{result}, limit)
+}
+
+func (s *memoryStore) AppendResults(added []EndpointResponseStored, limit int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	urls, groups := groupByURL(added)
+	for _, url := range urls {
+		bodies := s.bodies[url]
+		if bodies == nil {
+			bodies = make(map[int64][]byte)
+			s.bodies[url] = bodies
+		}
+
+		group := make([]EndpointResponseStored, len(groups[url]))
+		for i, result := range groups[url] {
+			if len(result.Body) > 0 {
+				bodies[result.Timestamp.UnixNano()] = append([]byte(nil), result.Body...)
+			}
+			result.Body = nil
+			group[i] = result
+		}
+		results, dropped := insertResults(s.results[url], group, limit)
+		s.results[url] = results
+
+		for _, timestamp := range droppedBodies(results, dropped) {
+			delete(bodies, timestamp.UnixNano())
+		}
+		for timestamp := range bodies {
+			if timestamp < results[0].Timestamp.UnixNano() {
+				delete(bodies, timestamp)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Body(url string, timestamp time.Time) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	body, ok := s.bodies[url][timestamp.UnixNano()]
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte(nil), body...), nil
+}
+
+func (s *memoryStore) Results(url string, from, to time.Time) ([]EndpointResponseStored, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return filterResults(s.results[url], from, to), nil
+}
+
+func (s *memoryStore) URLs() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var urls []string
+	for url := range s.results {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	return urls, nil
+}
+
+func (s *memoryStore) PutMeta(metas []EndpointMeta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, meta := range metas {
+		s.meta[meta.URL] = meta
+	}
+	return nil
+}
+
+func (s *memoryStore) DeleteMeta(urls []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, url := range urls {
+		delete(s.meta, url)
+	}
+	return nil
+}
+
+func (s *memoryStore) Meta(url string) (EndpointMeta, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	meta, ok := s.meta[url]
+	return meta, ok, nil
+}
+
+func (s *memoryStore) AllMeta() ([]EndpointMeta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var metas []EndpointMeta
+	for _, meta := range s.meta {
+		metas = append(metas, meta)
+	}
+	sortMeta(metas)
+	return metas, nil
+}
+
+func (s *memoryStore) View(fn func(tx RecordTx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return fn(&memoryTx{store: s})
+}
+
+func (s *memoryStore) Update(fn func(tx RecordTx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &memoryTx{
+		store:     s,
+		writable:  true,
+		records:   make(map[string]map[uint64][]byte),
+		sequences: make(map[string]uint64),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	for bucket, records := range tx.records {
+		s.records[bucket] = records
+	}
+	for bucket, sequence := range tx.sequences {
+		s.sequences[bucket] = sequence
+	}
+	return nil
+}
+
+// SchemaVersion is always 0: a memory store starts empty with the current
+// layout, so there is nothing to migrate.
+func (s *memoryStore) SchemaVersion() (int, error) {
+	return 0, nil
+}
+
+func (s *memoryStore) PendingMigrations() ([]Migration, error) {
+	return nil, nil
+}
+
+func (s *memoryStore) Migrate() ([]Migration, error) {
+	return nil, nil
+}
+
+func (s *memoryStore) Backup(w io.Writer) error {
+	return errors.New("the memory store cannot be backed up")
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// bucket returns the transaction's copy of the bucket if it changed it, or
+// the store's.
+func (t *memoryTx) bucket(name string) (map[uint64][]byte, error) {
+	if records, ok := t.records[name]; ok {
+		return records, nil
+	}
+	records, ok := t.store.records[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown bucket %q", name)
+	}
+	return records, nil
+}
+
+func (t *memoryTx) writableBucket(name string) (map[uint64][]byte, error) {
+	if !t.writable {
+		return nil, fmt.Errorf("transaction is read-only")
+	}
+	if records, ok := t.records[name]; ok {
+		return records, nil
+	}
+
+	records, err := t.bucket(name)
+	if err != nil {
+		return nil, err
+	}
+	copied := make(map[uint64][]byte, len(records))
+	for id, data := range records {
+		copied[id] = data
+	}
+	t.records[name] = copied
+	return copied, nil
+}
+
+func (t *memoryTx) NextID(bucket string) (uint64, error) {
+	if _, err := t.writableBucket(bucket); err != nil {
+		return 0, err
+	}
+
+	sequence, ok := t.sequences[bucket]
+	if !ok {
+		sequence = t.store.sequences[bucket]
+	}
+	sequence++
+	t.sequences[bucket] = sequence
+	return sequence, nil
+}
+
+func (t *memoryTx) Put(bucket string, id uint64, data []byte) error {
+	records, err := t.writableBucket(bucket)
+	if err != nil {
+		return err
+	}
+	records[id] = append([]byte(nil), data...)
+	return nil
+}
+
+func (t *memoryTx) Get(bucket string, id uint64) ([]byte, error) {
+	records, err := t.bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return records[id], nil
+}
+
+func (t *memoryTx) Delete(bucket string, id uint64) error {
+	records, err := t.writableBucket(bucket)
+	if err != nil {
+		return err
+	}
+	delete(records, id)
+	return nil
+}
+
+func (t *memoryTx) ForEach(bucket string, fn func(id uint64, data []byte) error) error {
+	records, err := t.bucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]uint64, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		if err := fn(id, records[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *memoryTx) Count(bucket string) (int, error) {
+	records, err := t.bucket(bucket)
+	if err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
@@ -0,0 +1,550 @@
+package endpoint
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Results are stored one row per check with plain columns, so the database
+// can be queried directly. Timestamps and durations are in nanoseconds. This
+// is the schema of the first migration; later ones change it.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS results (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	url         TEXT    NOT NULL,
+	method      TEXT    NOT NULL,
+	status      INTEGER NOT NULL,
+	expected    INTEGER NOT NULL,
+	error       TEXT    NOT NULL,
+	category    TEXT    NOT NULL,
+	timestamp   INTEGER NOT NULL,
+	duration    INTEGER NOT NULL,
+	body        TEXT    NOT NULL,
+	maintenance INTEGER NOT NULL,
+	flapping    INTEGER NOT NULL,
+	degraded    TEXT    NOT NULL,
+	anomaly     REAL    NOT NULL,
+	anomalous   INTEGER NOT NULL,
+	location    TEXT    NOT NULL,
+	ping        TEXT
+);
+CREATE INDEX IF NOT EXISTS results_url_timestamp ON results (url, timestamp);
+
+CREATE TABLE IF NOT EXISTS endpoint_meta (
+	url    TEXT PRIMARY KEY,
+	domain TEXT    NOT NULL,
+	labels TEXT    NOT NULL,
+	quorum INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS records (
+	bucket TEXT    NOT NULL,
+	id     INTEGER NOT NULL,
+	data   BLOB    NOT NULL,
+	PRIMARY KEY (bucket, id)
+);
+
+CREATE TABLE IF NOT EXISTS sequences (
+	bucket TEXT PRIMARY KEY,
+	value  INTEGER NOT NULL
+);
+`
+
+const sqliteResultColumns = `url, method, status, expected, error, category, timestamp, duration,
+	body_encoding, body_hash, body_size, body_truncated, maintenance, flapping, degraded, anomaly, anomalous,
+	location, ping, content_hash, content_changed`
+
+// NewSQLiteStore opens a SQLite database, creating it unless it is opened
+// read-only. Its tables are created by the first migration. It needs a build
+// with cgo enabled.
+func NewSQLiteStore(path string, readOnly bool) (Store, error) {
+	dsn := "file:" + path + "?_busy_timeout=5000"
+	if readOnly {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+		dsn += "&mode=ro"
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// A single connection serializes writes like bbolt does, instead of
+	// failing them while the database is locked.
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) AppendResult(result EndpointResponseStored, limit int) error {
+	return s.AppendResults([]EndpointResponseStored{result}, limit)
+}
+
+func (s *sqliteStore) AppendResults(added []EndpointResponseStored, limit int) error {
+	pings := make([]sql.NullString, len(added))
+	for i, result := range added {
+		if result.Ping != nil {
+			data, err := json.Marshal(result.Ping)
+			if err != nil {
+				return fmt.Errorf("failed to marshal ping: %w", err)
+			}
+			pings[i] = sql.NullString{String: string(data), Valid: true}
+		}
+	}
+
+	return s.transaction(func(tx *sql.Tx) error {
+		type history struct{ url, location string }
+		var histories []history
+		seen := make(map[history]bool)
+
+		for i, result := range added {
+			_, err := tx.Exec(`INSERT INTO results (`+sqliteResultColumns+`)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				result.URL, result.Method, result.Status, result.Expected, result.Error, result.Category,
+				result.Timestamp.UnixNano(), int64(result.Duration), result.BodyEncoding, result.BodyHash, result.BodySize,
+				result.BodyTruncated, result.Maintenance, result.Flapping, result.Degraded, result.Anomaly, result.Anomalous,
+				result.Location, pings[i], result.ContentHash, result.ContentChanged)
+			if err != nil {
+				return fmt.Errorf("failed to insert result: %w", err)
+			}
+			if len(result.Body) > 0 {
+				_, err := tx.Exec(`INSERT INTO bodies (url, timestamp, data) VALUES (?, ?, ?)
+					ON CONFLICT (url, timestamp) DO UPDATE SET data = excluded.data`,
+					result.URL, result.Timestamp.UnixNano(), result.Body)
+				if err != nil {
+					return fmt.Errorf("failed to insert body: %w", err)
+				}
+			}
+			if h := (history{result.URL, result.Location}); !seen[h] {
+				seen[h] = true
+				histories = append(histories, h)
+			}
+		}
+		if limit <= 0 {
+			return nil
+		}
+
+		trimmed := make(map[string]bool)
+		for _, h := range histories {
+			_, err := tx.Exec(`DELETE FROM results WHERE url = ? AND location = ? AND id NOT IN (
+				SELECT id FROM results WHERE url = ? AND location = ? ORDER BY timestamp DESC, id DESC LIMIT ?)`,
+				h.url, h.location, h.url, h.location, limit)
+			if err != nil {
+				return fmt.Errorf("failed to trim results: %w", err)
+			}
+			trimmed[h.url] = true
+		}
+		for url := range trimmed {
+			_, err := tx.Exec(`DELETE FROM bodies WHERE url = ? AND timestamp NOT IN (SELECT timestamp FROM results WHERE url = ?)`,
+				url, url)
+			if err != nil {
+				return fmt.Errorf("failed to trim bodies: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) Results(url string, from, to time.Time) ([]EndpointResponseStored, error) {
+	query := `SELECT ` + sqliteResultColumns + ` FROM results WHERE url = ?`
+	args := []interface{}{url}
+	if !from.IsZero() {
+		query += ` AND timestamp >= ?`
+		args = append(args, from.UnixNano())
+	}
+	if !to.IsZero() {
+		query += ` AND timestamp <= ?`
+		args = append(args, to.UnixNano())
+	}
+	query += ` ORDER BY timestamp, id`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query results: %w", err)
+	}
+	defer rows.Close()
+
+	var results []EndpointResponseStored
+	for rows.Next() {
+		var result EndpointResponseStored
+		var timestamp, duration int64
+		var ping sql.NullString
+		err := rows.Scan(&result.URL, &result.Method, &result.Status, &result.Expected, &result.Error, &result.Category,
+			&timestamp, &duration, &result.BodyEncoding, &result.BodyHash, &result.BodySize, &result.BodyTruncated,
+			&result.Maintenance, &result.Flapping, &result.Degraded, &result.Anomaly, &result.Anomalous,
+			&result.Location, &ping, &result.ContentHash, &result.ContentChanged)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read result: %w", err)
+		}
+
+		result.Timestamp = time.Unix(0, timestamp)
+		result.Duration = time.Duration(duration)
+		if ping.Valid {
+			result.Ping = &PingPayload{}
+			if err := json.Unmarshal([]byte(ping.String), result.Ping); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal ping: %w", err)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+func (s *sqliteStore) Body(url string, timestamp time.Time) ([]byte, error) {
+	var body []byte
+	err := s.db.QueryRow(`SELECT data FROM bodies WHERE url = ? AND timestamp = ?`, url, timestamp.UnixNano()).Scan(&body)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	return body, nil
+}
+
+func (s *sqliteStore) URLs() ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT url FROM results ORDER BY url`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query endpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, fmt.Errorf("failed to read endpoint: %w", err)
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+func (s *sqliteStore) PutMeta(metas []EndpointMeta) error {
+	return s.transaction(func(tx *sql.Tx) error {
+		for _, meta := range metas {
+			labels, err := json.Marshal(meta.Labels)
+			if err != nil {
+				return fmt.Errorf("failed to marshal endpoint labels: %w", err)
+			}
+
+			_, err = tx.Exec(`INSERT INTO endpoint_meta (url, domain, labels, quorum) VALUES (?, ?, ?, ?)
+				ON CONFLICT (url) DO UPDATE SET domain = excluded.domain, labels = excluded.labels, quorum = excluded.quorum`,
+				meta.URL, meta.Domain, string(labels), meta.Quorum)
+			if err != nil {
+				return fmt.Errorf("failed to store endpoint metadata: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) DeleteMeta(urls []string) error {
+	return s.transaction(func(tx *sql.Tx) error {
+		for _, url := range urls {
+			if _, err := tx.Exec(`DELETE FROM endpoint_meta WHERE url = ?`, url); err != nil {
+				return fmt.Errorf("failed to delete endpoint metadata: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) Meta(url string) (EndpointMeta, bool, error) {
+	metas, err := s.queryMeta(`SELECT url, domain, labels, quorum FROM endpoint_meta WHERE url = ?`, url)
+	if err != nil || len(metas) == 0 {
+		return EndpointMeta{}, false, err
+	}
+	return metas[0], true, nil
+}
+
+func (s *sqliteStore) AllMeta() ([]EndpointMeta, error) {
+	return s.queryMeta(`SELECT url, domain, labels, quorum FROM endpoint_meta ORDER BY url`)
+}
+
+func (s *sqliteStore) queryMeta(query string, args ...interface{}) ([]EndpointMeta, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query endpoint metadata: %w", err)
+	}
+	defer rows.Close()
+
+	var metas []EndpointMeta
+	for rows.Next() {
+		var meta EndpointMeta
+		var labels string
+		if err := rows.Scan(&meta.URL, &meta.Domain, &labels, &meta.Quorum); err != nil {
+			return nil, fmt.Errorf("failed to read endpoint metadata: %w", err)
+		}
+		if err := json.Unmarshal([]byte(labels), &meta.Labels); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal endpoint labels: %w", err)
+		}
+		metas = append(metas, meta)
+	}
+	return metas, rows.Err()
+}
+
+func (s *sqliteStore) View(fn func(tx RecordTx) error) error {
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	return fn(sqliteTx{tx: tx, writable: false})
+}
+
+func (s *sqliteStore) Update(fn func(tx RecordTx) error) error {
+	return s.transaction(func(tx *sql.Tx) error {
+		return fn(sqliteTx{tx: tx, writable: true})
+	})
+}
+
+func (s *sqliteStore) transaction(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) SchemaVersion() (int, error) {
+	var tables int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'metadata'`).Scan(&tables)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if tables == 0 {
+		return 0, nil
+	}
+
+	var value string
+	err = s.db.QueryRow(`SELECT value FROM metadata WHERE key = ?`, schemaVersionKey).Scan(&value)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q: %w", value, err)
+	}
+	return version, nil
+}
+
+func (s *sqliteStore) PendingMigrations() ([]Migration, error) {
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	return pendingMigrations(version, s.migrations())
+}
+
+func (s *sqliteStore) Migrate() ([]Migration, error) {
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pendingMigrations(version, s.migrations()); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range sqliteMigrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		err := s.transaction(func(tx *sql.Tx) error {
+			if err := migration.up(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS metadata (key TEXT PRIMARY KEY, value TEXT NOT NULL)`)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(`INSERT INTO metadata (key, value) VALUES (?, ?)
+				ON CONFLICT (key) DO UPDATE SET value = excluded.value`, schemaVersionKey, strconv.Itoa(migration.Version))
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %d: %w", migration.Version, err)
+		}
+		applied = append(applied, migration.Migration)
+	}
+
+	return applied, nil
+}
+
+func (s *sqliteStore) migrations() []Migration {
+	migrations := make([]Migration, len(sqliteMigrations))
+	for i, migration := range sqliteMigrations {
+		migrations[i] = migration.Migration
+	}
+	return migrations
+}
+
+// Backup copies the database with VACUUM INTO, which reads it in a single
+// transaction, through a temporary file.
+func (s *sqliteStore) Backup(w io.Writer) error {
+	f, err := os.CreateTemp("", "cron-backup-*.sqlite")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := s.db.Exec(`VACUUM INTO ?`, f.Name()); err != nil {
+		return fmt.Errorf("failed to copy database: %w", err)
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+func checkBucket(bucket string) error {
+	if !contains(recordBuckets, bucket) {
+		return fmt.Errorf("unknown bucket %q", bucket)
+	}
+	return nil
+}
+
+// checkWritable rejects changes in a View, since SQLite does not enforce
+// read-only transactions itself.
+func (t sqliteTx) checkWritable(bucket string) error {
+	if !t.writable {
+		return fmt.Errorf("transaction is read-only")
+	}
+	return checkBucket(bucket)
+}
+
+func (t sqliteTx) NextID(bucket string) (uint64, error) {
+	if err := t.checkWritable(bucket); err != nil {
+		return 0, err
+	}
+
+	var id uint64
+	err := t.tx.QueryRow(`INSERT INTO sequences (bucket, value) VALUES (?, 1)
+		ON CONFLICT (bucket) DO UPDATE SET value = value + 1 RETURNING value`, bucket).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate ID: %w", err)
+	}
+	return id, nil
+}
+
+func (t sqliteTx) Put(bucket string, id uint64, data []byte) error {
+	if err := t.checkWritable(bucket); err != nil {
+		return err
+	}
+
+	_, err := t.tx.Exec(`INSERT INTO records (bucket, id, data) VALUES (?, ?, ?)
+		ON CONFLICT (bucket, id) DO UPDATE SET data = excluded.data`, bucket, int64(id), data)
+	if err != nil {
+		return fmt.Errorf("failed to store record: %w", err)
+	}
+	return nil
+}
+
+func (t sqliteTx) Get(bucket string, id uint64) ([]byte, error) {
+	if err := checkBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	err := t.tx.QueryRow(`SELECT data FROM records WHERE bucket = ? AND id = ?`, bucket, int64(id)).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read record: %w", err)
+	}
+	return data, nil
+}
+
+func (t sqliteTx) Delete(bucket string, id uint64) error {
+	if err := t.checkWritable(bucket); err != nil {
+		return err
+	}
+
+	if _, err := t.tx.Exec(`DELETE FROM records WHERE bucket = ? AND id = ?`, bucket, int64(id)); err != nil {
+		return fmt.Errorf("failed to delete record: %w", err)
+	}
+	return nil
+}
+
+func (t sqliteTx) ForEach(bucket string, fn func(id uint64, data []byte) error) error {
+	if err := checkBucket(bucket); err != nil {
+		return err
+	}
+
+	rows, err := t.tx.Query(`SELECT id, data FROM records WHERE bucket = ? ORDER BY id`, bucket)
+	if err != nil {
+		return fmt.Errorf("failed to query records: %w", err)
+	}
+
+	// The transaction has a single connection, so the rows are read before
+	// fn can run queries of its own.
+	type record struct {
+		id   uint64
+		data []byte
+	}
+	var records []record
+	for rows.Next() {
+		var r record
+		var id int64
+		if err := rows.Scan(&id, &r.data); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read record: %w", err)
+		}
+		r.id = uint64(id)
+		records = append(records, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read records: %w", err)
+	}
+
+	for _, r := range records {
+		if err := fn(r.id, r.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t sqliteTx) Count(bucket string) (int, error) {
+	if err := checkBucket(bucket); err != nil {
+		return 0, err
+	}
+
+	var count int
+	if err := t.tx.QueryRow(`SELECT COUNT(*) FROM records WHERE bucket = ?`, bucket).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count records: %w", err)
+	}
+	return count, nil
+}
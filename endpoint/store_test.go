@@ -0,0 +1,573 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestStoreConformance runs the same behaviour checks against every storage
+// driver.
+func TestStoreConformance(t *testing.T) {
+	drivers := []struct {
+		name string
+		open func(t *testing.T) Store
+	}{
+		{
+			name: StorageBolt,
+			open: func(t *testing.T) Store {
+				path := filepath.Join(t.TempDir(), "endpoints.db")
+				store, err := NewBoltStore(path, false)
+				if err != nil {
+					t.Fatalf("Failed to open store: %v", err)
+				}
+				if _, err := store.Migrate(); err != nil {
+					t.Fatalf("Failed to migrate store: %v", err)
+				}
+				return store
+			},
+		},
+		{
+			name: StorageSQLite,
+			open: func(t *testing.T) Store {
+				path := filepath.Join(t.TempDir(), "endpoints.sqlite")
+				store, err := NewSQLiteStore(path, false)
+				if err != nil {
+					t.Skipf("SQLite is unavailable: %v", err)
+				}
+				if _, err := store.Migrate(); err != nil {
+					t.Fatalf("Failed to migrate store: %v", err)
+				}
+				return store
+			},
+		},
+		{
+			name: StorageMemory,
+			open: func(t *testing.T) Store {
+				return NewMemoryStore()
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, store Store)
+	}{
+		{"results", testStoreResults},
+		{"result order and limit", testStoreResultOrder},
+		{"limit per location", testStoreResultLocations},
+		{"batched results", testStoreResultBatch},
+		{"result range", testStoreResultRange},
+		{"bodies", testStoreBodies},
+		{"endpoint metadata", testStoreMeta},
+		{"records", testStoreRecords},
+		{"keyed records", testStoreKeyedRecords},
+		{"failed update", testStoreFailedUpdate},
+		{"migrations", testStoreMigrations},
+	}
+
+	for _, driver := range drivers {
+		t.Run(driver.name, func(t *testing.T) {
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					store := driver.open(t)
+					defer store.Close()
+					tt.run(t, store)
+				})
+			}
+		})
+	}
+}
+
+func storedResult(url string, timestamp time.Time) EndpointResponseStored {
+	return EndpointResponseStored{
+		URL:       url,
+		Method:    "GET",
+		Status:    200,
+		Expected:  200,
+		Timestamp: timestamp,
+		Duration:  120 * time.Millisecond,
+	}
+}
+
+func testStoreResults(t *testing.T, store Store) {
+	now := time.Unix(1700000000, 0)
+	exitCode := 2
+	full := EndpointResponseStored{
+		URL:            "https://b.example.com",
+		Method:         "POST",
+		Status:         503,
+		Expected:       200,
+		Error:          "received error status code: 503",
+		Category:       CategoryStatus,
+		Timestamp:      now,
+		Duration:       1500 * time.Millisecond,
+		Body:           []byte("unavailable"),
+		BodyEncoding:   bodyIdentity,
+		BodyHash:       hashBody([]byte("unavailable")),
+		BodySize:       11,
+		BodyTruncated:  true,
+		Maintenance:    true,
+		Flapping:       true,
+		Degraded:       SeverityWarning,
+		Anomaly:        6.5,
+		Anomalous:      true,
+		Location:       "ams",
+		Ping:           &PingPayload{Kind: PingFail, ExitCode: &exitCode, Log: "exit status 2"},
+		ContentHash:    hashBody([]byte("unavailable")),
+		ContentChanged: true,
+	}
+	if err := store.AppendResult(full, 10); err != nil {
+		t.Fatalf("Failed to append result: %v", err)
+	}
+	if err := store.AppendResult(storedResult("https://a.example.com", now), 10); err != nil {
+		t.Fatalf("Failed to append result: %v", err)
+	}
+
+	results, err := store.Results(full.URL, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to read results: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+	got := results[0]
+	if !got.Timestamp.Equal(full.Timestamp) {
+		t.Errorf("Expected timestamp %v, got %v", full.Timestamp, got.Timestamp)
+	}
+	got.Timestamp = full.Timestamp
+	withoutBody := full
+	withoutBody.Body = nil
+	if !reflect.DeepEqual(got, withoutBody) {
+		t.Errorf("Expected %+v, got %+v", withoutBody, got)
+	}
+	if body, err := store.Body(full.URL, now); err != nil || string(body) != "unavailable" {
+		t.Errorf("Expected the body to be stored apart, got %q, %v", body, err)
+	}
+
+	missing, err := store.Results("https://missing.example.com", time.Time{}, time.Time{})
+	if err != nil || len(missing) != 0 {
+		t.Errorf("Expected no results for an unknown endpoint, got %v, %v", missing, err)
+	}
+
+	urls, err := store.URLs()
+	if err != nil {
+		t.Fatalf("Failed to list endpoints: %v", err)
+	}
+	want := []string{"https://a.example.com", "https://b.example.com"}
+	if !reflect.DeepEqual(urls, want) {
+		t.Errorf("Expected endpoints %v, got %v", want, urls)
+	}
+}
+
+func testStoreResultOrder(t *testing.T, store Store) {
+	url := "https://example.com"
+	base := time.Unix(1700000000, 0)
+
+	// The third result arrives late, as if buffered by a probe agent.
+	for _, offset := range []int{1, 3, 2, 4, 5} {
+		result := storedResult(url, base.Add(time.Duration(offset)*time.Minute))
+		result.Status = 200 + offset
+		if err := store.AppendResult(result, 4); err != nil {
+			t.Fatalf("Failed to append result: %v", err)
+		}
+	}
+
+	results, err := store.Results(url, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to read results: %v", err)
+	}
+	var statuses []int
+	for _, result := range results {
+		statuses = append(statuses, result.Status)
+	}
+	if want := []int{202, 203, 204, 205}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("Expected statuses %v, got %v", want, statuses)
+	}
+}
+
+func testStoreResultLocations(t *testing.T, store Store) {
+	url := "https://example.com"
+	base := time.Unix(1700000000, 0)
+
+	// The server checks once for every two probe checks; each location
+	// keeps its own latest results.
+	for i := 0; i < 6; i++ {
+		result := storedResult(url, base.Add(time.Duration(i)*time.Minute))
+		result.Location = "ams"
+		result.Body = []byte(fmt.Sprintf("ams %d", i))
+		result.BodyEncoding = bodyIdentity
+		if i%2 == 0 {
+			result.Location = ""
+		}
+		if err := store.AppendResult(result, 2); err != nil {
+			t.Fatalf("Failed to append result: %v", err)
+		}
+	}
+
+	results, err := store.Results(url, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to read results: %v", err)
+	}
+	var kept []string
+	for _, result := range results {
+		kept = append(kept, fmt.Sprintf("%s %d", result.Location, result.Timestamp.Sub(base)/time.Minute))
+	}
+	if want := []string{" 2", "ams 3", " 4", "ams 5"}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("Expected results %v, got %v", want, kept)
+	}
+	if body, _ := store.Body(url, base.Add(time.Minute)); body != nil {
+		t.Errorf("Expected the dropped result's body to be removed, got %q", body)
+	}
+}
+
+func testStoreResultBatch(t *testing.T, store Store) {
+	base := time.Unix(1700000000, 0)
+	if err := store.AppendResult(storedResult("https://a.example.com", base), 3); err != nil {
+		t.Fatalf("Failed to append result: %v", err)
+	}
+
+	// A batch spans endpoints and locations and arrives out of order; the
+	// limit applies to the stored and the appended results together.
+	var batch []EndpointResponseStored
+	for _, offset := range []int{3, 1, 4, 2} {
+		result := storedResult("https://a.example.com", base.Add(time.Duration(offset)*time.Minute))
+		result.Body = []byte(fmt.Sprintf("a %d", offset))
+		result.BodyEncoding = bodyIdentity
+		batch = append(batch, result)
+	}
+	other := storedResult("https://b.example.com", base)
+	other.Location = "ams"
+	batch = append(batch, other)
+	if err := store.AppendResults(batch, 3); err != nil {
+		t.Fatalf("Failed to append results: %v", err)
+	}
+
+	results, err := store.Results("https://a.example.com", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to read results: %v", err)
+	}
+	var kept []time.Duration
+	for _, result := range results {
+		kept = append(kept, result.Timestamp.Sub(base)/time.Minute)
+	}
+	if want := []time.Duration{2, 3, 4}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("Expected results %v, got %v", want, kept)
+	}
+	if body, _ := store.Body("https://a.example.com", base.Add(time.Minute)); body != nil {
+		t.Errorf("Expected the dropped result's body to be removed, got %q", body)
+	}
+	if body, _ := store.Body("https://a.example.com", base.Add(4*time.Minute)); string(body) != "a 4" {
+		t.Errorf("Expected the kept result's body, got %q", body)
+	}
+	if results, _ := store.Results("https://b.example.com", time.Time{}, time.Time{}); len(results) != 1 || results[0].Location != "ams" {
+		t.Errorf("Expected the other endpoint's result, got %+v", results)
+	}
+}
+
+func testStoreResultRange(t *testing.T, store Store) {
+	url := "https://example.com"
+	base := time.Unix(1700000000, 0)
+	for i := 0; i < 5; i++ {
+		if err := store.AppendResult(storedResult(url, base.Add(time.Duration(i)*time.Hour)), 10); err != nil {
+			t.Fatalf("Failed to append result: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     int
+	}{
+		{"open", time.Time{}, time.Time{}, 5},
+		{"from", base.Add(2 * time.Hour), time.Time{}, 3},
+		{"to", time.Time{}, base.Add(time.Hour), 2},
+		{"between", base.Add(time.Hour), base.Add(3 * time.Hour), 3},
+		{"empty", base.Add(10 * time.Hour), time.Time{}, 0},
+	}
+
+	for _, tt := range tests {
+		results, err := store.Results(url, tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("%s: failed to read results: %v", tt.name, err)
+		}
+		if len(results) != tt.want {
+			t.Errorf("%s: expected %d results, got %d", tt.name, tt.want, len(results))
+		}
+	}
+}
+
+func testStoreBodies(t *testing.T, store Store) {
+	url := "https://example.com"
+	base := time.Unix(1700000000, 0)
+	for i := 0; i < 4; i++ {
+		result := storedResult(url, base.Add(time.Duration(i)*time.Minute))
+		if i != 2 {
+			result.Body = []byte(fmt.Sprintf("body %d", i))
+			result.BodyEncoding = bodyIdentity
+		}
+		if err := store.AppendResult(result, 2); err != nil {
+			t.Fatalf("Failed to append result: %v", err)
+		}
+	}
+
+	for i, want := range []string{"", "", "", "body 3"} {
+		body, err := store.Body(url, base.Add(time.Duration(i)*time.Minute))
+		if err != nil {
+			t.Fatalf("Failed to read body: %v", err)
+		}
+		if string(body) != want {
+			t.Errorf("Body %d: expected %q, got %q", i, want, body)
+		}
+	}
+
+	// A result older than every kept one is dropped along with its body.
+	old := storedResult(url, base.Add(-time.Hour))
+	old.Body = []byte("old")
+	if err := store.AppendResult(old, 2); err != nil {
+		t.Fatalf("Failed to append result: %v", err)
+	}
+	if body, _ := store.Body(url, old.Timestamp); body != nil {
+		t.Errorf("Expected the dropped result's body to be removed, got %q", body)
+	}
+}
+
+func testStoreMeta(t *testing.T, store Store) {
+	metas := []EndpointMeta{
+		{URL: "https://b.example.com", Domain: "b", Labels: map[string]string{"env": "prod"}, Quorum: 2},
+		{URL: "https://a.example.com", Domain: "a"},
+	}
+	if err := store.PutMeta(metas); err != nil {
+		t.Fatalf("Failed to store metadata: %v", err)
+	}
+
+	updated := metas[1]
+	updated.Domain = "renamed"
+	if err := store.PutMeta([]EndpointMeta{updated}); err != nil {
+		t.Fatalf("Failed to update metadata: %v", err)
+	}
+
+	meta, found, err := store.Meta("https://b.example.com")
+	if err != nil || !found {
+		t.Fatalf("Expected metadata to be found, got %v, %v", found, err)
+	}
+	if !reflect.DeepEqual(meta, metas[0]) {
+		t.Errorf("Expected %+v, got %+v", metas[0], meta)
+	}
+
+	if _, found, err := store.Meta("https://missing.example.com"); err != nil || found {
+		t.Errorf("Expected no metadata for an unknown endpoint, got %v, %v", found, err)
+	}
+
+	all, err := store.AllMeta()
+	if err != nil {
+		t.Fatalf("Failed to list metadata: %v", err)
+	}
+	want := []EndpointMeta{updated, metas[0]}
+	if !reflect.DeepEqual(all, want) {
+		t.Errorf("Expected %+v, got %+v", want, all)
+	}
+
+	if err := store.DeleteMeta([]string{"https://a.example.com", "https://missing.example.com"}); err != nil {
+		t.Fatalf("Failed to delete metadata: %v", err)
+	}
+	all, err = store.AllMeta()
+	if err != nil || !reflect.DeepEqual(all, metas[:1]) {
+		t.Errorf("Expected %+v after deleting, got %+v, %v", metas[:1], all, err)
+	}
+}
+
+func testStoreRecords(t *testing.T, store Store) {
+	var ids []uint64
+	err := store.Update(func(tx RecordTx) error {
+		for _, data := range []string{`"one"`, `"two"`, `"three"`} {
+			id, err := tx.NextID(incidentBucket)
+			if err != nil {
+				return err
+			}
+			if err := tx.Put(incidentBucket, id, []byte(data)); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return tx.Delete(incidentBucket, ids[1])
+	})
+	if err != nil {
+		t.Fatalf("Failed to write records: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []uint64{1, 2, 3}) {
+		t.Errorf("Expected sequential IDs starting at 1, got %v", ids)
+	}
+
+	err = store.View(func(tx RecordTx) error {
+		data, err := tx.Get(incidentBucket, ids[0])
+		if err != nil {
+			return err
+		}
+		if string(data) != `"one"` {
+			t.Errorf("Expected record one, got %s", data)
+		}
+
+		if data, err := tx.Get(incidentBucket, ids[1]); err != nil || data != nil {
+			t.Errorf("Expected the deleted record to be gone, got %s, %v", data, err)
+		}
+
+		count, err := tx.Count(incidentBucket)
+		if err != nil {
+			return err
+		}
+		if count != 2 {
+			t.Errorf("Expected 2 records, got %d", count)
+		}
+
+		var visited []uint64
+		err = tx.ForEach(incidentBucket, func(id uint64, data []byte) error {
+			visited = append(visited, id)
+			return nil
+		})
+		if !reflect.DeepEqual(visited, []uint64{1, 3}) {
+			t.Errorf("Expected records 1 and 3 in order, got %v", visited)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to read records: %v", err)
+	}
+
+	if err := store.View(func(tx RecordTx) error {
+		return tx.Put(incidentBucket, 10, []byte(`"ten"`))
+	}); err == nil {
+		t.Errorf("Expected writing in a read-only transaction to fail")
+	}
+	if err := store.Update(func(tx RecordTx) error {
+		return tx.Put("unknown", 1, []byte(`"one"`))
+	}); err == nil {
+		t.Errorf("Expected writing to an unknown bucket to fail")
+	}
+
+	// IDs are not reused after a delete.
+	err = store.Update(func(tx RecordTx) error {
+		id, err := tx.NextID(incidentBucket)
+		if id != 4 {
+			t.Errorf("Expected the next ID to be 4, got %d", id)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to allocate ID: %v", err)
+	}
+}
+
+func testStoreKeyedRecords(t *testing.T, store Store) {
+	err := store.Update(func(tx RecordTx) error {
+		// Another key already holds the ID the key is derived to.
+		id, _, err := keyedRecordID(tx, baselineBucket, "b")
+		if err != nil {
+			return err
+		}
+		if err := putRecord(tx, baselineBucket, id, keyedRecord{Key: "a", Record: []byte(`"first"`)}); err != nil {
+			return err
+		}
+		return putKeyedRecord(tx, baselineBucket, "b", "second")
+	})
+	if err != nil {
+		t.Fatalf("Failed to store keyed records: %v", err)
+	}
+
+	store.View(func(tx RecordTx) error {
+		var b string
+		if found, err := getKeyedRecord(tx, baselineBucket, "b", &b); err != nil || !found || b != "second" {
+			t.Errorf("Expected the colliding key to be stored next to the other, got %q, %v, %v", b, found, err)
+		}
+		if found, err := getKeyedRecord(tx, baselineBucket, "c", &b); err != nil || found {
+			t.Errorf("Expected an unknown key not to be found, got %v, %v", found, err)
+		}
+		if count, _ := tx.Count(baselineBucket); count != 2 {
+			t.Errorf("Expected 2 records, got %d", count)
+		}
+		return nil
+	})
+}
+
+func testStoreFailedUpdate(t *testing.T, store Store) {
+	errAbort := errors.New("abort")
+	err := store.Update(func(tx RecordTx) error {
+		id, err := tx.NextID(silenceBucket)
+		if err != nil {
+			return err
+		}
+		if err := tx.Put(silenceBucket, id, []byte(`"kept"`)); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("Expected the update to fail with its error, got %v", err)
+	}
+
+	err = store.Update(func(tx RecordTx) error {
+		count, err := tx.Count(silenceBucket)
+		if count != 0 {
+			t.Errorf("Expected the failed update to be discarded, got %d records", count)
+		}
+		if err != nil {
+			return err
+		}
+
+		id, err := tx.NextID(silenceBucket)
+		if id != 1 {
+			t.Errorf("Expected the failed update's ID to be released, got %d", id)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to read records: %v", err)
+	}
+}
+
+func TestOpenStore(t *testing.T) {
+	tests := []struct {
+		driver   string
+		readOnly bool
+		wantErr  bool
+	}{
+		{StorageMemory, false, false},
+		{StorageMemory, true, true},
+		{"postgres", false, true},
+	}
+
+	for _, tt := range tests {
+		store, err := OpenStore(tt.driver, "", tt.readOnly)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("OpenStore(%q, %v) error = %v, wantErr %v", tt.driver, tt.readOnly, err, tt.wantErr)
+		}
+		if store != nil {
+			store.Close()
+		}
+		if err := (StorageConfig{Driver: tt.driver}).Validate(); (err != nil) != (tt.driver == "postgres") {
+			t.Errorf("Validate(%q) error = %v", tt.driver, err)
+		}
+	}
+}
+
+func testStoreMigrations(t *testing.T, store Store) {
+	pending, err := store.PendingMigrations()
+	if err != nil || len(pending) != 0 {
+		t.Errorf("Expected no pending migrations after migrating, got %v, %v", pending, err)
+	}
+
+	before, err := store.SchemaVersion()
+	if err != nil {
+		t.Fatalf("Failed to read schema version: %v", err)
+	}
+	applied, err := store.Migrate()
+	if err != nil || len(applied) != 0 {
+		t.Errorf("Expected migrating again to do nothing, got %v, %v", applied, err)
+	}
+	if after, _ := store.SchemaVersion(); after != before {
+		t.Errorf("Expected schema version %d to stay, got %d", before, after)
+	}
+}
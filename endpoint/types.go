@@ -1,6 +1,10 @@
 package endpoint
 
 import (
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"io"
 	"net/http"
 	"sync"
 	"time"
@@ -11,12 +15,25 @@ import (
 
 type EndpointRequest struct {
 	URL             string
+	Domain          string
+	Labels          map[string]string
 	Method          string
 	Timeout         time.Duration
 	Status          int
 	RetryAttempts   int
 	RetryDelay      time.Duration
 	ExpectedContent string
+	LatencyWarning  time.Duration
+	LatencyCritical time.Duration
+	DegradedAfter   int
+	AnomalyAfter    int
+	Quorum          int
+	BodyPolicy      string
+	BodyLimit       int
+	MaxBodySize     int64
+	DetectChanges   bool
+	IgnoreContent   []string
+	AlertOnChange   bool
 }
 
 type EndpointError struct {
@@ -25,62 +42,235 @@ type EndpointError struct {
 	Message    string
 }
 
+// EndpointResponse is the result of a check. BodyHash and BodySize describe
+// the body as read, at most MaxBodySize bytes, and BodyTruncated is set when
+// the response was longer.
 type EndpointResponse struct {
-	Endpoint  EndpointRequest
-	Status    int
-	Error     error
-	Timestamp time.Time
-	Duration  time.Duration
-	Body      string
+	Endpoint       EndpointRequest
+	Status         int
+	Error          error
+	Category       string
+	Timestamp      time.Time
+	Duration       time.Duration
+	Body           string
+	BodyHash       string
+	BodySize       int64
+	BodyTruncated  bool
+	BodyStored     bool
+	Maintenance    bool
+	Flapping       bool
+	Degraded       string
+	Anomaly        float64
+	Anomalous      bool
+	Location       string
+	Ping           *PingPayload
+	ContentHash    string
+	ContentChanged bool
 }
 
 type EndpointListResponse struct {
-	URLs []string `json:"urls"`
+	URLs      []string       `json:"urls"`
+	Endpoints []EndpointMeta `json:"endpoints"`
 }
 
 type EndpointStats struct {
-	TotalChecks      int     `json:"total_checks"`
-	SuccessfulChecks int     `json:"successful_checks"`
-	UpTimePercentage float64 `json:"uptime_percentage"`
-	AverageResponse  int64   `json:"average_response_ms"`
-	LastCheck        string  `json:"last_check"`
+	TotalChecks       int     `json:"total_checks"`
+	SuccessfulChecks  int     `json:"successful_checks"`
+	MaintenanceChecks int     `json:"maintenance_checks"`
+	DegradedChecks    int     `json:"degraded_checks"`
+	AnomalousChecks   int     `json:"anomalous_checks"`
+	UpTimePercentage  float64 `json:"uptime_percentage"`
+	AverageResponse   int64   `json:"average_response_ms"`
+	LastCheck         string  `json:"last_check"`
 }
 
+// EndpointResponseStored is a result as stored. Body is kept apart from the
+// results by each store, so reading the history does not load it, and
+// BodyEncoding is empty when no body is stored.
 type EndpointResponseStored struct {
-	URL       string
-	Method    string
-	Status    int
-	Expected  int
-	Error     string
-	Timestamp time.Time
-	Duration  time.Duration
-	Body      string
+	URL            string
+	Method         string
+	Status         int
+	Expected       int
+	Error          string
+	Category       string
+	Timestamp      time.Time
+	Duration       time.Duration
+	Body           []byte `json:"-"`
+	BodyEncoding   string
+	BodyHash       string
+	BodySize       int64
+	BodyTruncated  bool
+	Maintenance    bool
+	Flapping       bool
+	Degraded       string
+	Anomaly        float64
+	Anomalous      bool
+	Location       string
+	Ping           *PingPayload
+	ContentHash    string
+	ContentChanged bool
+}
+
+// ResponseBody is the stored body of a check, decompressed. Hash, Size and
+// Truncated describe the body as read; StoredSize and StoredTruncated what
+// the body policy kept of it.
+type ResponseBody struct {
+	Timestamp       time.Time
+	Data            []byte
+	Hash            string
+	Size            int64
+	Truncated       bool
+	StoredSize      int64
+	StoredTruncated bool
+}
+
+// ExportRecord is one check as exported as CSV or JSON Lines. Imports read
+// the same fields.
+type ExportRecord struct {
+	URL         string    `json:"url"`
+	Domain      string    `json:"domain,omitempty"`
+	Location    string    `json:"location,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+	Method      string    `json:"method,omitempty"`
+	Status      int       `json:"status"`
+	Expected    int       `json:"expected,omitempty"`
+	Up          bool      `json:"up"`
+	DurationMS  float64   `json:"duration_ms"`
+	Error       string    `json:"error,omitempty"`
+	Category    string    `json:"category,omitempty"`
+	Degraded    string    `json:"degraded,omitempty"`
+	Maintenance bool      `json:"maintenance,omitempty"`
+}
+
+// ExportFilter selects the endpoints and time range to export. Empty fields
+// match everything.
+type ExportFilter struct {
+	URLs     []string
+	Domain   string
+	Selector Selector
+	Since    time.Time
+	Until    time.Time
+}
+
+type ImportResult struct {
+	Imported   int `json:"imported"`
+	Duplicates int `json:"duplicates"`
+	// Dropped counts the checks older than the history kept of their
+	// endpoint and location.
+	Dropped int `json:"dropped"`
 }
 
 type HistoryResponse struct {
-	URL     string         `json:"url"`
-	History []HistoryEntry `json:"history"`
-	Stats   EndpointStats  `json:"stats"`
+	URL         string              `json:"url"`
+	Domain      string              `json:"domain,omitempty"`
+	Labels      map[string]string   `json:"labels,omitempty"`
+	Flapping    bool                `json:"flapping"`
+	State       string              `json:"state,omitempty"`
+	History     []HistoryEntry      `json:"history"`
+	Stats       EndpointStats       `json:"stats"`
+	Locations   []LocationStats     `json:"locations,omitempty"`
+	Maintenance []MaintenanceWindow `json:"maintenance,omitempty"`
+}
+
+type HistoryListResponse struct {
+	Selector  string            `json:"selector"`
+	Endpoints []HistoryResponse `json:"endpoints"`
+	Stats     DomainStats       `json:"stats"`
 }
 
 type HistoryEntry struct {
-	Status    int           `json:"status"`
-	Expected  int           `json:"expected"`
-	Error     string        `json:"error,omitempty"`
-	Timestamp time.Time     `json:"timestamp"`
-	Duration  time.Duration `json:"duration"`
+	Status         int           `json:"status"`
+	Expected       int           `json:"expected"`
+	Error          string        `json:"error,omitempty"`
+	Category       string        `json:"category,omitempty"`
+	Timestamp      time.Time     `json:"timestamp"`
+	Duration       time.Duration `json:"duration"`
+	Maintenance    bool          `json:"maintenance,omitempty"`
+	Flapping       bool          `json:"flapping,omitempty"`
+	Degraded       string        `json:"degraded,omitempty"`
+	Anomaly        float64       `json:"anomaly_score,omitempty"`
+	Anomalous      bool          `json:"anomalous,omitempty"`
+	Location       string        `json:"location,omitempty"`
+	Ping           *PingPayload  `json:"ping,omitempty"`
+	BodyHash       string        `json:"body_hash,omitempty"`
+	BodySize       int64         `json:"body_size,omitempty"`
+	BodyStored     bool          `json:"body_stored,omitempty"`
+	ContentHash    string        `json:"content_hash,omitempty"`
+	ContentChanged bool          `json:"content_changed,omitempty"`
 }
 
 type DomainRequest struct {
-    Domain    string           `json:"domain"`
-    Endpoints []EndpointRequest `json:"endpoints"`
+	Domain    string            `json:"domain"`
+	Endpoints []EndpointRequest `json:"endpoints"`
 }
 
 type DomainResponse struct {
-    Domain    string            `json:"domain"`
-    Endpoints []HistoryResponse `json:"endpoints"`
+	Domain    string            `json:"domain"`
+	Endpoints []HistoryResponse `json:"endpoints"`
+	Stats     DomainStats       `json:"stats"`
+}
+
+type DomainStats struct {
+	TotalChecks          int     `json:"total_checks"`
+	SuccessfulChecks     int     `json:"successful_checks"`
+	UpTimePercentage     float64 `json:"uptime_percentage"`
+	WorstEndpoint        string  `json:"worst_endpoint"`
+	WorstUpTime          float64 `json:"worst_uptime_percentage"`
+	EndpointsUp          int     `json:"endpoints_up"`
+	EndpointsDown        int     `json:"endpoints_down"`
+	EndpointsDegraded    int     `json:"endpoints_degraded"`
+	EndpointsMaintenance int     `json:"endpoints_in_maintenance"`
+	Status               string  `json:"status"`
+}
+
+type EndpointMeta struct {
+	URL    string            `json:"url"`
+	Domain string            `json:"domain"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Quorum int               `json:"quorum,omitempty"`
+}
+
+type LocationStats struct {
+	Location         string  `json:"location"`
+	TotalChecks      int     `json:"total_checks"`
+	SuccessfulChecks int     `json:"successful_checks"`
+	UpTimePercentage float64 `json:"uptime_percentage"`
+	AverageResponse  int64   `json:"average_response_ms"`
+	LastCheck        string  `json:"last_check"`
+	Up               bool    `json:"up"`
+}
+
+type LocationCheck struct {
+	State     string        `json:"state"`
+	Timestamp time.Time     `json:"timestamp"`
+	Duration  time.Duration `json:"duration"`
+	Error     string        `json:"error,omitempty"`
+}
+
+type EndpointLocationStatus struct {
+	URL       string                   `json:"url"`
+	Domain    string                   `json:"domain,omitempty"`
+	Labels    map[string]string        `json:"labels,omitempty"`
+	State     string                   `json:"state"`
+	Failing   int                      `json:"failing_locations"`
+	Required  int                      `json:"required_failures"`
+	Locations map[string]LocationCheck `json:"locations"`
+}
+
+type LocationStatusResponse struct {
+	Locations []string                 `json:"locations"`
+	Endpoints []EndpointLocationStatus `json:"endpoints"`
 }
 
+type SelectorRequirement struct {
+	Key      string
+	Operator string
+	Value    string
+}
+
+type Selector []SelectorRequirement
+
 // Configuration types
 type RetryConfig struct {
 	Attempts int
@@ -91,19 +281,773 @@ type RetryConfig struct {
 // Handler types
 type EndpointHandler struct {
 	client   *http.Client
-	db       *bbolt.DB
+	store    Store
 	histSize int
+	flap     FlapConfig
+	anomaly  AnomalyConfig
+	location string
+	slos     []SLO
+}
+
+// Storage types
+
+// Store persists check results, endpoint metadata and records. Every
+// implementation must pass the conformance suite in store_test.go.
+type Store interface {
+	// AppendResult inserts the result in timestamp order and keeps only the
+	// latest limit results of the endpoint from each location.
+	AppendResult(result EndpointResponseStored, limit int) error
+	// AppendResults appends several results in one transaction, as if each
+	// were passed to AppendResult in order.
+	AppendResults(results []EndpointResponseStored, limit int) error
+	// Results returns the endpoint's results from from up to and including
+	// to, oldest first. A zero time leaves that end of the range open.
+	Results(url string, from, to time.Time) ([]EndpointResponseStored, error)
+	// URLs lists the endpoints with stored results in order.
+	URLs() ([]string, error)
+	PutMeta(metas []EndpointMeta) error
+	// DeleteMeta removes the metadata of the endpoints, ignoring unknown
+	// ones. Their results are kept.
+	DeleteMeta(urls []string) error
+	Meta(url string) (EndpointMeta, bool, error)
+	AllMeta() ([]EndpointMeta, error)
+	// View and Update run fn in a read-only or read-write transaction over
+	// the records. Update discards every change when fn returns an error.
+	View(fn func(tx RecordTx) error) error
+	Update(fn func(tx RecordTx) error) error
+	// SchemaVersion returns the version of the stored data, 0 for a
+	// database created before it was versioned.
+	SchemaVersion() (int, error)
+	// PendingMigrations lists the migrations that have not been applied,
+	// in order. It fails when the database is newer than this build.
+	PendingMigrations() ([]Migration, error)
+	// Migrate applies the pending migrations, each in a transaction that
+	// also records the new version, and returns the ones it applied.
+	Migrate() ([]Migration, error)
+	// Body returns the body stored with the endpoint's result at timestamp,
+	// or nil when there is none. Bodies are removed with their results.
+	Body(url string, timestamp time.Time) ([]byte, error)
+	// Backup writes a consistent copy of the database to w.
+	Backup(w io.Writer) error
+	Close() error
+}
+
+// Migration describes one step of a driver's schema. Migrations run in
+// order of version and are never changed once released.
+type Migration struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+}
+
+type boltMigration struct {
+	Migration
+	up func(tx *bbolt.Tx) error
+}
+
+type sqliteMigration struct {
+	Migration
+	up func(tx *sql.Tx) error
+}
+
+// RecordTx reads and writes records: documents stored under a sequential ID
+// in a named bucket.
+type RecordTx interface {
+	NextID(bucket string) (uint64, error)
+	Put(bucket string, id uint64, data []byte) error
+	// Get returns nil when there is no record with the ID.
+	Get(bucket string, id uint64) ([]byte, error)
+	Delete(bucket string, id uint64) error
+	// ForEach visits the records of the bucket in ID order. The bucket must
+	// not be modified from fn.
+	ForEach(bucket string, fn func(id uint64, data []byte) error) error
+	Count(bucket string) (int, error)
+}
+
+type StorageConfig struct {
+	Driver string
+}
+
+// BackupConfig protects the admin API and schedules local snapshots. The
+// admin API is disabled without a token and snapshots without a directory.
+type BackupConfig struct {
+	AdminToken       string
+	SnapshotDir      string
+	SnapshotInterval time.Duration
+	SnapshotKeep     int
+}
+
+// Snapshotter saves a snapshot of the database every interval, keeping the
+// newest ones.
+type Snapshotter struct {
+	handler *EndpointHandler
+	config  BackupConfig
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// RestoreResult describes an installed backup.
+type RestoreResult struct {
+	Version  int    `json:"version"`
+	Previous string `json:"previous,omitempty"`
+}
+
+type boltStore struct {
+	db *bbolt.DB
+}
+
+type boltTx struct {
+	tx *bbolt.Tx
+}
+
+type sqliteStore struct {
+	db *sql.DB
+}
+
+type sqliteTx struct {
+	tx       *sql.Tx
+	writable bool
+}
+
+type memoryStore struct {
+	mu        sync.RWMutex
+	results   map[string][]EndpointResponseStored
+	bodies    map[string]map[int64][]byte
+	meta      map[string]EndpointMeta
+	records   map[string]map[uint64][]byte
+	sequences map[string]uint64
+}
+
+// memoryTx copies a bucket before its first change, so an Update that fails
+// leaves the store untouched.
+type memoryTx struct {
+	store     *memoryStore
+	writable  bool
+	records   map[string]map[uint64][]byte
+	sequences map[string]uint64
+}
+
+type FlapConfig struct {
+	Window int
+	Start  float64
+	Stop   float64
+}
+
+type AnomalyConfig struct {
+	MinSamples int
+	Threshold  float64
+	Seasonal   bool
+}
+
+// Probe types
+type Probe struct {
+	Location string
+	Token    string
+	Domains  []string
+	Selector Selector
+}
+
+type ProbeAssignment struct {
+	Location  string            `json:"location"`
+	Interval  time.Duration     `json:"interval"`
+	Endpoints []EndpointRequest `json:"endpoints"`
+}
+
+type ProbeResult struct {
+	URL           string        `json:"url"`
+	Status        int           `json:"status"`
+	Error         string        `json:"error,omitempty"`
+	Category      string        `json:"category,omitempty"`
+	Timestamp     time.Time     `json:"timestamp"`
+	Duration      time.Duration `json:"duration"`
+	Body          string        `json:"body,omitempty"`
+	BodyHash      string        `json:"body_hash,omitempty"`
+	BodySize      int64         `json:"body_size,omitempty"`
+	BodyTruncated bool          `json:"body_truncated,omitempty"`
+}
+
+type ProbeResultsResponse struct {
+	Accepted int `json:"accepted"`
+	Rejected int `json:"rejected"`
+	// Late counts the accepted results that were only stored.
+	Late int `json:"late"`
+}
+
+type ProbeStatus struct {
+	Location  string     `json:"location"`
+	Endpoints int        `json:"endpoints"`
+	LastSeen  *time.Time `json:"last_seen,omitempty"`
+}
+
+type AgentConfig struct {
+	ServerURL  string
+	Token      string
+	BatchSize  int
+	BufferSize int
+}
+
+type Agent struct {
+	handler    *EndpointHandler
+	config     AgentConfig
+	client     *http.Client
+	assignment ProbeAssignment
+	done       chan struct{}
+	wg         sync.WaitGroup
 }
 
 type Scheduler struct {
 	handler   *EndpointHandler
+	events    *Broadcaster
+	alerter   *Alerter
 	interval  time.Duration
 	endpoints []EndpointRequest
+	states    map[string]string
+	flapping  map[string]bool
+	degraded  map[string]int
+	anomalous map[string]int
+	burning   map[string]string
+	changes   map[string]string
+	probes    []Probe
+	lastSeen  map[string]time.Time
+	mu        sync.Mutex
 	done      chan struct{}
 	wg        sync.WaitGroup
 }
 
 type API struct {
-	handler *EndpointHandler
-	router  *mux.Router
+	handler    *EndpointHandler
+	scheduler  *Scheduler
+	router     *mux.Router
+	adminToken string
+}
+
+// Event types
+type Event struct {
+	ID        uint64            `json:"id"`
+	Type      string            `json:"type"`
+	URL       string            `json:"url"`
+	Domain    string            `json:"domain,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+	Data      interface{}       `json:"data"`
+}
+
+type FlapChange struct {
+	URL       string    `json:"url"`
+	Domain    string    `json:"domain,omitempty"`
+	Flapping  bool      `json:"flapping"`
+	State     string    `json:"state"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type StateChange struct {
+	URL       string    `json:"url"`
+	Domain    string    `json:"domain,omitempty"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Timestamp time.Time `json:"timestamp"`
+	Error     string    `json:"error,omitempty"`
+	Category  string    `json:"category,omitempty"`
+}
+
+type EventFilter struct {
+	URL      string
+	Domain   string
+	Selector Selector
+}
+
+type Broadcaster struct {
+	mu          sync.Mutex
+	nextID      uint64
+	backlog     []Event
+	backlogSize int
+	bufferSize  int
+	subscribers map[*Subscription]struct{}
+}
+
+type Subscription struct {
+	events chan Event
+	filter EventFilter
+}
+
+// ContentChange records a new version of an endpoint's content, as seen
+// from one location. The first version has no previous hash or diff.
+type ContentChange struct {
+	ID            uint64     `json:"id"`
+	URL           string     `json:"url"`
+	Domain        string     `json:"domain,omitempty"`
+	Location      string     `json:"location,omitempty"`
+	Timestamp     time.Time  `json:"timestamp"`
+	Hash          string     `json:"hash"`
+	PreviousHash  string     `json:"previous_hash,omitempty"`
+	PreviousAt    *time.Time `json:"previous_at,omitempty"`
+	Diff          string     `json:"diff,omitempty"`
+	DiffTruncated bool       `json:"diff_truncated,omitempty"`
+}
+
+// changeIndex lists the kept versions of an endpoint's content as seen from
+// one location, oldest first, with the normalized content of the latest one
+// to diff the next version against.
+type changeIndex struct {
+	IDs       []uint64  `json:"ids"`
+	Hash      string    `json:"hash"`
+	Timestamp time.Time `json:"timestamp"`
+	Content   string    `json:"content"`
+}
+
+type ContentChangeFilter struct {
+	URL   string
+	Since time.Time
+	Until time.Time
+}
+
+// Incident types
+type Incident struct {
+	ID             uint64             `json:"id"`
+	Domain         string             `json:"domain,omitempty"`
+	Status         string             `json:"status"`
+	StartedAt      time.Time          `json:"started_at"`
+	ResolvedAt     *time.Time         `json:"resolved_at,omitempty"`
+	Duration       time.Duration      `json:"duration"`
+	FirstError     string             `json:"first_error"`
+	Category       string             `json:"category"`
+	Endpoints      []IncidentEndpoint `json:"endpoints"`
+	Notes          []IncidentNote     `json:"notes"`
+	AcknowledgedAt *time.Time         `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string             `json:"acknowledged_by,omitempty"`
+}
+
+type IncidentEndpoint struct {
+	URL        string     `json:"url"`
+	StartedAt  time.Time  `json:"started_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	Error      string     `json:"error"`
+	Category   string     `json:"category"`
+}
+
+type IncidentNote struct {
+	Author    string    `json:"author"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type IncidentFilter struct {
+	URL    string
+	Domain string
+	Status string
+	Since  time.Time
+	Until  time.Time
+}
+
+type ReliabilityStats struct {
+	URL                  string  `json:"url"`
+	Incidents            int     `json:"incidents"`
+	Ongoing              bool    `json:"ongoing"`
+	TotalDowntimeSeconds float64 `json:"total_downtime_seconds"`
+	MTTRSeconds          float64 `json:"mttr_seconds"`
+	MTBFSeconds          float64 `json:"mtbf_seconds"`
+}
+
+type AcknowledgeRequest struct {
+	URL string `json:"url,omitempty"`
+	By  string `json:"by"`
+}
+
+// Maintenance types
+type MaintenanceWindow struct {
+	ID         uint64      `json:"id"`
+	Name       string      `json:"name"`
+	Mode       string      `json:"mode"`
+	Start      time.Time   `json:"start,omitempty"`
+	End        time.Time   `json:"end,omitempty"`
+	Recurrence *Recurrence `json:"recurrence,omitempty"`
+	URLs       []string    `json:"urls,omitempty"`
+	Domains    []string    `json:"domains,omitempty"`
+	Selector   Selector    `json:"selector,omitempty"`
+	Source     string      `json:"source"`
+}
+
+type Recurrence struct {
+	Weekdays []string `json:"weekdays,omitempty"`
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Timezone string   `json:"timezone,omitempty"`
+}
+
+type StatusResponse struct {
+	Status      string              `json:"status"`
+	Endpoints   []EndpointStatus    `json:"endpoints"`
+	Maintenance []MaintenanceWindow `json:"maintenance"`
+}
+
+type EndpointStatus struct {
+	URL          string             `json:"url"`
+	Domain       string             `json:"domain,omitempty"`
+	Labels       map[string]string  `json:"labels,omitempty"`
+	State        string             `json:"state"`
+	LastCheck    time.Time          `json:"last_check"`
+	LastDuration time.Duration      `json:"last_duration"`
+	UpTime       float64            `json:"uptime_percentage"`
+	Flapping     bool               `json:"flapping"`
+	Degraded     string             `json:"degraded,omitempty"`
+	Maintenance  *MaintenanceWindow `json:"maintenance,omitempty"`
+}
+
+// Heartbeat types
+type Heartbeat struct {
+	ID           uint64            `json:"id"`
+	Name         string            `json:"name"`
+	Token        string            `json:"token,omitempty"`
+	Domain       string            `json:"domain,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Period       time.Duration     `json:"period"`
+	Grace        time.Duration     `json:"grace"`
+	Source       string            `json:"source"`
+	CreatedAt    time.Time         `json:"created_at"`
+	LastPingAt   *time.Time        `json:"last_ping_at,omitempty"`
+	LastStartAt  *time.Time        `json:"last_start_at,omitempty"`
+	LastMissedAt *time.Time        `json:"last_missed_at,omitempty"`
+}
+
+type PingPayload struct {
+	Kind     string `json:"kind"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Log      string `json:"log,omitempty"`
+}
+
+// Notification types
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, alert Alert) error
+}
+
+type Alert struct {
+	Kind       string            `json:"kind"`
+	URL        string            `json:"url"`
+	Domain     string            `json:"domain,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Category   string            `json:"category,omitempty"`
+	Status     int               `json:"status"`
+	Duration   time.Duration     `json:"duration"`
+	Error      string            `json:"error,omitempty"`
+	Degraded   string            `json:"degraded,omitempty"`
+	Anomaly    float64           `json:"anomaly_score,omitempty"`
+	Timestamp  time.Time         `json:"timestamp"`
+	HistoryURL string            `json:"history_url,omitempty"`
+	// Resolves is the kind of alert a recovery ends, down when unset.
+	Resolves string `json:"resolves,omitempty"`
+}
+
+type Alerter struct {
+	mu        sync.Mutex
+	publicURL string
+	notifiers []Notifier
+	routing   RoutingConfig
+	outages   map[string]*outage // by outageKey
+	silences  silenceLookup
+
+	// queue holds the work enqueued for the background sender, which runs
+	// it in order while sending is set.
+	queueMu sync.Mutex
+	queue   []func()
+	sending bool
+	idle    *sync.Cond
+}
+
+// silenceLookup finds the silence muting an alert, if any.
+type silenceLookup interface {
+	ActiveSilence(alert Alert, at time.Time) (*Silence, error)
+}
+
+// Silence types
+type Silence struct {
+	ID        uint64    `json:"id"`
+	URLs      []string  `json:"urls,omitempty"`
+	Domains   []string  `json:"domains,omitempty"`
+	Selector  Selector  `json:"selector,omitempty"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	CreatedBy string    `json:"created_by"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Status    string    `json:"status,omitempty"`
+}
+
+// Routing types
+type RoutingConfig struct {
+	Routes      []Route            `json:"routes"`
+	Escalations []EscalationPolicy `json:"escalations,omitempty"`
+}
+
+type Route struct {
+	Name       string        `json:"name"`
+	Domains    []string      `json:"domains,omitempty"`
+	Selector   Selector      `json:"selector,omitempty"`
+	Categories []string      `json:"categories,omitempty"`
+	Severities []string      `json:"severities,omitempty"`
+	Channels   []string      `json:"channels,omitempty"`
+	Escalation string        `json:"escalation,omitempty"`
+	Repeat     time.Duration `json:"repeat,omitempty"`
+	QuietHours []Recurrence  `json:"quiet_hours,omitempty"`
+	Continue   bool          `json:"continue,omitempty"`
+}
+
+type EscalationPolicy struct {
+	Name  string           `json:"name"`
+	Steps []EscalationStep `json:"steps"`
+}
+
+type EscalationStep struct {
+	After    time.Duration `json:"after"`
+	Channels []string      `json:"channels"`
+}
+
+type RoutingPlan struct {
+	Alert    Alert       `json:"alert"`
+	Severity string      `json:"severity"`
+	Default  bool        `json:"default"`
+	Routes   []RoutePlan `json:"routes"`
+}
+
+type RoutePlan struct {
+	Route  string           `json:"route"`
+	Steps  []EscalationStep `json:"steps"`
+	Repeat time.Duration    `json:"repeat,omitempty"`
+	Quiet  bool             `json:"quiet"`
+}
+
+type ActiveAlert struct {
+	Alert          Alert      `json:"alert"`
+	StartedAt      time.Time  `json:"started_at"`
+	Routes         []string   `json:"routes"`
+	Channels       []string   `json:"channels"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+}
+
+type outage struct {
+	alert          Alert
+	started        time.Time
+	acknowledgedAt *time.Time
+	acknowledgedBy string
+	routes         []*routeState
+	// silencedAt is when the current silence of the outage was first seen,
+	// and paused how long earlier silences held back its escalation.
+	silencedAt *time.Time
+	paused     time.Duration
+}
+
+type routeState struct {
+	route    Route
+	steps    []EscalationStep
+	fired    int
+	notified map[string]bool
+	lastSent time.Time
+}
+
+type NotifierConfig struct {
+	PublicURL string
+	Slack     *SlackConfig
+	Discord   *DiscordConfig
+	Email     *EmailConfig
+	PagerDuty *PagerDutyConfig
+	Opsgenie  *OpsgenieConfig
+}
+
+type SlackConfig struct {
+	Token   string
+	Channel string
+	BaseURL string
+}
+
+type SlackNotifier struct {
+	config  SlackConfig
+	client  *http.Client
+	mu      sync.Mutex
+	threads map[string]string
+}
+
+type slackMessage struct {
+	Channel        string       `json:"channel"`
+	Text           string       `json:"text"`
+	Blocks         []slackBlock `json:"blocks"`
+	ThreadTS       string       `json:"thread_ts,omitempty"`
+	ReplyBroadcast bool         `json:"reply_broadcast,omitempty"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Fields   []slackText `json:"fields,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	TS    string `json:"ts"`
+	Error string `json:"error"`
+}
+
+type DiscordConfig struct {
+	WebhookURL string
+	Username   string
+}
+
+type DiscordNotifier struct {
+	config DiscordConfig
+	client *http.Client
+}
+
+type discordMessage struct {
+	Username string         `json:"username,omitempty"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	URL         string         `json:"url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Timestamp   string         `json:"timestamp"`
+	Fields      []discordField `json:"fields"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type EmailConfig struct {
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	From       string
+	To         []string
+	Domains    map[string]EmailRoute
+	Digest     time.Duration
+	RequireTLS bool
+	RootCAs    *x509.CertPool
+}
+
+type EmailRoute struct {
+	From string
+	To   []string
+}
+
+type EmailNotifier struct {
+	config  EmailConfig
+	mu      sync.Mutex
+	pending map[string]*emailBatch
+}
+
+type emailBatch struct {
+	route  EmailRoute
+	alerts []Alert
+}
+
+type PagerDutyConfig struct {
+	RoutingKey string
+	BaseURL    string
+}
+
+type PagerDutyNotifier struct {
+	config PagerDutyConfig
+	client *http.Client
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+	Links       []pagerDutyLink   `json:"links,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+type OpsgenieConfig struct {
+	APIKey   string
+	BaseURL  string
+	Priority string
+}
+
+type OpsgenieNotifier struct {
+	config OpsgenieConfig
+	client *http.Client
+}
+
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Source      string            `json:"source"`
+	Entity      string            `json:"entity,omitempty"`
+	Priority    string            `json:"priority"`
+	Tags        []string          `json:"tags,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+type opsgenieClose struct {
+	Source string `json:"source"`
+	Note   string `json:"note,omitempty"`
+}
+
+// SLO types
+type SLO struct {
+	Name             string        `json:"name"`
+	Kind             string        `json:"kind"`
+	Objective        float64       `json:"objective"`
+	Window           time.Duration `json:"window"`
+	LatencyThreshold time.Duration `json:"latency_threshold,omitempty"`
+	URLs             []string      `json:"urls,omitempty"`
+	Domains          []string      `json:"domains,omitempty"`
+	Selector         Selector      `json:"selector,omitempty"`
+}
+
+type SLOStatus struct {
+	SLO
+	Endpoints       []string      `json:"endpoints"`
+	TotalChecks     int           `json:"total_checks"`
+	GoodChecks      int           `json:"good_checks"`
+	Attainment      float64       `json:"attainment"`
+	BudgetRemaining float64       `json:"error_budget_remaining"`
+	Coverage        time.Duration `json:"coverage"`
+	BurnRates       []BurnRate    `json:"burn_rates"`
+	Burn            string        `json:"burn,omitempty"`
+}
+
+type BurnRate struct {
+	Window time.Duration `json:"window"`
+	Rate   float64       `json:"rate"`
+}
+
+type burnAlert struct {
+	name      string
+	long      time.Duration
+	short     time.Duration
+	threshold float64
+}
+
+type sloCheck struct {
+	timestamp time.Time
+	good      bool
 }
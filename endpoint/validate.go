@@ -0,0 +1,98 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// ValidateConfig checks the configuration in config.go without opening the
+// database, returning every problem found. The retention is how far back the
+// server's stored history reaches, which bounds SLO windows.
+func ValidateConfig(retention time.Duration) error {
+	var errs []error
+
+	seen := make(map[string]bool)
+	for _, endpoint := range ConfiguredEndpoints(DOMAIN_CONFIG) {
+		if err := endpoint.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("endpoint %q: %w", endpoint.URL, err))
+		}
+		if seen[endpoint.URL] {
+			errs = append(errs, fmt.Errorf("endpoint %q: configured more than once", endpoint.URL))
+		}
+		seen[endpoint.URL] = true
+	}
+
+	for _, window := range MAINTENANCE_CONFIG {
+		if err := window.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("maintenance window %q: %w", window.Name, err))
+		}
+	}
+	for _, hb := range HEARTBEAT_CONFIG {
+		if err := hb.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("heartbeat %q: %w", hb.Name, err))
+		}
+	}
+
+	slos := append([]SLO(nil), SLO_CONFIG...)
+	if err := validateSLOs(slos, retention); err != nil {
+		errs = append(errs, err)
+	}
+
+	routing := ROUTING_CONFIG
+	routing.Routes = append([]Route(nil), routing.Routes...)
+	var channels []string
+	for _, notifier := range NOTIFIER_CONFIG.Notifiers() {
+		channels = append(channels, notifier.Name())
+	}
+	if err := routing.Validate(channels); err != nil {
+		errs = append(errs, fmt.Errorf("routing: %w", err))
+	}
+
+	if err := validateProbes(PROBE_CONFIG); err != nil {
+		errs = append(errs, err)
+	}
+	if err := STORAGE_CONFIG.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("storage: %w", err))
+	}
+	if err := BACKUP_CONFIG.Validate(STORAGE_CONFIG.Driver); err != nil {
+		errs = append(errs, fmt.Errorf("backup: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate checks that the endpoint can be probed and its thresholds make
+// sense.
+func (e EndpointRequest) Validate() error {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https url")
+	}
+	if e.Timeout < 0 || e.RetryAttempts < 0 || e.RetryDelay < 0 {
+		return errors.New("timeout and retries must not be negative")
+	}
+	if e.LatencyWarning > 0 && e.LatencyCritical > 0 && e.LatencyWarning > e.LatencyCritical {
+		return errors.New("latency warning threshold must not exceed the critical one")
+	}
+	if e.DegradedAfter < 0 || e.AnomalyAfter < 0 || e.Quorum < 0 {
+		return errors.New("degraded after, anomaly after and quorum must not be negative")
+	}
+	if e.BodyPolicy != "" && !contains(bodyPolicies, e.BodyPolicy) {
+		return fmt.Errorf("unknown body policy %q, expected one of %v", e.BodyPolicy, bodyPolicies)
+	}
+	if e.BodyLimit < 0 || e.MaxBodySize < 0 {
+		return errors.New("body limit and max body size must not be negative")
+	}
+	if !e.DetectChanges && (len(e.IgnoreContent) > 0 || e.AlertOnChange) {
+		return errors.New("ignore content and alert on change require detect changes")
+	}
+	if _, err := compileIgnoreContent(e.IgnoreContent); err != nil {
+		return err
+	}
+	return nil
+}
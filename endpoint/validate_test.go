@@ -0,0 +1,85 @@
+package endpoint
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEndpointValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint EndpointRequest
+		wantErr  bool
+	}{
+		{"valid", EndpointRequest{URL: "https://onplug.io", Timeout: 5 * time.Second}, false},
+		{"relative url", EndpointRequest{URL: "onplug.io"}, true},
+		{"unsupported scheme", EndpointRequest{URL: "ftp://onplug.io"}, true},
+		{"negative timeout", EndpointRequest{URL: "https://onplug.io", Timeout: -time.Second}, true},
+		{"thresholds out of order", EndpointRequest{URL: "https://onplug.io", LatencyWarning: 5 * time.Second, LatencyCritical: time.Second}, true},
+		{"negative quorum", EndpointRequest{URL: "https://onplug.io", Quorum: -1}, true},
+		{"change detection", EndpointRequest{URL: "https://onplug.io", DetectChanges: true, IgnoreContent: []string{`nonce="\w+"`}, AlertOnChange: true}, false},
+		{"ignore content without change detection", EndpointRequest{URL: "https://onplug.io", IgnoreContent: []string{`\d+`}}, true},
+		{"alert on change without change detection", EndpointRequest{URL: "https://onplug.io", AlertOnChange: true}, true},
+		{"invalid ignore content", EndpointRequest{URL: "https://onplug.io", DetectChanges: true, IgnoreContent: []string{`(`}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.endpoint.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	if err := ValidateConfig(24 * time.Hour); err != nil {
+		t.Errorf("Expected the shipped configuration to be valid, got %v", err)
+	}
+}
+
+func TestOpenEndpointHandler(t *testing.T) {
+	tmpDB := filepath.Join(t.TempDir(), "endpoints.db")
+
+	// Only bbolt locks the database against other processes.
+	defer func(config StorageConfig) { STORAGE_CONFIG = config }(STORAGE_CONFIG)
+	STORAGE_CONFIG = StorageConfig{Driver: StorageBolt}
+
+	handler, err := NewEndpointHandler(tmpDB, 10)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	endpoint := EndpointRequest{URL: "https://test.com", Domain: "test", Status: http.StatusOK}
+	handler.RegisterEndpoints([]EndpointRequest{endpoint})
+	handler.storeResponse(EndpointResponse{Endpoint: endpoint, Status: http.StatusOK, Timestamp: time.Now()})
+
+	if _, err := OpenEndpointHandler(tmpDB); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("Expected a database in use to be refused, got %v", err)
+	}
+	handler.Close()
+
+	readOnly, err := OpenEndpointHandler(tmpDB)
+	if err != nil {
+		t.Fatalf("Failed to open database read-only: %v", err)
+	}
+	defer readOnly.Close()
+
+	response, err := readOnly.GetHistoryResponse(endpoint.URL)
+	if err != nil || response == nil {
+		t.Fatalf("Expected history, got %v", err)
+	}
+	if response.Domain != "test" || response.Stats.TotalChecks != 1 {
+		t.Errorf("Expected the stored history, got %+v", response)
+	}
+	if err := readOnly.RegisterEndpoints([]EndpointRequest{endpoint}); err == nil {
+		t.Error("Expected writes to a read-only database to fail")
+	}
+
+	if _, err := OpenEndpointHandler(filepath.Join(t.TempDir(), "missing.db")); err == nil {
+		t.Error("Expected a missing database to be refused")
+	}
+}
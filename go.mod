@@ -4,7 +4,7 @@ go 1.23.1
 
 require (
 	github.com/gorilla/mux v1.8.1
+	github.com/mattn/go-sqlite3 v1.14.33
 	go.etcd.io/bbolt v1.3.11
+	golang.org/x/sys v0.4.0
 )
-
-require golang.org/x/sys v0.4.0 // indirect
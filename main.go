@@ -1,65 +1,69 @@
 package main
 
 import (
-	"context"
-	"log"
-	"net/http"
+	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
-	"terminally-online/cron/endpoint"
-	"time"
+	"strings"
 )
 
-func main() {
-	handler, err := endpoint.NewEndpointHandler("endpoints.db", 48)
-	if err != nil {
-		log.Fatalf("Failed to create endpoint handler: %v", err)
-	}
-	defer handler.Close()
+// Exit codes reported to scripts: a failed check or invalid configuration
+// exits with exitFailure, anything that kept the command from running with
+// exitError.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitError   = 2
+)
 
-	api := endpoint.NewAPI(handler)
+var commands = map[string]func(args []string) int{
+	"serve":           serve,
+	"agent":           agent,
+	"check":           check,
+	"list":            list,
+	"history":         history,
+	"top":             top,
+	"migrations":      migrations,
+	"restore":         restore,
+	"export":          export,
+	"import":          importHistory,
+	"validate-config": validateConfig,
+}
 
-	var endpoints []endpoint.EndpointRequest
-	for _, domain := range endpoint.DOMAIN_CONFIG {
-		endpoints = append(endpoints, domain.Endpoints...)
-	}
+const usage = `Usage: cron <command> [flags]
 
-	scheduler := endpoint.NewScheduler(
-		handler,
-		30*time.Minute,
-		endpoints,
-	)
+Commands:
+  serve            Run the server (default)
+  agent            Run a probe agent reporting to a server
+  check [url...]   Check endpoints once and print the results
+  list             List the endpoints stored in a database
+  history <url>    Print the stored history of an endpoint
+  top              Show a live dashboard of endpoint status
+  validate-config  Validate the configuration
+  migrations       List the migrations pending for a database
+  restore <backup> Replace a database with a backup
+  export [url...]  Export stored checks as CSV or JSON Lines
+  import <file>    Import checks from CSV or JSON Lines
 
-	scheduler.Start()
+Run cron <command> -h for the flags of a command.
+`
 
-	srv := &http.Server{
-		Handler:      api,
-		Addr:         ":8080",
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+func main() {
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
 
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
-
-	go func() {
-		log.Printf("Starting server on :8080")
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Error starting server: %v", err)
-		}
-	}()
-
-	<-stop
-	log.Println("Shutting down...")
-
-	scheduler.Stop()
+	if command == "help" {
+		fmt.Print(usage)
+		os.Exit(exitOK)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Printf("Error shutting down server: %v", err)
+	run, ok := commands[command]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", command)
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitError)
 	}
 
-	log.Println("Shutdown complete")
+	os.Exit(run(args))
 }
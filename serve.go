@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"terminally-online/cron/endpoint"
+	"time"
+)
+
+func serve(args []string) int {
+	addr := ":8080"
+	if port := os.Getenv("PORT"); port != "" {
+		addr = ":" + port
+	}
+
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	dbPath := flags.String("db", "endpoints.db", "path to the database")
+	flags.StringVar(&addr, "addr", addr, "address to listen on")
+	interval := flags.Duration("interval", 30*time.Minute, "how often endpoints are checked")
+	histSize := flags.Int("history", 48, "number of checks kept per endpoint and location")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	handler, err := endpoint.NewEndpointHandler(*dbPath, *histSize)
+	if err != nil {
+		log.Printf("Failed to create endpoint handler: %v", err)
+		return exitError
+	}
+	defer handler.Close()
+
+	endpoints := endpoint.ConfiguredEndpoints(endpoint.DOMAIN_CONFIG)
+	if err := handler.RegisterEndpoints(endpoints); err != nil {
+		log.Printf("Failed to register endpoints: %v", err)
+		return exitError
+	}
+	if err := handler.RegisterMaintenanceWindows(endpoint.MAINTENANCE_CONFIG); err != nil {
+		log.Printf("Failed to register maintenance windows: %v", err)
+		return exitError
+	}
+	if err := handler.RegisterHeartbeats(endpoint.HEARTBEAT_CONFIG); err != nil {
+		log.Printf("Failed to register heartbeats: %v", err)
+		return exitError
+	}
+	if err := handler.RegisterSLOs(endpoint.SLO_CONFIG, time.Duration(*histSize)*(*interval)); err != nil {
+		log.Printf("Invalid SLO configuration: %v", err)
+		return exitError
+	}
+
+	scheduler := endpoint.NewScheduler(
+		handler,
+		*interval,
+		endpoints,
+	)
+
+	for _, notifier := range endpoint.NOTIFIER_CONFIG.Notifiers() {
+		scheduler.Alerter().Register(notifier)
+		log.Printf("Sending alerts via %s", notifier.Name())
+	}
+	if err := scheduler.Alerter().SetRouting(endpoint.ROUTING_CONFIG); err != nil {
+		log.Printf("Invalid alert routing: %v", err)
+		return exitError
+	}
+	if err := scheduler.SetProbes(endpoint.PROBE_CONFIG); err != nil {
+		log.Printf("Invalid probe configuration: %v", err)
+		return exitError
+	}
+
+	backup := endpoint.BACKUP_CONFIG
+	if backup.SnapshotDir != "" {
+		if err := backup.Validate(endpoint.STORAGE_CONFIG.Driver); err != nil {
+			log.Printf("Invalid snapshot configuration: %v", err)
+			return exitError
+		}
+	}
+
+	api := endpoint.NewAPI(handler, scheduler)
+
+	scheduler.Start()
+
+	if backup.SnapshotDir != "" {
+		snapshotter := endpoint.NewSnapshotter(handler, backup)
+		snapshotter.Start()
+		defer snapshotter.Stop()
+	}
+
+	srv := &http.Server{
+		Handler:      api,
+		Addr:         addr,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	failed := make(chan error, 1)
+	go func() {
+		log.Printf("Starting server on %s", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			failed <- err
+		}
+	}()
+
+	code := exitOK
+	select {
+	case <-stop:
+	case err := <-failed:
+		log.Printf("Error starting server: %v", err)
+		code = exitError
+	}
+	log.Println("Shutting down...")
+
+	scheduler.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+
+	log.Println("Shutdown complete")
+	return code
+}
+
+// agent runs a probe agent that checks the endpoints assigned to it by the
+// server and reports the results back.
+func agent(args []string) int {
+	config := endpoint.AGENT_CONFIG
+	dbPath := os.Getenv("CRON_AGENT_DB")
+	if dbPath == "" {
+		dbPath = "agent.db"
+	}
+
+	flags := flag.NewFlagSet("agent", flag.ContinueOnError)
+	flags.StringVar(&dbPath, "db", dbPath, "path to the database buffering results")
+	flags.StringVar(&config.ServerURL, "server", config.ServerURL, "URL of the server to report to")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if config.ServerURL == "" || config.Token == "" {
+		log.Printf("A server URL and CRON_PROBE_TOKEN are required to run an agent")
+		return exitError
+	}
+
+	handler, err := endpoint.NewEndpointHandler(dbPath, 1)
+	if err != nil {
+		log.Printf("Failed to create endpoint handler: %v", err)
+		return exitError
+	}
+	defer handler.Close()
+
+	probe := endpoint.NewAgent(handler, config)
+	probe.Start()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	log.Println("Shutting down...")
+	probe.Stop()
+	log.Println("Shutdown complete")
+	return exitOK
+}
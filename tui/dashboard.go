@@ -0,0 +1,371 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"terminally-online/cron/endpoint"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	clearScreen = "\x1b[H\x1b[2J"
+	enterScreen = "\x1b[?1049h\x1b[?25l"
+	leaveScreen = "\x1b[?25h\x1b[?1049l"
+	reverse     = "\x1b[7m"
+	reset       = "\x1b[0m"
+)
+
+var stateColors = map[string]string{
+	endpoint.StateUp:          "\x1b[32m",
+	endpoint.StateDown:        "\x1b[31m",
+	endpoint.StateDegraded:    "\x1b[33m",
+	endpoint.StateMaintenance: "\x1b[34m",
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// Dashboard holds the state of the interactive view: the latest rows, the
+// domain filter and the selected endpoint.
+type Dashboard struct {
+	source   Source
+	rows     []Row
+	err      error
+	updated  time.Time
+	filter   string
+	input    *string
+	selected int
+	message  string
+}
+
+type checkDone struct {
+	url   string
+	entry endpoint.HistoryEntry
+	err   error
+}
+
+func NewDashboard(source Source, filter string) *Dashboard {
+	return &Dashboard{source: source, filter: filter}
+}
+
+// Run shows the dashboard until the user quits, refreshing at the interval.
+// When either side is not a terminal the rows are printed once as a plain
+// table instead.
+func Run(ctx context.Context, source Source, filter string, interval time.Duration, in, out *os.File) error {
+	if !isTerminal(in.Fd()) || !isTerminal(out.Fd()) {
+		return PrintTable(ctx, source, filter, out)
+	}
+
+	restore, err := makeRaw(in.Fd())
+	if err != nil {
+		return fmt.Errorf("failed to configure terminal: %w", err)
+	}
+	defer restore()
+
+	fmt.Fprint(out, enterScreen)
+	defer fmt.Fprint(out, leaveScreen)
+
+	keys := make(chan []byte)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := in.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+
+	d := NewDashboard(source, filter)
+	checks := make(chan checkDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	d.Refresh(ctx)
+	for {
+		width, height := size(out.Fd())
+		fmt.Fprint(out, d.Render(width, height))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			d.Refresh(ctx)
+		case done := <-checks:
+			d.checked(done)
+			d.Refresh(ctx)
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			switch d.HandleKey(key) {
+			case actionQuit:
+				return nil
+			case actionRefresh:
+				d.Refresh(ctx)
+			case actionCheck:
+				url := d.Selected().URL
+				d.message = "Checking " + url + "..."
+				go func() {
+					entry, err := source.CheckNow(ctx, url)
+					checks <- checkDone{url: url, entry: entry, err: err}
+				}()
+			}
+		}
+	}
+}
+
+// PrintTable prints the endpoints once, for output that is not a terminal.
+func PrintTable(ctx context.Context, source Source, filter string, out io.Writer) error {
+	d := NewDashboard(source, filter)
+	d.Refresh(ctx)
+	if d.err != nil {
+		return d.err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STATE\tURL\tDOMAIN\tLATENCY\tUPTIME\tTREND")
+	for _, row := range d.Visible() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.2f%%\t%s\n", row.State, row.URL, row.Domain,
+			row.LastDuration.Round(time.Millisecond), row.UpTime, Sparkline(row.Durations, 20))
+	}
+	return w.Flush()
+}
+
+// Refresh reloads the rows from the source, keeping the previous rows when
+// it fails.
+func (d *Dashboard) Refresh(ctx context.Context) {
+	rows, err := d.source.Rows(ctx)
+	d.err = err
+	if err != nil {
+		return
+	}
+	d.rows = rows
+	d.updated = time.Now()
+	d.clampSelection()
+}
+
+// Visible returns the rows whose domain or URL contain the filter.
+func (d *Dashboard) Visible() []Row {
+	if d.filter == "" {
+		return d.rows
+	}
+
+	filter := strings.ToLower(d.filter)
+	var rows []Row
+	for _, row := range d.rows {
+		if strings.Contains(strings.ToLower(row.Domain), filter) || strings.Contains(strings.ToLower(row.URL), filter) {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// Selected returns the highlighted row, or an empty row when none is shown.
+func (d *Dashboard) Selected() Row {
+	rows := d.Visible()
+	if d.selected < 0 || d.selected >= len(rows) {
+		return Row{}
+	}
+	return rows[d.selected]
+}
+
+type action int
+
+const (
+	actionNone action = iota
+	actionQuit
+	actionRefresh
+	actionCheck
+)
+
+// HandleKey applies a key press read from the terminal and returns what the
+// caller should do next.
+func (d *Dashboard) HandleKey(key []byte) action {
+	if d.input != nil {
+		return d.handleFilterKey(key)
+	}
+
+	switch string(key) {
+	case "q", "\x03":
+		return actionQuit
+	case "j", "\x1b[B":
+		d.selected++
+	case "k", "\x1b[A":
+		d.selected--
+	case "/":
+		input := d.filter
+		d.input = &input
+	case "r":
+		return actionRefresh
+	case "c", "\r", "\n":
+		if d.Selected().URL != "" {
+			return actionCheck
+		}
+	case "\x1b":
+		d.filter = ""
+	}
+	d.clampSelection()
+	return actionNone
+}
+
+func (d *Dashboard) handleFilterKey(key []byte) action {
+	switch string(key) {
+	case "\r", "\n":
+		d.filter = *d.input
+		d.input = nil
+		d.selected = 0
+	case "\x1b", "\x03":
+		d.input = nil
+	case "\x7f", "\b":
+		if len(*d.input) > 0 {
+			_, n := utf8.DecodeLastRuneInString(*d.input)
+			*d.input = (*d.input)[:len(*d.input)-n]
+		}
+	default:
+		if key[0] >= ' ' && key[0] != 0x7f {
+			*d.input += string(key)
+		}
+	}
+	return actionNone
+}
+
+func (d *Dashboard) checked(done checkDone) {
+	switch {
+	case done.err != nil:
+		d.message = fmt.Sprintf("Check of %s failed: %v", done.url, done.err)
+	case done.entry.Error != "":
+		d.message = fmt.Sprintf("%s is down: %s", done.url, done.entry.Error)
+	default:
+		d.message = fmt.Sprintf("%s is up: %d in %s", done.url, done.entry.Status, done.entry.Duration.Round(time.Millisecond))
+	}
+}
+
+func (d *Dashboard) clampSelection() {
+	if n := len(d.Visible()); d.selected >= n {
+		d.selected = n - 1
+	}
+	if d.selected < 0 {
+		d.selected = 0
+	}
+}
+
+// Render draws the whole screen for a terminal of the given size.
+func (d *Dashboard) Render(width, height int) string {
+	var b strings.Builder
+	b.WriteString(clearScreen)
+
+	rows := d.Visible()
+	counts := make(map[string]int)
+	for _, row := range rows {
+		counts[row.State]++
+	}
+
+	header := fmt.Sprintf("cron top  %s  %d endpoints: %d up, %d degraded, %d down",
+		d.source.Name(), len(rows), counts[endpoint.StateUp], counts[endpoint.StateDegraded], counts[endpoint.StateDown])
+	if !d.updated.IsZero() {
+		header += "  updated " + d.updated.Format("15:04:05")
+	}
+	if d.filter != "" {
+		header += fmt.Sprintf("  filter %q", d.filter)
+	}
+	writeLine(&b, truncate(header, width))
+
+	urlWidth := 20
+	for _, row := range rows {
+		urlWidth = max(urlWidth, utf8.RuneCountInString(row.URL))
+	}
+	urlWidth = min(urlWidth, max(width/3, 20))
+	const fixed = 12 + 16 + 10 + 9 + 5
+	trendWidth := max(width-urlWidth-fixed, 5)
+
+	writeLine(&b, truncate(fmt.Sprintf("%-12s %-*s %-16s %9s %8s  %s", "STATE", urlWidth, "URL", "DOMAIN", "LATENCY", "UPTIME", "TREND"), width))
+
+	// Leave room for the header, column names, status and help lines.
+	visible := max(height-4, 1)
+	first := 0
+	if d.selected >= visible {
+		first = d.selected - visible + 1
+	}
+	for i := first; i < len(rows) && i < first+visible; i++ {
+		row := rows[i]
+		state := row.State
+		if row.Flapping {
+			state += "~"
+		}
+		line := fmt.Sprintf("%s%-12s%s %-*s %-16s %9s %7.2f%%  %s",
+			stateColors[row.State], state, reset,
+			urlWidth, truncate(row.URL, urlWidth), truncate(row.Domain, 16),
+			row.LastDuration.Round(time.Millisecond), row.UpTime, Sparkline(row.Durations, trendWidth))
+		if i == d.selected {
+			line = reverse + strings.ReplaceAll(line, reset, reset+reverse) + reset
+		}
+		writeLine(&b, line)
+	}
+	for i := len(rows) - first; i < visible; i++ {
+		writeLine(&b, "")
+	}
+
+	switch {
+	case d.err != nil:
+		writeLine(&b, truncate("Error: "+d.err.Error(), width))
+	default:
+		writeLine(&b, truncate(d.message, width))
+	}
+	if d.input != nil {
+		b.WriteString("Filter by domain: " + *d.input)
+	} else {
+		b.WriteString(truncate("j/k move  c check now  / filter  esc clear filter  r refresh  q quit", width))
+	}
+	return b.String()
+}
+
+// Sparkline draws the latest durations as a bar per check, scaled between
+// the fastest and slowest of them.
+func Sparkline(durations []time.Duration, width int) string {
+	if len(durations) > width {
+		durations = durations[len(durations)-width:]
+	}
+	if len(durations) == 0 {
+		return ""
+	}
+
+	lowest, highest := durations[0], durations[0]
+	for _, d := range durations {
+		lowest = min(lowest, d)
+		highest = max(highest, d)
+	}
+
+	var b strings.Builder
+	for _, d := range durations {
+		level := 0
+		if highest > lowest {
+			level = int(float64(d-lowest) / float64(highest-lowest) * float64(len(sparks)-1))
+		}
+		b.WriteRune(sparks[level])
+	}
+	return b.String()
+}
+
+// writeLine ends lines with a carriage return as well, which raw mode no
+// longer adds.
+func writeLine(b *strings.Builder, line string) {
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	if width <= 1 {
+		return ""
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
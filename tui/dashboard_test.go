@@ -0,0 +1,147 @@
+package tui
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"terminally-online/cron/endpoint"
+	"testing"
+	"time"
+)
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		name      string
+		durations []time.Duration
+		width     int
+		want      string
+	}{
+		{"empty", nil, 10, ""},
+		{"constant", []time.Duration{time.Second, time.Second, time.Second}, 10, "▁▁▁"},
+		{"scaled", []time.Duration{0, 350 * time.Millisecond, 700 * time.Millisecond}, 10, "▁▄█"},
+		{"latest only", []time.Duration{700 * time.Millisecond, 0, 700 * time.Millisecond}, 2, "▁█"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sparkline(tt.durations, tt.width); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDashboardKeys(t *testing.T) {
+	d := NewDashboard(nil, "")
+	d.rows = []Row{
+		{URL: "https://a.example.com", Domain: "alpha"},
+		{URL: "https://b.example.com", Domain: "beta"},
+		{URL: "https://c.other.com", Domain: "beta"},
+	}
+
+	steps := []struct {
+		name     string
+		keys     []string
+		action   action
+		selected string
+		visible  int
+	}{
+		{"move down", []string{"j", "\x1b[B"}, actionNone, "https://c.other.com", 3},
+		{"stop at the last row", []string{"j"}, actionNone, "https://c.other.com", 3},
+		{"move up", []string{"k"}, actionNone, "https://b.example.com", 3},
+		{"filter by domain", []string{"/", "b", "e", "t", "x", "\x7f", "\r"}, actionNone, "https://b.example.com", 2},
+		{"check selected", []string{"c"}, actionCheck, "https://b.example.com", 2},
+		{"filter by url", []string{"/", "\x7f", "\x7f", "\x7f", "o", "t", "h", "\r"}, actionNone, "https://c.other.com", 1},
+		{"cancel filter edit", []string{"/", "x", "\x1b"}, actionNone, "https://c.other.com", 1},
+		{"clear filter", []string{"\x1b"}, actionNone, "https://a.example.com", 3},
+		{"refresh", []string{"r"}, actionRefresh, "https://a.example.com", 3},
+		{"quit", []string{"q"}, actionQuit, "https://a.example.com", 3},
+	}
+
+	for _, step := range steps {
+		var got action
+		for _, key := range step.keys {
+			got = d.HandleKey([]byte(key))
+		}
+		if got != step.action {
+			t.Errorf("%s: expected action %d, got %d", step.name, step.action, got)
+		}
+		if d.Selected().URL != step.selected {
+			t.Errorf("%s: expected %s to be selected, got %s", step.name, step.selected, d.Selected().URL)
+		}
+		if len(d.Visible()) != step.visible {
+			t.Errorf("%s: expected %d visible rows, got %d", step.name, step.visible, len(d.Visible()))
+		}
+	}
+}
+
+func TestAPISource(t *testing.T) {
+	handler := endpoint.NewStoreHandler(endpoint.NewMemoryStore(), 10)
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+
+	endpoints := []endpoint.EndpointRequest{
+		{URL: target.URL, Domain: "web", Method: "GET", Timeout: time.Second, Status: http.StatusOK},
+		{URL: "https://api.example.com", Domain: "api", Method: "GET", Timeout: time.Second, Status: http.StatusOK},
+	}
+	if err := handler.RegisterEndpoints(endpoints); err != nil {
+		t.Fatalf("Failed to register endpoints: %v", err)
+	}
+
+	adminToken := endpoint.BACKUP_CONFIG.AdminToken
+	endpoint.BACKUP_CONFIG.AdminToken = "secret"
+	defer func() { endpoint.BACKUP_CONFIG.AdminToken = adminToken }()
+	api := httptest.NewServer(endpoint.NewAPI(handler, endpoint.NewScheduler(handler, time.Minute, endpoints)))
+	defer api.Close()
+
+	if _, err := NewAPISource(api.URL, "").CheckNow(context.Background(), target.URL); err == nil {
+		t.Errorf("Expected checking without the admin token to fail")
+	}
+	source := NewAPISource(api.URL+"/", "secret")
+	ctx := context.Background()
+
+	entry, err := source.CheckNow(ctx, target.URL)
+	if err != nil {
+		t.Fatalf("Failed to check endpoint: %v", err)
+	}
+	if entry.Status != http.StatusOK || entry.Error != "" {
+		t.Errorf("Expected a successful check, got %+v", entry)
+	}
+	if _, err := source.CheckNow(ctx, "https://unknown.example.com"); err == nil {
+		t.Errorf("Expected checking an unknown endpoint to fail")
+	}
+
+	rows, err := source.Rows(ctx)
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	// Endpoints are listed once they have been checked.
+	if len(rows) != 1 || rows[0].URL != target.URL || len(rows[0].Durations) != 1 {
+		t.Fatalf("Expected a row for %s with one check, got %+v", target.URL, rows)
+	}
+
+	var filtered bytes.Buffer
+	if err := PrintTable(ctx, source, "api", &filtered); err != nil {
+		t.Fatalf("Failed to print table: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(filtered.String()), "\n"); len(lines) != 1 {
+		t.Errorf("Expected only the header, got:\n%s", filtered.String())
+	}
+
+	var out bytes.Buffer
+	if err := PrintTable(ctx, source, "web", &out); err != nil {
+		t.Fatalf("Failed to print table: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a header and one row, got:\n%s", out.String())
+	}
+	if !strings.Contains(lines[1], endpoint.StateUp) || !strings.Contains(lines[1], target.URL) {
+		t.Errorf("Expected %s to be up, got %q", target.URL, lines[1])
+	}
+}
@@ -0,0 +1,186 @@
+package tui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"terminally-online/cron/endpoint"
+	"time"
+)
+
+// Row is the dashboard's view of one endpoint.
+type Row struct {
+	URL          string
+	Domain       string
+	State        string
+	Flapping     bool
+	LastCheck    time.Time
+	LastDuration time.Duration
+	UpTime       float64
+	// Durations of the stored checks, oldest first.
+	Durations []time.Duration
+}
+
+// Source is where the dashboard reads endpoints from and sends checks to.
+type Source interface {
+	Name() string
+	Rows(ctx context.Context) ([]Row, error)
+	CheckNow(ctx context.Context, url string) (endpoint.HistoryEntry, error)
+}
+
+// APISource reads from the API of a running instance. Checks need the
+// instance's admin token.
+type APISource struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func NewAPISource(baseURL, token string) *APISource {
+	return &APISource{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *APISource) Name() string {
+	return s.baseURL
+}
+
+func (s *APISource) Rows(ctx context.Context) ([]Row, error) {
+	var status endpoint.StatusResponse
+	if err := s.do(ctx, http.MethodGet, "/status", &status); err != nil {
+		return nil, err
+	}
+	var history endpoint.HistoryListResponse
+	if err := s.do(ctx, http.MethodGet, "/endpoints/history", &history); err != nil {
+		return nil, err
+	}
+
+	durations := make(map[string][]time.Duration)
+	for _, ep := range history.Endpoints {
+		for _, entry := range ep.History {
+			durations[ep.URL] = append(durations[ep.URL], entry.Duration)
+		}
+	}
+	return newRows(status, durations), nil
+}
+
+func (s *APISource) CheckNow(ctx context.Context, target string) (endpoint.HistoryEntry, error) {
+	var entry endpoint.HistoryEntry
+	err := s.do(ctx, http.MethodPost, "/endpoint/check?url="+url.QueryEscape(target), &entry)
+	return entry, err
+}
+
+func (s *APISource) do(ctx context.Context, method, path string, response interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s", method, path, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// DBSource reads a database opened read-only. Checks made from it are not
+// stored.
+type DBSource struct {
+	path      string
+	handler   *endpoint.EndpointHandler
+	checker   *endpoint.EndpointHandler
+	endpoints map[string]endpoint.EndpointRequest
+}
+
+func NewDBSource(path string, handler *endpoint.EndpointHandler, configured []endpoint.EndpointRequest) *DBSource {
+	endpoints := make(map[string]endpoint.EndpointRequest)
+	for _, ep := range configured {
+		endpoints[ep.URL] = ep
+	}
+
+	return &DBSource{
+		path:      path,
+		handler:   handler,
+		checker:   endpoint.NewCheckHandler(),
+		endpoints: endpoints,
+	}
+}
+
+func (s *DBSource) Name() string {
+	return s.path + " (read-only)"
+}
+
+func (s *DBSource) Rows(ctx context.Context) ([]Row, error) {
+	// The database does not record the check interval, so the latest check
+	// of every location counts.
+	status, err := s.handler.GetStatus(time.Now(), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	durations := make(map[string][]time.Duration)
+	for _, ep := range status.Endpoints {
+		history, err := s.handler.GetEndpointHistory(ep.URL)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range history {
+			durations[ep.URL] = append(durations[ep.URL], result.Duration)
+		}
+	}
+	return newRows(status, durations), nil
+}
+
+func (s *DBSource) CheckNow(ctx context.Context, target string) (endpoint.HistoryEntry, error) {
+	request, ok := s.endpoints[target]
+	if !ok {
+		request = endpoint.EndpointRequest{URL: target}
+	}
+
+	result := s.checker.Check(ctx, request)
+	entry := endpoint.HistoryEntry{
+		Status:    result.Status,
+		Timestamp: result.Timestamp,
+		Duration:  result.Duration,
+	}
+	if result.Error != nil {
+		entry.Error = result.Error.Error()
+	}
+	return entry, nil
+}
+
+func newRows(status endpoint.StatusResponse, durations map[string][]time.Duration) []Row {
+	rows := make([]Row, 0, len(status.Endpoints))
+	for _, ep := range status.Endpoints {
+		rows = append(rows, Row{
+			URL:          ep.URL,
+			Domain:       ep.Domain,
+			State:        ep.State,
+			Flapping:     ep.Flapping,
+			LastCheck:    ep.LastCheck,
+			LastDuration: ep.LastDuration,
+			UpTime:       ep.UpTime,
+			Durations:    durations[ep.URL],
+		})
+	}
+	return rows
+}